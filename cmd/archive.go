@@ -0,0 +1,271 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/de-lachende-cavalier/portunus/pkg/config"
+	"github.com/de-lachende-cavalier/portunus/pkg/keys"
+	"github.com/de-lachende-cavalier/portunus/pkg/logger"
+)
+
+// defaultArchiveRetention is how long retired keys are kept when the config does not say
+const defaultArchiveRetention = "90d"
+
+var (
+	archiveRestoreSubset []string
+	archivePurgeAll      bool
+)
+
+func init() {
+	rootCmd.AddCommand(archiveCmd)
+	archiveCmd.AddCommand(archiveListCmd)
+	archiveCmd.AddCommand(archiveRestoreCmd)
+	archiveCmd.AddCommand(archivePurgeCmd)
+
+	archiveRestoreCmd.Flags().StringSliceVarP(&archiveRestoreSubset, "subset", "s", []string{},
+		"specifies the subset of keys you want to restore (if empty, restores all keys in the entry)")
+	archivePurgeCmd.Flags().BoolVar(&archivePurgeAll, "all", false,
+		"purge every archived key, not only those past the retention period")
+}
+
+var archiveCmd = &cobra.Command{
+	Use:   "archive",
+	Short: "Manage archived SSH keys",
+	Long: `Rotated keys are not deleted but moved into an archive (by default ~/.ssh/.portunus-archive/),
+where they are kept for a configurable retention period. Use the subcommands to inspect,
+restore or purge them.`,
+}
+
+var archiveListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List archived SSH keys",
+	Run:   runArchiveListCmd,
+}
+
+var archiveRestoreCmd = &cobra.Command{
+	Use:   "restore <entry>",
+	Short: "Restore archived SSH keys",
+	Long: `Restore the keys of an archive entry to their original location.
+Keys currently at those locations are archived first, so a restore can itself be undone.
+Restored keys are tracked again, with the lifetime of the keys they replace starting now.`,
+	Args:        cobra.ExactArgs(1),
+	Annotations: map[string]string{keepMissingKeysAnnotation: "true"},
+	Run:         runArchiveRestoreCmd,
+}
+
+var archivePurgeCmd = &cobra.Command{
+	Use:   "purge",
+	Short: "Purge archived SSH keys",
+	Long:  `Permanently delete archived keys that are past the retention period.`,
+	Run:   runArchivePurgeCmd,
+}
+
+// newArchive creates the archive of retired keys described by the configuration
+func newArchive() (*keys.Archive, error) {
+	dir := appConfig.Archive.Dir
+	if dir == "" {
+		dir = filepath.Join("~", ".ssh", keys.DefaultArchiveDirName)
+	}
+
+	dir, err := expandPath(dir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid archive directory: %w", err)
+	}
+
+	retention := appConfig.Archive.Retention
+	if retention == "" {
+		retention = defaultArchiveRetention
+	}
+
+	var retentionPeriod time.Duration
+	if retention != "0" {
+		retentionPeriod, err = parseDuration(retention)
+		if err != nil {
+			return nil, fmt.Errorf("invalid archive retention: %w", err)
+		}
+	}
+
+	return keys.NewArchive(dir, retentionPeriod), nil
+}
+
+// runArchiveListCmd lists the archive entries
+func runArchiveListCmd(cmd *cobra.Command, args []string) {
+	archive, err := newArchive()
+	if err != nil {
+		logger.Fatal(err, "Failed to open archive")
+	}
+
+	entries, invalid, err := archive.List()
+	if err != nil {
+		logger.Fatal(err, "Failed to list archive")
+	}
+
+	for _, entry := range invalid {
+		logger.Errorf(entry.Err, "Unreadable archive entry %s", entry.ID)
+		fmt.Printf("\t[-] %s unreadable: %v\n", entry.ID, entry.Err)
+	}
+
+	if len(entries) == 0 {
+		logger.Info("No archived keys found")
+		fmt.Println("[+] No archived keys found")
+		return
+	}
+
+	fmt.Printf("[+] Archived keys in %s:\n", archive.Dir())
+	for _, entry := range entries {
+		purgeInfo := "kept forever"
+		if expiresAt := archive.ExpiresAt(entry); !expiresAt.IsZero() {
+			purgeInfo = "purged after " + expiresAt.Format(time.RFC3339)
+		}
+
+		fmt.Printf("\t[+] %s (archived %s, %s)\n", entry.ID, entry.ArchivedAt.Format(time.RFC3339), purgeInfo)
+		for _, key := range entry.Keys {
+			fmt.Printf("\t\t- %s %s\n", key.OriginalPath, key.Fingerprint)
+		}
+	}
+}
+
+// runArchiveRestoreCmd restores the keys of an archive entry
+func runArchiveRestoreCmd(cmd *cobra.Command, args []string) {
+	archive, err := newArchive()
+	if err != nil {
+		logger.Fatal(err, "Failed to open archive")
+	}
+
+	var paths []string
+	for _, key := range archiveRestoreSubset {
+		path, err := resolveKeyPath(key)
+		if err != nil {
+			logger.Fatal(err, "Failed to resolve key path")
+		}
+		paths = append(paths, path)
+	}
+
+	// The public keys about to be replaced become retired keys
+	entry, err := archive.Get(args[0])
+	if err != nil {
+		logger.Fatal(err, "Failed to restore keys")
+	}
+	replaced := make(map[string]ssh.PublicKey)
+	for _, key := range entry.Keys {
+		if pubKey, err := keys.LoadPublicKey(key.OriginalPath); err == nil {
+			replaced[key.OriginalPath] = pubKey
+		}
+	}
+
+	// Restored keys may have been revoked when they were retired
+	var revoked *keys.KRL
+	if krl, err := newRevocationList(); err != nil {
+		logger.Error(err, "Failed to open revocation list")
+	} else if revoked, err = krl.Load(); err != nil {
+		logger.Error(err, "Failed to read revocation list")
+	}
+
+	restored, err := archive.Restore(args[0], paths)
+	if err != nil {
+		logger.Fatal(err, "Failed to restore keys")
+	}
+
+	var restoredPaths []string
+	for _, key := range restored {
+		logger.Infof("Restored key: %s", key.OriginalPath)
+		fmt.Printf("\t[+] %s restored\n", key.OriginalPath)
+		trackRestoredKey(key, replaced[key.OriginalPath])
+		warnIfRevoked(revoked, key.OriginalPath)
+		restoredPaths = append(restoredPaths, key.OriginalPath)
+	}
+
+	// Certificates and authorized_keys options still describe the replaced keys
+	reissueCertificates(restoredPaths)
+	syncExpiryTimes(restoredPaths)
+
+	if err := appConfig.Save(cfgFile); err != nil {
+		logger.Fatal(err, "Failed to save configuration")
+	}
+	fmt.Println("[+] The keys have been successfully restored")
+}
+
+// trackRestoredKey tracks a restored key in place of the key it replaced, if any.
+// The restored key gets the lifetime of the replaced key from now; without one, it is
+// tracked as expired so it gets renewed.
+func trackRestoredKey(key keys.ArchivedKey, replaced ssh.PublicKey) {
+	path := key.OriginalPath
+	previous, tracked := appConfig.Keys[path]
+
+	now := time.Now()
+	expiresAt := now
+	if tracked && previous.ExpiresAt.After(previous.CreatedAt) {
+		expiresAt = now.Add(previous.ExpiresAt.Sub(previous.CreatedAt))
+	}
+	appConfig.AddKey(path, now, expiresAt)
+	if cipher, bits, err := keys.DetectAlgorithm(path); err == nil {
+		appConfig.SetKeyAlgorithm(path, cipher, bits)
+	}
+	// The passphrase of the restored key is not the one recorded for the replaced key
+	appConfig.SetPassphraseRef(path, "")
+	appConfig.SetPassphraseHash(path, "")
+
+	appConfig.UnretireKey(path, key.Fingerprint)
+	if replaced != nil && ssh.FingerprintSHA256(replaced) != key.Fingerprint {
+		appConfig.RetireKey(path, config.RetiredKeyConfig{
+			PublicKey:   strings.TrimSpace(string(ssh.MarshalAuthorizedKey(replaced))),
+			Fingerprint: ssh.FingerprintSHA256(replaced),
+			RetiredAt:   now,
+		})
+	}
+
+	if expiresAt.Equal(now) {
+		fmt.Printf("\t[-] %s has no known lifetime and is tracked as expired, renew it\n", path)
+	} else {
+		fmt.Printf("\t[+] %s tracked, expiration date: %s\n", path, expiresAt.Format(time.RFC3339))
+	}
+}
+
+// warnIfRevoked warns that servers enforcing the revocation list will reject the key at path
+func warnIfRevoked(list *keys.KRL, path string) {
+	if list == nil {
+		return
+	}
+	pubKey, err := keys.LoadPublicKey(path)
+	if err != nil || !list.IsRevoked(pubKey) {
+		return
+	}
+	logger.Warn("Restored key " + path + " is in the revocation list")
+	fmt.Printf("\t[-] %s is in the revocation list, servers enforcing it will reject the key\n", path)
+}
+
+// runArchivePurgeCmd removes archive entries past their retention period
+func runArchivePurgeCmd(cmd *cobra.Command, args []string) {
+	archive, err := newArchive()
+	if err != nil {
+		logger.Fatal(err, "Failed to open archive")
+	}
+
+	var purged []keys.ArchiveEntry
+	if archivePurgeAll {
+		purged, err = archive.PurgeAll()
+	} else {
+		purged, err = archive.Purge(time.Now())
+	}
+	if err != nil {
+		logger.Fatal(err, "Failed to purge archive")
+	}
+
+	if len(purged) == 0 {
+		logger.Info("No archived keys to purge")
+		fmt.Println("[+] No archived keys to purge")
+		return
+	}
+
+	for _, entry := range purged {
+		logger.Infof("Purged archive entry: %s", entry.ID)
+		fmt.Printf("\t[+] %s purged (%d keys)\n", entry.ID, len(entry.Keys))
+	}
+	fmt.Println("[+] The archive has been successfully purged")
+}
@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/de-lachende-cavalier/portunus/pkg/config"
+	"github.com/de-lachende-cavalier/portunus/pkg/keys"
+	"github.com/de-lachende-cavalier/portunus/pkg/testutil"
+	"github.com/spf13/cobra"
+)
+
+// TestArchiveCmd_RotateListRestore tests that rotated keys can be listed and restored
+func TestArchiveCmd_RotateListRestore(t *testing.T) {
+	// Set up test environment
+	tempDir, configPath := setupTestEnvironment(t)
+	sshDir := filepath.Join(tempDir, ".ssh")
+
+	// Create test key files
+	key, _ := testutil.CreateTestKeyPair(t, sshDir, "id_ed25519")
+	oldFingerprint, err := keys.PublicKeyFingerprint(key)
+	if err != nil {
+		t.Fatalf("Failed to fingerprint key: %v", err)
+	}
+
+	// Initialize the config
+	cfgFile = configPath
+	appConfig = &config.Config{
+		Keys: make(map[string]config.KeyConfig),
+	}
+
+	// Rotate the key
+	rotateCipher = "ed25519"
+	rotateBackend = keys.BackendNative
+	rotateTime = "1h"
+	rotatePassword = "test"
+	rotateKeySubset = []string{key}
+	rootContext = context.Background()
+	mockCmd := &cobra.Command{Use: "test"}
+	runRotateCmd(mockCmd, nil)
+
+	// The old key must be listed in the archive
+	output := captureOutput(func() {
+		runArchiveListCmd(mockCmd, nil)
+	})
+	if !strings.Contains(output, key) || !strings.Contains(output, oldFingerprint) {
+		t.Fatalf("Expected archive listing to mention %s (%s), got: %s", key, oldFingerprint, output)
+	}
+
+	archive, err := newArchive()
+	if err != nil {
+		t.Fatalf("Failed to open archive: %v", err)
+	}
+	entries, _, err := archive.List()
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("Expected 1 archive entry, got %d (%v)", len(entries), err)
+	}
+
+	rotatedFingerprint, err := keys.PublicKeyFingerprint(key)
+	if err != nil {
+		t.Fatalf("Failed to fingerprint rotated key: %v", err)
+	}
+
+	// Restore the old key
+	archiveRestoreSubset = []string{"id_ed25519"}
+	output = captureOutput(func() {
+		runArchiveRestoreCmd(mockCmd, []string{entries[0].ID})
+	})
+
+	// The rotation revoked the old key, which servers would now reject
+	if !strings.Contains(output, key+" is in the revocation list") {
+		t.Errorf("Expected a warning that the restored key is revoked, got output:\n%s", output)
+	}
+
+	fingerprint, err := keys.PublicKeyFingerprint(key)
+	if err != nil {
+		t.Fatalf("Failed to fingerprint restored key: %v", err)
+	}
+	if fingerprint != oldFingerprint {
+		t.Errorf("Expected restored fingerprint %s, got %s", oldFingerprint, fingerprint)
+	}
+
+	// The restored key is tracked with the lifetime of the rotated one, which is retired instead
+	keyConfig := appConfig.Keys[key]
+	if lifetime := keyConfig.ExpiresAt.Sub(keyConfig.CreatedAt); lifetime != time.Hour {
+		t.Errorf("Expected the restored key to be valid for 1h, got %v", lifetime)
+	}
+	if len(keyConfig.Retired) != 1 || keyConfig.Retired[0].Fingerprint != rotatedFingerprint {
+		t.Errorf("Expected only the rotated key %s to be retired, got %+v", rotatedFingerprint, keyConfig.Retired)
+	}
+}
+
+// TestArchiveCmd_Purge tests purging the whole archive
+func TestArchiveCmd_Purge(t *testing.T) {
+	// Set up test environment
+	tempDir, configPath := setupTestEnvironment(t)
+	sshDir := filepath.Join(tempDir, ".ssh")
+
+	cfgFile = configPath
+	appConfig = &config.Config{
+		Keys: make(map[string]config.KeyConfig),
+		Archive: config.ArchiveConfig{
+			Dir:       filepath.Join(tempDir, "archive"),
+			Retention: "0",
+		},
+	}
+
+	archive, err := newArchive()
+	if err != nil {
+		t.Fatalf("Failed to open archive: %v", err)
+	}
+	if archive.Retention() != 0 {
+		t.Errorf("Expected archived keys to be kept forever, got retention %v", archive.Retention())
+	}
+
+	key, _ := testutil.CreateTestKeyPair(t, sshDir, "id_ed25519")
+	if _, err := archive.Store([]string{key}); err != nil {
+		t.Fatalf("Failed to store key: %v", err)
+	}
+
+	mockCmd := &cobra.Command{Use: "test"}
+
+	// Nothing is past its retention period
+	archivePurgeAll = false
+	output := captureOutput(func() {
+		runArchivePurgeCmd(mockCmd, nil)
+	})
+	if !strings.Contains(output, "No archived keys to purge") {
+		t.Errorf("Expected nothing to be purged, got: %s", output)
+	}
+
+	archivePurgeAll = true
+	defer func() { archivePurgeAll = false }()
+	output = captureOutput(func() {
+		runArchivePurgeCmd(mockCmd, nil)
+	})
+	if !strings.Contains(output, "successfully purged") {
+		t.Errorf("Expected archive to be purged, got: %s", output)
+	}
+
+	entries, _, err := archive.List()
+	if err != nil {
+		t.Fatalf("Failed to list archive: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Expected empty archive, got %d entries", len(entries))
+	}
+}
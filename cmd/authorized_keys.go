@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/de-lachende-cavalier/portunus/pkg/keys"
+	"github.com/de-lachende-cavalier/portunus/pkg/logger"
+)
+
+var authorizedKeysKeySubset []string
+
+func init() {
+	rootCmd.AddCommand(authorizedKeysCmd)
+
+	authorizedKeysCmd.Flags().StringSliceVarP(&authorizedKeysKeySubset, "subset", "s", []string{},
+		"specifies the subset of keys you want to act on (if empty, acts on all tracked keys)")
+}
+
+var authorizedKeysCmd = &cobra.Command{
+	Use:   "authorized-keys",
+	Short: "Write expiration dates into local authorized_keys files",
+	Long: `Set the expiry-time option of the lines authorizing tracked keys in the local
+authorized_keys files listed in the config file (authorized_keys.files), so sshd
+refuses the keys once they expire. Other options and comments are kept.
+The options are also updated whenever keys are renewed or rotated.`,
+	Run: runAuthorizedKeysCmd,
+}
+
+// runAuthorizedKeysCmd writes the expiration dates of tracked keys into the authorized_keys files
+func runAuthorizedKeysCmd(cmd *cobra.Command, args []string) {
+	logger.Info("Updating authorized_keys files...")
+	fmt.Println("[+] Updating authorized_keys files...")
+
+	if len(appConfig.AuthorizedKeys.Files) == 0 {
+		logger.Info("No authorized_keys files configured")
+		fmt.Println("[+] No authorized_keys files configured, add them to the config file")
+		return
+	}
+
+	var paths []string
+	if len(authorizedKeysKeySubset) > 0 {
+		for _, key := range authorizedKeysKeySubset {
+			path, err := resolveKeyPath(key)
+			if err != nil {
+				logger.Fatal(err, "Invalid key")
+			}
+			paths = append(paths, path)
+		}
+	} else {
+		for path := range appConfig.Keys {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+	}
+
+	if failed := syncExpiryTimes(paths); failed > 0 {
+		logger.Fatal(fmt.Errorf("%d files not updated", failed), "Failed to update authorized_keys files")
+	}
+
+	logger.Info("authorized_keys files are up to date")
+	fmt.Println("[+] The authorized_keys files are up to date")
+}
+
+// syncExpiryTimes writes the expiration dates of the tracked keys among paths into the
+// configured authorized_keys files. Failures are reported but not fatal; it returns their number.
+func syncExpiryTimes(paths []string) int {
+	files := appConfig.AuthorizedKeys.Files
+	if len(files) == 0 {
+		return 0
+	}
+
+	var tracked []string
+	pubKeys := make(map[string]ssh.PublicKey)
+	for _, path := range paths {
+		keyConfig, exists := appConfig.Keys[path]
+		if !exists || keyConfig.ExpiresAt.IsZero() {
+			continue
+		}
+		pubKey, err := keys.LoadPublicKey(path)
+		if err != nil {
+			logger.Errorf(err, "Not setting the expiry-time of %s", path)
+			continue
+		}
+		tracked = append(tracked, path)
+		pubKeys[path] = pubKey
+	}
+
+	failed := 0
+	for _, file := range files {
+		file, err := expandPath(file)
+		if err != nil {
+			logger.Error(err, "Invalid authorized_keys path")
+			failed++
+			continue
+		}
+
+		changed := make(map[string]int)
+		err = keys.UpdateAuthorizedKeysFile(file, func(data []byte) ([]byte, bool) {
+			total := 0
+			for _, path := range tracked {
+				data, changed[path] = keys.SetExpiryTime(data, pubKeys[path], appConfig.Keys[path].ExpiresAt)
+				total += changed[path]
+			}
+			return data, total > 0
+		})
+		if err != nil {
+			logger.Errorf(err, "Failed to update %s", file)
+			fmt.Printf("\t[-] %s not updated: %v\n", file, err)
+			failed++
+			continue
+		}
+
+		for _, path := range tracked {
+			if changed[path] == 0 {
+				continue
+			}
+			expiresAt := appConfig.Keys[path].ExpiresAt.Format(time.RFC3339)
+			logger.Infof("Set expiry-time of %s to %s in %s", path, expiresAt, file)
+			fmt.Printf("\t[+] %s expires %s in %s\n", path, expiresAt, file)
+		}
+	}
+	return failed
+}
@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/de-lachende-cavalier/portunus/pkg/config"
+	"github.com/de-lachende-cavalier/portunus/pkg/keys"
+)
+
+// writeTestAuthorizedKeys writes an authorized_keys file authorizing the key at path with options
+func writeTestAuthorizedKeys(t *testing.T, file, path string) string {
+	t.Helper()
+	pubKey, err := keys.LoadPublicKey(path)
+	if err != nil {
+		t.Fatalf("Failed to load public key: %v", err)
+	}
+	keyLine := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pubKey)))
+	if err := os.WriteFile(file, []byte("# local logins\nrestrict,pty "+keyLine+" alice@laptop\n"), 0600); err != nil {
+		t.Fatalf("Failed to write authorized keys: %v", err)
+	}
+	return keyLine
+}
+
+// TestAuthorizedKeysCmd tests writing the expiration dates of tracked keys into authorized_keys files
+func TestAuthorizedKeysCmd(t *testing.T) {
+	// Set up test environment
+	tempDir, configPath := setupTestEnvironment(t)
+	sshDir := filepath.Join(tempDir, ".ssh")
+
+	key := filepath.Join(sshDir, "id_ed25519")
+	generateCmdTestKey(t, key)
+	authorizedKeys := filepath.Join(sshDir, "authorized_keys")
+	keyLine := writeTestAuthorizedKeys(t, authorizedKeys, key)
+
+	// Initialize the config with the authorized_keys file
+	expiresAt := time.Date(2031, 2, 3, 4, 5, 0, 0, time.Local)
+	cfgFile = configPath
+	appConfig = &config.Config{
+		Keys: map[string]config.KeyConfig{
+			key: {CreatedAt: time.Now(), ExpiresAt: expiresAt},
+		},
+		AuthorizedKeys: config.AuthorizedKeysConfig{Files: []string{"~/.ssh/authorized_keys"}},
+	}
+	rootContext = context.Background()
+	authorizedKeysKeySubset = nil
+
+	output := captureOutput(func() {
+		runAuthorizedKeysCmd(&cobra.Command{Use: "test"}, nil)
+	})
+	if !strings.Contains(output, key+" expires "+expiresAt.Format(time.RFC3339)+" in "+authorizedKeys) {
+		t.Errorf("Expected the key to be reported, got output:\n%s", output)
+	}
+
+	want := "# local logins\nrestrict,pty,expiry-time=\"203102030405\" " + keyLine + " alice@laptop\n"
+	if data := mustReadFile(t, authorizedKeys); data != want {
+		t.Errorf("Unexpected authorized keys:\n%s\nwant:\n%s", data, want)
+	}
+
+	// Up to date files are left alone
+	output = captureOutput(func() {
+		runAuthorizedKeysCmd(&cobra.Command{Use: "test"}, nil)
+	})
+	if strings.Contains(output, " expires ") {
+		t.Errorf("Expected nothing to update, got output:\n%s", output)
+	}
+}
+
+// TestRenewCmd_AuthorizedKeys tests that renewing a key moves its expiry-time
+func TestRenewCmd_AuthorizedKeys(t *testing.T) {
+	// Set up test environment
+	tempDir, configPath := setupTestEnvironment(t)
+	sshDir := filepath.Join(tempDir, ".ssh")
+
+	key := filepath.Join(sshDir, "id_ed25519")
+	generateCmdTestKey(t, key)
+	authorizedKeys := filepath.Join(sshDir, "authorized_keys")
+	keyLine := writeTestAuthorizedKeys(t, authorizedKeys, key)
+
+	now := time.Now()
+	cfgFile = configPath
+	appConfig = &config.Config{
+		Keys: map[string]config.KeyConfig{
+			key: {CreatedAt: now.Add(-48 * time.Hour), ExpiresAt: now.Add(-time.Hour)},
+		},
+		AuthorizedKeys: config.AuthorizedKeysConfig{Files: []string{authorizedKeys}},
+	}
+	rootContext = context.Background()
+	renewTime = "30d"
+	renewKeySubset = []string{}
+	renewNoAgent = true
+	defer func() { renewNoAgent = false }()
+
+	runRenewCmd(&cobra.Command{Use: "test"}, nil)
+
+	expiry := appConfig.Keys[key].ExpiresAt.Format("200601021504")
+	want := "# local logins\nrestrict,pty,expiry-time=\"" + expiry + "\" " + keyLine + " alice@laptop\n"
+	if data := mustReadFile(t, authorizedKeys); data != want {
+		t.Errorf("Unexpected authorized keys:\n%s\nwant:\n%s", data, want)
+	}
+}
@@ -0,0 +1,310 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/de-lachende-cavalier/portunus/pkg/keys"
+	"github.com/de-lachende-cavalier/portunus/pkg/logger"
+)
+
+var (
+	caPasswordStdin bool
+	caSignSubset    []string
+	caSignPrincipal []string
+	caSignForce     bool
+)
+
+func init() {
+	rootCmd.AddCommand(caCmd)
+	caCmd.AddCommand(caInitCmd)
+	caCmd.AddCommand(caSignCmd)
+	caCmd.AddCommand(caPubkeyCmd)
+
+	caInitCmd.Flags().BoolVar(&caPasswordStdin, "password-stdin", false,
+		"reads the passphrase of the CA key from the first line of stdin")
+	caSignCmd.Flags().StringSliceVarP(&caSignSubset, "subset", "s", []string{},
+		"specifies the subset of keys you want to certify (if empty, acts on all tracked keys)")
+	caSignCmd.Flags().StringSliceVar(&caSignPrincipal, "principals", []string{},
+		"specifies the user names the certificates are valid for (if empty, keeps those of each key)")
+	caSignCmd.Flags().BoolVar(&caSignForce, "force", false,
+		"replaces the certificates imported from other CAs of the keys in the subset")
+}
+
+var caCmd = &cobra.Command{
+	Use:   "ca",
+	Short: "Manage the local SSH user certificate authority",
+	Long: `Portunus can hold a local user certificate authority (by default in ~/.ssh/.portunus-ca/)
+and sign tracked keys with certificates valid from their creation until their expiration date.
+Servers trusting the CA (TrustedUserCAKeys) then refuse expired keys, instead of the expiration
+being advisory. Certificates are reissued whenever a certified key is renewed or rotated.`,
+}
+
+var caInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Create the local certificate authority",
+	Run:   runCAInitCmd,
+}
+
+var caSignCmd = &cobra.Command{
+	Use:   "sign",
+	Short: "Certify SSH keys with the local certificate authority",
+	Long: `Sign the public key of tracked keys with the local CA. The certificate is written next
+to the key as <key>-cert.pub, where ssh picks it up, and is valid until the key expires.
+Keys whose certificate was imported from another CA are skipped, unless they are named in
+the subset together with --force.`,
+	Run: runCASignCmd,
+}
+
+var caPubkeyCmd = &cobra.Command{
+	Use:   "pubkey",
+	Short: "Print the public key of the local certificate authority",
+	Run:   runCAPubkeyCmd,
+}
+
+// caDir returns the directory of the local CA described by the configuration
+func caDir() (string, error) {
+	dir := appConfig.CA.Dir
+	if dir == "" {
+		dir = filepath.Join("~", ".ssh", keys.DefaultCADirName)
+	}
+
+	dir, err := expandPath(dir)
+	if err != nil {
+		return "", fmt.Errorf("invalid CA directory: %w", err)
+	}
+	return dir, nil
+}
+
+// openCA loads the local CA, reading the passphrase of its key from its source,
+// or prompting for it on a terminal when the key is encrypted
+func openCA() (*keys.CA, error) {
+	dir, err := caDir()
+	if err != nil {
+		return nil, err
+	}
+
+	var passphrase string
+	if source := appConfig.CA.PassphraseSource; source != nil {
+		if passphrase, err = passphraseSource(source).Resolve(rootContext); err != nil {
+			return nil, fmt.Errorf("failed to read CA passphrase: %w", err)
+		}
+	}
+
+	ca, err := keys.LoadCA(dir, passphrase)
+	if errors.Is(err, keys.ErrIncorrectPassphrase) && appConfig.CA.PassphraseSource == nil && stdinIsTerminal() {
+		if passphrase, err = promptHidden("Enter passphrase for the portunus CA: "); err != nil {
+			return nil, err
+		}
+		ca, err = keys.LoadCA(dir, passphrase)
+	}
+	return ca, err
+}
+
+// certificatePrincipals returns the user names the certificate of a key is valid for,
+// principals when given
+func certificatePrincipals(path string, principals []string) ([]string, error) {
+	if len(principals) > 0 {
+		return principals, nil
+	}
+	if principals := appConfig.Keys[path].Principals; len(principals) > 0 {
+		return principals, nil
+	}
+	if len(appConfig.CA.Principals) > 0 {
+		return appConfig.CA.Principals, nil
+	}
+
+	current, err := user.Current()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current user: %w", err)
+	}
+	return []string{current.Username}, nil
+}
+
+// issueCertificate signs a tracked key with a certificate valid for its recorded lifetime.
+// Without principals, those recorded for the key or the CA are used.
+func issueCertificate(ca *keys.CA, path string, principals []string) (*ssh.Certificate, error) {
+	keyConfig := appConfig.Keys[path]
+
+	principals, err := certificatePrincipals(path, principals)
+	if err != nil {
+		return nil, err
+	}
+
+	return ca.Sign(path, keys.CertificateSpec{
+		KeyID:       "portunus:" + path,
+		Principals:  principals,
+		ValidAfter:  keyConfig.CreatedAt,
+		ValidBefore: keyConfig.ExpiresAt,
+	})
+}
+
+// reissueCertificates reissues the certificates of the certified keys among paths,
+// so they follow the keys' new lifetimes. Failures are reported but not fatal.
+func reissueCertificates(paths []string) {
+	var certified []string
+	for _, path := range paths {
+		if appConfig.Keys[path].Certified {
+			certified = append(certified, path)
+		}
+	}
+	if len(certified) == 0 {
+		return
+	}
+
+	ca, err := openCA()
+	if err != nil {
+		logger.Error(err, "Failed to open certificate authority, certificates not reissued")
+		fmt.Printf("\t[-] Certificates not reissued: %v\n", err)
+		return
+	}
+
+	for _, path := range certified {
+		cert, err := issueCertificate(ca, path, nil)
+		if err != nil {
+			logger.Errorf(err, "Failed to reissue certificate of %s", path)
+			fmt.Printf("\t[-] %s certificate not reissued: %v\n", path, err)
+			continue
+		}
+
+		validBefore := time.Unix(int64(cert.ValidBefore), 0)
+		logger.Infof("Reissued certificate of %s (valid until %s)", path, validBefore.Format(time.RFC3339))
+		fmt.Printf("\t[+] %s certificate reissued, valid until %s\n", path, validBefore.Format(time.RFC3339))
+	}
+}
+
+// runCAInitCmd creates the local CA
+func runCAInitCmd(cmd *cobra.Command, args []string) {
+	logger.Info("Creating certificate authority...")
+	fmt.Println("[+] Creating certificate authority...")
+
+	dir, err := caDir()
+	if err != nil {
+		logger.Fatal(err, "Failed to create certificate authority")
+	}
+
+	var passphrase string
+	if source := appConfig.CA.PassphraseSource; source != nil {
+		passphrase, err = passphraseSource(source).Resolve(rootContext)
+	} else {
+		passphrase, err = readPassphrase(caPasswordStdin, "")
+	}
+	if err != nil {
+		logger.Fatal(err, "Failed to read CA passphrase")
+	}
+
+	ca, err := keys.InitCA(dir, passphrase)
+	if err != nil {
+		logger.Fatal(err, "Failed to create certificate authority")
+	}
+
+	logger.Infof("Created certificate authority in %s", ca.Dir())
+	fmt.Printf("[+] Certificate authority created in %s\n", ca.Dir())
+	fmt.Println("[+] To trust it, add its public key to TrustedUserCAKeys in sshd_config on your servers,")
+	fmt.Println("    or prefix it with cert-authority in their authorized_keys:")
+	fmt.Printf("\t%s", ssh.MarshalAuthorizedKey(ca.PublicKey()))
+}
+
+// runCASignCmd certifies tracked keys with the local CA
+func runCASignCmd(cmd *cobra.Command, args []string) {
+	logger.Info("Signing keys...")
+	fmt.Println("[+] Signing keys...")
+
+	var keysToSign []string
+	if len(caSignSubset) > 0 {
+		for _, key := range caSignSubset {
+			path, err := resolveKeyPath(key)
+			if err != nil {
+				logger.Fatal(err, "Failed to resolve key path")
+			}
+			keyConfig, exists := appConfig.Keys[path]
+			if !exists {
+				logger.Fatal(fmt.Errorf("key %s is not tracked", path), "Failed to sign keys")
+			}
+			if keyConfig.Certificate != nil && !caSignForce {
+				logger.Fatal(fmt.Errorf("key %s holds a certificate imported from another CA (pass --force to replace it)", path),
+					"Failed to sign keys")
+			}
+			keysToSign = append(keysToSign, path)
+		}
+	} else {
+		for path, keyConfig := range appConfig.Keys {
+			// Certificates imported from other CAs are only replaced on request
+			if keyConfig.Certificate != nil {
+				logger.Infof("Not signing %s, it holds a certificate imported from another CA", path)
+				fmt.Printf("\t[-] %s holds a certificate imported from another CA, name it with --force to replace it\n", path)
+				continue
+			}
+			keysToSign = append(keysToSign, path)
+		}
+		sort.Strings(keysToSign)
+	}
+
+	if len(keysToSign) == 0 {
+		logger.Info("No keys found to sign")
+		fmt.Println("[+] No keys found to sign")
+		return
+	}
+
+	ca, err := openCA()
+	if err != nil {
+		logger.Fatal(err, "Failed to open certificate authority")
+	}
+
+	now := time.Now()
+	signedCount := 0
+	for _, path := range keysToSign {
+		if now.After(appConfig.Keys[path].ExpiresAt) {
+			logger.Infof("Not signing expired key: %s", path)
+			fmt.Printf("\t[-] %s has expired, renew or rotate it first\n", path)
+			continue
+		}
+
+		cert, err := issueCertificate(ca, path, caSignPrincipal)
+		if err != nil {
+			logger.Errorf(err, "Failed to sign %s", path)
+			fmt.Printf("\t[-] %s not signed: %v\n", path, err)
+			continue
+		}
+		// Keys are only marked certified once they hold a certificate
+		appConfig.SetCertified(path, caSignPrincipal)
+		signedCount++
+
+		validBefore := time.Unix(int64(cert.ValidBefore), 0)
+		logger.Infof("Signed key: %s (principals: %s, valid until %s)", path,
+			strings.Join(cert.ValidPrincipals, ","), validBefore.Format(time.RFC3339))
+		fmt.Printf("\t[+] %s signed for %s, valid until %s\n", path,
+			strings.Join(cert.ValidPrincipals, ","), validBefore.Format(time.RFC3339))
+	}
+
+	// Save configuration
+	if err := appConfig.Save(cfgFile); err != nil {
+		logger.Fatal(err, "Failed to save configuration")
+	}
+
+	logger.Infof("Signed %d keys", signedCount)
+	fmt.Printf("[+] %d keys have been signed\n", signedCount)
+}
+
+// runCAPubkeyCmd prints the public key of the local CA
+func runCAPubkeyCmd(cmd *cobra.Command, args []string) {
+	dir, err := caDir()
+	if err != nil {
+		logger.Fatal(err, "Failed to open certificate authority")
+	}
+
+	pubKey, err := keys.ReadCAPublicKey(dir)
+	if err != nil {
+		logger.Fatal(err, "Failed to read CA public key")
+	}
+
+	fmt.Print(string(ssh.MarshalAuthorizedKey(pubKey)))
+}
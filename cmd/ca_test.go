@@ -0,0 +1,288 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/de-lachende-cavalier/portunus/pkg/config"
+	"github.com/de-lachende-cavalier/portunus/pkg/keys"
+)
+
+// initTestCA creates an encrypted CA in the test home, reading its passphrase from the config
+func initTestCA(t *testing.T) {
+	t.Helper()
+	t.Setenv("PORTUNUS_TEST_CA_PASSPHRASE", "ca-secret")
+	appConfig.CA.PassphraseSource = &config.PassphraseSource{Env: "PORTUNUS_TEST_CA_PASSPHRASE"}
+
+	captureOutput(func() {
+		runCAInitCmd(&cobra.Command{Use: "test"}, nil)
+	})
+}
+
+// generateCmdTestKey creates a native key pair for command tests
+func generateCmdTestKey(t *testing.T, path string) {
+	t.Helper()
+	generator, err := keys.NewGenerator(keys.BackendNative)
+	if err != nil {
+		t.Fatalf("Failed to create generator: %v", err)
+	}
+	if err := generator.Generate(context.Background(), path, keys.KeySpec{Cipher: "ed25519"}); err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+}
+
+// TestCACmd tests creating the CA and certifying tracked keys
+func TestCACmd(t *testing.T) {
+	// Set up test environment
+	tempDir, configPath := setupTestEnvironment(t)
+	sshDir := filepath.Join(tempDir, ".ssh")
+
+	valid := filepath.Join(sshDir, "id_valid")
+	expired := filepath.Join(sshDir, "id_expired")
+	broken := filepath.Join(sshDir, "id_broken")
+	generateCmdTestKey(t, valid)
+	generateCmdTestKey(t, expired)
+	generateCmdTestKey(t, broken)
+	if err := os.WriteFile(broken+".pub", []byte("not a key\n"), 0644); err != nil {
+		t.Fatalf("Failed to corrupt public key: %v", err)
+	}
+
+	// Initialize the config
+	now := time.Now().Truncate(time.Second)
+	cfgFile = configPath
+	appConfig = &config.Config{
+		Keys: map[string]config.KeyConfig{
+			valid:   {CreatedAt: now.Add(-time.Hour), ExpiresAt: now.Add(24 * time.Hour)},
+			expired: {CreatedAt: now.Add(-48 * time.Hour), ExpiresAt: now.Add(-24 * time.Hour)},
+			broken:  {CreatedAt: now.Add(-time.Hour), ExpiresAt: now.Add(24 * time.Hour)},
+		},
+	}
+	rootContext = context.Background()
+
+	// Create the CA with a passphrase read from stdin
+	stubPassphraseInput(t, "ca-secret\n", false)
+	caPasswordStdin = true
+	t.Cleanup(func() { caPasswordStdin = false })
+	output := captureOutput(func() {
+		runCAInitCmd(&cobra.Command{Use: "test"}, nil)
+	})
+	if !strings.Contains(output, "TrustedUserCAKeys") {
+		t.Errorf("Expected instructions to trust the CA, got output:\n%s", output)
+	}
+
+	caPubKey, err := keys.ReadCAPublicKey(filepath.Join(sshDir, keys.DefaultCADirName))
+	if err != nil {
+		t.Fatalf("Failed to read CA public key: %v", err)
+	}
+	output = captureOutput(func() {
+		runCAPubkeyCmd(&cobra.Command{Use: "test"}, nil)
+	})
+	if output != string(ssh.MarshalAuthorizedKey(caPubKey)) {
+		t.Errorf("Expected CA public key, got output:\n%s", output)
+	}
+
+	// Sign every tracked key, with the CA passphrase read from the config
+	t.Setenv("PORTUNUS_TEST_CA_PASSPHRASE", "ca-secret")
+	appConfig.CA.PassphraseSource = &config.PassphraseSource{Env: "PORTUNUS_TEST_CA_PASSPHRASE"}
+	caSignSubset = []string{}
+	caSignPrincipal = []string{"alice", "deploy"}
+	t.Cleanup(func() { caSignPrincipal = []string{} })
+	output = captureOutput(func() {
+		runCASignCmd(&cobra.Command{Use: "test"}, nil)
+	})
+	if !strings.Contains(output, expired+" has expired") {
+		t.Errorf("Expected the expired key not to be signed, got output:\n%s", output)
+	}
+
+	cert, err := keys.ReadCertificate(valid)
+	if err != nil {
+		t.Fatalf("Failed to read certificate: %v", err)
+	}
+	if cert.ValidAfter != uint64(now.Add(-time.Hour).Unix()) || cert.ValidBefore != uint64(now.Add(24*time.Hour).Unix()) {
+		t.Errorf("Expected certificate valid for the key's lifetime, got %d to %d", cert.ValidAfter, cert.ValidBefore)
+	}
+	if strings.Join(cert.ValidPrincipals, ",") != "alice,deploy" {
+		t.Errorf("Expected principals alice,deploy, got %v", cert.ValidPrincipals)
+	}
+	if ssh.FingerprintSHA256(cert.SignatureKey) != ssh.FingerprintSHA256(caPubKey) {
+		t.Error("Expected certificate to be signed by the CA")
+	}
+	if _, err := keys.ReadCertificate(expired); err == nil {
+		t.Error("Expected no certificate for the expired key")
+	}
+
+	// The certified keys are recorded in the config
+	loadedConfig, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if keyConfig := loadedConfig.Keys[valid]; !keyConfig.Certified || len(keyConfig.Principals) != 2 {
+		t.Errorf("Expected %s to be certified for its principals, got %+v", valid, keyConfig)
+	}
+	if loadedConfig.Keys[expired].Certified {
+		t.Errorf("Expected %s not to be certified", expired)
+	}
+
+	// A key that could not be signed is neither certified nor given the principals
+	if !strings.Contains(output, broken+" not signed") {
+		t.Errorf("Expected the broken key not to be signed, got output:\n%s", output)
+	}
+	if keyConfig := loadedConfig.Keys[broken]; keyConfig.Certified || len(keyConfig.Principals) != 0 {
+		t.Errorf("Expected %s not to be certified, got %+v", broken, keyConfig)
+	}
+}
+
+// TestCACmd_Reissue tests that renewing and rotating certified keys reissues their certificates
+func TestCACmd_Reissue(t *testing.T) {
+	// Set up test environment
+	tempDir, configPath := setupTestEnvironment(t)
+	sshDir := filepath.Join(tempDir, ".ssh")
+
+	key := filepath.Join(sshDir, "id_ed25519")
+	generateCmdTestKey(t, key)
+
+	// Initialize the config with an expired certified key
+	now := time.Now()
+	cfgFile = configPath
+	appConfig = &config.Config{
+		Keys: map[string]config.KeyConfig{
+			key: {CreatedAt: now.Add(-2 * time.Hour), ExpiresAt: now.Add(-time.Hour), Certified: true, Principals: []string{"alice"}},
+		},
+	}
+	rootContext = context.Background()
+	initTestCA(t)
+
+	// Renewing the key issues a certificate valid until its new expiration date
+	renewTime = "2h"
+	renewKeySubset = []string{}
+	output := captureOutput(func() {
+		runRenewCmd(&cobra.Command{Use: "test"}, nil)
+	})
+	if !strings.Contains(output, key+" certificate reissued") {
+		t.Errorf("Expected the certificate to be reissued, got output:\n%s", output)
+	}
+
+	cert, err := keys.ReadCertificate(key)
+	if err != nil {
+		t.Fatalf("Failed to read certificate: %v", err)
+	}
+	if cert.ValidBefore != uint64(appConfig.Keys[key].ExpiresAt.Unix()) {
+		t.Errorf("Expected certificate valid until %v, got %d", appConfig.Keys[key].ExpiresAt, cert.ValidBefore)
+	}
+
+	// Rotating the key certifies the new public key
+	rotateCipher = "ed25519"
+	rotateBackend = keys.BackendNative
+	rotateTime = "1h"
+	rotatePassword = "test"
+	rotateKeySubset = []string{key}
+	captureOutput(func() {
+		runRotateCmd(&cobra.Command{Use: "test"}, nil)
+	})
+
+	cert, err = keys.ReadCertificate(key)
+	if err != nil {
+		t.Fatalf("Failed to read certificate: %v", err)
+	}
+	fingerprint, err := keys.PublicKeyFingerprint(key)
+	if err != nil {
+		t.Fatalf("Failed to fingerprint key: %v", err)
+	}
+	if ssh.FingerprintSHA256(cert.Key) != fingerprint {
+		t.Error("Expected the certificate to be reissued for the rotated key")
+	}
+	if cert.ValidAfter != uint64(appConfig.Keys[key].CreatedAt.Unix()) {
+		t.Errorf("Expected certificate valid from %v, got %d", appConfig.Keys[key].CreatedAt, cert.ValidAfter)
+	}
+}
+
+// TestCACmd_ImportedCertificate tests that certificates imported from other CAs are only replaced with --force
+func TestCACmd_ImportedCertificate(t *testing.T) {
+	// Set up test environment with a key certified by a company CA
+	tempDir, configPath := setupTestEnvironment(t)
+	sshDir := filepath.Join(tempDir, ".ssh")
+	key := filepath.Join(sshDir, "id_corp")
+	generateCmdTestKey(t, key)
+
+	companyCA, err := keys.InitCA(filepath.Join(tempDir, "company-ca"), "")
+	if err != nil {
+		t.Fatalf("Failed to create CA: %v", err)
+	}
+	now := time.Now().Truncate(time.Second)
+	if _, err := companyCA.Sign(key, keys.CertificateSpec{
+		KeyID:       "alice@corp",
+		Principals:  []string{"alice"},
+		ValidAfter:  now.Add(-time.Hour),
+		ValidBefore: now.Add(8 * time.Hour),
+	}); err != nil {
+		t.Fatalf("Failed to sign key: %v", err)
+	}
+
+	cfgFile = configPath
+	appConfig = &config.Config{
+		Keys: make(map[string]config.KeyConfig),
+	}
+	rootContext = context.Background()
+	importKeySubset = []string{key}
+	t.Cleanup(func() { importKeySubset = []string{} })
+	captureOutput(func() {
+		runImportCmd(&cobra.Command{Use: "test"}, nil)
+	})
+	if appConfig.Keys[key].Certificate == nil {
+		t.Fatalf("Expected the certificate of %s to be imported", key)
+	}
+	imported := mustReadFile(t, keys.CertificatePath(key))
+	initTestCA(t)
+
+	// Signing every tracked key leaves the imported certificate alone
+	caSignSubset = []string{}
+	output := captureOutput(func() {
+		runCASignCmd(&cobra.Command{Use: "test"}, nil)
+	})
+	if !strings.Contains(output, key+" holds a certificate imported from another CA") {
+		t.Errorf("Expected the key to be skipped, got output:\n%s", output)
+	}
+	if got := mustReadFile(t, keys.CertificatePath(key)); got != imported {
+		t.Errorf("Expected the imported certificate to be kept, got:\n%s", got)
+	}
+	if appConfig.Keys[key].Certified {
+		t.Errorf("Expected %s not to be certified", key)
+	}
+
+	// Naming the key is refused without --force
+	if err := appConfig.Save(configPath); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+	output, ok := runCLI(t, tempDir, "ca", "sign", "-s", key)
+	if ok || !strings.Contains(output, "pass --force to replace it") {
+		t.Errorf("Expected signing the key to be refused, got output:\n%s", output)
+	}
+	if got := mustReadFile(t, keys.CertificatePath(key)); got != imported {
+		t.Errorf("Expected the imported certificate to be kept, got:\n%s", got)
+	}
+
+	// With --force, the local CA takes over the key
+	caSignSubset = []string{key}
+	caSignForce = true
+	t.Cleanup(func() { caSignSubset = []string{}; caSignForce = false })
+	captureOutput(func() {
+		runCASignCmd(&cobra.Command{Use: "test"}, nil)
+	})
+	cert, err := keys.ReadCertificate(key)
+	if err != nil {
+		t.Fatalf("Failed to read certificate: %v", err)
+	}
+	if ssh.FingerprintSHA256(cert.SignatureKey) == ssh.FingerprintSHA256(companyCA.PublicKey()) {
+		t.Error("Expected the certificate to be replaced by the local CA")
+	}
+	if keyConfig := appConfig.Keys[key]; !keyConfig.Certified || keyConfig.Certificate != nil {
+		t.Errorf("Expected %s to be certified by the local CA, got %+v", key, keyConfig)
+	}
+}
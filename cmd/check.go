@@ -1,29 +1,48 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
+	"sort"
 	"time"
 
 	"github.com/spf13/cobra"
 
+	"github.com/de-lachende-cavalier/portunus/pkg/keys"
 	"github.com/de-lachende-cavalier/portunus/pkg/logger"
 )
 
+var checkEnforce bool
+
 func init() {
 	rootCmd.AddCommand(checkCmd)
+
+	checkCmd.Flags().BoolVar(&checkEnforce, "enforce", false,
+		"removes the expired keys from the running ssh-agent (see the enforce command)")
 }
 
 var checkCmd = &cobra.Command{
 	Use:   "check",
 	Short: "Check for expired SSH keys",
-	Long:  `Check if any SSH keys have expired and need to be rotated or renewed.`,
-	Run:   runCheckCmd,
+	Long: `Check if any SSH keys have expired and need to be rotated or renewed.
+Keys whose certificate (<key>-cert.pub) expires before the key are flagged too.
+Expired keys are shown with the hosts of the SSH client config that use them.
+With --enforce, expired keys are also removed from the running ssh-agent.`,
+	Run: runCheckCmd,
 }
 
 // runCheckCmd checks for expired SSH keys
 func runCheckCmd(cmd *cobra.Command, args []string) {
 	logger.Info("Checking for expired keys...")
 
+	// Certificates expiring first stop keys from working before they expire
+	if checkCertificates() > 0 {
+		fmt.Println("\n[+] To track these keys with the dates of their certificates, run:")
+		fmt.Println("\tportunus import")
+		fmt.Println()
+	}
+
 	// Get expired keys from config
 	expiredKeys := appConfig.GetExpiredKeys()
 
@@ -37,6 +56,9 @@ func runCheckCmd(cmd *cobra.Command, args []string) {
 	logger.Info("The following keys have expired:")
 	fmt.Println("[+] The following keys have expired:")
 
+	// Show what stops working with each expired key
+	usage := keyUsage(expiredKeys)
+
 	for _, key := range expiredKeys {
 		keyConfig, exists := appConfig.Keys[key]
 		if !exists {
@@ -46,11 +68,64 @@ func runCheckCmd(cmd *cobra.Command, args []string) {
 		expiredFor := time.Since(keyConfig.ExpiresAt).Round(time.Second)
 		logger.Infof("- %s (expired %s ago)", key, expiredFor)
 		fmt.Printf("\t[+] %s (expired %s ago)\n", key, expiredFor)
+		if u := usage[key]; len(u) > 0 {
+			fmt.Printf("\t\t[-] used for %s\n", formatUsage(u))
+		}
+	}
+
+	// Stop expired keys from working through the agent
+	if checkEnforce {
+		if agent := connectAgent(); agent != nil {
+			defer agent.Close()
+			if removed := enforceExpiredKeys(agent); removed > 0 {
+				fmt.Printf("[+] Removed %d expired keys from ssh-agent\n", removed)
+			}
+		}
 	}
 
 	// Provide instructions
 	fmt.Println("\n[+] To rotate expired keys, run:")
-	fmt.Println("\tportunus rotate -t <duration> -p <password>")
+	fmt.Println("\tportunus rotate -t <duration>")
 	fmt.Println("\n[+] To renew expired keys, run:")
 	fmt.Println("\tportunus renew -t <duration>")
 }
+
+// checkCertificates reports tracked keys whose certificate expires before the key's
+// recorded expiration, since the certificate stops working first
+func checkCertificates() int {
+	paths := make([]string, 0, len(appConfig.Keys))
+	for path := range appConfig.Keys {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	flagged := 0
+	for _, path := range paths {
+		cert, err := keys.ReadCertificateInfo(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			logger.Debugf("Cannot read certificate of %s: %v", path, err)
+			continue
+		}
+
+		// Certificates only have second precision
+		expiresAt := appConfig.Keys[path].ExpiresAt.Truncate(time.Second)
+		if cert.ValidBefore.IsZero() || !cert.ValidBefore.Before(expiresAt) {
+			continue
+		}
+
+		if flagged == 0 {
+			logger.Info("The following certificates expire before their keys:")
+			fmt.Println("[-] The following certificates expire before their keys:")
+		}
+		flagged++
+
+		logger.Infof("- %s (certificate expires %s, key expires %s)", path,
+			cert.ValidBefore.Format(time.RFC3339), expiresAt.Format(time.RFC3339))
+		fmt.Printf("\t[-] %s certificate expires %s, %s before the key\n", path,
+			cert.ValidBefore.Format(time.RFC3339), expiresAt.Sub(cert.ValidBefore).Round(time.Second))
+	}
+	return flagged
+}
@@ -194,3 +194,27 @@ func TestCheckCmd_SomeExpired(t *testing.T) {
 		t.Errorf("Expected output to not mention non-expired key %s, got: %s", key2, output)
 	}
 }
+
+func TestCheckCmd_Usage(t *testing.T) {
+	// Set up test environment with an SSH config using the key
+	tempDir, configPath := setupTestEnvironment(t)
+	sshDir := filepath.Join(tempDir, ".ssh")
+	writeTestSSHConfig(t, sshDir)
+
+	key := filepath.Join(sshDir, "id_work")
+	now := time.Now()
+	cfgFile = configPath
+	appConfig = &config.Config{
+		Keys: map[string]config.KeyConfig{
+			key: {CreatedAt: now.Add(-48 * time.Hour), ExpiresAt: now.Add(-time.Hour)},
+		},
+	}
+	checkEnforce = false
+
+	output := captureOutput(func() {
+		runCheckCmd(&cobra.Command{Use: "test"}, nil)
+	})
+	if !strings.Contains(output, "\t\t[-] used for github.com, bastion\n") {
+		t.Errorf("Expected the hosts using the expired key, got output:\n%s", output)
+	}
+}
@@ -2,14 +2,22 @@ package cmd
 
 import (
 	"context"
+	"errors"
+	"net"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
+	"syscall"
 	"testing"
 	"time"
 
 	"github.com/de-lachende-cavalier/portunus/pkg/config"
+	"github.com/de-lachende-cavalier/portunus/pkg/keys"
 	"github.com/de-lachende-cavalier/portunus/pkg/testutil"
 	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
 )
 
 // setupTestEnvironment sets up a test environment for the commands
@@ -33,9 +41,90 @@ func setupTestEnvironment(t *testing.T) (string, string) {
 	})
 	os.Setenv("HOME", tempDir)
 
+	// Keep tests away from the developer's ssh-agent
+	t.Setenv("SSH_AUTH_SOCK", "")
+
 	return tempDir, configPath
 }
 
+// cliArgsEnv holds the arguments TestCLIProcess runs portunus with, one per line
+const cliArgsEnv = "PORTUNUS_TEST_CLI_ARGS"
+
+// runCLI runs portunus with args in a child process, with home as the home directory, and
+// returns its output and whether it succeeded. Commands failing through logger.Fatal exit
+// the process, so they cannot run inside the test binary itself.
+func runCLI(t *testing.T, home string, args ...string) (string, bool) {
+	t.Helper()
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestCLIProcess$")
+	cmd.Env = append(os.Environ(), "HOME="+home, "SSH_AUTH_SOCK=", cliArgsEnv+"="+strings.Join(args, "\n"))
+	output, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		t.Fatalf("Failed to run portunus: %v", err)
+	}
+	return string(output), err == nil
+}
+
+// TestCLIProcess runs portunus in the child processes of runCLI
+func TestCLIProcess(t *testing.T) {
+	args, ok := os.LookupEnv(cliArgsEnv)
+	if !ok {
+		t.Skip("only runs in the child processes of runCLI")
+	}
+	rootCmd.SetArgs(strings.Split(args, "\n"))
+	Execute()
+	os.Exit(0)
+}
+
+// startTestAgent serves an in-process ssh-agent on SSH_AUTH_SOCK for the duration of a test
+func startTestAgent(t *testing.T) agent.Agent {
+	t.Helper()
+
+	// Unix socket paths are short, so avoid the long test temp dir
+	dir, err := os.MkdirTemp("", "agent")
+	if err != nil {
+		t.Fatalf("Failed to create socket directory: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	socket := filepath.Join(dir, "agent.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("Failed to listen on %s: %v", socket, err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	keyring := agent.NewKeyring()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go agent.ServeAgent(keyring, conn)
+		}
+	}()
+
+	t.Setenv("SSH_AUTH_SOCK", socket)
+	return keyring
+}
+
+// agentFingerprints returns the fingerprints of the keys loaded in an agent
+func agentFingerprints(t *testing.T, a agent.Agent) map[string]bool {
+	t.Helper()
+	loaded, err := a.List()
+	if err != nil {
+		t.Fatalf("Failed to list agent keys: %v", err)
+	}
+
+	fingerprints := make(map[string]bool)
+	for _, key := range loaded {
+		fingerprints[ssh.FingerprintSHA256(key)] = true
+	}
+	return fingerprints
+}
+
 // TestRotateCommand tests the rotate command
 func TestRotateCommand(t *testing.T) {
 	// Skip this test if ssh-keygen is not available
@@ -59,6 +148,7 @@ func TestRotateCommand(t *testing.T) {
 
 	// Set up command flags
 	rotateCipher = "ed25519"
+	rotateBackend = keys.BackendSSHKeygen
 	rotateTime = "24h"
 	rotatePassword = "test"
 	rotateKeySubset = []string{key1, key2}
@@ -213,3 +303,28 @@ func TestCheckCommand(t *testing.T) {
 	// Note: We can't easily test the output, but at least ensure it doesn't crash
 	runCheckCmd(mockCmd, nil)
 }
+
+// TestRootContext_Signal tests that SIGTERM cancels the context commands run with
+func TestRootContext_Signal(t *testing.T) {
+	_, configPath := setupTestEnvironment(t)
+	cfgFile = configPath
+
+	rootCmd.PersistentPreRun(rootCmd, nil)
+	ctx := rootContext
+	t.Cleanup(func() { rootContext = context.Background() })
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatalf("Failed to send SIGTERM: %v", err)
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected SIGTERM to cancel the root context")
+	}
+
+	// The signal handlers are released once the command ran
+	rootCmd.PersistentPostRun(rootCmd, nil)
+	if !errors.Is(ctx.Err(), context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", ctx.Err())
+	}
+}
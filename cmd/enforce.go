@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/de-lachende-cavalier/portunus/pkg/keys"
+	"github.com/de-lachende-cavalier/portunus/pkg/logger"
+)
+
+func init() {
+	rootCmd.AddCommand(enforceCmd)
+}
+
+var enforceCmd = &cobra.Command{
+	Use:   "enforce",
+	Short: "Remove expired SSH keys from ssh-agent",
+	Long: `Remove every expired tracked key from the running ssh-agent (SSH_AUTH_SOCK),
+so expired keys stop working until they are rotated or renewed.
+Loaded keys are matched by their public key, whatever their comment.`,
+	Run: runEnforceCmd,
+}
+
+// runEnforceCmd removes expired keys from the running ssh-agent
+func runEnforceCmd(cmd *cobra.Command, args []string) {
+	logger.Info("Removing expired keys from ssh-agent...")
+	fmt.Println("[+] Removing expired keys from ssh-agent...")
+
+	agent, err := keys.ConnectAgent()
+	if errors.Is(err, keys.ErrNoAgent) {
+		logger.Info("No ssh-agent running")
+		fmt.Println("[+] No ssh-agent running, nothing to remove")
+		return
+	}
+	if err != nil {
+		logger.Fatal(err, "Failed to connect to ssh-agent")
+	}
+	defer agent.Close()
+
+	removed := enforceExpiredKeys(agent)
+	if removed == 0 {
+		logger.Info("No expired keys loaded in ssh-agent")
+		fmt.Println("[+] No expired keys loaded in ssh-agent")
+		return
+	}
+
+	logger.Infof("Removed %d expired keys from ssh-agent", removed)
+	fmt.Printf("[+] Removed %d expired keys from ssh-agent\n", removed)
+}
+
+// enforceExpiredKeys removes every expired tracked key from the agent and returns how many were loaded
+func enforceExpiredKeys(agent *keys.Agent) int {
+	expiredKeys := appConfig.GetExpiredKeys()
+	sort.Strings(expiredKeys)
+
+	removed := 0
+	for _, key := range expiredKeys {
+		pubKey, err := keys.LoadPublicKey(key)
+		if err != nil {
+			logger.Errorf(err, "Failed to read public key of %s", key)
+			fmt.Printf("\t[-] %s not checked: %v\n", key, err)
+			continue
+		}
+
+		loaded, err := agent.RemovePublicKey(pubKey)
+		if err != nil {
+			logger.Errorf(err, "Failed to remove %s from ssh-agent", key)
+			fmt.Printf("\t[-] %s not removed from ssh-agent: %v\n", key, err)
+			continue
+		}
+		if !loaded {
+			continue
+		}
+
+		removed++
+		fingerprint := ssh.FingerprintSHA256(pubKey)
+		logger.Infof("Removed expired key from ssh-agent: %s (%s)", key, fingerprint)
+		fmt.Printf("\t[+] %s (%s) removed from ssh-agent\n", key, fingerprint)
+	}
+
+	return removed
+}
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/de-lachende-cavalier/portunus/pkg/config"
+	"github.com/de-lachende-cavalier/portunus/pkg/keys"
+)
+
+// TestEnforceCmd tests that only expired tracked keys are removed from the ssh-agent
+func TestEnforceCmd(t *testing.T) {
+	// Set up test environment with a running agent
+	tempDir, configPath := setupTestEnvironment(t)
+	sshDir := filepath.Join(tempDir, ".ssh")
+	keyring := startTestAgent(t)
+
+	// Create an expired and a valid key, both loaded in the agent
+	generator, err := keys.NewGenerator(keys.BackendNative)
+	if err != nil {
+		t.Fatalf("Failed to create generator: %v", err)
+	}
+	expired := filepath.Join(sshDir, "id_expired")
+	valid := filepath.Join(sshDir, "id_valid")
+	fingerprints := make(map[string]string)
+	for _, key := range []string{expired, valid} {
+		if err := generator.Generate(context.Background(), key, keys.KeySpec{Cipher: "ed25519"}); err != nil {
+			t.Fatalf("Failed to generate key pair: %v", err)
+		}
+		if err := keys.NewAgent(keyring).Add(key, "", time.Time{}); err != nil {
+			t.Fatalf("Failed to load key in agent: %v", err)
+		}
+		if fingerprints[key], err = keys.PublicKeyFingerprint(key); err != nil {
+			t.Fatalf("Failed to fingerprint key: %v", err)
+		}
+	}
+
+	// Initialize the config
+	now := time.Now()
+	cfgFile = configPath
+	appConfig = &config.Config{
+		Keys: map[string]config.KeyConfig{
+			expired: {CreatedAt: now.Add(-48 * time.Hour), ExpiresAt: now.Add(-24 * time.Hour)},
+			valid:   {CreatedAt: now.Add(-48 * time.Hour), ExpiresAt: now.Add(24 * time.Hour)},
+		},
+	}
+
+	// Initialize the context
+	rootContext = context.Background()
+
+	// Run the enforce command
+	output := captureOutput(func() {
+		runEnforceCmd(&cobra.Command{Use: "test"}, nil)
+	})
+
+	if !strings.Contains(output, expired) || !strings.Contains(output, fingerprints[expired]) {
+		t.Errorf("Expected the removed key to be reported, got output:\n%s", output)
+	}
+	if strings.Contains(output, valid) {
+		t.Errorf("Expected the valid key not to be reported, got output:\n%s", output)
+	}
+
+	loaded := agentFingerprints(t, keyring)
+	if loaded[fingerprints[expired]] {
+		t.Error("Expected the expired key to be removed from the agent")
+	}
+	if !loaded[fingerprints[valid]] {
+		t.Error("Expected the valid key to stay loaded in the agent")
+	}
+}
@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/de-lachende-cavalier/portunus/pkg/config"
+	"github.com/de-lachende-cavalier/portunus/pkg/keys"
+	"github.com/de-lachende-cavalier/portunus/pkg/logger"
+)
+
+var importKeySubset []string
+
+func init() {
+	rootCmd.AddCommand(importCmd)
+
+	importCmd.Flags().StringSliceVarP(&importKeySubset, "subset", "s", []string{},
+		"specifies the subset of keys you want to import (if empty, acts on all discovered keys)")
+}
+
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Track SSH keys using the dates of their certificates",
+	Long: `Track keys that come with an SSH certificate (<key>-cert.pub), e.g. issued by a company CA.
+Each key is tracked from the start to the end of its certificate's validity window, and the
+certificate's key ID, principals and signing CA are recorded. Already tracked keys take the
+dates of their certificate. Certificates that never expire are not imported.`,
+	Run: runImportCmd,
+}
+
+// runImportCmd tracks keys using the validity window of their certificates
+func runImportCmd(cmd *cobra.Command, args []string) {
+	logger.Info("Importing certificates...")
+	fmt.Println("[+] Importing certificates...")
+
+	var keyPaths []string
+	if len(importKeySubset) > 0 {
+		for _, key := range importKeySubset {
+			path, err := resolveKeyPath(key)
+			if err != nil {
+				logger.Fatal(err, "Failed to resolve key path")
+			}
+			keyPaths = append(keyPaths, path)
+		}
+	} else {
+		roots, err := keyRoots()
+		if err != nil {
+			logger.Fatal(err, "Failed to read key directories")
+		}
+
+		keyManager, err := keys.NewManager(keys.WithRoots(roots...))
+		if err != nil {
+			logger.Fatal(err, "Failed to create key manager")
+		}
+
+		discovery, err := keyManager.DiscoverKeys(rootContext)
+		if err != nil {
+			logger.Fatal(err, "Failed to get SSH keys")
+		}
+
+		// Only keys with a certificate are of interest when scanning
+		for _, key := range discovery.Keys {
+			if fileExists(keys.CertificatePath(key.Path)) {
+				keyPaths = append(keyPaths, key.Path)
+			}
+		}
+		sort.Strings(keyPaths)
+	}
+
+	if len(keyPaths) == 0 {
+		logger.Info("No certificates found to import")
+		fmt.Println("[+] No certificates found to import")
+		return
+	}
+
+	importedCount := 0
+	for _, path := range keyPaths {
+		cert, err := keys.ReadCertificateInfo(path)
+		if err != nil {
+			logger.Errorf(err, "Failed to read certificate of %s", path)
+			fmt.Printf("\t[-] %s not imported: %v\n", path, err)
+			continue
+		}
+		if cert.ValidBefore.IsZero() {
+			logger.Infof("Not importing certificate of %s: it never expires", path)
+			fmt.Printf("\t[-] %s not imported: its certificate never expires\n", path)
+			continue
+		}
+
+		// A certificate valid from the beginning of time is tracked from now on
+		validAfter := cert.ValidAfter
+		if validAfter.IsZero() {
+			validAfter = time.Now()
+		}
+
+		appConfig.ImportCertificate(path, config.CertificateConfig{
+			KeyID:       cert.KeyID,
+			Principals:  cert.Principals,
+			Serial:      cert.Serial,
+			Authority:   cert.Authority,
+			ValidAfter:  validAfter,
+			ValidBefore: cert.ValidBefore,
+		})
+		importedCount++
+
+		logger.Infof("Imported certificate of %s (key ID: %s, principals: %s, expires: %s)", path,
+			cert.KeyID, strings.Join(cert.Principals, ","), cert.ValidBefore.Format(time.RFC3339))
+		fmt.Printf("\t[+] %s tracked from its certificate %q, expiration date: %s\n", path,
+			cert.KeyID, cert.ValidBefore.Format(time.RFC3339))
+	}
+
+	// Save configuration
+	if err := appConfig.Save(cfgFile); err != nil {
+		logger.Fatal(err, "Failed to save configuration")
+	}
+
+	logger.Infof("Imported %d certificates", importedCount)
+	fmt.Printf("[+] %d certificates have been imported\n", importedCount)
+}
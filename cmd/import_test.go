@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/de-lachende-cavalier/portunus/pkg/config"
+	"github.com/de-lachende-cavalier/portunus/pkg/keys"
+)
+
+// TestImportCmd tests tracking keys with the dates of their certificates
+// and flagging certificates that expire before their keys
+func TestImportCmd(t *testing.T) {
+	// Set up test environment
+	tempDir, configPath := setupTestEnvironment(t)
+	sshDir := filepath.Join(tempDir, ".ssh")
+
+	// A key certified by a company CA, and one without certificate
+	certified := filepath.Join(sshDir, "id_corp")
+	plain := filepath.Join(sshDir, "id_plain")
+	generateCmdTestKey(t, certified)
+	generateCmdTestKey(t, plain)
+
+	companyCA, err := keys.InitCA(filepath.Join(tempDir, "company-ca"), "")
+	if err != nil {
+		t.Fatalf("Failed to create CA: %v", err)
+	}
+	now := time.Now().Truncate(time.Second)
+	validAfter, validBefore := now.Add(-time.Hour), now.Add(8*time.Hour)
+	if _, err := companyCA.Sign(certified, keys.CertificateSpec{
+		KeyID:       "alice@corp",
+		Principals:  []string{"alice"},
+		ValidAfter:  validAfter,
+		ValidBefore: validBefore,
+	}); err != nil {
+		t.Fatalf("Failed to sign key: %v", err)
+	}
+
+	// Initialize the config
+	cfgFile = configPath
+	appConfig = &config.Config{
+		Keys: make(map[string]config.KeyConfig),
+	}
+	rootContext = context.Background()
+
+	// Import every discovered certificate
+	importKeySubset = []string{}
+	output := captureOutput(func() {
+		runImportCmd(&cobra.Command{Use: "test"}, nil)
+	})
+	if !strings.Contains(output, certified+" tracked from its certificate") {
+		t.Errorf("Expected %s to be imported, got output:\n%s", certified, output)
+	}
+
+	loadedConfig, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	keyConfig, ok := loadedConfig.Keys[certified]
+	if !ok {
+		t.Fatalf("Expected %s to be tracked", certified)
+	}
+	if !keyConfig.CreatedAt.Equal(validAfter) || !keyConfig.ExpiresAt.Equal(validBefore) {
+		t.Errorf("Expected the certificate's dates %v to %v, got %v to %v", validAfter, validBefore, keyConfig.CreatedAt, keyConfig.ExpiresAt)
+	}
+	if keyConfig.Certificate == nil || keyConfig.Certificate.KeyID != "alice@corp" || keyConfig.Certificate.Principals[0] != "alice" {
+		t.Errorf("Expected the certificate to be recorded, got %+v", keyConfig.Certificate)
+	}
+	if _, ok := loadedConfig.Keys[plain]; ok {
+		t.Errorf("Expected %s without certificate not to be tracked", plain)
+	}
+
+	// The certificate matches the recorded expiration, so check has nothing to flag
+	output = captureOutput(func() {
+		runCheckCmd(&cobra.Command{Use: "test"}, nil)
+	})
+	if strings.Contains(output, "expire before their keys") {
+		t.Errorf("Expected no certificate to be flagged, got output:\n%s", output)
+	}
+
+	// Once the key is renewed past its certificate, check flags it
+	keyConfig = appConfig.Keys[certified]
+	keyConfig.ExpiresAt = validBefore.Add(24 * time.Hour)
+	appConfig.Keys[certified] = keyConfig
+	output = captureOutput(func() {
+		runCheckCmd(&cobra.Command{Use: "test"}, nil)
+	})
+	if !strings.Contains(output, certified+" certificate expires") || !strings.Contains(output, "24h0m0s before the key") {
+		t.Errorf("Expected the certificate to be flagged, got output:\n%s", output)
+	}
+}
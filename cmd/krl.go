@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/de-lachende-cavalier/portunus/pkg/keys"
+	"github.com/de-lachende-cavalier/portunus/pkg/logger"
+)
+
+var krlExportOutput string
+
+func init() {
+	rootCmd.AddCommand(krlCmd)
+	krlCmd.AddCommand(krlAddCmd)
+	krlCmd.AddCommand(krlListCmd)
+	krlCmd.AddCommand(krlExportCmd)
+
+	krlExportCmd.Flags().StringVarP(&krlExportOutput, "output", "o", "",
+		"specifies the file to write the revocation list to (if empty, writes to stdout)")
+}
+
+var krlCmd = &cobra.Command{
+	Use:   "krl",
+	Short: "Manage the revocation list of retired SSH keys",
+	Long: `Every key retired by rotate is added to an OpenSSH key revocation list (KRL), by default
+~/.ssh/portunus.krl. Deploy it on your servers with the RevokedKeys option of sshd_config
+so retired keys, which may be compromised, are refused everywhere.`,
+}
+
+var krlAddCmd = &cobra.Command{
+	Use:   "add <key>...",
+	Short: "Revoke SSH keys",
+	Long: `Add public keys to the revocation list. Each argument is a private key, whose public key
+is read from <key>.pub or the key itself, or a public key file ending in .pub.`,
+	Args: cobra.MinimumNArgs(1),
+	Run:  runKRLAddCmd,
+}
+
+var krlListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List revoked SSH keys",
+	Run:   runKRLListCmd,
+}
+
+var krlExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the revocation list for deployment",
+	Run:   runKRLExportCmd,
+}
+
+// newRevocationList opens the revocation list of retired keys described by the configuration
+func newRevocationList() (*keys.RevocationList, error) {
+	path := appConfig.KRL.Path
+	if path == "" {
+		path = filepath.Join("~", ".ssh", keys.DefaultKRLName)
+	}
+
+	path, err := expandPath(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid revocation list path: %w", err)
+	}
+	return keys.NewRevocationList(path), nil
+}
+
+// loadRevokedKey reads the public key to revoke from a private or public key file
+func loadRevokedKey(arg string) (ssh.PublicKey, error) {
+	path, err := resolveKeyPath(arg)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasSuffix(path, ".pub") {
+		return keys.LoadPublicKey(path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key %s: %w", path, err)
+	}
+	pubKey, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key %s: %w", path, err)
+	}
+	return pubKey, nil
+}
+
+// runKRLAddCmd adds keys to the revocation list
+func runKRLAddCmd(cmd *cobra.Command, args []string) {
+	krl, err := newRevocationList()
+	if err != nil {
+		logger.Fatal(err, "Failed to open revocation list")
+	}
+
+	var pubKeys []ssh.PublicKey
+	for _, arg := range args {
+		pubKey, err := loadRevokedKey(arg)
+		if err != nil {
+			logger.Fatal(err, "Failed to read key to revoke")
+		}
+		pubKeys = append(pubKeys, pubKey)
+	}
+
+	added, err := krl.Revoke(pubKeys...)
+	if err != nil {
+		logger.Fatal(err, "Failed to revoke keys")
+	}
+
+	for _, pubKey := range added {
+		fingerprint := ssh.FingerprintSHA256(pubKey)
+		logger.Infof("Revoked key: %s", fingerprint)
+		fmt.Printf("\t[+] %s revoked\n", fingerprint)
+	}
+	if skipped := len(pubKeys) - len(added); skipped > 0 {
+		fmt.Printf("\t[+] %d keys were already revoked\n", skipped)
+	}
+	fmt.Printf("[+] The revocation list %s has been updated\n", krl.Path())
+}
+
+// runKRLListCmd lists the revoked keys
+func runKRLListCmd(cmd *cobra.Command, args []string) {
+	krl, err := newRevocationList()
+	if err != nil {
+		logger.Fatal(err, "Failed to open revocation list")
+	}
+
+	list, err := krl.Load()
+	if err != nil {
+		logger.Fatal(err, "Failed to read revocation list")
+	}
+
+	if len(list.Keys) == 0 {
+		logger.Info("No revoked keys found")
+		fmt.Println("[+] No revoked keys found")
+		return
+	}
+
+	fmt.Printf("[+] Revoked keys in %s (version %d, generated %s):\n",
+		krl.Path(), list.Version, list.GeneratedAt.Format(time.RFC3339))
+	for _, pubKey := range list.Keys {
+		fmt.Printf("\t[+] %s %s\n", pubKey.Type(), ssh.FingerprintSHA256(pubKey))
+	}
+}
+
+// runKRLExportCmd writes the binary revocation list to a file or stdout
+func runKRLExportCmd(cmd *cobra.Command, args []string) {
+	krl, err := newRevocationList()
+	if err != nil {
+		logger.Fatal(err, "Failed to open revocation list")
+	}
+
+	list, err := krl.Load()
+	if err != nil {
+		logger.Fatal(err, "Failed to read revocation list")
+	}
+
+	data := list.Marshal()
+	if list.Signed() {
+		// Re-encoding a signed list would invalidate its signatures
+		if data, err = os.ReadFile(krl.Path()); err != nil {
+			logger.Fatal(err, "Failed to read revocation list")
+		}
+	}
+
+	if krlExportOutput == "" {
+		if _, err := os.Stdout.Write(data); err != nil {
+			logger.Fatal(err, "Failed to export revocation list")
+		}
+		return
+	}
+
+	output, err := expandPath(krlExportOutput)
+	if err != nil {
+		logger.Fatal(err, "Invalid output path")
+	}
+	if err := os.WriteFile(output, data, 0644); err != nil {
+		logger.Fatal(err, "Failed to export revocation list")
+	}
+
+	logger.Infof("Exported revocation list to %s", output)
+	fmt.Printf("[+] Revocation list with %d keys exported to %s\n", len(list.Keys), output)
+}
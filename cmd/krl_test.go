@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/de-lachende-cavalier/portunus/pkg/config"
+	"github.com/de-lachende-cavalier/portunus/pkg/keys"
+)
+
+// TestKRLCmd tests revoking keys manually, listing and exporting the revocation list
+func TestKRLCmd(t *testing.T) {
+	// Set up test environment
+	tempDir, configPath := setupTestEnvironment(t)
+	sshDir := filepath.Join(tempDir, ".ssh")
+
+	key := filepath.Join(sshDir, "id_ed25519")
+	other := filepath.Join(sshDir, "id_other")
+	generateCmdTestKey(t, key)
+	generateCmdTestKey(t, other)
+
+	// Initialize the config
+	cfgFile = configPath
+	appConfig = &config.Config{
+		Keys: make(map[string]config.KeyConfig),
+	}
+	rootContext = context.Background()
+
+	output := captureOutput(func() {
+		runKRLListCmd(&cobra.Command{Use: "test"}, nil)
+	})
+	if !strings.Contains(output, "No revoked keys found") {
+		t.Errorf("Expected an empty revocation list, got output:\n%s", output)
+	}
+
+	// Revoke a private key by name and a public key file, twice
+	args := []string{"id_ed25519", other + ".pub"}
+	captureOutput(func() {
+		runKRLAddCmd(&cobra.Command{Use: "test"}, args)
+	})
+	output = captureOutput(func() {
+		runKRLAddCmd(&cobra.Command{Use: "test"}, args)
+	})
+	if !strings.Contains(output, "2 keys were already revoked") {
+		t.Errorf("Expected the keys to be revoked only once, got output:\n%s", output)
+	}
+
+	output = captureOutput(func() {
+		runKRLListCmd(&cobra.Command{Use: "test"}, nil)
+	})
+	for _, path := range []string{key, other} {
+		fingerprint, err := keys.PublicKeyFingerprint(path)
+		if err != nil {
+			t.Fatalf("Failed to fingerprint key: %v", err)
+		}
+		if !strings.Contains(output, "ssh-ed25519 "+fingerprint) {
+			t.Errorf("Expected %s to be listed, got output:\n%s", fingerprint, output)
+		}
+	}
+
+	// Export the list for deployment
+	exported := filepath.Join(tempDir, "revoked_keys")
+	krlExportOutput = exported
+	t.Cleanup(func() { krlExportOutput = "" })
+	captureOutput(func() {
+		runKRLExportCmd(&cobra.Command{Use: "test"}, nil)
+	})
+
+	data, err := os.ReadFile(exported)
+	if err != nil {
+		t.Fatalf("Failed to read exported revocation list: %v", err)
+	}
+	list, err := keys.ParseKRL(data)
+	if err != nil {
+		t.Fatalf("Failed to parse exported revocation list: %v", err)
+	}
+	if len(list.Keys) != 2 {
+		t.Errorf("Expected 2 revoked keys, got %d", len(list.Keys))
+	}
+}
+
+// TestRotateCmd_Revoke tests that rotated keys are added to the revocation list
+func TestRotateCmd_Revoke(t *testing.T) {
+	// Set up test environment
+	tempDir, configPath := setupTestEnvironment(t)
+	sshDir := filepath.Join(tempDir, ".ssh")
+
+	key := filepath.Join(sshDir, "id_ed25519")
+	generateCmdTestKey(t, key)
+	oldKey, err := keys.LoadPublicKey(key)
+	if err != nil {
+		t.Fatalf("Failed to load public key: %v", err)
+	}
+
+	// Initialize the config with a custom revocation list location
+	krlPath := filepath.Join(tempDir, "revoked.krl")
+	cfgFile = configPath
+	appConfig = &config.Config{
+		Keys: make(map[string]config.KeyConfig),
+		KRL:  config.KRLConfig{Path: krlPath},
+	}
+	rootContext = context.Background()
+
+	// Set up command flags
+	rotateCipher = "ed25519"
+	rotateBackend = keys.BackendNative
+	rotateTime = "1h"
+	rotatePassword = "test"
+	rotateKeySubset = []string{key}
+
+	output := captureOutput(func() {
+		runRotateCmd(&cobra.Command{Use: "test"}, nil)
+	})
+	if !strings.Contains(output, "("+ssh.FingerprintSHA256(oldKey)+") added to the revocation list") {
+		t.Errorf("Expected the retired key to be revoked, got output:\n%s", output)
+	}
+
+	list, err := keys.NewRevocationList(krlPath).Load()
+	if err != nil {
+		t.Fatalf("Failed to load revocation list: %v", err)
+	}
+	if len(list.Keys) != 1 || !list.IsRevoked(oldKey) {
+		t.Errorf("Expected the retired key to be revoked, got %d keys", len(list.Keys))
+	}
+}
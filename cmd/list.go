@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/de-lachende-cavalier/portunus/pkg/keys"
+	"github.com/de-lachende-cavalier/portunus/pkg/logger"
+)
+
+var listSoon string
+
+func init() {
+	rootCmd.AddCommand(listCmd)
+
+	listCmd.Flags().StringVar(&listSoon, "soon", "7d",
+		"keys expiring within this duration are reported as expiring soon (format: <int><specifier>)")
+}
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List tracked SSH keys",
+	Long: `List every SSH key tracked by portunus with its type, size, fingerprint, comment,
+creation and expiration dates, time remaining, the hosts of the SSH client config
+using it and status.`,
+	Annotations: map[string]string{keepMissingKeysAnnotation: "true"},
+	Run:         runListCmd,
+}
+
+// runListCmd lists the tracked SSH keys
+func runListCmd(cmd *cobra.Command, args []string) {
+	soon, err := parseDuration(listSoon)
+	if err != nil {
+		logger.Fatal(err, "Failed to parse time duration")
+	}
+
+	if len(appConfig.Keys) == 0 {
+		logger.Info("No tracked keys found")
+		fmt.Println("[+] No tracked keys found")
+		return
+	}
+
+	paths := make([]string, 0, len(appConfig.Keys))
+	for path := range appConfig.Keys {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	// Show which hosts of the SSH client config use each key
+	usage := keyUsage(paths)
+
+	now := time.Now()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tTYPE\tBITS\tFINGERPRINT\tCOMMENT\tCREATED\tEXPIRES\tREMAINING\tHOSTS\tSTATUS")
+
+	for _, path := range paths {
+		keyConfig := appConfig.Keys[path]
+		status := appConfig.KeyStatus(path, now, soon)
+
+		keyType, bits, fingerprint, comment := "-", "-", "-", "-"
+		if info, err := keys.ReadKeyInfo(path); err == nil {
+			keyType, fingerprint = info.Type, info.Fingerprint
+			if info.Bits > 0 {
+				bits = strconv.Itoa(info.Bits)
+			}
+			if info.Comment != "" {
+				comment = info.Comment
+			}
+		} else {
+			logger.Debugf("Cannot read public key of %s: %v", path, err)
+		}
+
+		hosts := "-"
+		if u := usage[path]; len(u) > 0 {
+			hosts = formatUsage(u)
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			path, keyType, bits, fingerprint, comment,
+			keyConfig.CreatedAt.Format(time.DateOnly),
+			keyConfig.ExpiresAt.Format(time.DateOnly),
+			formatRemaining(keyConfig.ExpiresAt.Sub(now)),
+			hosts,
+			status)
+	}
+
+	if err := w.Flush(); err != nil {
+		logger.Error(err, "Failed to write key list")
+	}
+}
+
+// formatRemaining formats the time left before expiration in days, hours and minutes
+func formatRemaining(d time.Duration) string {
+	sign := ""
+	if d < 0 {
+		sign = "-"
+		d = -d
+	}
+
+	days := d / (24 * time.Hour)
+	hours := (d % (24 * time.Hour)) / time.Hour
+	minutes := (d % time.Hour) / time.Minute
+
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%s%dd %dh", sign, days, hours)
+	case hours > 0:
+		return fmt.Sprintf("%s%dh %dm", sign, hours, minutes)
+	default:
+		return fmt.Sprintf("%s%dm", sign, minutes)
+	}
+}
@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/de-lachende-cavalier/portunus/pkg/config"
+	"github.com/de-lachende-cavalier/portunus/pkg/testutil"
+	"github.com/spf13/cobra"
+)
+
+// TestListCmd tests that the list command reports metadata and status of every tracked key
+func TestListCmd(t *testing.T) {
+	// Set up test environment
+	tempDir, configPath := setupTestEnvironment(t)
+	sshDir := filepath.Join(tempDir, ".ssh")
+
+	// Create test key files
+	valid, _ := testutil.CreateTestKeyPair(t, sshDir, "id_valid")
+	soon, _ := testutil.CreateTestKeyPair(t, sshDir, "id_soon")
+	expired, _ := testutil.CreateTestKeyPair(t, sshDir, "id_expired")
+	missing := filepath.Join(sshDir, "id_missing")
+
+	// Initialize the config
+	now := time.Now()
+	cfgFile = configPath
+	appConfig = &config.Config{
+		Keys: map[string]config.KeyConfig{
+			valid:   {CreatedAt: now.Add(-24 * time.Hour), ExpiresAt: now.Add(30 * 24 * time.Hour)},
+			soon:    {CreatedAt: now.Add(-24 * time.Hour), ExpiresAt: now.Add(48 * time.Hour)},
+			expired: {CreatedAt: now.Add(-48 * time.Hour), ExpiresAt: now.Add(-24 * time.Hour)},
+			missing: {CreatedAt: now.Add(-48 * time.Hour), ExpiresAt: now.Add(24 * time.Hour)},
+		},
+	}
+
+	listSoon = "7d"
+	rootContext = context.Background()
+	mockCmd := &cobra.Command{Use: "test"}
+
+	output := captureOutput(func() {
+		runListCmd(mockCmd, nil)
+	})
+
+	lines := make(map[string]string)
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 0 {
+			lines[fields[0]] = line
+		}
+	}
+
+	tests := []struct {
+		key    string
+		status config.KeyStatus
+	}{
+		{valid, config.StatusValid},
+		{soon, config.StatusExpiringSoon},
+		{expired, config.StatusExpired},
+		{missing, config.StatusMissing},
+	}
+	for _, tt := range tests {
+		line, ok := lines[tt.key]
+		if !ok {
+			t.Errorf("Expected %s to be listed, got: %s", tt.key, output)
+			continue
+		}
+		if !strings.HasSuffix(strings.TrimSpace(line), string(tt.status)) {
+			t.Errorf("Expected %s to have status %q, got: %s", tt.key, tt.status, line)
+		}
+	}
+
+	// Public key metadata is shown for existing keys
+	for _, want := range []string{"ed25519", "256", "SHA256:7U5WPhVG7bqifPMzZQRwRhy8scnVoQjOMPJ6Wd5r7ng", "test@example.com"} {
+		if !strings.Contains(lines[valid], want) {
+			t.Errorf("Expected %s to be listed with %s, got: %s", valid, want, lines[valid])
+		}
+	}
+}
+
+// Test formatRemaining function
+func Test_formatRemaining(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{30*24*time.Hour + 5*time.Hour, "30d 5h"},
+		{3*time.Hour + 20*time.Minute, "3h 20m"},
+		{45 * time.Minute, "45m"},
+		{-(2*24*time.Hour + time.Hour), "-2d 1h"},
+	}
+
+	for _, tt := range tests {
+		if got := formatRemaining(tt.d); got != tt.want {
+			t.Errorf("formatRemaining(%v) = %s, want %s", tt.d, got, tt.want)
+		}
+	}
+}
+
+// TestListCmd_Hosts tests that the list command shows the hosts using each key
+func TestListCmd_Hosts(t *testing.T) {
+	// Set up test environment with an SSH config using one of the keys
+	tempDir, configPath := setupTestEnvironment(t)
+	sshDir := filepath.Join(tempDir, ".ssh")
+	writeTestSSHConfig(t, sshDir)
+
+	used, _ := testutil.CreateTestKeyPair(t, sshDir, "id_work")
+	unused, _ := testutil.CreateTestKeyPair(t, sshDir, "id_unused")
+
+	now := time.Now()
+	cfgFile = configPath
+	appConfig = &config.Config{
+		Keys: map[string]config.KeyConfig{
+			used:   {CreatedAt: now, ExpiresAt: now.Add(30 * 24 * time.Hour)},
+			unused: {CreatedAt: now, ExpiresAt: now.Add(30 * 24 * time.Hour)},
+		},
+	}
+	listSoon = "7d"
+
+	output := captureOutput(func() {
+		runListCmd(&cobra.Command{Use: "test"}, nil)
+	})
+
+	for _, line := range strings.Split(output, "\n") {
+		switch {
+		case strings.HasPrefix(line, used+" "):
+			if !strings.Contains(line, " github.com, bastion ") {
+				t.Errorf("Expected the hosts using %s, got: %s", used, line)
+			}
+		case strings.HasPrefix(line, unused+" "):
+			if strings.Contains(line, "github.com") {
+				t.Errorf("Expected no hosts for %s, got: %s", unused, line)
+			}
+		}
+	}
+	if !strings.Contains(output, "HOSTS") {
+		t.Errorf("Expected a HOSTS column, got: %s", output)
+	}
+}
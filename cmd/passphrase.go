@@ -0,0 +1,286 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+
+	"github.com/de-lachende-cavalier/portunus/pkg/config"
+	"github.com/de-lachende-cavalier/portunus/pkg/keys"
+	"github.com/de-lachende-cavalier/portunus/pkg/logger"
+	"github.com/de-lachende-cavalier/portunus/pkg/secrets"
+)
+
+// Hooks used to read passphrases, replaced in tests
+var (
+	passphraseInput  io.Reader = os.Stdin
+	passphrasePrompt io.Writer = os.Stderr
+	stdinIsTerminal            = func() bool { return term.IsTerminal(int(os.Stdin.Fd())) }
+	readHiddenInput            = func() ([]byte, error) { return term.ReadPassword(int(os.Stdin.Fd())) }
+)
+
+// readPassphrase returns the passphrase used to encrypt new keys.
+// It is read from stdin when fromStdin is set, taken from the deprecated
+// --password flag when given, or prompted for without echo on a terminal.
+func readPassphrase(fromStdin bool, flagValue string) (string, error) {
+	switch {
+	case fromStdin && flagValue != "":
+		return "", errors.New("--password and --password-stdin are mutually exclusive")
+	case fromStdin:
+		return readPassphraseStdin(passphraseInput)
+	case flagValue != "":
+		return flagValue, nil
+	case stdinIsTerminal():
+		return promptPassphrase()
+	default:
+		return "", errors.New("no passphrase given: use --password-stdin or run from a terminal")
+	}
+}
+
+// readPassphraseStdin reads a passphrase from the first line of r
+func readPassphraseStdin(r io.Reader) (string, error) {
+	return readPassphraseLine(bufio.NewReader(r))
+}
+
+// readPassphraseLine reads the next line of r as a passphrase
+func readPassphraseLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("failed to read passphrase from stdin: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// promptHidden asks for a secret without echoing it
+func promptHidden(prompt string) (string, error) {
+	fmt.Fprint(passphrasePrompt, prompt)
+	secret, err := readHiddenInput()
+	fmt.Fprintln(passphrasePrompt)
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	return string(secret), nil
+}
+
+// confirm asks a yes or no question on the terminal, defaulting to no
+func confirm(question string) (bool, error) {
+	fmt.Fprintf(passphrasePrompt, "%s [y/N]: ", question)
+	answer, err := readPassphraseLine(bufio.NewReader(passphraseInput))
+	if err != nil {
+		return false, err
+	}
+
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true, nil
+	}
+	return false, nil
+}
+
+// promptPassphrase asks for a new passphrase twice without echoing it
+func promptPassphrase() (string, error) {
+	passphrase, err := promptHidden("Enter new passphrase (empty for no passphrase): ")
+	if err != nil {
+		return "", err
+	}
+
+	confirmation, err := promptHidden("Enter same passphrase again: ")
+	if err != nil {
+		return "", err
+	}
+
+	if passphrase != confirmation {
+		return "", errors.New("passphrases do not match")
+	}
+	return passphrase, nil
+}
+
+// resolvePassphrases returns the passphrase for each key to rotate.
+// Keys with a passphrase source read it from there; the others share the
+// passphrase given on stdin or at the prompt, which is only asked for when needed.
+func resolvePassphrases(keyPaths []string) (map[string]string, error) {
+	passphrases := make(map[string]string, len(keyPaths))
+
+	var shared []string
+	for _, path := range keyPaths {
+		source := appConfig.Keys[path].PassphraseSource
+		if source == nil {
+			shared = append(shared, path)
+			continue
+		}
+
+		passphrase, err := passphraseSource(source).Resolve(rootContext)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read passphrase for %s: %w", path, err)
+		}
+		passphrases[path] = passphrase
+	}
+
+	if len(shared) == 0 {
+		return passphrases, nil
+	}
+
+	passphrase, err := readPassphrase(rotatePassStdin, rotatePassword)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range shared {
+		passphrases[path] = passphrase
+	}
+
+	return passphrases, nil
+}
+
+// unlockKey returns a signer for the key at path and the passphrase decrypting it.
+// When agent holds the key, the agent signs and no passphrase is needed. Otherwise the key is
+// tried unencrypted, with its passphrase source, with the generated passphrase stored in the
+// passphrase sink and with the other candidates, in that order, before the passphrase is
+// prompted for on a terminal, where purpose says what it is needed for.
+func unlockKey(agent *keys.Agent, path, purpose string, candidates ...string) (ssh.Signer, string, error) {
+	if agent != nil {
+		if pubKey, err := keys.LoadPublicKey(path); err == nil {
+			if signer, err := agent.Signer(pubKey); err == nil && signer != nil {
+				return signer, "", nil
+			}
+		}
+	}
+
+	keyConfig := appConfig.Keys[path]
+	known := []string{""}
+	if source := keyConfig.PassphraseSource; source != nil {
+		passphrase, err := passphraseSource(source).Resolve(rootContext)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read passphrase for %s: %w", path, err)
+		}
+		known = append(known, passphrase)
+	}
+	if ref := keyConfig.PassphraseRef; ref != "" {
+		if passphrase, err := lookupPassphrase(ref); err != nil {
+			logger.Errorf(err, "Failed to read stored passphrase of %s", path)
+		} else {
+			known = append(known, passphrase)
+		}
+	}
+	known = append(known, candidates...)
+
+	for _, passphrase := range known {
+		signer, err := keys.LoadSigner(path, passphrase)
+		if err == nil {
+			return signer, passphrase, nil
+		}
+		if !errors.Is(err, keys.ErrIncorrectPassphrase) {
+			return nil, "", err
+		}
+	}
+
+	if !stdinIsTerminal() {
+		return nil, "", fmt.Errorf("passphrase for %s is unknown: set its passphrase_source or run from a terminal", path)
+	}
+	passphrase, err := promptHidden(fmt.Sprintf("Enter passphrase for %s to %s: ", path, purpose))
+	if err != nil {
+		return nil, "", err
+	}
+	signer, err := keys.LoadSigner(path, passphrase)
+	if err != nil {
+		return nil, "", err
+	}
+	return signer, passphrase, nil
+}
+
+// passphraseLookup reads back passphrases stored in a passphrase sink
+type passphraseLookup interface {
+	Lookup(ctx context.Context, ref string) (string, error)
+}
+
+// lookupPassphrase reads the passphrase referenced by ref from the configured passphrase sink
+func lookupPassphrase(ref string) (string, error) {
+	sink, err := newPassphraseSink()
+	if err != nil {
+		return "", err
+	}
+	lookup, ok := sink.(passphraseLookup)
+	if !ok {
+		return "", errors.New("passphrase sink cannot read passphrases back")
+	}
+	return lookup.Lookup(rootContext, ref)
+}
+
+// passphraseSource converts a configured passphrase source
+func passphraseSource(source *config.PassphraseSource) secrets.Source {
+	return secrets.Source{
+		Env:     source.Env,
+		File:    source.File,
+		Command: source.Command,
+	}
+}
+
+// newPassphraseSink returns the configured sink for generated passphrases
+func newPassphraseSink() (keys.PassphraseSink, error) {
+	sinkConfig := appConfig.PassphraseSink
+	if sinkConfig == nil {
+		return nil, errors.New("no passphrase_sink configured")
+	}
+
+	switch {
+	case sinkConfig.Command != "" && sinkConfig.Vault != nil:
+		return nil, errors.New("passphrase_sink must set only one of command or vault")
+	case sinkConfig.Command != "":
+		return &secrets.CommandSink{Command: sinkConfig.Command, LookupCommand: sinkConfig.LookupCommand, Prefix: sinkConfig.Prefix}, nil
+	case sinkConfig.Vault != nil:
+		vault := sinkConfig.Vault
+
+		address := vault.Address
+		if address == "" {
+			address = os.Getenv("VAULT_ADDR")
+		}
+		tokenEnv := vault.TokenEnv
+		if tokenEnv == "" {
+			tokenEnv = "VAULT_TOKEN"
+		}
+
+		return &secrets.VaultSink{
+			Address: address,
+			Token:   os.Getenv(tokenEnv),
+			Mount:   vault.Mount,
+			Prefix:  sinkConfig.Prefix,
+			Field:   vault.Field,
+		}, nil
+	default:
+		return nil, errors.New("passphrase_sink must set command or vault")
+	}
+}
+
+// checkPassphrase enforces the configured passphrase policy on the new passphrase of a key
+func checkPassphrase(path, passphrase string) error {
+	policyConfig := appConfig.PassphrasePolicy
+	if policyConfig == nil {
+		return nil
+	}
+
+	policy := secrets.Policy{
+		MinLength:   policyConfig.MinLength,
+		MinEntropy:  policyConfig.MinEntropy,
+		ForbidEmpty: policyConfig.ForbidEmpty,
+		ForbidReuse: policyConfig.ForbidReuse,
+	}
+	if err := policy.Check(passphrase, appConfig.Keys[path].PassphraseHash); err != nil {
+		return fmt.Errorf("passphrase for %s rejected: %w", path, err)
+	}
+	return nil
+}
+
+// passphraseHash returns the hash to record for a key's new passphrase,
+// or an empty string when the policy does not need one
+func passphraseHash(passphrase string) (string, error) {
+	if appConfig.PassphrasePolicy == nil || !appConfig.PassphrasePolicy.ForbidReuse {
+		return "", nil
+	}
+	return secrets.HashPassphrase(passphrase)
+}
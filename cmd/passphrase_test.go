@@ -0,0 +1,237 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/de-lachende-cavalier/portunus/pkg/config"
+	"github.com/de-lachende-cavalier/portunus/pkg/keys"
+	"github.com/de-lachende-cavalier/portunus/pkg/secrets"
+)
+
+// stubPassphraseInput replaces the passphrase hooks for the duration of a test
+func stubPassphraseInput(t *testing.T, stdin string, terminal bool, hidden ...string) {
+	t.Helper()
+
+	origInput, origPrompt, origTerminal, origHidden := passphraseInput, passphrasePrompt, stdinIsTerminal, readHiddenInput
+	t.Cleanup(func() {
+		passphraseInput, passphrasePrompt, stdinIsTerminal, readHiddenInput = origInput, origPrompt, origTerminal, origHidden
+	})
+
+	passphraseInput = strings.NewReader(stdin)
+	passphrasePrompt = io.Discard
+	stdinIsTerminal = func() bool { return terminal }
+	readHiddenInput = func() ([]byte, error) {
+		if len(hidden) == 0 {
+			return nil, io.EOF
+		}
+		line := hidden[0]
+		hidden = hidden[1:]
+		return []byte(line), nil
+	}
+}
+
+// TestReadPassphrase tests every way of providing the passphrase for new keys
+func TestReadPassphrase(t *testing.T) {
+	tests := []struct {
+		name      string
+		stdin     string
+		terminal  bool
+		hidden    []string
+		fromStdin bool
+		flag      string
+		want      string
+		wantErr   bool
+	}{
+		{name: "Stdin", stdin: "secret\n", fromStdin: true, want: "secret"},
+		{name: "StdinCRLF", stdin: "secret\r\nignored\n", fromStdin: true, want: "secret"},
+		{name: "StdinNoNewline", stdin: "secret", fromStdin: true, want: "secret"},
+		{name: "Flag", flag: "secret", want: "secret"},
+		{name: "StdinAndFlag", stdin: "secret\n", fromStdin: true, flag: "secret", wantErr: true},
+		{name: "Prompt", terminal: true, hidden: []string{"secret", "secret"}, want: "secret"},
+		{name: "PromptMismatch", terminal: true, hidden: []string{"secret", "typo"}, wantErr: true},
+		{name: "PromptAborted", terminal: true, wantErr: true},
+		{name: "NoTerminal", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubPassphraseInput(t, tt.stdin, tt.terminal, tt.hidden...)
+
+			got, err := readPassphrase(tt.fromStdin, tt.flag)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected error, got passphrase %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to read passphrase: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected passphrase %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+// TestCheckPassphrase tests that the configured policy is enforced per key
+func TestCheckPassphrase(t *testing.T) {
+	appConfig = &config.Config{
+		Keys: map[string]config.KeyConfig{},
+		PassphrasePolicy: &config.PassphrasePolicy{
+			MinLength:   12,
+			ForbidEmpty: true,
+			ForbidReuse: true,
+		},
+	}
+
+	hash, err := passphraseHash("previous passphrase")
+	if err != nil {
+		t.Fatalf("Failed to hash passphrase: %v", err)
+	}
+	if hash == "" {
+		t.Fatal("Expected a hash to be recorded when reuse is forbidden")
+	}
+	appConfig.Keys["/keys/id_work"] = config.KeyConfig{PassphraseHash: hash}
+
+	tests := []struct {
+		name       string
+		passphrase string
+		wantRule   string
+	}{
+		{"Empty", "", secrets.RuleForbidEmpty},
+		{"TooShort", "short", secrets.RuleMinLength},
+		{"Reused", "previous passphrase", secrets.RuleForbidReuse},
+		{"Valid", "a brand new passphrase", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkPassphrase("/keys/id_work", tt.passphrase)
+			if tt.wantRule == "" {
+				if err != nil {
+					t.Errorf("Expected passphrase to be accepted, got %v", err)
+				}
+				return
+			}
+
+			var policyErr *secrets.PolicyError
+			if !errors.As(err, &policyErr) || policyErr.Rule != tt.wantRule {
+				t.Errorf("Expected rule %s to fail, got %v", tt.wantRule, err)
+			}
+		})
+	}
+
+	// Without a policy every passphrase is accepted and no hash is kept
+	appConfig.PassphrasePolicy = nil
+	if err := checkPassphrase("/keys/id_work", ""); err != nil {
+		t.Errorf("Expected passphrase to be accepted without a policy, got %v", err)
+	}
+	if hash, _ := passphraseHash("secret"); hash != "" {
+		t.Errorf("Expected no hash without a policy, got %q", hash)
+	}
+}
+
+// TestUnlockKey tests every place the passphrase of a key is looked for, in order
+func TestUnlockKey(t *testing.T) {
+	tempDir, _ := setupTestEnvironment(t)
+	sshDir := filepath.Join(tempDir, ".ssh")
+	generator, err := keys.NewGenerator(keys.BackendNative)
+	if err != nil {
+		t.Fatalf("Failed to create generator: %v", err)
+	}
+	key := filepath.Join(sshDir, "id_ed25519")
+	if err := generator.Generate(context.Background(), key, keys.KeySpec{Cipher: "ed25519", Passphrase: "secret"}); err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	plain := filepath.Join(sshDir, "id_plain")
+	generateCmdTestKey(t, plain)
+	fingerprint, err := keys.PublicKeyFingerprint(key)
+	if err != nil {
+		t.Fatalf("Failed to fingerprint key: %v", err)
+	}
+
+	// The sink holds the generated passphrase of the key
+	secretDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(secretDir, "id_ed25519"), []byte("secret\n"), 0600); err != nil {
+		t.Fatalf("Failed to write secret: %v", err)
+	}
+	t.Setenv("PORTUNUS_TEST_PASSPHRASE", "secret")
+	t.Setenv("PORTUNUS_TEST_STALE_PASSPHRASE", "stale")
+	rootContext = context.Background()
+
+	tests := []struct {
+		name       string
+		path       string
+		keyConfig  config.KeyConfig
+		candidates []string
+		terminal   bool
+		hidden     []string
+		want       string
+		wantErr    bool
+	}{
+		{name: "unencrypted", path: plain, candidates: []string{"secret"}, want: ""},
+		{name: "source", path: key, keyConfig: config.KeyConfig{PassphraseSource: &config.PassphraseSource{Env: "PORTUNUS_TEST_PASSPHRASE"}}, want: "secret"},
+		{name: "sink", path: key, keyConfig: config.KeyConfig{PassphraseRef: "command:id_ed25519"}, want: "secret"},
+		// A source left behind by a passphrase change does not hide the stored passphrase
+		{name: "stale source", path: key, keyConfig: config.KeyConfig{
+			PassphraseSource: &config.PassphraseSource{Env: "PORTUNUS_TEST_STALE_PASSPHRASE"},
+			PassphraseRef:    "command:id_ed25519",
+		}, want: "secret"},
+		{name: "candidate", path: key, candidates: []string{"other", "secret"}, want: "secret"},
+		{name: "prompt", path: key, terminal: true, hidden: []string{"secret"}, want: "secret"},
+		{name: "wrong prompt", path: key, terminal: true, hidden: []string{"wrong"}, wantErr: true},
+		{name: "unknown", path: key, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			appConfig = &config.Config{
+				Keys: map[string]config.KeyConfig{tt.path: tt.keyConfig},
+				PassphraseSink: &config.PassphraseSink{
+					Command:       "cat > " + secretDir + "/{name}",
+					LookupCommand: "cat " + secretDir + "/{name}",
+				},
+			}
+			stubPassphraseInput(t, "", tt.terminal, tt.hidden...)
+
+			signer, passphrase, err := unlockKey(nil, tt.path, "test it", tt.candidates...)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected error, got passphrase %q", passphrase)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to unlock key: %v", err)
+			}
+			if passphrase != tt.want {
+				t.Errorf("Expected passphrase %q, got %q", tt.want, passphrase)
+			}
+			if tt.path == key && ssh.FingerprintSHA256(signer.PublicKey()) != fingerprint {
+				t.Error("Expected a signer for the key")
+			}
+		})
+	}
+
+	// A key held by the agent needs no passphrase
+	agent := keys.NewAgent(startTestAgent(t))
+	if err := agent.Add(key, "secret", time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("Failed to load key in agent: %v", err)
+	}
+	appConfig = &config.Config{Keys: map[string]config.KeyConfig{key: {}}}
+	stubPassphraseInput(t, "", false)
+	signer, passphrase, err := unlockKey(agent, key, "test it")
+	if err != nil || passphrase != "" || ssh.FingerprintSHA256(signer.PublicKey()) != fingerprint {
+		t.Errorf("Expected the agent to sign without a passphrase, got %q, %v", passphrase, err)
+	}
+}
@@ -0,0 +1,226 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/de-lachende-cavalier/portunus/pkg/keys"
+	"github.com/de-lachende-cavalier/portunus/pkg/logger"
+	"github.com/de-lachende-cavalier/portunus/pkg/secrets"
+)
+
+var (
+	passwdPassStdin bool
+	passwdGenerate  bool
+	passwdKeySubset []string
+)
+
+func init() {
+	rootCmd.AddCommand(passwdCmd)
+
+	passwdCmd.Flags().BoolVar(&passwdPassStdin, "password-stdin", false,
+		"reads the old password from the first line of stdin and the new one from the second")
+	passwdCmd.Flags().BoolVar(&passwdGenerate, "generate-passphrase", false,
+		"generates a random new passphrase for each key and stores it in the configured passphrase_sink")
+	passwdCmd.Flags().StringSliceVarP(&passwdKeySubset, "subset", "s", []string{},
+		"specifies the subset of keys you want to act on (if empty, acts on all tracked keys)")
+}
+
+var passwdCmd = &cobra.Command{
+	Use:   "passwd",
+	Short: "Change the passphrase of SSH keys",
+	Long: `Change the passphrase of tracked SSH keys without replacing the key material,
+so the public keys do not need to be redistributed.
+The old passphrase is verified before the key is re-encrypted. It is read from the key's
+passphrase source or the passphrase sink when they hold it, and prompted for otherwise.
+Passphrases are prompted for without echo, or read from stdin with --password-stdin.`,
+	Run: runPasswdCmd,
+}
+
+// runPasswdCmd handles changing the passphrase of SSH keys
+func runPasswdCmd(cmd *cobra.Command, args []string) {
+	logger.Info("Changing passphrases...")
+	fmt.Println("[+] Changing passphrases...")
+
+	// Get keys to act on
+	var keyPaths []string
+	if len(passwdKeySubset) > 0 {
+		for _, key := range passwdKeySubset {
+			path, err := resolveKeyPath(key)
+			if err != nil {
+				logger.Fatal(err, "Failed to resolve key path")
+			}
+			if _, exists := appConfig.Keys[path]; !exists {
+				logger.Infof("Key not found in configuration: %s", path)
+				fmt.Printf("[+] Key not found in configuration: %s\n", path)
+				continue
+			}
+			keyPaths = append(keyPaths, path)
+		}
+	} else {
+		for path := range appConfig.Keys {
+			keyPaths = append(keyPaths, path)
+		}
+		sort.Strings(keyPaths)
+	}
+
+	if len(keyPaths) == 0 {
+		logger.Info("No keys found to change the passphrase of")
+		fmt.Println("[+] No keys found to change the passphrase of")
+		return
+	}
+
+	var sink keys.PassphraseSink
+	if passwdGenerate {
+		var err error
+		if sink, err = newPassphraseSink(); err != nil {
+			logger.Fatal(err, "Failed to configure passphrase sink")
+		}
+	}
+
+	// Read the passphrases before touching any keys
+	var oldPassphrase, newPassphrase string
+	switch {
+	case passwdPassStdin:
+		reader := bufio.NewReader(passphraseInput)
+		var err error
+		if oldPassphrase, err = readPassphraseLine(reader); err != nil {
+			logger.Fatal(err, "Failed to read old passphrase")
+		}
+		if !passwdGenerate {
+			if newPassphrase, err = readPassphraseLine(reader); err != nil {
+				logger.Fatal(err, "Failed to read new passphrase")
+			}
+		}
+	case passwdGenerate:
+		// Only the old passphrases are needed, and they may be known already
+	case stdinIsTerminal():
+		var err error
+		if newPassphrase, err = promptPassphrase(); err != nil {
+			logger.Fatal(err, "Failed to read new passphrase")
+		}
+	default:
+		logger.Fatal(errors.New("no passphrase given: use --password-stdin or run from a terminal"), "Failed to read passphrase")
+	}
+
+	// Create key manager
+	keyManager, err := keys.NewManager()
+	if err != nil {
+		logger.Fatal(err, "Failed to create key manager")
+	}
+
+	changedCount := 0
+	for _, path := range keyPaths {
+		old := oldPassphrase
+		if !passwdPassStdin {
+			if _, old, err = unlockKey(nil, path, "change it"); err != nil {
+				logger.Errorf(err, "Failed to read old passphrase: %s", path)
+				fmt.Printf("\t[-] %s passphrase not changed: %v\n", path, err)
+				continue
+			}
+		}
+
+		if sink == nil {
+			if err := checkNewPassphrase(path, old, newPassphrase); err != nil {
+				logger.Errorf(err, "Passphrase rejected by policy: %s", path)
+				fmt.Printf("\t[-] %s passphrase not changed: %v\n", path, err)
+				continue
+			}
+		}
+
+		ref, changed, err := changePassphrase(keyManager, sink, path, old, newPassphrase)
+		if err != nil {
+			logger.Errorf(err, "Failed to change passphrase: %s", path)
+			fmt.Printf("\t[-] %s passphrase not changed: %v\n", path, err)
+			continue
+		}
+
+		appConfig.SetPassphraseChanged(path, time.Now(), ref)
+		if sink != nil {
+			appConfig.SetPassphraseHash(path, "")
+		} else if hash, err := passphraseHash(newPassphrase); err != nil {
+			logger.Errorf(err, "Failed to hash passphrase of %s", path)
+		} else {
+			appConfig.SetPassphraseHash(path, hash)
+		}
+		changedCount++
+
+		logger.Infof("Changed passphrase: %s", path)
+		fmt.Printf("\t[+] %s passphrase changed\n", path)
+		warnIfStaleSource(path, changed)
+	}
+
+	// Save configuration
+	if err := appConfig.Save(cfgFile); err != nil {
+		logger.Fatal(err, "Failed to save configuration")
+	}
+
+	if changedCount < len(keyPaths) {
+		fmt.Printf("[-] %d of %d passphrases changed\n", changedCount, len(keyPaths))
+		logger.Fatal(fmt.Errorf("%d keys failed", len(keyPaths)-changedCount), "Failed to change passphrases")
+	}
+
+	logger.Info("Passphrases have been successfully changed")
+	fmt.Println("[+] The passphrases have been successfully changed")
+}
+
+// checkNewPassphrase enforces the passphrase policy on the passphrase replacing oldPassphrase
+func checkNewPassphrase(path, oldPassphrase, newPassphrase string) error {
+	if err := checkPassphrase(path, newPassphrase); err != nil {
+		return err
+	}
+
+	// The old passphrase is known here even when no hash of it was recorded
+	if policy := appConfig.PassphrasePolicy; policy != nil && policy.ForbidReuse && oldPassphrase == newPassphrase {
+		return fmt.Errorf("passphrase for %s rejected: %w", path,
+			&secrets.PolicyError{Rule: secrets.RuleForbidReuse, Reason: "same as the previous passphrase"})
+	}
+	return nil
+}
+
+// changePassphrase re-encrypts a key, generating the new passphrase and storing it
+// in the sink when one is given. It returns the reference of the stored passphrase
+// and the new passphrase.
+func changePassphrase(keyManager *keys.Manager, sink keys.PassphraseSink, path, oldPassphrase, newPassphrase string) (string, string, error) {
+	if sink == nil {
+		return "", newPassphrase, keyManager.ChangePassphrase(rootContext, path, oldPassphrase, newPassphrase)
+	}
+
+	generated, err := keys.GeneratePassphrase()
+	if err != nil {
+		return "", "", err
+	}
+	if err := keyManager.ChangePassphrase(rootContext, path, oldPassphrase, generated); err != nil {
+		return "", "", err
+	}
+
+	ref, err := sink.Store(rootContext, keyManager.SecretName(path), generated)
+	if err != nil {
+		// Nobody would know the generated passphrase, so put the old one back
+		if revertErr := keyManager.ChangePassphrase(rootContext, path, generated, oldPassphrase); revertErr != nil {
+			return "", "", fmt.Errorf("failed to store passphrase: %w (restoring the old passphrase failed: %v)", err, revertErr)
+		}
+		return "", "", fmt.Errorf("failed to store passphrase: %w", err)
+	}
+
+	return ref, generated, nil
+}
+
+// warnIfStaleSource warns when the passphrase source of a key does not return its new passphrase,
+// since rotations would encrypt the new key with the passphrase the source still returns
+func warnIfStaleSource(path, passphrase string) {
+	source := appConfig.Keys[path].PassphraseSource
+	if source == nil {
+		return
+	}
+	if current, err := passphraseSource(source).Resolve(rootContext); err == nil && current == passphrase {
+		return
+	}
+	logger.Infof("Passphrase source of %s does not return its new passphrase", path)
+	fmt.Printf("\t[-] %s passphrase_source does not return the new passphrase, update it\n", path)
+}
@@ -0,0 +1,248 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/de-lachende-cavalier/portunus/pkg/config"
+	"github.com/de-lachende-cavalier/portunus/pkg/keys"
+)
+
+// TestPasswdCmd tests changing the passphrase of a subset of tracked keys
+func TestPasswdCmd(t *testing.T) {
+	// Set up test environment
+	tempDir, configPath := setupTestEnvironment(t)
+	sshDir := filepath.Join(tempDir, ".ssh")
+
+	// Create encrypted test keys
+	generator, err := keys.NewGenerator(keys.BackendNative)
+	if err != nil {
+		t.Fatalf("Failed to create generator: %v", err)
+	}
+	workKey := filepath.Join(sshDir, "id_work")
+	otherKey := filepath.Join(sshDir, "id_other")
+	for _, key := range []string{workKey, otherKey} {
+		if err := generator.Generate(context.Background(), key, keys.KeySpec{Cipher: "ed25519", Passphrase: "old"}); err != nil {
+			t.Fatalf("Failed to generate key pair: %v", err)
+		}
+	}
+	fingerprint, err := keys.PublicKeyFingerprint(workKey)
+	if err != nil {
+		t.Fatalf("Failed to fingerprint key: %v", err)
+	}
+
+	// Initialize the config
+	now := time.Now()
+	cfgFile = configPath
+	appConfig = &config.Config{
+		Keys: map[string]config.KeyConfig{
+			workKey:  {CreatedAt: now, ExpiresAt: now.Add(time.Hour)},
+			otherKey: {CreatedAt: now, ExpiresAt: now.Add(time.Hour)},
+		},
+	}
+
+	// Feed the old and new passphrases through stdin
+	stubPassphraseInput(t, "old\nnew\n", false)
+	passwdPassStdin = true
+	passwdKeySubset = []string{"id_work"}
+	t.Cleanup(func() {
+		passwdPassStdin = false
+		passwdKeySubset = nil
+	})
+
+	// Initialize the context
+	rootContext = context.Background()
+
+	// Run the passwd command
+	runPasswdCmd(&cobra.Command{Use: "test"}, nil)
+
+	privData, err := os.ReadFile(workKey)
+	if err != nil {
+		t.Fatalf("Failed to read private key: %v", err)
+	}
+	signer, err := ssh.ParsePrivateKeyWithPassphrase(privData, []byte("new"))
+	if err != nil {
+		t.Fatalf("Expected key to be encrypted with the new passphrase: %v", err)
+	}
+	if got := ssh.FingerprintSHA256(signer.PublicKey()); got != fingerprint {
+		t.Errorf("Expected key material to be kept (%s), got %s", fingerprint, got)
+	}
+
+	// Keys outside the subset are untouched
+	otherData, err := os.ReadFile(otherKey)
+	if err != nil {
+		t.Fatalf("Failed to read private key: %v", err)
+	}
+	if _, err := ssh.ParsePrivateKeyWithPassphrase(otherData, []byte("old")); err != nil {
+		t.Errorf("Expected %s to keep its passphrase: %v", otherKey, err)
+	}
+
+	loadedConfig, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if loadedConfig.Keys[workKey].PassphraseChangedAt == nil {
+		t.Error("Expected the passphrase change to be recorded")
+	}
+	if loadedConfig.Keys[otherKey].PassphraseChangedAt != nil {
+		t.Error("Expected no passphrase change to be recorded for keys outside the subset")
+	}
+}
+
+// TestPasswdCmd_GeneratePassphrase tests that a failing sink leaves the old passphrase in place
+func TestPasswdCmd_GeneratePassphrase(t *testing.T) {
+	// Set up test environment
+	tempDir, _ := setupTestEnvironment(t)
+	sshDir := filepath.Join(tempDir, ".ssh")
+
+	generator, err := keys.NewGenerator(keys.BackendNative)
+	if err != nil {
+		t.Fatalf("Failed to create generator: %v", err)
+	}
+	key := filepath.Join(sshDir, "id_work")
+	if err := generator.Generate(context.Background(), key, keys.KeySpec{Cipher: "ed25519", Passphrase: "old"}); err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+
+	keyManager, err := keys.NewManager()
+	if err != nil {
+		t.Fatalf("Failed to create key manager: %v", err)
+	}
+	rootContext = context.Background()
+
+	sink := &secretsDirSink{dir: filepath.Join(tempDir, "missing")}
+	if _, _, err := changePassphrase(keyManager, sink, key, "old", ""); err == nil {
+		t.Fatal("Expected error when the sink fails, got nil")
+	}
+
+	privData, err := os.ReadFile(key)
+	if err != nil {
+		t.Fatalf("Failed to read private key: %v", err)
+	}
+	if _, err := ssh.ParsePrivateKeyWithPassphrase(privData, []byte("old")); err != nil {
+		t.Errorf("Expected the old passphrase to be restored: %v", err)
+	}
+
+	sink.dir = tempDir
+	ref, generated, err := changePassphrase(keyManager, sink, key, "old", "")
+	if err != nil {
+		t.Fatalf("Failed to change passphrase: %v", err)
+	}
+	if ref != "dir:id_work" {
+		t.Errorf("Expected reference dir:id_work, got %q", ref)
+	}
+
+	stored, err := os.ReadFile(filepath.Join(tempDir, "id_work"))
+	if err != nil {
+		t.Fatalf("Failed to read stored passphrase: %v", err)
+	}
+	privData, err = os.ReadFile(key)
+	if err != nil {
+		t.Fatalf("Failed to read private key: %v", err)
+	}
+	if _, err := ssh.ParsePrivateKeyWithPassphrase(privData, stored); err != nil {
+		t.Errorf("Expected key to be encrypted with the stored passphrase: %v", err)
+	}
+	if generated != string(stored) {
+		t.Error("Expected the generated passphrase to be returned")
+	}
+}
+
+// TestPasswdCmd_Unattended tests changing passphrases without a terminal, reading the old
+// ones from the passphrase source and the passphrase sink
+func TestPasswdCmd_Unattended(t *testing.T) {
+	// Set up test environment
+	tempDir, configPath := setupTestEnvironment(t)
+	sshDir := filepath.Join(tempDir, ".ssh")
+
+	generator, err := keys.NewGenerator(keys.BackendNative)
+	if err != nil {
+		t.Fatalf("Failed to create generator: %v", err)
+	}
+	sourced := filepath.Join(sshDir, "id_sourced")
+	stored := filepath.Join(sshDir, "id_stored")
+	for _, key := range []string{sourced, stored} {
+		if err := generator.Generate(context.Background(), key, keys.KeySpec{Cipher: "ed25519", Passphrase: "old"}); err != nil {
+			t.Fatalf("Failed to generate key pair: %v", err)
+		}
+	}
+
+	// The sink holds the generated passphrase of one key, the environment the other's
+	secretDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(secretDir, "id_stored"), []byte("old\n"), 0600); err != nil {
+		t.Fatalf("Failed to write secret: %v", err)
+	}
+	t.Setenv("PORTUNUS_TEST_PASSPHRASE", "old")
+
+	now := time.Now()
+	cfgFile = configPath
+	appConfig = &config.Config{
+		Keys: map[string]config.KeyConfig{
+			sourced: {CreatedAt: now, ExpiresAt: now.Add(time.Hour), PassphraseSource: &config.PassphraseSource{Env: "PORTUNUS_TEST_PASSPHRASE"}},
+			stored:  {CreatedAt: now, ExpiresAt: now.Add(time.Hour), PassphraseRef: "command:id_stored"},
+		},
+		PassphraseSink: &config.PassphraseSink{
+			Command:       "cat > " + secretDir + "/{name}",
+			LookupCommand: "cat " + secretDir + "/{name}",
+		},
+	}
+	rootContext = context.Background()
+
+	// Generate new passphrases with nobody at the terminal
+	stubPassphraseInput(t, "", false)
+	passwdGenerate = true
+	passwdKeySubset = nil
+	t.Cleanup(func() { passwdGenerate = false })
+	output := captureOutput(func() {
+		runPasswdCmd(&cobra.Command{Use: "test"}, nil)
+	})
+	if !strings.Contains(output, "The passphrases have been successfully changed") {
+		t.Fatalf("Expected the passphrases to be changed, got output:\n%s", output)
+	}
+
+	for _, key := range []string{sourced, stored} {
+		secret, err := os.ReadFile(filepath.Join(secretDir, filepath.Base(key)))
+		if err != nil {
+			t.Fatalf("Failed to read stored passphrase: %v", err)
+		}
+		if _, err := keys.LoadSigner(key, strings.TrimSpace(string(secret))); err != nil {
+			t.Errorf("Expected %s to be encrypted with the stored passphrase: %v", key, err)
+		}
+	}
+
+	// The environment still holds the old passphrase
+	if !strings.Contains(output, sourced+" passphrase_source does not return the new passphrase") {
+		t.Errorf("Expected the stale passphrase source to be reported, got output:\n%s", output)
+	}
+	if strings.Contains(output, stored+" passphrase_source") {
+		t.Errorf("Expected no warning for the key without passphrase source, got output:\n%s", output)
+	}
+
+	// The generated passphrases are read back for the next change
+	output = captureOutput(func() {
+		runPasswdCmd(&cobra.Command{Use: "test"}, nil)
+	})
+	if !strings.Contains(output, "The passphrases have been successfully changed") {
+		t.Errorf("Expected the passphrases to be changed again, got output:\n%s", output)
+	}
+}
+
+// secretsDirSink stores passphrases as files in a directory
+type secretsDirSink struct {
+	dir string
+}
+
+// Store writes the passphrase to a file named after the key
+func (s *secretsDirSink) Store(ctx context.Context, name, passphrase string) (string, error) {
+	if err := os.WriteFile(filepath.Join(s.dir, name), []byte(passphrase), 0600); err != nil {
+		return "", err
+	}
+	return "dir:" + name, nil
+}
@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/de-lachende-cavalier/portunus/pkg/config"
+	"github.com/de-lachende-cavalier/portunus/pkg/keys"
+	"github.com/de-lachende-cavalier/portunus/pkg/logger"
+	"github.com/de-lachende-cavalier/portunus/pkg/publish"
+)
+
+// defaultPublishTitle names the keys uploaded to Git hosting accounts
+const defaultPublishTitle = "{user}@{hostname} {name} {date}"
+
+// newPublisher returns the publisher of a Git hosting account, reading its token from its source
+func newPublisher(publisherConfig config.PublisherConfig) (publish.Publisher, error) {
+	if publisherConfig.Token == nil {
+		return nil, fmt.Errorf("publisher %s has no token", publisherConfig.Provider)
+	}
+	token, err := passphraseSource(publisherConfig.Token).Resolve(rootContext)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s token: %w", publisherConfig.Provider, err)
+	}
+	return publish.New(publisherConfig.Provider, publisherConfig.Address, token)
+}
+
+// publishesKey reports whether the key at path is published to the account
+func publishesKey(publisherConfig config.PublisherConfig, path string) bool {
+	for _, key := range publisherConfig.Keys {
+		if keyPath, err := resolveKeyPath(key); err == nil && keyPath == filepath.Clean(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// publishKeys uploads the new public keys of rotated keys to the configured Git hosting accounts
+// and deletes their old public keys there. Failures are reported without stopping the others; it returns their number.
+func publishKeys(results []keys.RotationResult) int {
+	failed := 0
+	for _, publisherConfig := range appConfig.Publishers {
+		var published []keys.RotationResult
+		for _, result := range results {
+			if result.Success && publishesKey(publisherConfig, result.Path) {
+				published = append(published, result)
+			}
+		}
+		if len(published) == 0 {
+			continue
+		}
+
+		account := publisherConfig.Provider
+		if publisherConfig.Address != "" {
+			account += " (" + publisherConfig.Address + ")"
+		}
+
+		publisher, err := newPublisher(publisherConfig)
+		if err != nil {
+			logger.Errorf(err, "Failed to configure publisher %s", account)
+			fmt.Printf("\t[-] keys not published to %s: %v\n", account, err)
+			failed += len(published)
+			continue
+		}
+
+		for _, result := range published {
+			if err := publishKey(publisher, publisherConfig, account, result); err != nil {
+				failed++
+			}
+		}
+	}
+	return failed
+}
+
+// publishKey replaces the old public key of a rotated key with the new one on an account
+func publishKey(publisher publish.Publisher, publisherConfig config.PublisherConfig, account string, result keys.RotationResult) error {
+	data, err := os.ReadFile(result.Path + ".pub")
+	if err != nil {
+		logger.Errorf(err, "Failed to read public key of %s", result.Path)
+		fmt.Printf("\t[-] %s not published to %s: %v\n", result.Path, account, err)
+		return err
+	}
+	pubKey, comment, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		logger.Errorf(err, "Failed to parse public key of %s", result.Path)
+		fmt.Printf("\t[-] %s not published to %s: %v\n", result.Path, account, err)
+		return err
+	}
+
+	tmpl := publisherConfig.Title
+	if tmpl == "" {
+		tmpl = defaultPublishTitle
+	}
+	title, err := keys.ExpandCommentTemplate(tmpl, keys.NewCommentData(result.Path, comment, result.RotatedAt))
+	if err != nil {
+		logger.Errorf(err, "Invalid title for %s", account)
+		fmt.Printf("\t[-] %s not published to %s: %v\n", result.Path, account, err)
+		return err
+	}
+
+	if err := publisher.Publish(rootContext, pubKey, title); err != nil {
+		logger.Errorf(err, "Failed to publish %s to %s", result.Path, account)
+		fmt.Printf("\t[-] %s new key not published to %s: %v\n", result.Path, account, err)
+		return err
+	}
+	logger.Infof("Published %s to %s as %q", result.Path, account, title)
+	fmt.Printf("\t[+] %s new key published to %s as %q\n", result.Path, account, title)
+
+	// The old key is only deleted once the new one is there
+	if result.OldPublicKey == nil {
+		return nil
+	}
+	deleted, err := publisher.Unpublish(rootContext, result.OldPublicKey)
+	if err != nil {
+		logger.Errorf(err, "Failed to remove old key of %s from %s", result.Path, account)
+		fmt.Printf("\t[-] %s old key not removed from %s: %v\n", result.Path, account, err)
+		return err
+	}
+	if deleted > 0 {
+		logger.Infof("Removed old key of %s (%s) from %s", result.Path, result.OldFingerprint, account)
+		fmt.Printf("\t[+] %s old key (%s) removed from %s\n", result.Path, result.OldFingerprint, account)
+	}
+	return nil
+}
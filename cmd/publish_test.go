@@ -0,0 +1,185 @@
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/de-lachende-cavalier/portunus/pkg/config"
+	"github.com/de-lachende-cavalier/portunus/pkg/keys"
+	"github.com/de-lachende-cavalier/portunus/pkg/testutil"
+)
+
+func TestRotateCmd_Publish(t *testing.T) {
+	// Set up test environment with a GitHub and a GitLab account holding the key
+	tempDir, configPath := setupTestEnvironment(t)
+	sshDir := filepath.Join(tempDir, ".ssh")
+	key := filepath.Join(sshDir, "id_work")
+	generateCmdTestKey(t, key)
+	oldKey, err := keys.LoadPublicKey(key)
+	if err != nil {
+		t.Fatalf("Failed to load public key: %v", err)
+	}
+	oldLine := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(oldKey)))
+
+	github := testutil.StartKeyServer(t, "/user/keys", "per_page", func(r *http.Request) bool {
+		return r.Header.Get("Authorization") == "Bearer gh-token"
+	})
+	github.Add(oldLine+" old@laptop", "old laptop key")
+	gitlab := testutil.StartKeyServer(t, "/api/v4/user/keys", "per_page", func(r *http.Request) bool {
+		return r.Header.Get("PRIVATE-TOKEN") == "gl-token"
+	})
+	gitlab.Add(oldLine, "old laptop key")
+	t.Setenv("PORTUNUS_TEST_GITHUB_TOKEN", "gh-token")
+	t.Setenv("PORTUNUS_TEST_GITLAB_TOKEN", "gl-token")
+
+	cfgFile = configPath
+	appConfig = &config.Config{
+		Keys: make(map[string]config.KeyConfig),
+		Publishers: []config.PublisherConfig{
+			{
+				Provider: "github",
+				Address:  github.URL,
+				Token:    &config.PassphraseSource{Env: "PORTUNUS_TEST_GITHUB_TOKEN"},
+				Keys:     []string{"id_work"},
+				Title:    "{name} {date}",
+			},
+			{
+				Provider: "gitlab",
+				Address:  gitlab.URL,
+				Token:    &config.PassphraseSource{Env: "PORTUNUS_TEST_GITLAB_TOKEN"},
+				Keys:     []string{"~/.ssh/id_work"},
+			},
+		},
+	}
+	rootContext = context.Background()
+
+	// Set up command flags
+	rotateCipher = "ed25519"
+	rotateBackend = keys.BackendNative
+	rotateTime = "1h"
+	rotatePassword = "test"
+	rotateNoPublish = false
+	rotateKeySubset = []string{key}
+
+	// Run the rotate command
+	output := captureOutput(func() {
+		runRotateCmd(&cobra.Command{Use: "test"}, nil)
+	})
+
+	newKey, err := keys.LoadPublicKey(key)
+	if err != nil {
+		t.Fatalf("Failed to load public key: %v", err)
+	}
+	newLine := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(newKey)))
+
+	// The GitHub account holds the new key only
+	title := "id_work " + time.Now().Format(time.DateOnly)
+	uploaded := github.Keys()
+	if len(uploaded) != 1 || uploaded[0].Key != newLine || uploaded[0].Title != title {
+		t.Errorf("Expected only the new key titled %q on GitHub, got %+v", title, uploaded)
+	}
+	if !strings.Contains(output, "new key published to github") || !strings.Contains(output, "old key ("+ssh.FingerprintSHA256(oldKey)+") removed from github") {
+		t.Errorf("Expected the GitHub account to be updated, got output:\n%s", output)
+	}
+
+	// The GitLab account gets the new key under the default title
+	if uploaded := gitlab.Keys(); len(uploaded) != 1 || uploaded[0].Key != newLine {
+		t.Errorf("Expected only the new key on GitLab, got %+v", uploaded)
+	}
+	if !strings.Contains(output, "The keys have been successfully rotated") {
+		t.Errorf("Expected the rotation to succeed, got output:\n%s", output)
+	}
+
+	// --no-publish leaves the accounts alone
+	rotateNoPublish = true
+	t.Cleanup(func() { rotateNoPublish = false })
+	runRotateCmd(&cobra.Command{Use: "test"}, nil)
+	if uploaded := github.Keys(); len(uploaded) != 1 || uploaded[0].Key != newLine {
+		t.Errorf("Expected the GitHub account to be untouched with --no-publish, got %+v", uploaded)
+	}
+}
+
+// TestRotateCmd_PublishFailure tests that an account that cannot be updated fails the run,
+// once the rotated keys are recorded and the other accounts updated
+func TestRotateCmd_PublishFailure(t *testing.T) {
+	tempDir, configPath := setupTestEnvironment(t)
+	sshDir := filepath.Join(tempDir, ".ssh")
+	key := filepath.Join(sshDir, "id_work")
+	generateCmdTestKey(t, key)
+	oldKey, err := keys.LoadPublicKey(key)
+	if err != nil {
+		t.Fatalf("Failed to load public key: %v", err)
+	}
+	oldLine := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(oldKey)))
+
+	github := testutil.StartKeyServer(t, "/user/keys", "per_page", func(r *http.Request) bool {
+		return r.Header.Get("Authorization") == "Bearer gh-token"
+	})
+	github.Add(oldLine, "old laptop key")
+	gitlab := testutil.StartKeyServer(t, "/api/v4/user/keys", "per_page", func(r *http.Request) bool {
+		return r.Header.Get("PRIVATE-TOKEN") == "gl-token"
+	})
+	gitlab.Add(oldLine, "old laptop key")
+	t.Setenv("PORTUNUS_TEST_GITHUB_TOKEN", "gh-token")
+	t.Setenv("PORTUNUS_TEST_GITLAB_TOKEN", "wrong")
+
+	appConfig = &config.Config{
+		Keys: make(map[string]config.KeyConfig),
+		Publishers: []config.PublisherConfig{
+			{
+				Provider: "github",
+				Address:  github.URL,
+				Token:    &config.PassphraseSource{Env: "PORTUNUS_TEST_GITHUB_TOKEN"},
+				Keys:     []string{"id_work"},
+			},
+			{
+				Provider: "gitlab",
+				Address:  gitlab.URL,
+				Token:    &config.PassphraseSource{Env: "PORTUNUS_TEST_GITLAB_TOKEN"},
+				Keys:     []string{"id_work"},
+			},
+		},
+	}
+	if err := appConfig.Save(configPath); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+
+	output, ok := runCLI(t, tempDir, "rotate", "--backend", keys.BackendNative, "-c", "ed25519", "-t", "1h", "-p", "test", "-s", key)
+	if ok {
+		t.Errorf("Expected the rotation to fail, got output:\n%s", output)
+	}
+	if !strings.Contains(output, "new key not published to gitlab") || !strings.Contains(output, "1 keys rotated, 1 not published") {
+		t.Errorf("Expected the GitLab failure to be reported, got output:\n%s", output)
+	}
+
+	// The rotation itself went through
+	newKey, err := keys.LoadPublicKey(key)
+	if err != nil {
+		t.Fatalf("Failed to load public key: %v", err)
+	}
+	if ssh.FingerprintSHA256(newKey) == ssh.FingerprintSHA256(oldKey) {
+		t.Fatal("Expected the key to be rotated")
+	}
+	loadedConfig, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if _, tracked := loadedConfig.Keys[key]; !tracked {
+		t.Errorf("Expected the rotated key to be tracked, got %+v", loadedConfig.Keys)
+	}
+
+	newLine := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(newKey)))
+	if uploaded := github.Keys(); len(uploaded) != 1 || uploaded[0].Key != newLine {
+		t.Errorf("Expected only the new key on GitHub, got %+v", uploaded)
+	}
+	if uploaded := gitlab.Keys(); len(uploaded) != 1 || uploaded[0].Key != oldLine {
+		t.Errorf("Expected the GitLab account to be untouched, got %+v", uploaded)
+	}
+}
@@ -6,13 +6,14 @@ import (
 
 	"github.com/spf13/cobra"
 
-	"github.com/de-lachende-cavalier/portunus/pkg/config"
+	"github.com/de-lachende-cavalier/portunus/pkg/keys"
 	"github.com/de-lachende-cavalier/portunus/pkg/logger"
 )
 
 var (
 	renewTime      string
 	renewKeySubset []string
+	renewNoAgent   bool
 )
 
 func init() {
@@ -23,14 +24,19 @@ func init() {
 	renewCmd.Flags().StringSliceVarP(&renewKeySubset, "subset", "s", []string{},
 		"specifies the subset of keys you want to act on (if empty, acts on all expired keys)")
 
+	renewCmd.Flags().BoolVar(&renewNoAgent, "no-agent", false,
+		"leaves the running ssh-agent untouched instead of extending the lifetime of the renewed keys in it")
+
 	renewCmd.MarkFlagRequired("time")
 }
 
 var renewCmd = &cobra.Command{
 	Use:   "renew",
 	Short: "Renew expired SSH keys",
-	Long:  `Renew expired SSH keys by extending their expiration date.`,
-	Run:   runRenewCmd,
+	Long: `Renew expired SSH keys by extending their expiration date.
+Renewed keys loaded in the running ssh-agent (SSH_AUTH_SOCK) are reloaded so they
+stay loaded until their new expiration date, and certified keys get a new certificate.`,
+	Run: runRenewCmd,
 }
 
 // runRenewCmd handles the renewal of SSH keys
@@ -60,9 +66,17 @@ func runRenewCmd(cmd *cobra.Command, args []string) {
 		return
 	}
 
+	// Extend the lifetime of the renewed keys in the running ssh-agent
+	var agent *keys.Agent
+	if !renewNoAgent {
+		if agent = connectAgent(); agent != nil {
+			defer agent.Close()
+		}
+	}
+
 	// Renew keys
 	now := time.Now()
-	renewedCount := 0
+	var renewed []string
 
 	for _, key := range keysToRenew {
 		keyConfig, exists := appConfig.Keys[key]
@@ -72,23 +86,60 @@ func runRenewCmd(cmd *cobra.Command, args []string) {
 			continue
 		}
 
-		// Update expiration time by creating a new KeyConfig
-		newKeyConfig := config.KeyConfig{
-			CreatedAt: keyConfig.CreatedAt,
-			ExpiresAt: now.Add(duration),
-		}
+		// Update expiration time, keeping the rest of the key's settings
+		newKeyConfig := keyConfig
+		newKeyConfig.ExpiresAt = now.Add(duration)
 		appConfig.Keys[key] = newKeyConfig
 
 		logger.Infof("Renewed key: %s (new expiration: %s)", key, newKeyConfig.ExpiresAt.Format(time.RFC3339))
 		fmt.Printf("\t[+] %s renewed, new expiration date: %s\n", key, newKeyConfig.ExpiresAt.Format(time.RFC3339))
-		renewedCount++
+		renewed = append(renewed, key)
+
+		if agent != nil {
+			refreshAgentKey(agent, key, newKeyConfig.ExpiresAt)
+		}
 	}
 
+	// Certificates of renewed keys must follow their new expiration date
+	reissueCertificates(renewed)
+
+	// Local authorized_keys files enforce the new expiration dates
+	syncExpiryTimes(renewed)
+
 	// Save configuration
 	if err := appConfig.Save(cfgFile); err != nil {
 		logger.Fatal(err, "Failed to save configuration")
 	}
 
-	logger.Infof("Successfully renewed %d keys", renewedCount)
+	logger.Infof("Successfully renewed %d keys", len(renewed))
 	fmt.Printf("[+] The keys have been successfully renewed\n")
 }
+
+// refreshAgentKey reloads a renewed key in the agent with its new expiration, if it is loaded.
+// The key is decrypted with its known passphrase, or one prompted for when needed.
+func refreshAgentKey(agent *keys.Agent, path string, expiresAt time.Time) {
+	fingerprint, err := keys.PublicKeyFingerprint(path)
+	if err != nil {
+		logger.Errorf(err, "Failed to refresh %s in ssh-agent", path)
+		return
+	}
+	if key, err := agent.Find(fingerprint); err != nil || key == nil {
+		return
+	}
+
+	// Reloading reads the key from disk, so it needs the passphrase even though the agent holds it
+	_, passphrase, err := unlockKey(nil, path, "refresh it in ssh-agent")
+	loaded := true
+	if err == nil {
+		loaded, err = agent.Refresh(path, passphrase, expiresAt)
+	}
+
+	switch {
+	case err != nil:
+		logger.Errorf(err, "Failed to refresh %s in ssh-agent", path)
+		fmt.Printf("\t[-] %s not refreshed in ssh-agent: %v\n", path, err)
+	case loaded:
+		logger.Infof("Refreshed %s in ssh-agent", path)
+		fmt.Printf("\t[+] %s refreshed in ssh-agent\n", path)
+	}
+}
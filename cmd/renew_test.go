@@ -2,11 +2,14 @@ package cmd
 
 import (
 	"context"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/de-lachende-cavalier/portunus/pkg/config"
+	"github.com/de-lachende-cavalier/portunus/pkg/keys"
 	"github.com/de-lachende-cavalier/portunus/pkg/testutil"
 	"github.com/spf13/cobra"
 )
@@ -97,3 +100,81 @@ func TestRenewCmd(t *testing.T) {
 		}
 	}
 }
+
+// TestRenewCmd_Agent tests that renewed keys are reloaded in the ssh-agent,
+// decrypted with the passphrase from their source or from the passphrase sink
+func TestRenewCmd_Agent(t *testing.T) {
+	tests := []struct {
+		name      string
+		keyConfig config.KeyConfig
+	}{
+		{"source", config.KeyConfig{PassphraseSource: &config.PassphraseSource{Env: "PORTUNUS_TEST_PASSPHRASE"}}},
+		{"sink", config.KeyConfig{PassphraseRef: "command:id_ed25519"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Set up test environment with a running agent
+			tempDir, configPath := setupTestEnvironment(t)
+			sshDir := filepath.Join(tempDir, ".ssh")
+			keyring := startTestAgent(t)
+
+			// Create an encrypted test key and load it in the agent
+			generator, err := keys.NewGenerator(keys.BackendNative)
+			if err != nil {
+				t.Fatalf("Failed to create generator: %v", err)
+			}
+			key := filepath.Join(sshDir, "id_ed25519")
+			if err := generator.Generate(context.Background(), key, keys.KeySpec{Cipher: "ed25519", Passphrase: "secret"}); err != nil {
+				t.Fatalf("Failed to generate key pair: %v", err)
+			}
+			if err := keys.NewAgent(keyring).Add(key, "secret", time.Now().Add(time.Minute)); err != nil {
+				t.Fatalf("Failed to load key in agent: %v", err)
+			}
+			t.Setenv("PORTUNUS_TEST_PASSPHRASE", "secret")
+			secretDir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(secretDir, "id_ed25519"), []byte("secret\n"), 0600); err != nil {
+				t.Fatalf("Failed to write secret: %v", err)
+			}
+
+			// Initialize the config
+			now := time.Now()
+			keyConfig := tt.keyConfig
+			keyConfig.CreatedAt = now.Add(-time.Hour)
+			keyConfig.ExpiresAt = now.Add(-time.Minute)
+			cfgFile = configPath
+			appConfig = &config.Config{
+				Keys: map[string]config.KeyConfig{key: keyConfig},
+				PassphraseSink: &config.PassphraseSink{
+					Command:       "cat > " + secretDir + "/{name}",
+					LookupCommand: "cat " + secretDir + "/{name}",
+				},
+			}
+
+			// Set up command flags, with nobody at the terminal
+			renewTime = "1h"
+			renewKeySubset = []string{}
+			stubPassphraseInput(t, "", false)
+
+			// Initialize the context
+			rootContext = context.Background()
+
+			// Run the renew command
+			output := captureOutput(func() {
+				runRenewCmd(&cobra.Command{Use: "test"}, nil)
+			})
+
+			if !strings.Contains(output, key+" refreshed in ssh-agent") {
+				t.Errorf("Expected %s to be refreshed in the agent, got output:\n%s", key, output)
+			}
+
+			fingerprint, err := keys.PublicKeyFingerprint(key)
+			if err != nil {
+				t.Fatalf("Failed to fingerprint key: %v", err)
+			}
+			if !agentFingerprints(t, keyring)[fingerprint] {
+				t.Error("Expected the renewed key to stay loaded in the agent")
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/de-lachende-cavalier/portunus/pkg/config"
+	"github.com/de-lachende-cavalier/portunus/pkg/keys"
+	"github.com/de-lachende-cavalier/portunus/pkg/logger"
+)
+
+var (
+	revokeRemoteKeySubset []string
+	revokeRemoteAll       bool
+)
+
+func init() {
+	rootCmd.AddCommand(revokeRemoteCmd)
+
+	revokeRemoteCmd.Flags().StringSliceVarP(&revokeRemoteKeySubset, "subset", "s", []string{},
+		"specifies the subset of keys you want to act on (if empty, acts on all keys with hosts)")
+	revokeRemoteCmd.Flags().BoolVar(&revokeRemoteAll, "all", false,
+		"also removes retired keys that were already removed from every host, e.g. after adding hosts")
+}
+
+var revokeRemoteCmd = &cobra.Command{
+	Use:   "revoke-remote",
+	Short: "Remove retired SSH keys from remote hosts",
+	Long: `Remove the public keys retired by rotate from the authorized_keys files of the hosts
+listed for each key in the config file. Every host is logged in to with the current key,
+taken from the running ssh-agent or decrypted with its passphrase, and every line whose
+key matches a retired key is removed, whatever its options or comment.
+A retired key removed from all the hosts of its key is not looked for again unless --all is given.`,
+	Run: runRevokeRemoteCmd,
+}
+
+// runRevokeRemoteCmd removes retired keys from the hosts of their keys
+func runRevokeRemoteCmd(cmd *cobra.Command, args []string) {
+	logger.Info("Removing retired keys from remote hosts...")
+	fmt.Println("[+] Removing retired keys from remote hosts...")
+
+	distributor, err := newDistributor()
+	if err != nil {
+		logger.Fatal(err, "Failed to configure remote hosts")
+	}
+	if distributor == nil {
+		logger.Info("No keys with remote hosts")
+		fmt.Println("[+] No keys with remote hosts, add them to the config file")
+		return
+	}
+
+	// Get keys to clean up
+	var keyPaths []string
+	if len(revokeRemoteKeySubset) > 0 {
+		for _, key := range revokeRemoteKeySubset {
+			path, err := resolveKeyPath(key)
+			if err != nil {
+				logger.Fatal(err, "Invalid key")
+			}
+			keyPaths = append(keyPaths, path)
+		}
+	} else {
+		for path := range distributor.Inventory {
+			keyPaths = append(keyPaths, path)
+		}
+		sort.Strings(keyPaths)
+	}
+
+	// Log in with keys loaded in the running ssh-agent when possible
+	agent := connectAgent()
+	if agent != nil {
+		defer agent.Close()
+	}
+
+	failed, invalid := 0, 0
+	for _, path := range keyPaths {
+		hosts := distributor.Hosts(path)
+		retired := pendingRetiredKeys(path)
+		if len(hosts) == 0 || len(retired) == 0 {
+			logger.Infof("Nothing to remove for %s", path)
+			fmt.Printf("\t[+] %s has no retired keys to remove from its hosts\n", path)
+			continue
+		}
+
+		// A retired key that cannot be parsed is reported, the others are still removed
+		pubKeys := make([]ssh.PublicKey, 0, len(retired))
+		var valid []config.RetiredKeyConfig
+		for _, r := range retired {
+			pubKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(r.PublicKey))
+			if err != nil {
+				logger.Errorf(err, "Invalid retired key %s of %s in configuration", r.Fingerprint, path)
+				fmt.Printf("\t[-] %s: retired key %s is invalid: %v\n", path, r.Fingerprint, err)
+				invalid++
+				continue
+			}
+			pubKeys = append(pubKeys, pubKey)
+			valid = append(valid, r)
+		}
+		retired = valid
+		if len(retired) == 0 {
+			continue
+		}
+
+		signer, err := hostLoginSigner(agent, path)
+		if err != nil {
+			logger.Errorf(err, "Cannot log in to the hosts of %s", path)
+			fmt.Printf("\t[-] %s cannot log in to its hosts: %v\n", path, err)
+			failed += len(hosts)
+			continue
+		}
+
+		clean := true
+		for _, host := range hosts {
+			removed, err := distributor.RemoveKeys(rootContext, host, signer, pubKeys)
+			if err != nil {
+				logger.Errorf(err, "Failed to remove retired keys of %s from %s", path, host)
+				fmt.Printf("\t[-] %s: %s not cleaned up: %v\n", path, host, err)
+				clean = false
+				failed++
+				continue
+			}
+
+			var report []string
+			for i, n := range removed {
+				if n > 0 {
+					report = append(report, fmt.Sprintf("%s (%d entries)", retired[i].Fingerprint, n))
+				}
+			}
+			if len(report) == 0 {
+				fmt.Printf("\t[+] %s: %s holds no retired key\n", path, host)
+				continue
+			}
+			logger.Infof("Removed retired keys of %s from %s: %s", path, host, strings.Join(report, ", "))
+			fmt.Printf("\t[+] %s: removed %s from %s\n", path, strings.Join(report, ", "), host)
+		}
+
+		if clean {
+			now := time.Now()
+			for _, r := range retired {
+				appConfig.SetRetiredKeyRemoved(path, r.Fingerprint, now)
+			}
+		}
+	}
+
+	// Save configuration
+	if err := appConfig.Save(cfgFile); err != nil {
+		logger.Fatal(err, "Failed to save configuration")
+	}
+
+	if failed > 0 || invalid > 0 {
+		logger.Fatal(fmt.Errorf("%d hosts not cleaned up, %d invalid retired keys", failed, invalid), "Failed to remove retired keys from remote hosts")
+	}
+
+	logger.Info("Retired keys have been removed from remote hosts")
+	fmt.Println("[+] Retired keys have been removed from remote hosts")
+}
+
+// pendingRetiredKeys returns the retired keys of a key that are still to be removed from its hosts
+func pendingRetiredKeys(path string) []config.RetiredKeyConfig {
+	var pending []config.RetiredKeyConfig
+	for _, r := range appConfig.Keys[path].Retired {
+		if r.RemovedAt == nil || revokeRemoteAll {
+			pending = append(pending, r)
+		}
+	}
+	return pending
+}
+
+// hostLoginSigner returns a signer for the key at path to log in to its hosts, taken from the agent
+// when it holds the key, or decrypted with the key's passphrase
+func hostLoginSigner(agent *keys.Agent, path string) (ssh.Signer, error) {
+	signer, _, err := unlockKey(agent, path, "log in to its hosts")
+	return signer, err
+}
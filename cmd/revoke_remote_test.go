@@ -0,0 +1,214 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/de-lachende-cavalier/portunus/pkg/config"
+	"github.com/de-lachende-cavalier/portunus/pkg/keys"
+	"github.com/de-lachende-cavalier/portunus/pkg/testutil"
+)
+
+// TestRevokeRemoteCmd tests removing retired keys from the hosts of a key
+func TestRevokeRemoteCmd(t *testing.T) {
+	// Set up test environment with a host authorizing the current and retired keys
+	tempDir, configPath := setupTestEnvironment(t)
+	sshDir := filepath.Join(tempDir, ".ssh")
+	server := testutil.StartSSHServer(t)
+
+	key := filepath.Join(sshDir, "id_ed25519")
+	generateCmdTestKey(t, key)
+	retiredPath := filepath.Join(tempDir, "retired")
+	generateCmdTestKey(t, retiredPath)
+	currentKey, err := keys.LoadPublicKey(key)
+	if err != nil {
+		t.Fatalf("Failed to load public key: %v", err)
+	}
+	retiredKey, err := keys.LoadPublicKey(retiredPath)
+	if err != nil {
+		t.Fatalf("Failed to load public key: %v", err)
+	}
+
+	retiredLine := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(retiredKey)))
+	authorizedKeys := "# deploy keys\n" + retiredLine + " old@laptop\n" +
+		string(ssh.MarshalAuthorizedKey(currentKey)) + `restrict ` + retiredLine + "\n"
+	if err := os.WriteFile(server.AuthorizedKeysPath(), []byte(authorizedKeys), 0600); err != nil {
+		t.Fatalf("Failed to write authorized keys: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(sshDir, "known_hosts"), []byte(server.KnownHostsLine()), 0600); err != nil {
+		t.Fatalf("Failed to write known hosts: %v", err)
+	}
+
+	// Initialize the config with the retired key and the host of the key
+	now := time.Now()
+	cfgFile = configPath
+	appConfig = &config.Config{
+		Keys: map[string]config.KeyConfig{
+			key: {
+				CreatedAt: now,
+				ExpiresAt: now.Add(time.Hour),
+				Hosts:     []config.HostConfig{{Address: server.Addr, User: "alice"}},
+				Retired: []config.RetiredKeyConfig{{
+					PublicKey:   retiredLine,
+					Fingerprint: ssh.FingerprintSHA256(retiredKey),
+					RetiredAt:   now,
+				}},
+			},
+		},
+	}
+	rootContext = context.Background()
+	revokeRemoteKeySubset = nil
+	revokeRemoteAll = false
+
+	output := captureOutput(func() {
+		runRevokeRemoteCmd(&cobra.Command{Use: "test"}, nil)
+	})
+	want := "removed " + ssh.FingerprintSHA256(retiredKey) + " (2 entries) from alice@" + server.Addr
+	if !strings.Contains(output, want) {
+		t.Errorf("Expected the per-host report %q, got output:\n%s", want, output)
+	}
+
+	data := mustReadFile(t, server.AuthorizedKeysPath())
+	if wantData := "# deploy keys\n" + string(ssh.MarshalAuthorizedKey(currentKey)); data != wantData {
+		t.Errorf("Expected only the retired key to be removed, got:\n%s", data)
+	}
+	if appConfig.Keys[key].Retired[0].RemovedAt == nil {
+		t.Error("Expected the retired key to be marked as removed")
+	}
+
+	// Removed keys are not looked for again, unless asked to
+	output = captureOutput(func() {
+		runRevokeRemoteCmd(&cobra.Command{Use: "test"}, nil)
+	})
+	if !strings.Contains(output, "has no retired keys to remove") {
+		t.Errorf("Expected nothing left to remove, got output:\n%s", output)
+	}
+
+	revokeRemoteAll = true
+	defer func() { revokeRemoteAll = false }()
+	output = captureOutput(func() {
+		runRevokeRemoteCmd(&cobra.Command{Use: "test"}, nil)
+	})
+	if !strings.Contains(output, "alice@"+server.Addr+" holds no retired key") {
+		t.Errorf("Expected the host to be checked again, got output:\n%s", output)
+	}
+}
+
+// TestRevokeRemoteCmd_InvalidRetiredKey tests that a corrupted retired key does not stop the clean up
+func TestRevokeRemoteCmd_InvalidRetiredKey(t *testing.T) {
+	// Set up test environment with a host authorizing the current and retired keys
+	tempDir, configPath := setupTestEnvironment(t)
+	sshDir := filepath.Join(tempDir, ".ssh")
+	server := testutil.StartSSHServer(t)
+
+	key := filepath.Join(sshDir, "id_ed25519")
+	generateCmdTestKey(t, key)
+	retiredPath := filepath.Join(tempDir, "retired")
+	generateCmdTestKey(t, retiredPath)
+	currentKey, err := keys.LoadPublicKey(key)
+	if err != nil {
+		t.Fatalf("Failed to load public key: %v", err)
+	}
+	retiredKey, err := keys.LoadPublicKey(retiredPath)
+	if err != nil {
+		t.Fatalf("Failed to load public key: %v", err)
+	}
+
+	retiredLine := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(retiredKey)))
+	authorizedKeys := retiredLine + "\n" + string(ssh.MarshalAuthorizedKey(currentKey))
+	if err := os.WriteFile(server.AuthorizedKeysPath(), []byte(authorizedKeys), 0600); err != nil {
+		t.Fatalf("Failed to write authorized keys: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(sshDir, "known_hosts"), []byte(server.KnownHostsLine()), 0600); err != nil {
+		t.Fatalf("Failed to write known hosts: %v", err)
+	}
+
+	now := time.Now()
+	cfgFile = configPath
+	appConfig = &config.Config{
+		Keys: map[string]config.KeyConfig{
+			key: {
+				CreatedAt: now,
+				ExpiresAt: now.Add(time.Hour),
+				Hosts:     []config.HostConfig{{Address: server.Addr, User: "alice"}},
+				Retired: []config.RetiredKeyConfig{
+					{PublicKey: "ssh-ed25519 corrupted", Fingerprint: "SHA256:corrupted", RetiredAt: now},
+					{PublicKey: retiredLine, Fingerprint: ssh.FingerprintSHA256(retiredKey), RetiredAt: now},
+				},
+			},
+		},
+	}
+	if err := appConfig.Save(configPath); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+
+	// The run fails, but only once the other retired keys are removed
+	output, ok := runCLI(t, tempDir, "revoke-remote")
+	if ok {
+		t.Errorf("Expected revoke-remote to fail, got output:\n%s", output)
+	}
+	if !strings.Contains(output, "retired key SHA256:corrupted is invalid") {
+		t.Errorf("Expected the invalid retired key to be reported, got output:\n%s", output)
+	}
+
+	// The valid retired key is still removed
+	if data := mustReadFile(t, server.AuthorizedKeysPath()); data != string(ssh.MarshalAuthorizedKey(currentKey)) {
+		t.Errorf("Expected the retired key to be removed, got:\n%s", data)
+	}
+	loadedConfig, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	retired := loadedConfig.Keys[key].Retired
+	if retired[0].RemovedAt != nil || retired[1].RemovedAt == nil {
+		t.Errorf("Expected only the valid retired key to be marked as removed, got %+v", retired)
+	}
+}
+
+// TestRotateCmd_RetiredKeys tests that rotations record the retired keys of their hosts
+func TestRotateCmd_RetiredKeys(t *testing.T) {
+	// Set up test environment
+	tempDir, configPath := setupTestEnvironment(t)
+	sshDir := filepath.Join(tempDir, ".ssh")
+
+	key := filepath.Join(sshDir, "id_ed25519")
+	generateCmdTestKey(t, key)
+	oldKey, err := keys.LoadPublicKey(key)
+	if err != nil {
+		t.Fatalf("Failed to load public key: %v", err)
+	}
+
+	cfgFile = configPath
+	appConfig = &config.Config{
+		Keys: make(map[string]config.KeyConfig),
+	}
+	rootContext = context.Background()
+
+	rotateCipher = "ed25519"
+	rotateBackend = keys.BackendNative
+	rotateTime = "1h"
+	rotatePassword = "test"
+	rotateKeySubset = []string{key}
+
+	runRotateCmd(&cobra.Command{Use: "test"}, nil)
+
+	retired := appConfig.Keys[key].Retired
+	if len(retired) != 1 || retired[0].Fingerprint != ssh.FingerprintSHA256(oldKey) {
+		t.Fatalf("Expected the retired key to be recorded, got %+v", retired)
+	}
+	pubKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(retired[0].PublicKey))
+	if err != nil || ssh.FingerprintSHA256(pubKey) != retired[0].Fingerprint {
+		t.Errorf("Expected the retired public key to be recorded, got %q", retired[0].PublicKey)
+	}
+	// Without hosts, the retired key was not removed anywhere
+	if retired[0].RemovedAt != nil {
+		t.Error("Expected the retired key to be pending")
+	}
+}
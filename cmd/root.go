@@ -3,6 +3,8 @@ package cmd
 import (
 	"context"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/spf13/cobra"
 
@@ -10,26 +12,31 @@ import (
 	"github.com/de-lachende-cavalier/portunus/pkg/logger"
 )
 
+// keepMissingKeysAnnotation marks commands that must see tracked keys whose files are gone
+const keepMissingKeysAnnotation = "portunus:keep-missing-keys"
+
 var (
 	cfgFile     string
 	logLevel    string
 	prettyLogs  bool
 	appConfig   *config.Config
 	rootContext context.Context
+	// cancelRootContext releases the signal handlers of rootContext
+	cancelRootContext context.CancelFunc = func() {}
 )
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "portunus",
 	Short: "portunus is a simple utility for managing SSH key expiration",
-	Long: `portunus acts as middleware, handling the keys for you through ssh-keygen 
+	Long: `portunus acts as middleware, handling the keys for you (natively or through ssh-keygen) 
 and keeping track of their specified expiration dates, which ssh-keygen cannot do. 
 Once the keys have expired, portunus will prompt you to either rotate them 
 (delete the old ones and make new ones) or to renew them 
 (postpone their expiration date by some specified amount).`,
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
-		// Initialize context
-		rootContext = context.Background()
+		// Initialize context, cancelled on Ctrl-C or SIGTERM so rotations can roll back
+		rootContext, cancelRootContext = signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 
 		// Initialize logger
 		logger.Init(logLevel, prettyLogs)
@@ -41,12 +48,19 @@ Once the keys have expired, portunus will prompt you to either rotate them
 			logger.Fatal(err, "Failed to load configuration")
 		}
 
-		// Clean up non-existent keys from config
+		// Clean up non-existent keys from config, unless the command reports them
+		if cmd.Annotations[keepMissingKeysAnnotation] != "" {
+			return
+		}
 		appConfig.CleanNonExistentKeys()
 		if err := appConfig.Save(cfgFile); err != nil {
 			logger.Error(err, "Failed to save configuration after cleanup")
 		}
 	},
+	PersistentPostRun: func(cmd *cobra.Command, args []string) {
+		// Restore the default signal handling
+		cancelRootContext()
+	},
 	Run: func(cmd *cobra.Command, args []string) {
 		// The root command doesn't do anything by itself
 		_ = cmd.Help()
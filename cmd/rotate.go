@@ -2,46 +2,87 @@ package cmd
 
 import (
 	"fmt"
-	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
 
+	"github.com/de-lachende-cavalier/portunus/pkg/config"
 	"github.com/de-lachende-cavalier/portunus/pkg/keys"
 	"github.com/de-lachende-cavalier/portunus/pkg/logger"
 )
 
 var (
 	rotateCipher    string
+	rotateBackend   string
 	rotateTime      string
 	rotatePassword  string
+	rotatePassStdin bool
+	rotateGenerate  bool
+	rotateNoAgent   bool
+	rotateNoRemote  bool
+	rotateNoPublish bool
+	rotateYes       bool
 	rotateKeySubset []string
 )
 
 func init() {
 	rootCmd.AddCommand(rotateCmd)
 
-	rotateCmd.Flags().StringVarP(&rotateCipher, "cipher", "c", "ed25519",
-		"specifies which cipher to use for key generation")
+	rotateCmd.Flags().StringVarP(&rotateCipher, "cipher", "c", keys.CipherKeep,
+		"specifies which cipher to use for key generation (ed25519, rsa, ecdsa, or keep to reuse each key's current algorithm and size)")
+	rotateCmd.Flags().StringVar(&rotateBackend, "backend", keys.DefaultBackend,
+		"specifies the key generation backend (native or ssh-keygen)")
 	rotateCmd.Flags().StringVarP(&rotateTime, "time", "t", "",
 		"specifies for how much longer the key should be valid (format: <int><specifier>, where specifier is either s (seconds), m (minutes), h (hours) or d (days)")
 	rotateCmd.Flags().StringVarP(&rotatePassword, "password", "p", "",
-		"specifies the password to use with ssh-keygen (NOTE: this password is used for ALL the keys that are rotated)")
+		"specifies the password used to encrypt the new keys (NOTE: this password is used for ALL the keys without a passphrase source)")
+	rotateCmd.Flags().BoolVar(&rotatePassStdin, "password-stdin", false,
+		"reads the password used to encrypt the new keys without a passphrase source from the first line of stdin")
+	rotateCmd.Flags().BoolVar(&rotateGenerate, "generate-passphrase", false,
+		"generates a random passphrase for each new key and stores it in the configured passphrase_sink")
+	rotateCmd.Flags().BoolVar(&rotateNoAgent, "no-agent", false,
+		"leaves the running ssh-agent untouched instead of swapping the rotated keys in it")
+	rotateCmd.Flags().BoolVar(&rotateNoRemote, "no-distribute", false,
+		"leaves the authorized_keys files of the keys' remote hosts untouched")
+	rotateCmd.Flags().BoolVar(&rotateNoPublish, "no-publish", false,
+		"leaves the SSH keys of the configured GitHub, GitLab and Gitea accounts untouched")
+	rotateCmd.Flags().BoolVarP(&rotateYes, "yes", "y", false,
+		"rotates without asking for confirmation when the keys are used by hosts of the SSH client config")
 	rotateCmd.Flags().StringSliceVarP(&rotateKeySubset, "subset", "s", []string{},
-		"specifies the subset of keys you want to act on (if empty, acts on all keys in ~/.ssh)")
+		"specifies the subset of keys you want to act on (if empty, acts on all keys in the key directories)")
 
 	rotateCmd.MarkFlagRequired("time")
-	rotateCmd.MarkFlagRequired("password")
+	rotateCmd.MarkFlagsMutuallyExclusive("generate-passphrase", "password")
+	rotateCmd.MarkFlagsMutuallyExclusive("generate-passphrase", "password-stdin")
+	rotateCmd.Flags().MarkDeprecated("password", "it leaks into shell history and process listings; use --password-stdin or the interactive prompt")
 }
 
 var rotateCmd = &cobra.Command{
 	Use:   "rotate",
 	Short: "Rotate SSH keys",
-	Long: `Rotate SSH keys by deleting old ones and creating new ones with the same name.
-If called without the subset flag, this command rotates ALL the keys in ~/.ssh/.
-The new keys will be tracked with their expiration dates.`,
+	Long: `Rotate SSH keys by archiving old ones and creating new ones with the same name.
+If called without the subset flag, this command rotates ALL the keys in the key
+directories (~/.ssh/ unless key_roots is set in the config file).
+Retired keys can be recovered with the archive command until their retention period ends.
+The new keys will be tracked with their expiration dates.
+Keys with a passphrase_source in the config file read their passphrase from it.
+The passphrase for the other keys is prompted for without echo, or read from stdin
+with --password-stdin. With --generate-passphrase, every new key gets a random
+passphrase that is stored in the configured passphrase_sink instead.
+Retired keys are removed from the running ssh-agent (SSH_AUTH_SOCK) and the new
+keys are added to it, loaded until they expire. Certified keys get a new certificate
+from the local CA. Retired public keys are added to the revocation list (see the krl command).
+Keys with hosts in the config file are distributed before they replace the old ones:
+the new public key is appended to the authorized_keys file of every host, logging in
+with the old key, and must log in itself; the old entry is then removed with the new key.
+If any host cannot be updated, the rotation of the key is aborted.
+Rotated keys listed by a publisher in the config file are uploaded to the GitHub,
+GitLab or Gitea account it describes, and their old public keys are deleted there.
+Before rotating, the hosts of the SSH client config using the keys are listed and,
+on a terminal, the rotation must be confirmed unless --yes is given.`,
 	Run: runRotateCmd,
 }
 
@@ -56,8 +97,72 @@ func runRotateCmd(cmd *cobra.Command, args []string) {
 		logger.Fatal(err, "Failed to parse time duration")
 	}
 
+	// Select the key generation backend
+	generator, err := keys.NewGenerator(rotateBackend)
+	if err != nil {
+		logger.Fatal(err, "Failed to select key generation backend")
+	}
+
+	// Open the archive retired keys are moved to
+	archive, err := newArchive()
+	if err != nil {
+		logger.Fatal(err, "Failed to open archive")
+	}
+
+	// Drop archived keys past their retention period
+	if purged, err := archive.Purge(time.Now()); err != nil {
+		logger.Error(err, "Failed to purge archive")
+	} else if len(purged) > 0 {
+		logger.Infof("Purged %d expired archive entries", len(purged))
+	}
+
+	// Collect the directories to search for keys
+	roots, err := keyRoots()
+	if err != nil {
+		logger.Fatal(err, "Failed to read key directories")
+	}
+
+	// Open the revocation list retired public keys are added to
+	krl, err := newRevocationList()
+	if err != nil {
+		logger.Fatal(err, "Failed to open revocation list")
+	}
+
+	opts := []keys.Option{keys.WithGenerator(generator), keys.WithArchive(archive), keys.WithRoots(roots...), keys.WithRevocationList(krl)}
+
+	// Store generated passphrases in the configured secret manager
+	if rotateGenerate {
+		sink, err := newPassphraseSink()
+		if err != nil {
+			logger.Fatal(err, "Failed to configure passphrase sink")
+		}
+		opts = append(opts, keys.WithPassphraseSink(sink))
+	}
+
+	// Swap the rotated keys in the running ssh-agent
+	var sshAgent *keys.Agent
+	if !rotateNoAgent {
+		if sshAgent = connectAgent(); sshAgent != nil {
+			defer sshAgent.Close()
+			opts = append(opts, keys.WithAgent(sshAgent))
+		}
+	}
+
+	// Install the rotated keys on the remote hosts they give access to
+	distribute := false
+	if !rotateNoRemote {
+		distributor, err := newDistributor()
+		if err != nil {
+			logger.Fatal(err, "Failed to configure remote hosts")
+		}
+		if distributor != nil {
+			opts = append(opts, keys.WithDistributor(distributor))
+			distribute = true
+		}
+	}
+
 	// Create key manager
-	keyManager, err := keys.NewManager()
+	keyManager, err := keys.NewManager(opts...)
 	if err != nil {
 		logger.Fatal(err, "Failed to create key manager")
 	}
@@ -65,28 +170,27 @@ func runRotateCmd(cmd *cobra.Command, args []string) {
 	// Get keys to rotate
 	var keyPaths []string
 	if len(rotateKeySubset) > 0 {
-		// Use specified subset of keys
-		homeDir, err := cmd.Flags().GetString("home")
-		if err != nil {
-			homeDir, err = getHomeDir()
-			if err != nil {
-				logger.Fatal(err, "Failed to get home directory")
-			}
-		}
-
+		// Use specified subset of keys, named like in the other commands
 		for _, key := range rotateKeySubset {
-			// If the key doesn't have a path, assume it's in ~/.ssh/
-			if !filepath.IsAbs(key) && !strings.HasPrefix(key, ".") {
-				key = filepath.Join(homeDir, ".ssh", key)
+			path, err := resolveKeyPath(key)
+			if err != nil {
+				logger.Fatal(err, "Failed to resolve key path")
 			}
-			keyPaths = append(keyPaths, key)
+			keyPaths = append(keyPaths, path)
 		}
 	} else {
-		// Get all keys
-		keyPaths, err = keyManager.GetAllKeys(rootContext)
+		// Get all files identified as private keys
+		discovery, err := keyManager.DiscoverKeys(rootContext)
 		if err != nil {
 			logger.Fatal(err, "Failed to get SSH keys")
 		}
+
+		for _, skipped := range discovery.Skipped {
+			logger.Infof("Skipping %s: %s", skipped.Path, skipped.Reason)
+		}
+		for _, key := range discovery.Keys {
+			keyPaths = append(keyPaths, key.Path)
+		}
 	}
 
 	if len(keyPaths) == 0 {
@@ -95,19 +199,119 @@ func runRotateCmd(cmd *cobra.Command, args []string) {
 		return
 	}
 
+	// Show what the rotation affects and let the user back out
+	if !confirmRotation(keyPaths) {
+		logger.Info("Rotation cancelled")
+		fmt.Println("[+] Rotation cancelled")
+		return
+	}
+
+	// Resolve the passphrase of every key before touching any of them
+	passphrases := make(map[string]string)
+	if !rotateGenerate {
+		passphrases, err = resolvePassphrases(keyPaths)
+		if err != nil {
+			logger.Fatal(err, "Failed to read passphrase")
+		}
+
+		// Enforce the passphrase policy before any key is replaced
+		for _, path := range keyPaths {
+			if err := checkPassphrase(path, passphrases[path]); err != nil {
+				logger.Fatal(err, "Passphrase rejected by policy")
+			}
+		}
+	}
+
+	// The old keys log in to their hosts to install the new ones
+	oldPassphrases := make(map[string]string)
+	if distribute {
+		for _, path := range keyPaths {
+			if len(appConfig.Keys[path].Hosts) == 0 {
+				continue
+			}
+			_, oldPassphrases[path], err = unlockKey(sshAgent, path, "log in to its hosts", passphrases[path])
+			if err != nil {
+				logger.Fatal(err, "Failed to read old passphrase")
+			}
+		}
+	}
+
 	// Rotate keys
-	creationTimes, err := keyManager.RotateKeys(rootContext, keyPaths, rotateCipher, rotatePassword)
-	if err != nil {
-		logger.Fatal(err, "Failed to rotate keys")
+	requests := make([]keys.RotationRequest, len(keyPaths))
+	for i, path := range keyPaths {
+		requests[i] = keys.RotationRequest{
+			Path: path,
+			Spec: keys.KeySpec{
+				Cipher:     rotateCipher,
+				Passphrase: passphrases[path],
+			},
+			CommentTemplate:    appConfig.Keys[path].CommentTemplate,
+			GeneratePassphrase: rotateGenerate,
+			Lifetime:           duration,
+			OldPassphrase:      oldPassphrases[path],
+		}
 	}
+	results, rotateErr := keyManager.RotateKeys(rootContext, requests)
+
+	// Update configuration with every key that was rotated, even if others failed
+	var rotated []string
+	for _, result := range results {
+		if !result.Success {
+			logger.Errorf(result.Err, "Failed to rotate key: %s", result.Path)
+			fmt.Printf("\t[-] %s not rotated: %v\n", result.Path, result.Err)
+			continue
+		}
 
-	// Update configuration
-	for path, creationTime := range creationTimes {
-		expirationTime := creationTime.Add(duration)
-		appConfig.AddKey(path, creationTime, expirationTime)
+		// Certificates imported from another CA cannot follow the new key
+		previous := appConfig.Keys[result.Path]
 
-		logger.Infof("Rotated key: %s (expires: %s)", path, expirationTime.Format(time.RFC3339))
-		fmt.Printf("\t[+] %s rotated, expiration date: %s\n", path, expirationTime.Format(time.RFC3339))
+		expirationTime := result.CreatedAt.Add(duration)
+		appConfig.AddKey(result.Path, result.CreatedAt, expirationTime)
+		appConfig.SetKeyAlgorithm(result.Path, result.Cipher, result.Bits)
+		appConfig.SetPassphraseRef(result.Path, result.PassphraseRef)
+		if rotateGenerate {
+			appConfig.SetPassphraseHash(result.Path, "")
+		} else if hash, err := passphraseHash(passphrases[result.Path]); err != nil {
+			logger.Errorf(err, "Failed to hash passphrase of %s", result.Path)
+		} else {
+			appConfig.SetPassphraseHash(result.Path, hash)
+		}
+		rotated = append(rotated, result.Path)
+		retireKey(result)
+
+		logger.Infof("Rotated key: %s (%s -> %s, expires: %s)", result.Path,
+			result.OldFingerprint, result.NewFingerprint, expirationTime.Format(time.RFC3339))
+		fmt.Printf("\t[+] %s rotated, expiration date: %s\n", result.Path, expirationTime.Format(time.RFC3339))
+		if result.AgentLoaded {
+			fmt.Printf("\t[+] %s loaded into ssh-agent\n", result.Path)
+		}
+		for _, host := range result.Hosts {
+			if host.Retired {
+				fmt.Printf("\t[+] %s new key authorized on %s, old key removed\n", result.Path, host.Host)
+			} else {
+				fmt.Printf("\t[-] %s new key authorized on %s, old key not removed: %v\n", result.Path, host.Host, host.Err)
+			}
+		}
+		if result.Revoked {
+			fmt.Printf("\t[+] %s retired key (%s) added to the revocation list\n", result.Path, result.OldFingerprint)
+		}
+		if previous.Certificate != nil && !previous.Certified {
+			logger.Infof("Certificate of %s no longer matches the rotated key", result.Path)
+			fmt.Printf("\t[-] %s certificate %q no longer matches the key, request a new one\n",
+				result.Path, previous.Certificate.KeyID)
+		}
+	}
+
+	// The certificates of rotated keys were issued for their old public keys
+	reissueCertificates(rotated)
+
+	// Local authorized_keys files enforce the new expiration dates
+	syncExpiryTimes(rotated)
+
+	// Git hosting accounts get the new public keys in place of the old ones
+	unpublished := 0
+	if !rotateNoPublish {
+		unpublished = publishKeys(results)
 	}
 
 	// Save configuration
@@ -115,10 +319,69 @@ func runRotateCmd(cmd *cobra.Command, args []string) {
 		logger.Fatal(err, "Failed to save configuration")
 	}
 
+	if rotateErr != nil {
+		fmt.Printf("[-] %d of %d keys rotated\n", len(rotated), len(results))
+		logger.Fatal(rotateErr, "Failed to rotate keys")
+	}
+	if unpublished > 0 {
+		fmt.Printf("[-] %d keys rotated, %d not published to their accounts, update them by hand\n", len(rotated), unpublished)
+		logger.Fatal(fmt.Errorf("%d keys not published", unpublished), "Failed to publish keys")
+	}
+
 	logger.Info("Keys have been successfully rotated")
 	fmt.Println("[+] The keys have been successfully rotated")
 }
 
+// confirmRotation lists the hosts of the SSH client config using the keys to rotate and,
+// on a terminal, asks whether to go on. Keys used by no host need no confirmation.
+func confirmRotation(keyPaths []string) bool {
+	usage := keyUsage(keyPaths)
+	if len(usage) == 0 {
+		return true
+	}
+
+	fmt.Println("[+] Rotating these keys affects the following hosts:")
+	for _, path := range keyPaths {
+		if u := usage[path]; len(u) > 0 {
+			fmt.Printf("\t[+] %s: %s\n", path, formatUsage(u))
+		} else {
+			fmt.Printf("\t[+] %s: not used in the SSH config\n", path)
+		}
+	}
+
+	if rotateYes || rotatePassStdin || !stdinIsTerminal() {
+		return true
+	}
+	ok, err := confirm("Rotate these keys?")
+	if err != nil {
+		logger.Fatal(err, "Failed to read confirmation")
+	}
+	return ok
+}
+
+// retireKey records the retired public key of a rotated key, to remove it from the key's hosts.
+// It is already removed when the rotation cleaned up every host.
+func retireKey(result keys.RotationResult) {
+	if result.OldPublicKey == nil {
+		return
+	}
+	appConfig.RetireKey(result.Path, config.RetiredKeyConfig{
+		PublicKey:   strings.TrimSpace(string(ssh.MarshalAuthorizedKey(result.OldPublicKey))),
+		Fingerprint: ssh.FingerprintSHA256(result.OldPublicKey),
+		RetiredAt:   result.RotatedAt,
+	})
+
+	if len(result.Hosts) == 0 {
+		return
+	}
+	for _, host := range result.Hosts {
+		if !host.Retired {
+			return
+		}
+	}
+	appConfig.SetRetiredKeyRemoved(result.Path, ssh.FingerprintSHA256(result.OldPublicKey), result.RotatedAt)
+}
+
 // parseDuration parses a duration string in the format "<int><specifier>"
 func parseDuration(s string) (time.Duration, error) {
 	// Check if the duration ends with "d" for days
@@ -135,12 +398,3 @@ func parseDuration(s string) (time.Duration, error) {
 	// Use standard time.ParseDuration for other units
 	return time.ParseDuration(s)
 }
-
-// getHomeDir returns the user's home directory
-func getHomeDir() (string, error) {
-	home, err := filepath.Abs(filepath.Dir(filepath.Join(filepath.Dir("~"), "..")))
-	if err != nil {
-		return "", fmt.Errorf("failed to get home directory: %w", err)
-	}
-	return home, nil
-}
@@ -9,8 +9,10 @@ import (
 	"time"
 
 	"github.com/de-lachende-cavalier/portunus/pkg/config"
+	"github.com/de-lachende-cavalier/portunus/pkg/keys"
 	"github.com/de-lachende-cavalier/portunus/pkg/testutil"
 	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
 )
 
 // Helper function, check whether the correct cipher has been used in overwriting the keys.
@@ -48,6 +50,7 @@ func TestRotateCmd_RSA(t *testing.T) {
 
 	// Set up command flags
 	rotateCipher = "rsa"
+	rotateBackend = keys.BackendSSHKeygen
 	rotateTime = "30m"
 	rotatePassword = "test"
 	rotateKeySubset = []string{key1, key2}
@@ -109,6 +112,7 @@ func TestRotateCmd_Ed25519(t *testing.T) {
 
 	// Set up command flags
 	rotateCipher = "ed25519"
+	rotateBackend = keys.BackendSSHKeygen
 	rotateTime = "30m"
 	rotatePassword = "test"
 	rotateKeySubset = []string{key1, key2}
@@ -146,3 +150,689 @@ func TestRotateCmd_Ed25519(t *testing.T) {
 		}
 	}
 }
+
+// TestRotateCmd_NativeBackend tests key rotation without ssh-keygen.
+func TestRotateCmd_NativeBackend(t *testing.T) {
+	// Set up test environment
+	tempDir, configPath := setupTestEnvironment(t)
+	sshDir := filepath.Join(tempDir, ".ssh")
+
+	// Create test key files
+	key1, _ := testutil.CreateTestKeyPair(t, sshDir, "id_ed25519")
+	key2, _ := testutil.CreateTestKeyPair(t, sshDir, "id_ecdsa")
+
+	// Initialize the config
+	cfgFile = configPath
+	appConfig = &config.Config{
+		Keys: make(map[string]config.KeyConfig),
+	}
+
+	// Set up command flags
+	rotateCipher = "ecdsa"
+	rotateBackend = keys.BackendNative
+	rotateTime = "1h"
+	rotatePassword = "test"
+	rotateKeySubset = []string{key1, key2}
+
+	// Initialize the context
+	rootContext = context.Background()
+
+	// Create a mock command for testing
+	mockCmd := &cobra.Command{Use: "test"}
+
+	// Run the rotate command
+	runRotateCmd(mockCmd, nil)
+
+	// Check if the config was updated
+	loadedConfig, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	if len(loadedConfig.Keys) != 2 {
+		t.Errorf("Expected 2 keys in config, got %d", len(loadedConfig.Keys))
+	}
+
+	// Check if the keys were regenerated with the requested cipher
+	for key := range loadedConfig.Keys {
+		pubKey, err := os.ReadFile(key + ".pub")
+		if err != nil {
+			t.Fatalf("Failed to read public key: %v", err)
+		}
+		if !strings.HasPrefix(string(pubKey), "ecdsa-sha2-nistp521") {
+			t.Errorf("Expected ECDSA cipher for key %s", key)
+		}
+	}
+}
+
+// TestRotateCmd_SubsetName tests that bare key names in the subset are looked for in ~/.ssh,
+// like in the other commands, wherever portunus runs from
+func TestRotateCmd_SubsetName(t *testing.T) {
+	// Set up test environment
+	tempDir, configPath := setupTestEnvironment(t)
+	sshDir := filepath.Join(tempDir, ".ssh")
+	key := filepath.Join(sshDir, "id_work")
+	generateCmdTestKey(t, key)
+	fingerprint, err := keys.PublicKeyFingerprint(key)
+	if err != nil {
+		t.Fatalf("Failed to fingerprint key: %v", err)
+	}
+
+	// Initialize the config
+	cfgFile = configPath
+	appConfig = &config.Config{
+		Keys: make(map[string]config.KeyConfig),
+	}
+	rootContext = context.Background()
+
+	// Set up command flags
+	rotateCipher = "ed25519"
+	rotateBackend = keys.BackendNative
+	rotateTime = "1h"
+	rotatePassword = "test"
+	rotateKeySubset = []string{"id_work"}
+
+	runRotateCmd(&cobra.Command{Use: "test"}, nil)
+
+	if got, _ := keys.PublicKeyFingerprint(key); got == fingerprint {
+		t.Errorf("Expected %s to be rotated", key)
+	}
+	if _, tracked := appConfig.Keys[key]; !tracked || len(appConfig.Keys) != 1 {
+		t.Errorf("Expected only %s to be tracked, got %v", key, appConfig.Keys)
+	}
+}
+
+// TestRotateCmd_CommentTemplate tests that per-key comment templates are applied and kept.
+func TestRotateCmd_CommentTemplate(t *testing.T) {
+	// Set up test environment
+	tempDir, configPath := setupTestEnvironment(t)
+	sshDir := filepath.Join(tempDir, ".ssh")
+
+	// Create test key files
+	key1, _ := testutil.CreateTestKeyPair(t, sshDir, "id_work")
+	key2, _ := testutil.CreateTestKeyPair(t, sshDir, "id_personal")
+
+	// Initialize the config, only the first key has a template
+	now := time.Now()
+	cfgFile = configPath
+	appConfig = &config.Config{
+		Keys: map[string]config.KeyConfig{
+			key1: {
+				CreatedAt:       now.Add(-48 * time.Hour),
+				ExpiresAt:       now.Add(-24 * time.Hour),
+				CommentTemplate: "{name} rotated {date}",
+			},
+		},
+	}
+
+	// Set up command flags
+	rotateCipher = "ed25519"
+	rotateBackend = keys.BackendNative
+	rotateTime = "1h"
+	rotatePassword = "test"
+	rotateKeySubset = []string{key1, key2}
+
+	// Initialize the context
+	rootContext = context.Background()
+
+	// Run the rotate command
+	runRotateCmd(&cobra.Command{Use: "test"}, nil)
+
+	_, comment, err := keys.ReadPublicKey(key1)
+	if err != nil {
+		t.Fatalf("Failed to read public key: %v", err)
+	}
+	if expected := "id_work rotated " + time.Now().Format(time.DateOnly); comment != expected {
+		t.Errorf("Expected comment %q, got %q", expected, comment)
+	}
+
+	_, comment, err = keys.ReadPublicKey(key2)
+	if err != nil {
+		t.Fatalf("Failed to read public key: %v", err)
+	}
+	if comment != "test@example.com" {
+		t.Errorf("Expected comment to be carried over, got %q", comment)
+	}
+
+	// The template survives the rotation
+	loadedConfig, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if loadedConfig.Keys[key1].CommentTemplate != "{name} rotated {date}" {
+		t.Errorf("Expected comment template to be kept, got %q", loadedConfig.Keys[key1].CommentTemplate)
+	}
+}
+
+// TestRotateCmd_KeepCipher tests that keep mode preserves each key's algorithm and records it.
+func TestRotateCmd_KeepCipher(t *testing.T) {
+	// Set up test environment
+	tempDir, configPath := setupTestEnvironment(t)
+	sshDir := filepath.Join(tempDir, ".ssh")
+
+	// Create an RSA key for a legacy appliance next to an ed25519 key
+	generator, err := keys.NewGenerator(keys.BackendNative)
+	if err != nil {
+		t.Fatalf("Failed to create generator: %v", err)
+	}
+	rsaKey := filepath.Join(sshDir, "id_legacy")
+	if err := generator.Generate(context.Background(), rsaKey, keys.KeySpec{Cipher: "rsa", Bits: 2048}); err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	edKey, _ := testutil.CreateTestKeyPair(t, sshDir, "id_ed25519")
+
+	// Initialize the config
+	cfgFile = configPath
+	appConfig = &config.Config{
+		Keys: make(map[string]config.KeyConfig),
+	}
+
+	// Set up command flags
+	rotateCipher = keys.CipherKeep
+	rotateBackend = keys.BackendNative
+	rotateTime = "1h"
+	rotatePassword = "test"
+	rotateKeySubset = []string{rsaKey, edKey}
+
+	// Initialize the context
+	rootContext = context.Background()
+
+	// Run the rotate command
+	runRotateCmd(&cobra.Command{Use: "test"}, nil)
+
+	loadedConfig, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	if kc := loadedConfig.Keys[rsaKey]; kc.Cipher != "rsa" || kc.Bits != 2048 {
+		t.Errorf("Expected rsa/2048 to be recorded for %s, got %s/%d", rsaKey, kc.Cipher, kc.Bits)
+	}
+	if kc := loadedConfig.Keys[edKey]; kc.Cipher != "ed25519" {
+		t.Errorf("Expected ed25519 to be recorded for %s, got %s", edKey, kc.Cipher)
+	}
+	if !usedCorrectCipher(rsaKey, "rsa") {
+		t.Errorf("Expected RSA cipher for key %s", rsaKey)
+	}
+	if !usedCorrectCipher(edKey, "ed25519") {
+		t.Errorf("Expected Ed25519 cipher for key %s", edKey)
+	}
+}
+
+// TestRotateCmd_PasswordStdin tests that the passphrase for new keys can be read from stdin.
+func TestRotateCmd_PasswordStdin(t *testing.T) {
+	// Set up test environment
+	tempDir, configPath := setupTestEnvironment(t)
+	sshDir := filepath.Join(tempDir, ".ssh")
+
+	// Create test key files
+	key, _ := testutil.CreateTestKeyPair(t, sshDir, "id_ed25519")
+
+	// Initialize the config
+	cfgFile = configPath
+	appConfig = &config.Config{
+		Keys: make(map[string]config.KeyConfig),
+	}
+
+	// Set up command flags, feeding the passphrase through stdin
+	stubPassphraseInput(t, "from-stdin\n", false)
+	rotateCipher = "ed25519"
+	rotateBackend = keys.BackendNative
+	rotateTime = "1h"
+	rotatePassword = ""
+	rotatePassStdin = true
+	rotateKeySubset = []string{key}
+	t.Cleanup(func() { rotatePassStdin = false })
+
+	// Initialize the context
+	rootContext = context.Background()
+
+	// Run the rotate command
+	runRotateCmd(&cobra.Command{Use: "test"}, nil)
+
+	privData, err := os.ReadFile(key)
+	if err != nil {
+		t.Fatalf("Failed to read private key: %v", err)
+	}
+	if _, err := ssh.ParsePrivateKeyWithPassphrase(privData, []byte("from-stdin")); err != nil {
+		t.Errorf("Expected new key to be encrypted with the stdin passphrase: %v", err)
+	}
+}
+
+// TestRotateCmd_PassphraseSources tests that keys with a passphrase source get their own passphrase.
+func TestRotateCmd_PassphraseSources(t *testing.T) {
+	// Set up test environment
+	tempDir, configPath := setupTestEnvironment(t)
+	sshDir := filepath.Join(tempDir, ".ssh")
+
+	// Create test key files
+	workKey, _ := testutil.CreateTestKeyPair(t, sshDir, "id_work")
+	deployKey, _ := testutil.CreateTestKeyPair(t, sshDir, "id_deploy")
+	secretFile := testutil.CreateTestFile(t, tempDir, "deploy-passphrase", "deploy-secret\n")
+	if err := os.Chmod(secretFile, 0600); err != nil {
+		t.Fatalf("Failed to chmod secret file: %v", err)
+	}
+	t.Setenv("PORTUNUS_TEST_WORK_PASSPHRASE", "work-secret")
+
+	// Initialize the config with a passphrase source per key
+	cfgFile = configPath
+	appConfig = &config.Config{
+		Keys: map[string]config.KeyConfig{
+			workKey:   {PassphraseSource: &config.PassphraseSource{Env: "PORTUNUS_TEST_WORK_PASSPHRASE"}},
+			deployKey: {PassphraseSource: &config.PassphraseSource{File: secretFile}},
+		},
+	}
+
+	// No shared passphrase is given and there is no terminal to prompt on
+	stubPassphraseInput(t, "", false)
+	rotateCipher = "ed25519"
+	rotateBackend = keys.BackendNative
+	rotateTime = "1h"
+	rotatePassword = ""
+	rotateKeySubset = []string{workKey, deployKey}
+
+	// Initialize the context
+	rootContext = context.Background()
+
+	// Run the rotate command
+	runRotateCmd(&cobra.Command{Use: "test"}, nil)
+
+	for key, passphrase := range map[string]string{workKey: "work-secret", deployKey: "deploy-secret"} {
+		privData, err := os.ReadFile(key)
+		if err != nil {
+			t.Fatalf("Failed to read private key: %v", err)
+		}
+		if _, err := ssh.ParsePrivateKeyWithPassphrase(privData, []byte(passphrase)); err != nil {
+			t.Errorf("Expected %s to be encrypted with its own passphrase: %v", key, err)
+		}
+	}
+
+	loadedConfig, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if loadedConfig.Keys[workKey].PassphraseSource == nil {
+		t.Error("Expected the passphrase source to be kept after rotation")
+	}
+}
+
+// TestRotateCmd_GeneratePassphrase tests that generated passphrases are stored and referenced in the config.
+func TestRotateCmd_GeneratePassphrase(t *testing.T) {
+	// Set up test environment
+	tempDir, configPath := setupTestEnvironment(t)
+	sshDir := filepath.Join(tempDir, ".ssh")
+	secretsDir := filepath.Join(tempDir, "secrets")
+	if err := os.MkdirAll(secretsDir, 0700); err != nil {
+		t.Fatalf("Failed to create secrets directory: %v", err)
+	}
+
+	// Create test key files
+	key, _ := testutil.CreateTestKeyPair(t, sshDir, "id_ed25519")
+
+	// Initialize the config with a command sink writing to the secrets directory
+	cfgFile = configPath
+	appConfig = &config.Config{
+		Keys: make(map[string]config.KeyConfig),
+		PassphraseSink: &config.PassphraseSink{
+			Command: "cat > " + secretsDir + "/{name}",
+		},
+	}
+
+	// Set up command flags
+	rotateCipher = "ed25519"
+	rotateBackend = keys.BackendNative
+	rotateTime = "1h"
+	rotatePassword = ""
+	rotateGenerate = true
+	rotateKeySubset = []string{key}
+	t.Cleanup(func() { rotateGenerate = false })
+
+	// Initialize the context
+	rootContext = context.Background()
+
+	// Run the rotate command
+	runRotateCmd(&cobra.Command{Use: "test"}, nil)
+
+	stored, err := os.ReadFile(filepath.Join(secretsDir, "id_ed25519"))
+	if err != nil {
+		t.Fatalf("Failed to read stored passphrase: %v", err)
+	}
+	privData, err := os.ReadFile(key)
+	if err != nil {
+		t.Fatalf("Failed to read private key: %v", err)
+	}
+	if _, err := ssh.ParsePrivateKeyWithPassphrase(privData, []byte(strings.TrimSpace(string(stored)))); err != nil {
+		t.Errorf("Expected new key to be encrypted with the stored passphrase: %v", err)
+	}
+
+	loadedConfig, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if ref := loadedConfig.Keys[key].PassphraseRef; ref != "command:id_ed25519" {
+		t.Errorf("Expected passphrase reference command:id_ed25519, got %q", ref)
+	}
+	if strings.Contains(mustReadFile(t, configPath), strings.TrimSpace(string(stored))) {
+		t.Error("Expected the passphrase itself not to be written to the config")
+	}
+}
+
+// mustReadFile returns the content of a file, failing the test on error
+func mustReadFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", path, err)
+	}
+	return string(data)
+}
+
+// TestRotateCmd_PassphrasePolicy tests that rotated keys record the hash needed to forbid passphrase reuse.
+func TestRotateCmd_PassphrasePolicy(t *testing.T) {
+	// Set up test environment
+	tempDir, configPath := setupTestEnvironment(t)
+	sshDir := filepath.Join(tempDir, ".ssh")
+
+	// Create test key files
+	key, _ := testutil.CreateTestKeyPair(t, sshDir, "id_ed25519")
+
+	// Initialize the config with a policy forbidding reuse
+	cfgFile = configPath
+	appConfig = &config.Config{
+		Keys:             make(map[string]config.KeyConfig),
+		PassphrasePolicy: &config.PassphrasePolicy{MinLength: 12, ForbidReuse: true},
+	}
+
+	// Set up command flags
+	rotateCipher = "ed25519"
+	rotateBackend = keys.BackendNative
+	rotateTime = "1h"
+	rotatePassword = "a long enough passphrase"
+	rotateKeySubset = []string{key}
+
+	// Initialize the context
+	rootContext = context.Background()
+
+	// Run the rotate command
+	runRotateCmd(&cobra.Command{Use: "test"}, nil)
+
+	// The same passphrase is now rejected for the next rotation
+	if err := checkPassphrase(key, rotatePassword); err == nil {
+		t.Error("Expected the previous passphrase to be rejected")
+	}
+	if strings.Contains(mustReadFile(t, configPath), rotatePassword) {
+		t.Error("Expected the passphrase itself not to be written to the config")
+	}
+}
+
+// TestRotateCmd_Agent tests that rotation swaps the retired key for the new one in the ssh-agent.
+func TestRotateCmd_Agent(t *testing.T) {
+	// Set up test environment with a running agent
+	tempDir, configPath := setupTestEnvironment(t)
+	sshDir := filepath.Join(tempDir, ".ssh")
+	keyring := startTestAgent(t)
+
+	// Create a test key and load it in the agent
+	generator, err := keys.NewGenerator(keys.BackendNative)
+	if err != nil {
+		t.Fatalf("Failed to create generator: %v", err)
+	}
+	key := filepath.Join(sshDir, "id_ed25519")
+	if err := generator.Generate(context.Background(), key, keys.KeySpec{Cipher: "ed25519"}); err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	oldFingerprint, err := keys.PublicKeyFingerprint(key)
+	if err != nil {
+		t.Fatalf("Failed to fingerprint key: %v", err)
+	}
+	if err := keys.NewAgent(keyring).Add(key, "", time.Time{}); err != nil {
+		t.Fatalf("Failed to load key in agent: %v", err)
+	}
+
+	// Initialize the config
+	cfgFile = configPath
+	appConfig = &config.Config{
+		Keys: make(map[string]config.KeyConfig),
+	}
+
+	// Set up command flags
+	rotateCipher = "ed25519"
+	rotateBackend = keys.BackendNative
+	rotateTime = "1h"
+	rotatePassword = "test"
+	rotateKeySubset = []string{key}
+
+	// Initialize the context
+	rootContext = context.Background()
+
+	// Run the rotate command
+	runRotateCmd(&cobra.Command{Use: "test"}, nil)
+
+	newFingerprint, err := keys.PublicKeyFingerprint(key)
+	if err != nil {
+		t.Fatalf("Failed to fingerprint key: %v", err)
+	}
+
+	loaded := agentFingerprints(t, keyring)
+	if loaded[oldFingerprint] {
+		t.Error("Expected the retired key to be removed from the agent")
+	}
+	if !loaded[newFingerprint] {
+		t.Error("Expected the new key to be loaded in the agent")
+	}
+}
+
+func TestRotateCmd_Distribute(t *testing.T) {
+	// Set up test environment with a remote host authorizing the key
+	tempDir, configPath := setupTestEnvironment(t)
+	sshDir := filepath.Join(tempDir, ".ssh")
+	server := testutil.StartSSHServer(t)
+
+	generator, err := keys.NewGenerator(keys.BackendNative)
+	if err != nil {
+		t.Fatalf("Failed to create generator: %v", err)
+	}
+	key := filepath.Join(sshDir, "id_ed25519")
+	if err := generator.Generate(context.Background(), key, keys.KeySpec{Cipher: "ed25519", Passphrase: "test"}); err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	oldKey, err := keys.LoadPublicKey(key)
+	if err != nil {
+		t.Fatalf("Failed to load public key: %v", err)
+	}
+	if err := os.WriteFile(server.AuthorizedKeysPath(), ssh.MarshalAuthorizedKey(oldKey), 0600); err != nil {
+		t.Fatalf("Failed to write authorized keys: %v", err)
+	}
+	knownHosts := filepath.Join(sshDir, "known_hosts")
+	if err := os.WriteFile(knownHosts, []byte(server.KnownHostsLine()), 0600); err != nil {
+		t.Fatalf("Failed to write known hosts: %v", err)
+	}
+
+	// Initialize the config with the host inventory of the key
+	cfgFile = configPath
+	appConfig = &config.Config{
+		Keys: map[string]config.KeyConfig{
+			key: {Hosts: []config.HostConfig{{Address: server.Addr, User: "alice"}}},
+		},
+	}
+
+	// Set up command flags
+	rotateCipher = "ed25519"
+	rotateBackend = keys.BackendNative
+	rotateTime = "1h"
+	rotatePassword = "test"
+	rotateNoRemote = false
+	rotateKeySubset = []string{key}
+
+	// Initialize the context
+	rootContext = context.Background()
+
+	// Run the rotate command
+	output := captureOutput(func() {
+		runRotateCmd(&cobra.Command{Use: "test"}, nil)
+	})
+	if !strings.Contains(output, "new key authorized on alice@"+server.Addr+", old key removed") {
+		t.Errorf("Expected the host to be updated, got output:\n%s", output)
+	}
+
+	newKey, err := keys.LoadPublicKey(key)
+	if err != nil {
+		t.Fatalf("Failed to load public key: %v", err)
+	}
+	data := mustReadFile(t, server.AuthorizedKeysPath())
+	if !keys.IsAuthorized([]byte(data), newKey) || keys.IsAuthorized([]byte(data), oldKey) {
+		t.Errorf("Expected only the new key to be authorized on the host, got:\n%s", data)
+	}
+
+	// The old key logged in to install the new one, which then logged in itself
+	logins := server.Logins()
+	if len(logins) == 0 || logins[0] != ssh.FingerprintSHA256(oldKey) || logins[len(logins)-1] != ssh.FingerprintSHA256(newKey) {
+		t.Errorf("Unexpected logins: %v", logins)
+	}
+
+	// The host inventory survives the rotation
+	if hosts := appConfig.Keys[key].Hosts; len(hosts) != 1 {
+		t.Errorf("Expected the host inventory to be kept, got %v", hosts)
+	}
+	// The old key was removed from every host
+	if retired := appConfig.Keys[key].Retired; len(retired) != 1 || retired[0].RemovedAt == nil {
+		t.Errorf("Expected the retired key to be recorded as removed, got %+v", retired)
+	}
+}
+
+// TestRotateCmd_Distribute_OldPassphrase tests logging in to the hosts with an old key
+// whose passphrase differs from the new one
+func TestRotateCmd_Distribute_OldPassphrase(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		generate bool
+		ref      string
+		hidden   []string
+	}{
+		// The old passphrase is asked for on the terminal
+		{name: "prompt", password: "new-secret", hidden: []string{"old-secret"}},
+		// The old passphrase is read back from the sink it was stored in
+		{name: "sink", generate: true, ref: "command:id_ed25519"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir, configPath := setupTestEnvironment(t)
+			sshDir := filepath.Join(tempDir, ".ssh")
+			server := testutil.StartSSHServer(t)
+
+			generator, err := keys.NewGenerator(keys.BackendNative)
+			if err != nil {
+				t.Fatalf("Failed to create generator: %v", err)
+			}
+			key := filepath.Join(sshDir, "id_ed25519")
+			if err := generator.Generate(context.Background(), key, keys.KeySpec{Cipher: "ed25519", Passphrase: "old-secret"}); err != nil {
+				t.Fatalf("Failed to generate key pair: %v", err)
+			}
+			oldKey, err := keys.LoadPublicKey(key)
+			if err != nil {
+				t.Fatalf("Failed to load public key: %v", err)
+			}
+			if err := os.WriteFile(server.AuthorizedKeysPath(), ssh.MarshalAuthorizedKey(oldKey), 0600); err != nil {
+				t.Fatalf("Failed to write authorized keys: %v", err)
+			}
+			if err := os.WriteFile(filepath.Join(sshDir, "known_hosts"), []byte(server.KnownHostsLine()), 0600); err != nil {
+				t.Fatalf("Failed to write known hosts: %v", err)
+			}
+
+			// The sink keeps the passphrase of the old key
+			secretDir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(secretDir, "id_ed25519"), []byte("old-secret\n"), 0600); err != nil {
+				t.Fatalf("Failed to write secret: %v", err)
+			}
+
+			cfgFile = configPath
+			appConfig = &config.Config{
+				Keys: map[string]config.KeyConfig{
+					key: {
+						Hosts:         []config.HostConfig{{Address: server.Addr, User: "alice"}},
+						PassphraseRef: tt.ref,
+					},
+				},
+				PassphraseSink: &config.PassphraseSink{
+					Command:       "cat > " + secretDir + "/{name}",
+					LookupCommand: "cat " + secretDir + "/{name}",
+				},
+			}
+			rootContext = context.Background()
+
+			rotateCipher = "ed25519"
+			rotateBackend = keys.BackendNative
+			rotateTime = "1h"
+			rotatePassword = tt.password
+			rotateGenerate = tt.generate
+			rotateNoRemote = false
+			rotateKeySubset = []string{key}
+			t.Cleanup(func() { rotatePassword, rotateGenerate = "test", false })
+			stubPassphraseInput(t, "", len(tt.hidden) > 0, tt.hidden...)
+
+			output := captureOutput(func() {
+				runRotateCmd(&cobra.Command{Use: "test"}, nil)
+			})
+			if !strings.Contains(output, "new key authorized on alice@"+server.Addr+", old key removed") {
+				t.Errorf("Expected the host to be updated, got output:\n%s", output)
+			}
+			logins := server.Logins()
+			if len(logins) == 0 || logins[0] != ssh.FingerprintSHA256(oldKey) {
+				t.Errorf("Expected the old key to log in first, got %v", logins)
+			}
+		})
+	}
+}
+
+func TestRotateCmd_Confirm(t *testing.T) {
+	// Set up test environment with an SSH config using the key
+	tempDir, configPath := setupTestEnvironment(t)
+	sshDir := filepath.Join(tempDir, ".ssh")
+	writeTestSSHConfig(t, sshDir)
+
+	key := filepath.Join(sshDir, "id_work")
+	generateCmdTestKey(t, key)
+	fingerprint, err := keys.PublicKeyFingerprint(key)
+	if err != nil {
+		t.Fatalf("Failed to fingerprint key: %v", err)
+	}
+
+	cfgFile = configPath
+	appConfig = &config.Config{
+		Keys: make(map[string]config.KeyConfig),
+	}
+	rootContext = context.Background()
+
+	// Set up command flags, prompting for the passphrase on a terminal
+	rotateCipher = "ed25519"
+	rotateBackend = keys.BackendNative
+	rotateTime = "1h"
+	rotatePassword = ""
+	rotateYes = false
+	rotateKeySubset = []string{key}
+	t.Cleanup(func() { rotatePassword = "test" })
+
+	// Declining leaves the key alone
+	stubPassphraseInput(t, "n\n", true)
+	output := captureOutput(func() {
+		runRotateCmd(&cobra.Command{Use: "test"}, nil)
+	})
+	if !strings.Contains(output, "\t[+] "+key+": github.com, bastion\n") {
+		t.Errorf("Expected the hosts using the key, got output:\n%s", output)
+	}
+	if !strings.Contains(output, "Rotation cancelled") {
+		t.Errorf("Expected the rotation to be cancelled, got output:\n%s", output)
+	}
+	if got, _ := keys.PublicKeyFingerprint(key); got != fingerprint {
+		t.Error("Expected the key not to be rotated")
+	}
+
+	// Confirming rotates it
+	stubPassphraseInput(t, "yes\n", true, "new-secret", "new-secret")
+	runRotateCmd(&cobra.Command{Use: "test"}, nil)
+	if got, _ := keys.PublicKeyFingerprint(key); got == fingerprint {
+		t.Error("Expected the key to be rotated")
+	}
+}
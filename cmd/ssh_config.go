@@ -0,0 +1,242 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/de-lachende-cavalier/portunus/pkg/keys"
+	"github.com/de-lachende-cavalier/portunus/pkg/logger"
+	"github.com/de-lachende-cavalier/portunus/pkg/sshconfig"
+)
+
+func init() {
+	rootCmd.AddCommand(sshConfigCmd)
+	sshConfigCmd.AddCommand(sshConfigRewriteCmd)
+	rootCmd.AddCommand(moveCmd)
+}
+
+var sshConfigCmd = &cobra.Command{
+	Use:   "ssh-config",
+	Short: "Show which Host blocks of the SSH client config use each tracked key",
+	Long: `Show the IdentityFile and CertificateFile lines of the SSH client config (~/.ssh/config
+unless ssh_config is set in the config file, and the files it includes) that refer to each
+tracked key, with the Host or Match block they belong to.`,
+	Run: runSSHConfigCmd,
+}
+
+var sshConfigRewriteCmd = &cobra.Command{
+	Use:   "rewrite <old> <new>",
+	Short: "Point the SSH client config to a key that was moved",
+	Long: `Replace the references to the key at <old>, its public key and its certificate in the
+IdentityFile and CertificateFile lines of the SSH client config with <new>, keeping the
+formatting and comments of the files. The key stays tracked under its new path.`,
+	Args:        cobra.ExactArgs(2),
+	Annotations: map[string]string{keepMissingKeysAnnotation: "true"},
+	Run:         runSSHConfigRewriteCmd,
+}
+
+var moveCmd = &cobra.Command{
+	Use:   "move <key> <new path>",
+	Short: "Move an SSH key and update the references to it",
+	Long: `Move a key pair and its certificate to a new path, keep it tracked under that path and
+point the IdentityFile and CertificateFile lines of the SSH client config to it.`,
+	Args: cobra.ExactArgs(2),
+	Run:  runMoveCmd,
+}
+
+// loadSSHConfig reads the SSH client config described by the configuration
+func loadSSHConfig() (*sshconfig.Config, error) {
+	path := appConfig.SSHConfig
+	if path == "" {
+		path = sshconfig.DefaultPath()
+	}
+
+	path, err := expandPath(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SSH config path: %w", err)
+	}
+	return sshconfig.Load(path)
+}
+
+// keyUsage maps keys to the blocks of the SSH client config using them.
+// An unreadable SSH config is only logged, leaving the usage of the keys unknown.
+func keyUsage(paths []string) map[string][]sshconfig.Usage {
+	sshConfig, err := loadSSHConfig()
+	if err != nil {
+		logger.Error(err, "Failed to read SSH config, the hosts using the keys are unknown")
+		return nil
+	}
+
+	for _, d := range sshConfig.Unresolved {
+		logger.Infof("Cannot resolve %s %s at %s: %v", d.Keyword, d.Value, d, d.Err)
+	}
+
+	usage := make(map[string][]sshconfig.Usage)
+	for _, path := range paths {
+		if u := sshConfig.Usage(path); len(u) > 0 {
+			usage[path] = u
+		}
+	}
+	return usage
+}
+
+// formatUsage lists the hosts a key is used for
+func formatUsage(usage []sshconfig.Usage) string {
+	hosts := make([]string, len(usage))
+	for i, u := range usage {
+		hosts[i] = u.String()
+	}
+	return strings.Join(hosts, ", ")
+}
+
+// runSSHConfigCmd lists the references of the SSH client config to each tracked key
+func runSSHConfigCmd(cmd *cobra.Command, args []string) {
+	sshConfig, err := loadSSHConfig()
+	if err != nil {
+		logger.Fatal(err, "Failed to read SSH config")
+	}
+
+	if len(appConfig.Keys) == 0 {
+		logger.Info("No tracked keys found")
+		fmt.Println("[+] No tracked keys found")
+		return
+	}
+
+	paths := make([]string, 0, len(appConfig.Keys))
+	for path := range appConfig.Keys {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		refs := sshConfig.References(path)
+		if len(refs) == 0 {
+			fmt.Printf("[-] %s is not used in the SSH config\n", path)
+			continue
+		}
+
+		fmt.Printf("[+] %s is used by:\n", path)
+		for _, ref := range refs {
+			block := ref.Block
+			if block == "" {
+				block = "all hosts"
+			}
+			fmt.Printf("\t[+] %s (%s %s, %s)\n", block, ref.Keyword, ref.Value, ref)
+		}
+	}
+
+	reportUnresolved(sshConfig)
+}
+
+// reportUnresolved lists the lines of the SSH client config whose paths ssh only resolves
+// when connecting, which may refer to any key
+func reportUnresolved(sshConfig *sshconfig.Config) {
+	for _, d := range sshConfig.Unresolved {
+		logger.Infof("Cannot resolve %s %s at %s: %v", d.Keyword, d.Value, d, d.Err)
+		fmt.Printf("[-] %s %s at %s cannot be resolved (%v), check it by hand\n", d.Keyword, d.Value, d, d.Err)
+	}
+}
+
+// runSSHConfigRewriteCmd points the SSH client config to a moved key
+func runSSHConfigRewriteCmd(cmd *cobra.Command, args []string) {
+	oldPath, err := resolveKeyPath(args[0])
+	if err != nil {
+		logger.Fatal(err, "Invalid key")
+	}
+	newPath, err := resolveKeyPath(args[1])
+	if err != nil {
+		logger.Fatal(err, "Invalid key")
+	}
+
+	if err := rewriteKeyReferences(oldPath, newPath); err != nil {
+		logger.Fatal(err, "Failed to update SSH config")
+	}
+
+	// The key is tracked under its new path once it is there
+	if _, tracked := appConfig.Keys[oldPath]; tracked && fileExists(newPath) {
+		appConfig.RenameKey(oldPath, newPath)
+		if err := appConfig.Save(cfgFile); err != nil {
+			logger.Fatal(err, "Failed to save configuration")
+		}
+		fmt.Printf("\t[+] %s is now tracked as %s\n", oldPath, newPath)
+	}
+}
+
+// rewriteKeyReferences points the references of the SSH client config from oldPath to newPath
+func rewriteKeyReferences(oldPath, newPath string) error {
+	sshConfig, err := loadSSHConfig()
+	if err != nil {
+		return err
+	}
+
+	rewritten := sshConfig.Rewrite(oldPath, newPath)
+	if err := sshConfig.Save(); err != nil {
+		return err
+	}
+
+	if len(rewritten) == 0 {
+		fmt.Printf("\t[+] %s is not used in the SSH config\n", oldPath)
+	}
+	for _, ref := range rewritten {
+		logger.Infof("Rewrote %s %s at %s", ref.Keyword, ref.Value, ref)
+		fmt.Printf("\t[+] %s now has %s %s\n", ref, ref.Keyword, ref.Value)
+	}
+	reportUnresolved(sshConfig)
+	return nil
+}
+
+// runMoveCmd moves a key pair and updates the references to it
+func runMoveCmd(cmd *cobra.Command, args []string) {
+	oldPath, err := resolveKeyPath(args[0])
+	if err != nil {
+		logger.Fatal(err, "Invalid key")
+	}
+	newPath, err := resolveKeyPath(args[1])
+	if err != nil {
+		logger.Fatal(err, "Invalid key")
+	}
+
+	if !fileExists(oldPath) {
+		logger.Fatal(fmt.Errorf("%s does not exist", oldPath), "Failed to move key")
+	}
+
+	// Move the private key last, so a failure leaves it where the references point
+	files := []string{keys.CertificatePath(oldPath), oldPath + ".pub", oldPath}
+	for _, from := range files {
+		to := newPath + from[len(oldPath):]
+		if _, err := os.Lstat(to); err == nil {
+			logger.Fatal(fmt.Errorf("%s already exists", to), "Failed to move key")
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(newPath), 0700); err != nil {
+		logger.Fatal(err, "Failed to create key directory")
+	}
+	for _, from := range files {
+		to := newPath + from[len(oldPath):]
+		if err := os.Rename(from, to); err != nil {
+			if errors.Is(err, os.ErrNotExist) && from != oldPath {
+				continue
+			}
+			logger.Fatal(err, "Failed to move key")
+		}
+		logger.Infof("Moved %s to %s", from, to)
+	}
+	fmt.Printf("[+] %s moved to %s\n", oldPath, newPath)
+
+	if _, tracked := appConfig.Keys[oldPath]; tracked {
+		appConfig.RenameKey(oldPath, newPath)
+		if err := appConfig.Save(cfgFile); err != nil {
+			logger.Fatal(err, "Failed to save configuration")
+		}
+	}
+
+	if err := rewriteKeyReferences(oldPath, newPath); err != nil {
+		logger.Fatal(err, "Failed to update SSH config")
+	}
+}
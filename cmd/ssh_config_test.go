@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/de-lachende-cavalier/portunus/pkg/config"
+)
+
+// writeTestSSHConfig writes an SSH client config using the key at ~/.ssh/id_work
+func writeTestSSHConfig(t *testing.T, sshDir string) {
+	t.Helper()
+	sshConfig := "Host github.com\n  # work account\n  IdentityFile ~/.ssh/id_work\n  CertificateFile ~/.ssh/id_work-cert.pub\n\nInclude hosts.conf\n"
+	if err := os.WriteFile(filepath.Join(sshDir, "config"), []byte(sshConfig), 0600); err != nil {
+		t.Fatalf("Failed to write SSH config: %v", err)
+	}
+	included := "Host bastion\n    IdentityFile=\"~/.ssh/id_work\"\n"
+	if err := os.WriteFile(filepath.Join(sshDir, "hosts.conf"), []byte(included), 0600); err != nil {
+		t.Fatalf("Failed to write SSH config: %v", err)
+	}
+}
+
+// TestSSHConfigCmd tests showing the Host blocks using tracked keys
+func TestSSHConfigCmd(t *testing.T) {
+	// Set up test environment
+	tempDir, configPath := setupTestEnvironment(t)
+	sshDir := filepath.Join(tempDir, ".ssh")
+	writeTestSSHConfig(t, sshDir)
+	included := mustReadFile(t, filepath.Join(sshDir, "hosts.conf")) + "Host *\n  IdentityFile ~/.ssh/id_%h\n"
+	if err := os.WriteFile(filepath.Join(sshDir, "hosts.conf"), []byte(included), 0600); err != nil {
+		t.Fatalf("Failed to write SSH config: %v", err)
+	}
+
+	key := filepath.Join(sshDir, "id_work")
+	unused := filepath.Join(sshDir, "id_unused")
+	cfgFile = configPath
+	appConfig = &config.Config{
+		Keys: map[string]config.KeyConfig{
+			key:    {CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour)},
+			unused: {CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour)},
+		},
+	}
+
+	output := captureOutput(func() {
+		runSSHConfigCmd(&cobra.Command{Use: "test"}, nil)
+	})
+	for _, want := range []string{
+		"Host github.com (IdentityFile ~/.ssh/id_work, " + filepath.Join(sshDir, "config") + ":3)",
+		"Host github.com (CertificateFile ~/.ssh/id_work-cert.pub, " + filepath.Join(sshDir, "config") + ":4)",
+		"Host bastion (IdentityFile ~/.ssh/id_work, " + filepath.Join(sshDir, "hosts.conf") + ":2)",
+		unused + " is not used in the SSH config",
+		// The key of every host could be any tracked key
+		"IdentityFile ~/.ssh/id_%h at " + filepath.Join(sshDir, "hosts.conf") + ":4 cannot be resolved",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected %q in output:\n%s", want, output)
+		}
+	}
+}
+
+// TestMoveCmd tests moving a key along with its tracking data and SSH config references
+func TestMoveCmd(t *testing.T) {
+	// Set up test environment
+	tempDir, configPath := setupTestEnvironment(t)
+	sshDir := filepath.Join(tempDir, ".ssh")
+	writeTestSSHConfig(t, sshDir)
+
+	key := filepath.Join(sshDir, "id_work")
+	generateCmdTestKey(t, key)
+	if err := os.WriteFile(key+"-cert.pub", []byte("certificate\n"), 0644); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+
+	cfgFile = configPath
+	appConfig = &config.Config{
+		Keys: map[string]config.KeyConfig{
+			key: {CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour), CommentTemplate: "{user}"},
+		},
+		Publishers: []config.PublisherConfig{{Provider: "github", Keys: []string{"id_work"}}},
+	}
+	rootContext = context.Background()
+
+	newKey := filepath.Join(sshDir, "work", "id_work_2025")
+	output := captureOutput(func() {
+		runMoveCmd(&cobra.Command{Use: "test"}, []string{"id_work", newKey})
+	})
+	if !strings.Contains(output, filepath.Join(sshDir, "hosts.conf")+":2 now has IdentityFile ~/.ssh/work/id_work_2025") {
+		t.Errorf("Expected the included reference to be reported, got output:\n%s", output)
+	}
+
+	for _, suffix := range []string{"", ".pub", "-cert.pub"} {
+		if fileExists(key + suffix) {
+			t.Errorf("Expected %s to be moved", key+suffix)
+		}
+		if !fileExists(newKey + suffix) {
+			t.Errorf("Expected %s to exist", newKey+suffix)
+		}
+	}
+
+	if _, tracked := appConfig.Keys[key]; tracked || appConfig.Keys[newKey].CommentTemplate != "{user}" {
+		t.Errorf("Expected the key to be tracked under its new path, got %v", appConfig.Keys)
+	}
+	if got := appConfig.Publishers[0].Keys; len(got) != 1 || got[0] != "~/.ssh/work/id_work_2025" {
+		t.Errorf("Expected the publisher to list the moved key, got %v", got)
+	}
+
+	want := "Host github.com\n  # work account\n  IdentityFile ~/.ssh/work/id_work_2025\n  CertificateFile ~/.ssh/work/id_work_2025-cert.pub\n\nInclude hosts.conf\n"
+	if data := mustReadFile(t, filepath.Join(sshDir, "config")); data != want {
+		t.Errorf("Unexpected SSH config:\n%s\nwant:\n%s", data, want)
+	}
+	want = "Host bastion\n    IdentityFile=\"~/.ssh/work/id_work_2025\"\n"
+	if data := mustReadFile(t, filepath.Join(sshDir, "hosts.conf")); data != want {
+		t.Errorf("Unexpected included SSH config:\n%s\nwant:\n%s", data, want)
+	}
+}
+
+// TestSSHConfigRewriteCmd tests updating the SSH config after a key was moved by hand
+func TestSSHConfigRewriteCmd(t *testing.T) {
+	// Set up test environment
+	tempDir, configPath := setupTestEnvironment(t)
+	sshDir := filepath.Join(tempDir, ".ssh")
+	writeTestSSHConfig(t, sshDir)
+
+	key := filepath.Join(sshDir, "id_work")
+	newKey := filepath.Join(sshDir, "id_work_new")
+	generateCmdTestKey(t, newKey)
+
+	cfgFile = configPath
+	appConfig = &config.Config{
+		Keys: map[string]config.KeyConfig{
+			key: {CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour)},
+		},
+	}
+
+	runSSHConfigRewriteCmd(&cobra.Command{Use: "test"}, []string{"id_work", "id_work_new"})
+
+	if data := mustReadFile(t, filepath.Join(sshDir, "config")); !strings.Contains(data, "IdentityFile ~/.ssh/id_work_new\n") {
+		t.Errorf("Expected the reference to be rewritten, got:\n%s", data)
+	}
+	if _, tracked := appConfig.Keys[newKey]; !tracked {
+		t.Error("Expected the key to be tracked under its new path")
+	}
+}
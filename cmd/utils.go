@@ -1,9 +1,15 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+
+	"github.com/de-lachende-cavalier/portunus/pkg/config"
+	"github.com/de-lachende-cavalier/portunus/pkg/keys"
+	"github.com/de-lachende-cavalier/portunus/pkg/logger"
+	"github.com/de-lachende-cavalier/portunus/pkg/remote"
 )
 
 // expandPath expands a path with ~ to the user's home directory
@@ -32,3 +38,75 @@ func fileExists(path string) bool {
 	}
 	return !info.IsDir()
 }
+
+// resolveKeyPath expands a key given on the command line to a full path.
+// Bare key names are assumed to live in ~/.ssh.
+func resolveKeyPath(key string) (string, error) {
+	return config.ResolveKeyPath(key)
+}
+
+// keyRoots returns the key directories declared in the configuration.
+// An empty result makes the key manager fall back to ~/.ssh.
+func keyRoots() ([]keys.Root, error) {
+	var roots []keys.Root
+	for _, root := range appConfig.KeyRoots {
+		dir, err := expandPath(root.Path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key root %q: %w", root.Path, err)
+		}
+
+		roots = append(roots, keys.Root{
+			Dir:       dir,
+			Recursive: root.Recursive,
+			Include:   root.Include,
+			Exclude:   root.Exclude,
+		})
+	}
+	return roots, nil
+}
+
+// connectAgent connects to the running ssh-agent, returning nil when there is none
+func connectAgent() *keys.Agent {
+	agent, err := keys.ConnectAgent()
+	if errors.Is(err, keys.ErrNoAgent) {
+		logger.Debugf("Not updating ssh-agent: %v", err)
+		return nil
+	}
+	if err != nil {
+		logger.Error(err, "Failed to connect to ssh-agent, it will not be updated")
+		return nil
+	}
+	return agent
+}
+
+// newDistributor returns a distributor for the keys with hosts in the config, or nil when there are none
+func newDistributor() (*remote.Distributor, error) {
+	inventory := make(map[string][]remote.Host)
+	for path, keyConfig := range appConfig.Keys {
+		for _, host := range keyConfig.Hosts {
+			inventory[path] = append(inventory[path], remote.Host{
+				Address:        host.Address,
+				User:           host.User,
+				AuthorizedKeys: host.AuthorizedKeys,
+			})
+		}
+	}
+	if len(inventory) == 0 {
+		return nil, nil
+	}
+
+	knownHosts := appConfig.KnownHosts
+	if knownHosts == "" {
+		knownHosts = filepath.Join("~", ".ssh", "known_hosts")
+	}
+	knownHosts, err := expandPath(knownHosts)
+	if err != nil {
+		return nil, fmt.Errorf("invalid known hosts path: %w", err)
+	}
+
+	hostKeyCallback, err := remote.KnownHosts(knownHosts)
+	if err != nil {
+		return nil, err
+	}
+	return remote.NewDistributor(inventory, hostKeyCallback)
+}
@@ -6,6 +6,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/de-lachende-cavalier/portunus/pkg/config"
 	"github.com/de-lachende-cavalier/portunus/pkg/testutil"
 )
 
@@ -154,3 +155,90 @@ func Test_fileExists(t *testing.T) {
 		t.Errorf("Expected directory %s to not be reported as a file", tempDir)
 	}
 }
+
+// Test resolveKeyPath function
+func Test_resolveKeyPath(t *testing.T) {
+	// Create a temporary directory for testing
+	tempDir := testutil.TempDir(t)
+
+	// Set the HOME environment variable to the test directory
+	originalHome := os.Getenv("HOME")
+	defer os.Setenv("HOME", originalHome)
+	os.Setenv("HOME", tempDir)
+
+	// Bare key names live in ~/.ssh
+	path, err := resolveKeyPath("id_ed25519")
+	if err != nil {
+		t.Fatalf("Failed to resolve key path: %v", err)
+	}
+	expected := filepath.Join(tempDir, ".ssh", "id_ed25519")
+	if path != expected {
+		t.Errorf("Expected path %s, got %s", expected, path)
+	}
+
+	// Paths starting with ~ are expanded
+	path, err = resolveKeyPath("~/keys/deploy")
+	if err != nil {
+		t.Fatalf("Failed to resolve key path: %v", err)
+	}
+	expected = filepath.Join(tempDir, "keys", "deploy")
+	if path != expected {
+		t.Errorf("Expected path %s, got %s", expected, path)
+	}
+
+	// Absolute paths are kept as they are
+	path, err = resolveKeyPath("/absolute/key")
+	if err != nil {
+		t.Fatalf("Failed to resolve key path: %v", err)
+	}
+	if path != "/absolute/key" {
+		t.Errorf("Expected path /absolute/key, got %s", path)
+	}
+}
+
+// Test keyRoots function
+func Test_keyRoots(t *testing.T) {
+	// Create a temporary directory for testing
+	tempDir := testutil.TempDir(t)
+
+	// Set the HOME environment variable to the test directory
+	originalHome := os.Getenv("HOME")
+	defer os.Setenv("HOME", originalHome)
+	os.Setenv("HOME", tempDir)
+
+	// Without configured roots the key manager falls back to ~/.ssh
+	appConfig = &config.Config{}
+	roots, err := keyRoots()
+	if err != nil {
+		t.Fatalf("Failed to get key roots: %v", err)
+	}
+	if len(roots) != 0 {
+		t.Errorf("Expected no key roots, got %d", len(roots))
+	}
+
+	appConfig = &config.Config{
+		KeyRoots: []config.KeyRoot{
+			{Path: "~/.ssh/work", Recursive: true, Exclude: []string{"*.bak"}},
+			{Path: "/srv/deploy", Include: []string{"deploy_*"}},
+		},
+	}
+	roots, err = keyRoots()
+	if err != nil {
+		t.Fatalf("Failed to get key roots: %v", err)
+	}
+	if len(roots) != 2 {
+		t.Fatalf("Expected 2 key roots, got %d", len(roots))
+	}
+	if roots[0].Dir != filepath.Join(tempDir, ".ssh", "work") || !roots[0].Recursive {
+		t.Errorf("Expected recursive root in ~/.ssh/work, got %+v", roots[0])
+	}
+	if roots[1].Dir != "/srv/deploy" || len(roots[1].Include) != 1 {
+		t.Errorf("Expected root /srv/deploy with include patterns, got %+v", roots[1])
+	}
+
+	// Roots must have a path
+	appConfig = &config.Config{KeyRoots: []config.KeyRoot{{}}}
+	if _, err := keyRoots(); err == nil {
+		t.Error("Expected error for empty key root path, got nil")
+	}
+}
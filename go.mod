@@ -5,6 +5,8 @@ go 1.22.6
 require (
 	github.com/rs/zerolog v1.32.0
 	github.com/spf13/cobra v1.8.1
+	golang.org/x/crypto v0.26.0
+	golang.org/x/term v0.23.0
 )
 
 require (
@@ -3,8 +3,11 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
@@ -12,11 +15,193 @@ import (
 type KeyConfig struct {
 	CreatedAt time.Time `json:"created_at"`
 	ExpiresAt time.Time `json:"expires_at"`
+	// Cipher and Bits record the algorithm and size the key was generated with
+	Cipher string `json:"cipher,omitempty"`
+	Bits   int    `json:"bits,omitempty"`
+	// CommentTemplate sets the comment of the key when it is rotated,
+	// e.g. "{user}@{hostname} rotated {date}"; the old comment is kept when empty
+	CommentTemplate string `json:"comment_template,omitempty"`
+	// PassphraseSource is where the passphrase of the key is read from when it is rotated
+	PassphraseSource *PassphraseSource `json:"passphrase_source,omitempty"`
+	// PassphraseRef references the generated passphrase of the key in the passphrase sink
+	PassphraseRef string `json:"passphrase_ref,omitempty"`
+	// PassphraseChangedAt is when the passphrase was last changed without rotating the key
+	PassphraseChangedAt *time.Time `json:"passphrase_changed_at,omitempty"`
+	// PassphraseHash is a salted hash of the current passphrase, kept to forbid its reuse
+	PassphraseHash string `json:"passphrase_hash,omitempty"`
+	// Certified keys get a certificate from the local CA, reissued whenever they are renewed or rotated
+	Certified bool `json:"certified,omitempty"`
+	// Principals are the user names the key's certificate is valid for (default: CA principals)
+	Principals []string `json:"principals,omitempty"`
+	// Certificate describes the certificate the key's dates were imported from
+	Certificate *CertificateConfig `json:"certificate,omitempty"`
+	// Hosts are the remote hosts the key gives access to, updated when it is rotated
+	Hosts []HostConfig `json:"hosts,omitempty"`
+	// Retired lists the public keys the key replaced, to remove from its hosts
+	Retired []RetiredKeyConfig `json:"retired,omitempty"`
+}
+
+// RetiredKeyConfig represents a public key retired by a rotation
+type RetiredKeyConfig struct {
+	// PublicKey is the retired key in authorized_keys format
+	PublicKey   string    `json:"public_key"`
+	Fingerprint string    `json:"fingerprint"`
+	RetiredAt   time.Time `json:"retired_at"`
+	// RemovedAt is when the key was last removed from every host of the inventory
+	RemovedAt *time.Time `json:"removed_at,omitempty"`
+}
+
+// HostConfig represents a remote host a key is authorized on
+type HostConfig struct {
+	// Address is the host name, optionally followed by :port (default 22)
+	Address string `json:"address"`
+	// User is the remote user name (default: the current user)
+	User string `json:"user,omitempty"`
+	// AuthorizedKeys is the path of the authorized_keys file on the host (default ~/.ssh/authorized_keys)
+	AuthorizedKeys string `json:"authorized_keys,omitempty"`
+}
+
+// CertificateConfig describes an SSH certificate issued for a key by another CA
+type CertificateConfig struct {
+	KeyID      string   `json:"key_id,omitempty"`
+	Principals []string `json:"principals,omitempty"`
+	Serial     uint64   `json:"serial,omitempty"`
+	// Authority is the SHA256 fingerprint of the CA that signed the certificate
+	Authority   string    `json:"authority,omitempty"`
+	ValidAfter  time.Time `json:"valid_after"`
+	ValidBefore time.Time `json:"valid_before"`
+}
+
+// PassphraseSource represents where a key's passphrase is read from.
+// Exactly one of its fields should be set.
+type PassphraseSource struct {
+	// Env is the name of an environment variable holding the passphrase
+	Env string `json:"env,omitempty"`
+	// File is the path of a file holding the passphrase
+	File string `json:"file,omitempty"`
+	// Command is a shell command printing the passphrase, e.g. "pass show ssh/work"
+	Command string `json:"command,omitempty"`
+}
+
+// KeyStatus describes the state of a tracked key
+type KeyStatus string
+
+// Possible states of a tracked key
+const (
+	StatusValid        KeyStatus = "valid"
+	StatusExpiringSoon KeyStatus = "expiring soon"
+	StatusExpired      KeyStatus = "expired"
+	StatusMissing      KeyStatus = "missing"
+)
+
+// ArchiveConfig represents the configuration of the archive of retired keys
+type ArchiveConfig struct {
+	// Dir is where retired keys are moved to (default ~/.ssh/.portunus-archive)
+	Dir string `json:"dir,omitempty"`
+	// Retention is how long retired keys are kept, e.g. "90d" ("0" keeps them forever)
+	Retention string `json:"retention,omitempty"`
+}
+
+// CAConfig represents the configuration of the local user certificate authority
+type CAConfig struct {
+	// Dir is where the CA key is kept (default ~/.ssh/.portunus-ca)
+	Dir string `json:"dir,omitempty"`
+	// PassphraseSource is where the passphrase of the CA key is read from
+	PassphraseSource *PassphraseSource `json:"passphrase_source,omitempty"`
+	// Principals are the default user names certificates are valid for (default: the current user)
+	Principals []string `json:"principals,omitempty"`
+}
+
+// KRLConfig represents the configuration of the revocation list of retired keys
+type KRLConfig struct {
+	// Path is where the binary KRL is kept (default ~/.ssh/portunus.krl)
+	Path string `json:"path,omitempty"`
+}
+
+// AuthorizedKeysConfig represents the local authorized_keys files that enforce the expiration of tracked keys
+type AuthorizedKeysConfig struct {
+	// Files get an expiry-time option on the lines of tracked keys (e.g. ~/.ssh/authorized_keys)
+	Files []string `json:"files,omitempty"`
+}
+
+// PublisherConfig represents a Git hosting account the public keys of rotated keys are uploaded to
+type PublisherConfig struct {
+	// Provider is the hosting service: github, gitlab or gitea
+	Provider string `json:"provider"`
+	// Address is the API URL (default https://api.github.com for github, https://gitlab.com for gitlab)
+	Address string `json:"address,omitempty"`
+	// Token is where the access token of the account is read from
+	Token *PassphraseSource `json:"token"`
+	// Keys are the tracked keys published to the account
+	Keys []string `json:"keys"`
+	// Title names uploaded keys, with the placeholders of comment templates (default "{user}@{hostname} {name} {date}")
+	Title string `json:"title,omitempty"`
+}
+
+// PassphraseSink represents the secret manager generated passphrases are stored in.
+// Exactly one of Command and Vault should be set.
+type PassphraseSink struct {
+	// Prefix is prepended to the key's file name to form the secret name, e.g. "ssh/"
+	Prefix string `json:"prefix,omitempty"`
+	// Command reads the passphrase from stdin, e.g. "pass insert -m -f {name}"
+	Command string `json:"command,omitempty"`
+	// LookupCommand prints a stored passphrase, e.g. "pass show {name}"
+	LookupCommand string `json:"lookup_command,omitempty"`
+	// Vault stores passphrases in a KV v2 secrets engine
+	Vault *VaultConfig `json:"vault,omitempty"`
+}
+
+// VaultConfig represents a KV v2 secrets engine
+type VaultConfig struct {
+	// Address is the server URL (default $VAULT_ADDR)
+	Address string `json:"address,omitempty"`
+	// Mount is the path the engine is mounted at (default "secret")
+	Mount string `json:"mount,omitempty"`
+	// Field is the key the passphrase is stored under (default "passphrase")
+	Field string `json:"field,omitempty"`
+	// TokenEnv is the environment variable holding the token (default VAULT_TOKEN)
+	TokenEnv string `json:"token_env,omitempty"`
+}
+
+// PassphrasePolicy represents the rules new passphrases must follow
+type PassphrasePolicy struct {
+	// MinLength is the minimum number of characters
+	MinLength int `json:"min_length,omitempty"`
+	// MinEntropy is the minimum estimated entropy in bits
+	MinEntropy float64 `json:"min_entropy,omitempty"`
+	// ForbidEmpty rejects empty passphrases, which leave keys unencrypted
+	ForbidEmpty bool `json:"forbid_empty,omitempty"`
+	// ForbidReuse rejects a key's previous passphrase
+	ForbidReuse bool `json:"forbid_reuse,omitempty"`
+}
+
+// KeyRoot represents a directory searched for private keys
+type KeyRoot struct {
+	Path      string   `json:"path"`
+	Recursive bool     `json:"recursive,omitempty"`
+	Include   []string `json:"include,omitempty"`
+	Exclude   []string `json:"exclude,omitempty"`
 }
 
 // Config represents the application configuration
 type Config struct {
-	Keys map[string]KeyConfig `json:"keys"`
+	Keys     map[string]KeyConfig `json:"keys"`
+	KeyRoots []KeyRoot            `json:"key_roots,omitempty"`
+	Archive  ArchiveConfig        `json:"archive"`
+	CA       CAConfig             `json:"ca"`
+	KRL      KRLConfig            `json:"krl"`
+	// AuthorizedKeys are the local authorized_keys files expiration dates are written to
+	AuthorizedKeys AuthorizedKeysConfig `json:"authorized_keys"`
+	// SSHConfig is the SSH client configuration referring to keys (default ~/.ssh/config)
+	SSHConfig string `json:"ssh_config,omitempty"`
+	// KnownHosts is the known_hosts file host keys are checked against (default ~/.ssh/known_hosts)
+	KnownHosts string `json:"known_hosts,omitempty"`
+	// Publishers are the Git hosting accounts rotated public keys are uploaded to
+	Publishers []PublisherConfig `json:"publishers,omitempty"`
+	// PassphraseSink is where passphrases generated during rotation are stored
+	PassphraseSink *PassphraseSink `json:"passphrase_sink,omitempty"`
+	// PassphrasePolicy is enforced on the passphrases of rotated keys
+	PassphrasePolicy *PassphrasePolicy `json:"passphrase_policy,omitempty"`
 }
 
 // DefaultConfigPath returns the default path for the config file
@@ -28,6 +213,45 @@ func DefaultConfigPath() string {
 	return filepath.Join(homeDir, ".portunus.json")
 }
 
+// ResolveKeyPath expands a reference to a key, as given on the command line or in the
+// config file, to a full path. Bare key names are assumed to live in ~/.ssh.
+func ResolveKeyPath(key string) (string, error) {
+	if key == "" {
+		return "", errors.New("empty path")
+	}
+	if filepath.Base(key) == key && key != "~" {
+		key = filepath.Join("~", ".ssh", key)
+	}
+
+	if key[0] == '~' {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to get home directory: %w", err)
+		}
+		key = filepath.Join(homeDir, key[1:])
+	}
+
+	return filepath.Abs(key)
+}
+
+// keyReference returns a reference to the key at path in the style of ref:
+// references relative to the home directory stay so when the key is under it
+func keyReference(ref, path string) string {
+	if filepath.Base(ref) == ref {
+		if resolved, err := ResolveKeyPath(filepath.Base(path)); err == nil && resolved == path {
+			return filepath.Base(path)
+		}
+	}
+	if filepath.Base(ref) == ref || strings.HasPrefix(ref, "~") {
+		if homeDir, err := os.UserHomeDir(); err == nil {
+			if rel, err := filepath.Rel(homeDir, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				return filepath.Join("~", rel)
+			}
+		}
+	}
+	return path
+}
+
 // Load loads the configuration from the specified path
 func Load(path string) (*Config, error) {
 	if path == "" {
@@ -72,12 +296,149 @@ func (c *Config) Save(path string) error {
 	return os.WriteFile(path, data, 0600)
 }
 
-// AddKey adds a key to the configuration
+// AddKey adds a key to the configuration, keeping the settings of an already tracked key
 func (c *Config) AddKey(path string, createdAt, expiresAt time.Time) {
-	c.Keys[path] = KeyConfig{
-		CreatedAt: createdAt,
-		ExpiresAt: expiresAt,
+	keyConfig := c.Keys[path]
+	keyConfig.CreatedAt = createdAt
+	keyConfig.ExpiresAt = expiresAt
+	keyConfig.PassphraseChangedAt = nil
+	keyConfig.Certificate = nil
+	c.Keys[path] = keyConfig
+}
+
+// ImportCertificate tracks a key with the validity window of its certificate,
+// keeping the settings of an already tracked key
+func (c *Config) ImportCertificate(path string, cert CertificateConfig) {
+	keyConfig := c.Keys[path]
+	keyConfig.CreatedAt = cert.ValidAfter
+	keyConfig.ExpiresAt = cert.ValidBefore
+	keyConfig.Certificate = &cert
+	c.Keys[path] = keyConfig
+}
+
+// SetKeyAlgorithm records the algorithm and size of a tracked key
+func (c *Config) SetKeyAlgorithm(path, cipher string, bits int) {
+	keyConfig, exists := c.Keys[path]
+	if !exists {
+		return
+	}
+	keyConfig.Cipher = cipher
+	keyConfig.Bits = bits
+	c.Keys[path] = keyConfig
+}
+
+// SetPassphraseRef records where the passphrase of a tracked key is stored
+func (c *Config) SetPassphraseRef(path, ref string) {
+	keyConfig, exists := c.Keys[path]
+	if !exists {
+		return
+	}
+	keyConfig.PassphraseRef = ref
+	c.Keys[path] = keyConfig
+}
+
+// SetPassphraseChanged records that the passphrase of a tracked key was changed.
+// ref references the new passphrase in the passphrase sink, if it was stored there.
+func (c *Config) SetPassphraseChanged(path string, changedAt time.Time, ref string) {
+	keyConfig, exists := c.Keys[path]
+	if !exists {
+		return
+	}
+	keyConfig.PassphraseChangedAt = &changedAt
+	keyConfig.PassphraseRef = ref
+	c.Keys[path] = keyConfig
+}
+
+// SetPassphraseHash records the hash of the current passphrase of a tracked key
+func (c *Config) SetPassphraseHash(path, hash string) {
+	keyConfig, exists := c.Keys[path]
+	if !exists {
+		return
+	}
+	keyConfig.PassphraseHash = hash
+	c.Keys[path] = keyConfig
+}
+
+// SetCertified marks a tracked key as certified by the local CA, whose certificate
+// replaces any imported one. principals replace the key's principals when not empty.
+func (c *Config) SetCertified(path string, principals []string) {
+	keyConfig, exists := c.Keys[path]
+	if !exists {
+		return
+	}
+	keyConfig.Certified = true
+	keyConfig.Certificate = nil
+	if len(principals) > 0 {
+		keyConfig.Principals = principals
 	}
+	c.Keys[path] = keyConfig
+}
+
+// RetireKey records a public key retired by a tracked key, unless it is already recorded
+func (c *Config) RetireKey(path string, retired RetiredKeyConfig) {
+	keyConfig, exists := c.Keys[path]
+	if !exists {
+		return
+	}
+	for _, r := range keyConfig.Retired {
+		if r.Fingerprint == retired.Fingerprint {
+			return
+		}
+	}
+	keyConfig.Retired = append(keyConfig.Retired, retired)
+	c.Keys[path] = keyConfig
+}
+
+// UnretireKey forgets a retired public key of a tracked key, e.g. once it is restored
+func (c *Config) UnretireKey(path, fingerprint string) {
+	keyConfig, exists := c.Keys[path]
+	if !exists {
+		return
+	}
+	retired := keyConfig.Retired[:0]
+	for _, r := range keyConfig.Retired {
+		if r.Fingerprint != fingerprint {
+			retired = append(retired, r)
+		}
+	}
+	keyConfig.Retired = retired
+	if len(keyConfig.Retired) == 0 {
+		keyConfig.Retired = nil
+	}
+	c.Keys[path] = keyConfig
+}
+
+// SetRetiredKeyRemoved records when a retired public key was removed from every host of a tracked key
+func (c *Config) SetRetiredKeyRemoved(path, fingerprint string, removedAt time.Time) {
+	keyConfig, exists := c.Keys[path]
+	if !exists {
+		return
+	}
+	for i := range keyConfig.Retired {
+		if keyConfig.Retired[i].Fingerprint == fingerprint {
+			keyConfig.Retired[i].RemovedAt = &removedAt
+		}
+	}
+	c.Keys[path] = keyConfig
+}
+
+// RenameKey moves the settings of a tracked key to its new path,
+// and points the publishers listing the key to it
+func (c *Config) RenameKey(oldPath, newPath string) {
+	for i := range c.Publishers {
+		for j, ref := range c.Publishers[i].Keys {
+			if path, err := ResolveKeyPath(ref); err == nil && path == oldPath {
+				c.Publishers[i].Keys[j] = keyReference(ref, newPath)
+			}
+		}
+	}
+
+	keyConfig, exists := c.Keys[oldPath]
+	if !exists {
+		return
+	}
+	delete(c.Keys, oldPath)
+	c.Keys[newPath] = keyConfig
 }
 
 // RemoveKey removes a key from the configuration
@@ -99,6 +460,24 @@ func (c *Config) GetExpiredKeys() []string {
 	return expired
 }
 
+// KeyStatus returns the status of a tracked key at the given time.
+// Keys expiring within soon are reported as expiring soon.
+func (c *Config) KeyStatus(path string, now time.Time, soon time.Duration) KeyStatus {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return StatusMissing
+	}
+
+	keyConfig := c.Keys[path]
+	switch {
+	case now.After(keyConfig.ExpiresAt):
+		return StatusExpired
+	case now.Add(soon).After(keyConfig.ExpiresAt):
+		return StatusExpiringSoon
+	default:
+		return StatusValid
+	}
+}
+
 // CleanNonExistentKeys removes keys that no longer exist from the configuration
 func (c *Config) CleanNonExistentKeys() {
 	for path := range c.Keys {
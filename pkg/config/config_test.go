@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -92,6 +93,24 @@ func TestConfig_AddAndRemoveKey(t *testing.T) {
 		}
 	}
 
+	// Re-adding a tracked key keeps its other settings
+	cfg.Keys[keyPath] = KeyConfig{CreatedAt: now, ExpiresAt: expiry, CommentTemplate: "{user}@{hostname}"}
+	cfg.AddKey(keyPath, now.Add(time.Hour), expiry.Add(time.Hour))
+	if cfg.Keys[keyPath].CommentTemplate != "{user}@{hostname}" {
+		t.Errorf("Expected comment template to be kept, got %q", cfg.Keys[keyPath].CommentTemplate)
+	}
+	if !cfg.Keys[keyPath].ExpiresAt.Equal(expiry.Add(time.Hour)) {
+		t.Errorf("Expected ExpiresAt %v, got %v", expiry.Add(time.Hour), cfg.Keys[keyPath].ExpiresAt)
+	}
+
+	// Rename the key, keeping its settings
+	movedPath := "/home/user/.ssh/keys/id_ed25519"
+	cfg.RenameKey(keyPath, movedPath)
+	if _, ok := cfg.Keys[keyPath]; ok || cfg.Keys[movedPath].CommentTemplate != "{user}@{hostname}" {
+		t.Errorf("Expected the key to be moved to %s, got %v", movedPath, cfg.Keys)
+	}
+	cfg.RenameKey(movedPath, keyPath)
+
 	// Remove the key
 	cfg.RemoveKey(keyPath)
 
@@ -106,6 +125,132 @@ func TestConfig_AddAndRemoveKey(t *testing.T) {
 	}
 }
 
+// TestConfig_RenameKey_Publishers tests pointing publishers to a moved key
+func TestConfig_RenameKey_Publishers(t *testing.T) {
+	homeDir := testutil.TempDir(t)
+	t.Setenv("HOME", homeDir)
+
+	keyPath := filepath.Join(homeDir, ".ssh", "id_work")
+	cfg := &Config{
+		Keys: map[string]KeyConfig{keyPath: {CommentTemplate: "{user}"}},
+		Publishers: []PublisherConfig{
+			{Provider: "github", Keys: []string{"id_work", "id_personal"}},
+			{Provider: "gitlab", Keys: []string{"~/.ssh/id_work"}},
+			{Provider: "gitea", Keys: []string{keyPath}},
+		},
+	}
+
+	tests := []struct {
+		newPath string
+		want    [][]string
+	}{
+		{
+			newPath: filepath.Join(homeDir, ".ssh", "id_work_2025"),
+			want: [][]string{
+				{"id_work_2025", "id_personal"},
+				{"~/.ssh/id_work_2025"},
+				{filepath.Join(homeDir, ".ssh", "id_work_2025")},
+			},
+		},
+		{
+			newPath: filepath.Join(homeDir, ".ssh", "work", "id_work"),
+			want: [][]string{
+				{"~/.ssh/work/id_work", "id_personal"},
+				{"~/.ssh/work/id_work"},
+				{filepath.Join(homeDir, ".ssh", "work", "id_work")},
+			},
+		},
+		{
+			newPath: "/srv/keys/id_work",
+			want: [][]string{
+				{"/srv/keys/id_work", "id_personal"},
+				{"/srv/keys/id_work"},
+				{"/srv/keys/id_work"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		cfg.RenameKey(keyPath, tt.newPath)
+		keyPath = tt.newPath
+
+		if cfg.Keys[keyPath].CommentTemplate != "{user}" {
+			t.Errorf("Expected the key to be tracked under %s, got %v", keyPath, cfg.Keys)
+		}
+		for i, publisher := range cfg.Publishers {
+			if strings.Join(publisher.Keys, ",") != strings.Join(tt.want[i], ",") {
+				t.Errorf("Moving to %s: expected %s keys %v, got %v", tt.newPath, publisher.Provider, tt.want[i], publisher.Keys)
+			}
+		}
+	}
+}
+
+// TestConfig_ImportCertificate tests tracking a key with the dates of its certificate
+func TestConfig_ImportCertificate(t *testing.T) {
+	cfg := &Config{
+		Keys: make(map[string]KeyConfig),
+	}
+
+	now := time.Now().Round(time.Second)
+	keyPath := "/home/user/.ssh/id_ed25519"
+	cfg.Keys[keyPath] = KeyConfig{CreatedAt: now, ExpiresAt: now.Add(time.Hour), Cipher: "ed25519"}
+
+	cert := CertificateConfig{KeyID: "alice@corp", Principals: []string{"alice"}, ValidAfter: now.Add(-time.Hour), ValidBefore: now.Add(24 * time.Hour)}
+	cfg.ImportCertificate(keyPath, cert)
+
+	keyConfig := cfg.Keys[keyPath]
+	if !keyConfig.CreatedAt.Equal(cert.ValidAfter) || !keyConfig.ExpiresAt.Equal(cert.ValidBefore) {
+		t.Errorf("Expected the certificate's dates, got %v to %v", keyConfig.CreatedAt, keyConfig.ExpiresAt)
+	}
+	if keyConfig.Certificate == nil || keyConfig.Certificate.KeyID != "alice@corp" {
+		t.Errorf("Expected the certificate to be recorded, got %+v", keyConfig.Certificate)
+	}
+	if keyConfig.Cipher != "ed25519" {
+		t.Errorf("Expected the key's other settings to be kept, got cipher %q", keyConfig.Cipher)
+	}
+
+	// A rotated key no longer matches the imported certificate
+	cfg.AddKey(keyPath, now, now.Add(time.Hour))
+	if cfg.Keys[keyPath].Certificate != nil {
+		t.Error("Expected the certificate to be dropped when the key is replaced")
+	}
+}
+
+func TestConfig_RetireKey(t *testing.T) {
+	cfg := &Config{
+		Keys: make(map[string]KeyConfig),
+	}
+
+	now := time.Now()
+	keyPath := "/home/user/.ssh/id_ed25519"
+	cfg.Keys[keyPath] = KeyConfig{CreatedAt: now, ExpiresAt: now.Add(time.Hour)}
+
+	retired := RetiredKeyConfig{PublicKey: "ssh-ed25519 AAAA", Fingerprint: "SHA256:old", RetiredAt: now}
+	cfg.RetireKey(keyPath, retired)
+	cfg.RetireKey(keyPath, retired)
+	cfg.RetireKey("/home/user/.ssh/untracked", retired)
+
+	if got := cfg.Keys[keyPath].Retired; len(got) != 1 || got[0].Fingerprint != "SHA256:old" {
+		t.Fatalf("Expected the retired key to be recorded once, got %+v", got)
+	}
+	if _, exists := cfg.Keys["/home/user/.ssh/untracked"]; exists {
+		t.Error("Expected untracked keys to be ignored")
+	}
+
+	// Rotating the key again keeps the retired keys
+	cfg.AddKey(keyPath, now, now.Add(time.Hour))
+	cfg.SetRetiredKeyRemoved(keyPath, "SHA256:old", now)
+	if removedAt := cfg.Keys[keyPath].Retired[0].RemovedAt; removedAt == nil || !removedAt.Equal(now) {
+		t.Errorf("Expected the retired key to be marked as removed, got %v", removedAt)
+	}
+
+	// Restoring the retired key forgets it
+	cfg.UnretireKey(keyPath, "SHA256:old")
+	if got := cfg.Keys[keyPath].Retired; got != nil {
+		t.Errorf("Expected no retired keys after restoring it, got %+v", got)
+	}
+}
+
 func TestConfig_GetExpiredKeys(t *testing.T) {
 	// Create a test config
 	cfg := &Config{
@@ -237,3 +382,38 @@ func TestLoad_NonExistentFile(t *testing.T) {
 		t.Errorf("Expected 0 keys, got %d", len(cfg.Keys))
 	}
 }
+
+func TestConfig_KeyStatus(t *testing.T) {
+	// Create a temporary directory for testing
+	tempDir := testutil.TempDir(t)
+
+	validKey, _ := testutil.CreateTestKeyPair(t, tempDir, "valid_key")
+	soonKey, _ := testutil.CreateTestKeyPair(t, tempDir, "soon_key")
+	expiredKey, _ := testutil.CreateTestKeyPair(t, tempDir, "expired_key")
+	missingKey := filepath.Join(tempDir, "missing_key")
+
+	now := time.Now()
+	cfg := &Config{
+		Keys: make(map[string]KeyConfig),
+	}
+	cfg.AddKey(validKey, now.Add(-24*time.Hour), now.Add(30*24*time.Hour))
+	cfg.AddKey(soonKey, now.Add(-24*time.Hour), now.Add(24*time.Hour))
+	cfg.AddKey(expiredKey, now.Add(-48*time.Hour), now.Add(-24*time.Hour))
+	cfg.AddKey(missingKey, now.Add(-48*time.Hour), now.Add(24*time.Hour))
+
+	tests := []struct {
+		path string
+		want KeyStatus
+	}{
+		{validKey, StatusValid},
+		{soonKey, StatusExpiringSoon},
+		{expiredKey, StatusExpired},
+		{missingKey, StatusMissing},
+	}
+
+	for _, tt := range tests {
+		if got := cfg.KeyStatus(tt.path, now, 7*24*time.Hour); got != tt.want {
+			t.Errorf("KeyStatus(%s) = %s, want %s", filepath.Base(tt.path), got, tt.want)
+		}
+	}
+}
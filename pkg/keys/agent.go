@@ -0,0 +1,179 @@
+package keys
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// ErrNoAgent is returned when no ssh-agent is advertised through SSH_AUTH_SOCK
+var ErrNoAgent = errors.New("no ssh-agent available (SSH_AUTH_SOCK is not set)")
+
+// Agent loads and unloads keys in an ssh-agent
+type Agent struct {
+	client agent.Agent
+	conn   net.Conn
+}
+
+// ConnectAgent connects to the ssh-agent listening on SSH_AUTH_SOCK
+func ConnectAgent() (*Agent, error) {
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		return nil, ErrNoAgent
+	}
+
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to ssh-agent at %s: %w", socket, err)
+	}
+
+	return &Agent{client: agent.NewClient(conn), conn: conn}, nil
+}
+
+// NewAgent wraps an agent implementation, such as an in-process keyring
+func NewAgent(client agent.Agent) *Agent {
+	return &Agent{client: client}
+}
+
+// Close closes the connection to the agent
+func (a *Agent) Close() error {
+	if a.conn == nil {
+		return nil
+	}
+	return a.conn.Close()
+}
+
+// Find returns the loaded key with the given SHA256 fingerprint, or nil if it is not loaded
+func (a *Agent) Find(fingerprint string) (*agent.Key, error) {
+	loaded, err := a.client.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list agent keys: %w", err)
+	}
+
+	for _, key := range loaded {
+		if ssh.FingerprintSHA256(key) == fingerprint {
+			return key, nil
+		}
+	}
+	return nil, nil
+}
+
+// Remove unloads the key with the given fingerprint and reports whether it was loaded
+func (a *Agent) Remove(fingerprint string) (bool, error) {
+	return a.remove(fingerprint, func(key *agent.Key) bool {
+		return ssh.FingerprintSHA256(key) == fingerprint
+	})
+}
+
+// RemovePublicKey unloads the key whose public key blob matches pubKey
+// and reports whether it was loaded
+func (a *Agent) RemovePublicKey(pubKey ssh.PublicKey) (bool, error) {
+	blob := pubKey.Marshal()
+	return a.remove(ssh.FingerprintSHA256(pubKey), func(key *agent.Key) bool {
+		return bytes.Equal(key.Blob, blob)
+	})
+}
+
+// remove unloads the first loaded key matched by match and reports whether there was one.
+// fingerprint names the key in errors.
+func (a *Agent) remove(fingerprint string, match func(*agent.Key) bool) (bool, error) {
+	loaded, err := a.client.List()
+	if err != nil {
+		return false, fmt.Errorf("failed to list agent keys: %w", err)
+	}
+
+	for _, key := range loaded {
+		if !match(key) {
+			continue
+		}
+		if err := a.client.Remove(key); err != nil {
+			return false, fmt.Errorf("failed to remove %s from agent: %w", fingerprint, err)
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// Signer returns a signer using the loaded key whose public key blob matches pubKey,
+// or nil if it is not loaded
+func (a *Agent) Signer(pubKey ssh.PublicKey) (ssh.Signer, error) {
+	signers, err := a.client.Signers()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list agent keys: %w", err)
+	}
+
+	blob := pubKey.Marshal()
+	for _, signer := range signers {
+		if bytes.Equal(signer.PublicKey().Marshal(), blob) {
+			return signer, nil
+		}
+	}
+	return nil, nil
+}
+
+// Add loads the private key at path, decrypted with passphrase.
+// The agent drops the key at expiresAt; a zero expiresAt keeps it loaded indefinitely.
+func (a *Agent) Add(path, passphrase string, expiresAt time.Time) error {
+	privateKey, err := decryptPrivateKey(path, passphrase)
+	if err != nil {
+		return err
+	}
+
+	// The agent shows the comment in ssh-add -l; an unreadable public key leaves it empty
+	_, comment, _ := ReadPublicKey(path)
+
+	added := agent.AddedKey{PrivateKey: privateKey, Comment: comment}
+	if !expiresAt.IsZero() {
+		lifetime := math.Ceil(time.Until(expiresAt).Seconds())
+		if lifetime <= 0 {
+			return fmt.Errorf("key %s has already expired", path)
+		}
+		added.LifetimeSecs = uint32(min(lifetime, math.MaxUint32))
+	}
+
+	if err := a.client.Add(added); err != nil {
+		return fmt.Errorf("failed to add %s to agent: %w", path, err)
+	}
+	return nil
+}
+
+// Replace unloads the key with oldFingerprint, if loaded, and loads the key at path
+func (a *Agent) Replace(oldFingerprint, path, passphrase string, expiresAt time.Time) error {
+	if oldFingerprint != "" {
+		if _, err := a.Remove(oldFingerprint); err != nil {
+			return err
+		}
+	}
+	return a.Add(path, passphrase, expiresAt)
+}
+
+// Refresh reloads the key at path with a new expiration if it is loaded,
+// since the agent protocol cannot change the constraints of a loaded key.
+// It reports whether the key was loaded.
+func (a *Agent) Refresh(path, passphrase string, expiresAt time.Time) (bool, error) {
+	fingerprint, err := PublicKeyFingerprint(path)
+	if err != nil {
+		return false, err
+	}
+
+	key, err := a.Find(fingerprint)
+	if err != nil || key == nil {
+		return false, err
+	}
+
+	// Decrypt before removing so a wrong passphrase leaves the agent untouched
+	if _, err := decryptPrivateKey(path, passphrase); err != nil {
+		return true, err
+	}
+	if err := a.client.Remove(key); err != nil {
+		return true, fmt.Errorf("failed to remove %s from agent: %w", path, err)
+	}
+	return true, a.Add(path, passphrase, expiresAt)
+}
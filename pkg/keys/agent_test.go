@@ -0,0 +1,190 @@
+package keys
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh/agent"
+
+	"github.com/de-lachende-cavalier/portunus/pkg/testutil"
+)
+
+// generateTestKey creates a native key pair encrypted with passphrase and returns its fingerprint
+func generateTestKey(t *testing.T, path, passphrase string) string {
+	t.Helper()
+	g := &nativeGenerator{}
+	if err := g.Generate(context.Background(), path, KeySpec{Cipher: "ed25519", Passphrase: passphrase, Comment: "test@example.com"}); err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	fingerprint, err := PublicKeyFingerprint(path)
+	if err != nil {
+		t.Fatalf("Failed to fingerprint key: %v", err)
+	}
+	return fingerprint
+}
+
+// TestAgent_AddRemoveRefresh tests loading, refreshing and unloading keys in an in-process agent
+func TestAgent_AddRemoveRefresh(t *testing.T) {
+	sshDir := testutil.CreateTestSSHDir(t)
+	keyPath := filepath.Join(sshDir, "id_ed25519")
+	fingerprint := generateTestKey(t, keyPath, "secret")
+
+	keyring := agent.NewKeyring()
+	a := NewAgent(keyring)
+
+	if err := a.Add(keyPath, "wrong", time.Time{}); !errors.Is(err, ErrIncorrectPassphrase) {
+		t.Errorf("Expected ErrIncorrectPassphrase, got %v", err)
+	}
+	if err := a.Add(keyPath, "secret", time.Now().Add(-time.Minute)); err == nil {
+		t.Error("Expected error adding an expired key, got nil")
+	}
+
+	if err := a.Add(keyPath, "secret", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("Failed to add key: %v", err)
+	}
+	key, err := a.Find(fingerprint)
+	if err != nil || key == nil {
+		t.Fatalf("Expected key to be loaded, got %v, %v", key, err)
+	}
+	if key.Comment != "test@example.com" {
+		t.Errorf("Expected comment test@example.com, got %q", key.Comment)
+	}
+
+	loaded, err := a.Refresh(keyPath, "secret", time.Now().Add(2*time.Hour))
+	if err != nil || !loaded {
+		t.Fatalf("Failed to refresh key: %v, %v", loaded, err)
+	}
+	if list, _ := keyring.List(); len(list) != 1 {
+		t.Errorf("Expected exactly one loaded key after refresh, got %d", len(list))
+	}
+
+	removed, err := a.Remove(fingerprint)
+	if err != nil || !removed {
+		t.Fatalf("Failed to remove key: %v, %v", removed, err)
+	}
+	if removed, _ := a.Remove(fingerprint); removed {
+		t.Error("Expected removing an unloaded key to report false")
+	}
+	if loaded, err := a.Refresh(keyPath, "secret", time.Now().Add(time.Hour)); err != nil || loaded {
+		t.Errorf("Expected refresh of an unloaded key to do nothing, got %v, %v", loaded, err)
+	}
+}
+
+// TestConnectAgent tests talking to an agent over SSH_AUTH_SOCK
+func TestConnectAgent(t *testing.T) {
+	t.Setenv("SSH_AUTH_SOCK", "")
+	if _, err := ConnectAgent(); !errors.Is(err, ErrNoAgent) {
+		t.Errorf("Expected ErrNoAgent, got %v", err)
+	}
+
+	// Unix socket paths are short, so avoid the long test temp dir
+	dir, err := os.MkdirTemp("", "agent")
+	if err != nil {
+		t.Fatalf("Failed to create socket directory: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	socket := filepath.Join(dir, "agent.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("Failed to listen on %s: %v", socket, err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	keyring := agent.NewKeyring()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go agent.ServeAgent(keyring, conn)
+		}
+	}()
+
+	t.Setenv("SSH_AUTH_SOCK", socket)
+	a, err := ConnectAgent()
+	if err != nil {
+		t.Fatalf("Failed to connect to agent: %v", err)
+	}
+	defer a.Close()
+
+	sshDir := testutil.CreateTestSSHDir(t)
+	keyPath := filepath.Join(sshDir, "id_ed25519")
+	fingerprint := generateTestKey(t, keyPath, "")
+
+	if err := a.Add(keyPath, "", time.Time{}); err != nil {
+		t.Fatalf("Failed to add key: %v", err)
+	}
+	if key, err := a.Find(fingerprint); err != nil || key == nil {
+		t.Errorf("Expected key to be loaded through the socket, got %v, %v", key, err)
+	}
+}
+
+// TestManager_RotateKeys_Agent tests that rotation swaps the retired key for the new one in the agent
+func TestManager_RotateKeys_Agent(t *testing.T) {
+	sshDir := testutil.CreateTestSSHDir(t)
+	keyPath := filepath.Join(sshDir, "id_ed25519")
+	oldFingerprint := generateTestKey(t, keyPath, "")
+
+	a := NewAgent(agent.NewKeyring())
+	if err := a.Add(keyPath, "", time.Time{}); err != nil {
+		t.Fatalf("Failed to add key: %v", err)
+	}
+
+	manager := &Manager{
+		sshDir:    sshDir,
+		generator: &nativeGenerator{},
+		agent:     a,
+	}
+
+	requests := []RotationRequest{{Path: keyPath, Spec: KeySpec{Cipher: "ed25519", Passphrase: "secret"}, Lifetime: time.Hour}}
+	results, err := manager.RotateKeys(context.Background(), requests)
+	if err != nil {
+		t.Fatalf("Failed to rotate keys: %v", err)
+	}
+	if !results[0].AgentLoaded {
+		t.Error("Expected the new key to be loaded in the agent")
+	}
+
+	if key, _ := a.Find(oldFingerprint); key != nil {
+		t.Error("Expected the retired key to be removed from the agent")
+	}
+	if key, _ := a.Find(results[0].NewFingerprint); key == nil {
+		t.Error("Expected the new key to be loaded in the agent")
+	}
+}
+
+// TestAgent_RemovePublicKey tests unloading keys by public key blob
+func TestAgent_RemovePublicKey(t *testing.T) {
+	sshDir := testutil.CreateTestSSHDir(t)
+	keyPath := filepath.Join(sshDir, "id_ed25519")
+	generateTestKey(t, keyPath, "secret")
+
+	a := NewAgent(agent.NewKeyring())
+	if err := a.Add(keyPath, "secret", time.Time{}); err != nil {
+		t.Fatalf("Failed to add key: %v", err)
+	}
+
+	// Without the .pub file the public key comes from the encrypted private key
+	if err := os.Remove(keyPath + ".pub"); err != nil {
+		t.Fatalf("Failed to remove public key: %v", err)
+	}
+	pubKey, err := LoadPublicKey(keyPath)
+	if err != nil {
+		t.Fatalf("Failed to load public key: %v", err)
+	}
+
+	removed, err := a.RemovePublicKey(pubKey)
+	if err != nil || !removed {
+		t.Fatalf("Expected key to be removed, got %v, %v", removed, err)
+	}
+	if removed, _ := a.RemovePublicKey(pubKey); removed {
+		t.Error("Expected removing an unloaded key to report false")
+	}
+}
@@ -0,0 +1,392 @@
+package keys
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/de-lachende-cavalier/portunus/pkg/logger"
+)
+
+// DefaultArchiveDirName is the name of the archive directory inside ~/.ssh
+const DefaultArchiveDirName = ".portunus-archive"
+
+// manifestName is the name of the file describing an archive entry
+const manifestName = "manifest.json"
+
+// entryIDFormat is the timestamp format used to name archive entries
+const entryIDFormat = "20060102T150405Z"
+
+// ArchivedKey describes a key pair stored in an archive entry
+type ArchivedKey struct {
+	OriginalPath string `json:"original_path"`
+	File         string `json:"file"`
+	Fingerprint  string `json:"fingerprint,omitempty"`
+}
+
+// ArchiveEntry is a set of key pairs retired at the same time
+type ArchiveEntry struct {
+	ID         string        `json:"-"`
+	ArchivedAt time.Time     `json:"archived_at"`
+	Keys       []ArchivedKey `json:"keys"`
+}
+
+// InvalidArchiveEntry is an archive entry whose manifest cannot be read
+type InvalidArchiveEntry struct {
+	ID  string
+	Err error
+}
+
+// Archive stores retired key pairs so they can be restored or matched later
+type Archive struct {
+	dir       string
+	retention time.Duration
+}
+
+// archiveItem is a key pair to archive, currently stored at source
+type archiveItem struct {
+	originalPath string
+	source       string
+}
+
+// NewArchive creates an archive rooted at dir.
+// Entries older than retention are removed by Purge; a zero retention keeps them forever.
+func NewArchive(dir string, retention time.Duration) *Archive {
+	return &Archive{
+		dir:       dir,
+		retention: retention,
+	}
+}
+
+// Dir returns the directory holding the archive
+func (a *Archive) Dir() string {
+	return a.dir
+}
+
+// Retention returns how long entries are kept
+func (a *Archive) Retention() time.Duration {
+	return a.retention
+}
+
+// ExpiresAt returns when an entry becomes eligible for purging, or the zero time if never
+func (a *Archive) ExpiresAt(entry ArchiveEntry) time.Time {
+	if a.retention == 0 {
+		return time.Time{}
+	}
+	return entry.ArchivedAt.Add(a.retention)
+}
+
+// Store moves the key pairs at paths into a new archive entry
+func (a *Archive) Store(paths []string) (*ArchiveEntry, error) {
+	items := make([]archiveItem, len(paths))
+	for i, path := range paths {
+		items[i] = archiveItem{originalPath: path, source: path}
+	}
+	return a.store(items)
+}
+
+// store moves the given key pairs into a new archive entry
+func (a *Archive) store(items []archiveItem) (*ArchiveEntry, error) {
+	if err := ensureDir(a.dir); err != nil {
+		return nil, fmt.Errorf("failed to create archive directory: %w", err)
+	}
+
+	now := time.Now().UTC()
+	entryDir, id, err := a.createEntryDir(now)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &ArchiveEntry{
+		ID:         id,
+		ArchivedAt: now,
+	}
+	used := make(map[string]bool)
+
+	for _, item := range items {
+		// Keys from different directories may share a name
+		file := filepath.Base(item.originalPath)
+		for n := 2; used[file]; n++ {
+			file = filepath.Base(item.originalPath) + "-" + strconv.Itoa(n)
+		}
+
+		fingerprint, _ := PublicKeyFingerprint(item.source)
+
+		moved := false
+		for _, suffix := range []string{"", ".pub"} {
+			err := moveFile(item.source+suffix, filepath.Join(entryDir, file+suffix))
+			if err == nil {
+				moved = true
+				continue
+			}
+			if !errors.Is(err, os.ErrNotExist) {
+				// Record what was already moved so it is not lost
+				_ = writeManifest(entryDir, entry)
+				return nil, fmt.Errorf("failed to archive %s: %w", item.originalPath, err)
+			}
+		}
+		if !moved {
+			continue
+		}
+
+		used[file] = true
+		entry.Keys = append(entry.Keys, ArchivedKey{
+			OriginalPath: item.originalPath,
+			File:         file,
+			Fingerprint:  fingerprint,
+		})
+	}
+
+	if err := writeManifest(entryDir, entry); err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+// createEntryDir creates a uniquely named directory for a new entry
+func (a *Archive) createEntryDir(now time.Time) (string, string, error) {
+	base := now.Format(entryIDFormat)
+
+	for n := 1; ; n++ {
+		id := base
+		if n > 1 {
+			id = base + "-" + strconv.Itoa(n)
+		}
+
+		dir := filepath.Join(a.dir, id)
+		err := os.Mkdir(dir, 0700)
+		if err == nil {
+			return dir, id, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return "", "", fmt.Errorf("failed to create archive entry: %w", err)
+		}
+	}
+}
+
+// List returns all archive entries, oldest first.
+// Entries whose manifest cannot be read are skipped and returned separately.
+func (a *Archive) List() ([]ArchiveEntry, []InvalidArchiveEntry, error) {
+	dirEntries, err := os.ReadDir(a.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil, nil
+		}
+		return nil, nil, fmt.Errorf("failed to read archive directory: %w", err)
+	}
+
+	var entries []ArchiveEntry
+	var invalid []InvalidArchiveEntry
+	for _, dirEntry := range dirEntries {
+		if !dirEntry.IsDir() {
+			continue
+		}
+
+		entry, err := a.Get(dirEntry.Name())
+		if err != nil {
+			invalid = append(invalid, InvalidArchiveEntry{ID: dirEntry.Name(), Err: err})
+			continue
+		}
+		entries = append(entries, *entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ArchivedAt.Before(entries[j].ArchivedAt)
+	})
+
+	return entries, invalid, nil
+}
+
+// Get returns the archive entry with the given ID
+func (a *Archive) Get(id string) (*ArchiveEntry, error) {
+	if id == "" || filepath.Base(id) != id {
+		return nil, fmt.Errorf("invalid archive entry: %q", id)
+	}
+
+	data, err := os.ReadFile(filepath.Join(a.dir, id, manifestName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive entry %s: %w", id, err)
+	}
+
+	var entry ArchiveEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("failed to parse archive entry %s: %w", id, err)
+	}
+	entry.ID = id
+
+	return &entry, nil
+}
+
+// Restore moves archived key pairs back to their original location.
+// If paths is empty every key in the entry is restored. Key pairs currently at the
+// original locations are archived in a new entry first, so nothing is lost.
+func (a *Archive) Restore(id string, paths []string) ([]ArchivedKey, error) {
+	entry, err := a.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[string]bool)
+	for _, path := range paths {
+		wanted[path] = true
+	}
+
+	var restore, keep []ArchivedKey
+	for _, key := range entry.Keys {
+		if len(wanted) == 0 || wanted[key.OriginalPath] {
+			restore = append(restore, key)
+		} else {
+			keep = append(keep, key)
+		}
+	}
+	if len(restore) == 0 {
+		return nil, fmt.Errorf("no matching keys in archive entry %s", id)
+	}
+
+	// Archive the key pairs being replaced
+	var current []string
+	for _, key := range restore {
+		if _, err := os.Stat(key.OriginalPath); err == nil {
+			current = append(current, key.OriginalPath)
+		}
+	}
+	if len(current) > 0 {
+		if _, err := a.Store(current); err != nil {
+			return nil, fmt.Errorf("failed to archive current keys: %w", err)
+		}
+	}
+
+	entryDir := filepath.Join(a.dir, id)
+	for _, key := range restore {
+		if err := ensureDir(filepath.Dir(key.OriginalPath)); err != nil {
+			return nil, fmt.Errorf("failed to create directory for %s: %w", key.OriginalPath, err)
+		}
+
+		for _, suffix := range []string{"", ".pub"} {
+			err := moveFile(filepath.Join(entryDir, key.File+suffix), key.OriginalPath+suffix)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return nil, fmt.Errorf("failed to restore %s: %w", key.OriginalPath, err)
+			}
+		}
+	}
+
+	if len(keep) == 0 {
+		if err := os.RemoveAll(entryDir); err != nil {
+			return nil, fmt.Errorf("failed to remove archive entry %s: %w", id, err)
+		}
+	} else {
+		entry.Keys = keep
+		if err := writeManifest(entryDir, entry); err != nil {
+			return nil, err
+		}
+	}
+
+	return restore, nil
+}
+
+// Purge removes the entries whose retention period has passed
+func (a *Archive) Purge(now time.Time) ([]ArchiveEntry, error) {
+	if a.retention == 0 {
+		return nil, nil
+	}
+	return a.purge(func(entry ArchiveEntry) bool {
+		return now.After(a.ExpiresAt(entry))
+	})
+}
+
+// PurgeAll removes every entry regardless of its age
+func (a *Archive) PurgeAll() ([]ArchiveEntry, error) {
+	return a.purge(func(ArchiveEntry) bool {
+		return true
+	})
+}
+
+// purge removes the entries matched by the given predicate.
+// Unreadable entries are left alone, since their age is unknown.
+func (a *Archive) purge(match func(ArchiveEntry) bool) ([]ArchiveEntry, error) {
+	entries, invalid, err := a.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range invalid {
+		logger.Errorf(entry.Err, "Skipping unreadable archive entry %s", entry.ID)
+	}
+
+	var purged []ArchiveEntry
+	for _, entry := range entries {
+		if !match(entry) {
+			continue
+		}
+
+		if err := os.RemoveAll(filepath.Join(a.dir, entry.ID)); err != nil {
+			return purged, fmt.Errorf("failed to remove archive entry %s: %w", entry.ID, err)
+		}
+		purged = append(purged, entry)
+	}
+
+	return purged, nil
+}
+
+// writeManifest writes the manifest of an archive entry
+func writeManifest(entryDir string, entry *ArchiveEntry) error {
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(filepath.Join(entryDir, manifestName), data, 0600); err != nil {
+		return fmt.Errorf("failed to write archive manifest: %w", err)
+	}
+	return nil
+}
+
+// moveFile renames a file, falling back to copying when crossing filesystems
+func moveFile(from, to string) error {
+	err := os.Rename(from, to)
+	if err == nil || errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	if err := copyFile(from, to); err != nil {
+		return err
+	}
+	return os.Remove(from)
+}
+
+// copyFile copies a file, preserving its permissions
+func copyFile(from, to string) error {
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	dst, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		os.Remove(to)
+		return err
+	}
+	return dst.Close()
+}
@@ -0,0 +1,210 @@
+package keys
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/de-lachende-cavalier/portunus/pkg/testutil"
+)
+
+// TestArchive_StoreAndList tests archiving key pairs and listing the entries
+func TestArchive_StoreAndList(t *testing.T) {
+	sshDir := testutil.CreateTestSSHDir(t)
+	archive := NewArchive(filepath.Join(sshDir, DefaultArchiveDirName), 24*time.Hour)
+
+	key1, pub1 := testutil.CreateTestKeyPair(t, sshDir, "id_ed25519")
+
+	// A second key with the same name in another directory
+	otherDir := filepath.Join(sshDir, "work")
+	if err := os.MkdirAll(otherDir, 0700); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	key2, _ := testutil.CreateTestKeyPair(t, otherDir, "id_ed25519")
+
+	entry, err := archive.Store([]string{key1, key2})
+	if err != nil {
+		t.Fatalf("Failed to store keys: %v", err)
+	}
+
+	testutil.AssertFileNotExists(t, key1)
+	testutil.AssertFileNotExists(t, pub1)
+	testutil.AssertFileNotExists(t, key2)
+
+	if len(entry.Keys) != 2 {
+		t.Fatalf("Expected 2 archived keys, got %d", len(entry.Keys))
+	}
+	if entry.Keys[0].File == entry.Keys[1].File {
+		t.Errorf("Expected keys with the same name to be stored under different files")
+	}
+	if entry.Keys[0].Fingerprint == "" {
+		t.Errorf("Expected archived key to record its fingerprint")
+	}
+
+	entries, _, err := archive.List()
+	if err != nil {
+		t.Fatalf("Failed to list archive: %v", err)
+	}
+	if len(entries) != 1 || entries[0].ID != entry.ID {
+		t.Fatalf("Expected the stored entry to be listed, got %+v", entries)
+	}
+	if entries[0].Keys[1].OriginalPath != key2 {
+		t.Errorf("Expected original path %s, got %s", key2, entries[0].Keys[1].OriginalPath)
+	}
+}
+
+// TestArchive_Restore tests restoring archived key pairs over the current ones
+func TestArchive_Restore(t *testing.T) {
+	sshDir := testutil.CreateTestSSHDir(t)
+	archive := NewArchive(filepath.Join(sshDir, DefaultArchiveDirName), 0)
+
+	key, pub := testutil.CreateTestKeyPair(t, sshDir, "id_ed25519")
+	entry, err := archive.Store([]string{key})
+	if err != nil {
+		t.Fatalf("Failed to store key: %v", err)
+	}
+
+	// A newer key took the old key's place
+	testutil.CreateTestFile(t, sshDir, "id_ed25519", "new private key")
+	testutil.CreateTestFile(t, sshDir, "id_ed25519.pub", "new public key")
+
+	restored, err := archive.Restore(entry.ID, nil)
+	if err != nil {
+		t.Fatalf("Failed to restore key: %v", err)
+	}
+	if len(restored) != 1 || restored[0].OriginalPath != key {
+		t.Fatalf("Expected %s to be restored, got %+v", key, restored)
+	}
+
+	fingerprint, err := PublicKeyFingerprint(key)
+	if err != nil {
+		t.Fatalf("Failed to fingerprint restored key: %v", err)
+	}
+	if fingerprint != entry.Keys[0].Fingerprint {
+		t.Errorf("Expected restored fingerprint %s, got %s", entry.Keys[0].Fingerprint, fingerprint)
+	}
+	testutil.AssertFileExists(t, pub)
+
+	// The restored entry is gone and the replaced key was archived instead
+	entries, _, err := archive.List()
+	if err != nil {
+		t.Fatalf("Failed to list archive: %v", err)
+	}
+	if len(entries) != 1 || entries[0].ID == entry.ID {
+		t.Fatalf("Expected only the replaced key's entry to remain, got %+v", entries)
+	}
+
+	if _, err := archive.Restore("../outside", nil); err == nil {
+		t.Error("Expected error for invalid entry ID, got nil")
+	}
+}
+
+// TestArchive_Purge tests removing entries past their retention period
+func TestArchive_Purge(t *testing.T) {
+	sshDir := testutil.CreateTestSSHDir(t)
+	archive := NewArchive(filepath.Join(sshDir, DefaultArchiveDirName), time.Hour)
+
+	key, _ := testutil.CreateTestKeyPair(t, sshDir, "id_ed25519")
+	if _, err := archive.Store([]string{key}); err != nil {
+		t.Fatalf("Failed to store key: %v", err)
+	}
+
+	purged, err := archive.Purge(time.Now())
+	if err != nil {
+		t.Fatalf("Failed to purge archive: %v", err)
+	}
+	if len(purged) != 0 {
+		t.Errorf("Expected no entries to be purged within the retention period, got %d", len(purged))
+	}
+
+	purged, err = archive.Purge(time.Now().Add(2 * time.Hour))
+	if err != nil {
+		t.Fatalf("Failed to purge archive: %v", err)
+	}
+	if len(purged) != 1 {
+		t.Errorf("Expected 1 entry to be purged, got %d", len(purged))
+	}
+
+	entries, _, err := archive.List()
+	if err != nil {
+		t.Fatalf("Failed to list archive: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Expected empty archive, got %d entries", len(entries))
+	}
+}
+
+// TestArchive_InvalidEntry tests that an unreadable entry does not hide or block the others
+func TestArchive_InvalidEntry(t *testing.T) {
+	sshDir := testutil.CreateTestSSHDir(t)
+	archive := NewArchive(filepath.Join(sshDir, DefaultArchiveDirName), time.Hour)
+
+	key, _ := testutil.CreateTestKeyPair(t, sshDir, "id_ed25519")
+	entry, err := archive.Store([]string{key})
+	if err != nil {
+		t.Fatalf("Failed to store key: %v", err)
+	}
+
+	// Corrupt the manifest of a second entry
+	corrupt := filepath.Join(archive.Dir(), "20200101T000000Z")
+	if err := os.Mkdir(corrupt, 0700); err != nil {
+		t.Fatalf("Failed to create entry: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(corrupt, manifestName), []byte("{not json"), 0600); err != nil {
+		t.Fatalf("Failed to write manifest: %v", err)
+	}
+
+	entries, invalid, err := archive.List()
+	if err != nil {
+		t.Fatalf("Failed to list archive: %v", err)
+	}
+	if len(entries) != 1 || entries[0].ID != entry.ID {
+		t.Errorf("Expected the valid entry to be listed, got %+v", entries)
+	}
+	if len(invalid) != 1 || invalid[0].ID != "20200101T000000Z" || invalid[0].Err == nil {
+		t.Errorf("Expected the corrupt entry to be reported, got %+v", invalid)
+	}
+
+	// Purging removes the valid entry and leaves the unreadable one alone
+	purged, err := archive.Purge(time.Now().Add(2 * time.Hour))
+	if err != nil {
+		t.Fatalf("Failed to purge archive: %v", err)
+	}
+	if len(purged) != 1 || purged[0].ID != entry.ID {
+		t.Errorf("Expected the valid entry to be purged, got %+v", purged)
+	}
+	testutil.AssertFileExists(t, corrupt)
+}
+
+// TestManager_RotateKeys_Archive tests that rotation archives the retired key pairs
+func TestManager_RotateKeys_Archive(t *testing.T) {
+	sshDir := testutil.CreateTestSSHDir(t)
+	archive := NewArchive(filepath.Join(sshDir, DefaultArchiveDirName), 0)
+
+	key, _ := testutil.CreateTestKeyPair(t, sshDir, "id_ed25519")
+
+	manager := &Manager{
+		sshDir:    sshDir,
+		generator: &nativeGenerator{},
+		archive:   archive,
+	}
+
+	results, err := manager.RotateKeys(context.Background(), NewRotationRequests([]string{key}, KeySpec{Cipher: "ed25519"}))
+	if err != nil {
+		t.Fatalf("Failed to rotate keys: %v", err)
+	}
+	if results[0].ArchiveID == "" {
+		t.Fatal("Expected rotation to report the archive entry")
+	}
+
+	entry, err := archive.Get(results[0].ArchiveID)
+	if err != nil {
+		t.Fatalf("Failed to read archive entry: %v", err)
+	}
+	if len(entry.Keys) != 1 || entry.Keys[0].Fingerprint != results[0].OldFingerprint {
+		t.Errorf("Expected the old key to be archived, got %+v", entry.Keys)
+	}
+	assertNoStagingDirs(t, sshDir)
+}
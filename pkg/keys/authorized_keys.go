@@ -0,0 +1,187 @@
+package keys
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// expiryTimeLayout is the format of the expiry-time option, which sshd reads in its local time
+const expiryTimeLayout = "200601021504"
+
+// AuthorizeKey appends the authorized_keys line of pubKey to the content of an
+// authorized_keys file, unless the key is already authorized. It reports whether it was added.
+func AuthorizeKey(data []byte, pubKey ssh.PublicKey, comment string) ([]byte, bool) {
+	if IsAuthorized(data, pubKey) {
+		return data, false
+	}
+
+	out := bytes.Clone(data)
+	if len(out) > 0 && out[len(out)-1] != '\n' {
+		out = append(out, '\n')
+	}
+	return append(out, authorizedKeyLine(pubKey, comment)...), true
+}
+
+// UnauthorizeKey removes every line authorizing pubKey from the content of an
+// authorized_keys file, whatever its options and comment, and returns how many were removed.
+// Other lines, including comments and lines that do not parse, are kept as they are.
+func UnauthorizeKey(data []byte, pubKey ssh.PublicKey) ([]byte, int) {
+	var out []byte
+	removed := 0
+	for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+		if authorizesKey(line, pubKey) {
+			removed++
+			continue
+		}
+		out = append(out, line...)
+	}
+	return out, removed
+}
+
+// IsAuthorized reports whether the content of an authorized_keys file authorizes pubKey
+func IsAuthorized(data []byte, pubKey ssh.PublicKey) bool {
+	for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+		if authorizesKey(line, pubKey) {
+			return true
+		}
+	}
+	return false
+}
+
+// authorizesKey reports whether a single authorized_keys line authorizes pubKey
+func authorizesKey(line []byte, pubKey ssh.PublicKey) bool {
+	key, _, _, _, err := ssh.ParseAuthorizedKey(line)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(key.Marshal(), pubKey.Marshal())
+}
+
+// SetExpiryTime sets the expiry-time option of every line authorizing pubKey to expiresAt,
+// replacing any previous expiry-time and keeping the other options, the key and its comment.
+// It returns how many lines were changed.
+func SetExpiryTime(data []byte, pubKey ssh.PublicKey, expiresAt time.Time) ([]byte, int) {
+	option := fmt.Sprintf("expiry-time=%q", expiresAt.Local().Format(expiryTimeLayout))
+
+	var out []byte
+	changed := 0
+	for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+		if authorizesKey(line, pubKey) {
+			if updated := setLineOption(line, "expiry-time", option); !bytes.Equal(updated, line) {
+				line = updated
+				changed++
+			}
+		}
+		out = append(out, line...)
+	}
+	return out, changed
+}
+
+// setLineOption replaces the option called name of an authorized_keys line with option,
+// or adds it after the existing options
+func setLineOption(line []byte, name, option string) []byte {
+	body := strings.TrimRight(string(line), "\r\n")
+	eol := string(line[len(body):])
+	rest := strings.TrimLeft(body, " \t")
+	indent := body[:len(body)-len(rest)]
+
+	var options []string
+	if _, _, parsed, _, _ := ssh.ParseAuthorizedKey(line); len(parsed) > 0 {
+		end := optionsEnd(rest)
+		for _, o := range splitOptions(rest[:end]) {
+			if n, _, _ := strings.Cut(o, "="); !strings.EqualFold(n, name) {
+				options = append(options, o)
+			}
+		}
+		rest = strings.TrimLeft(rest[end:], " \t")
+	}
+	options = append(options, option)
+
+	return []byte(indent + strings.Join(options, ",") + " " + rest + eol)
+}
+
+// optionsEnd returns the length of the options of an authorized_keys line,
+// which end at the first blank outside double quotes
+func optionsEnd(s string) int {
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			quoted = !quoted
+		case ' ', '\t':
+			if !quoted {
+				return i
+			}
+		}
+	}
+	return len(s)
+}
+
+// splitOptions splits authorized_keys options on commas outside double quotes
+func splitOptions(s string) []string {
+	var options []string
+	quoted := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				options = append(options, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(options, s[start:])
+}
+
+// UpdateAuthorizedKeysFile applies update to the content of a local authorized_keys file
+// and, when it reports a change, atomically replaces the file, keeping its permissions
+func UpdateAuthorizedKeysFile(path string, update func([]byte) ([]byte, bool)) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to read authorized keys: %w", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read authorized keys: %w", err)
+	}
+
+	data, changed := update(data)
+	if !changed {
+		return nil
+	}
+
+	// Write next to the file and rename so sshd never reads it half-written
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".portunus-authorized-keys-*")
+	if err != nil {
+		return fmt.Errorf("failed to write authorized keys: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write authorized keys: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to write authorized keys: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write authorized keys: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package keys
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/de-lachende-cavalier/portunus/pkg/testutil"
+)
+
+// TestAuthorizedKeys tests adding and removing keys from the content of an authorized_keys file
+func TestAuthorizedKeys(t *testing.T) {
+	sshDir := testutil.CreateTestSSHDir(t)
+	generateTestKey(t, filepath.Join(sshDir, "old"), "")
+	generateTestKey(t, filepath.Join(sshDir, "new"), "")
+	oldKey, err := LoadPublicKey(filepath.Join(sshDir, "old"))
+	if err != nil {
+		t.Fatalf("Failed to load public key: %v", err)
+	}
+	newKey, err := LoadPublicKey(filepath.Join(sshDir, "new"))
+	if err != nil {
+		t.Fatalf("Failed to load public key: %v", err)
+	}
+
+	oldLine := strings.TrimSpace(string(authorizedKeyLine(oldKey, "")))
+	// The old key is authorized twice, once with options, and the file lacks a final newline
+	data := []byte("# servers\n" + oldLine + " laptop\nnot a key\n" + `restrict,from="10.0.0.1" ` + oldLine)
+
+	if !IsAuthorized(data, oldKey) || IsAuthorized(data, newKey) {
+		t.Fatal("Expected only the old key to be authorized")
+	}
+
+	data, added := AuthorizeKey(data, newKey, "alice@laptop")
+	if !added || !IsAuthorized(data, newKey) {
+		t.Fatal("Expected the new key to be added")
+	}
+	if _, added := AuthorizeKey(data, newKey, "alice@laptop"); added {
+		t.Error("Expected an authorized key not to be added twice")
+	}
+
+	data, removed := UnauthorizeKey(data, oldKey)
+	if removed != 2 {
+		t.Errorf("Expected 2 lines removed, got %d", removed)
+	}
+
+	want := "# servers\nnot a key\n" + string(authorizedKeyLine(newKey, "alice@laptop"))
+	if string(data) != want {
+		t.Errorf("Unexpected authorized keys:\n%s\nwant:\n%s", data, want)
+	}
+
+	if _, removed := UnauthorizeKey(data, oldKey); removed != 0 {
+		t.Errorf("Expected nothing removed, got %d", removed)
+	}
+}
+
+// TestSetExpiryTime tests setting the expiry-time option of the lines authorizing a key
+func TestSetExpiryTime(t *testing.T) {
+	sshDir := testutil.CreateTestSSHDir(t)
+	generateTestKey(t, filepath.Join(sshDir, "tracked"), "")
+	generateTestKey(t, filepath.Join(sshDir, "other"), "")
+	tracked, err := LoadPublicKey(filepath.Join(sshDir, "tracked"))
+	if err != nil {
+		t.Fatalf("Failed to load public key: %v", err)
+	}
+	other, err := LoadPublicKey(filepath.Join(sshDir, "other"))
+	if err != nil {
+		t.Fatalf("Failed to load public key: %v", err)
+	}
+
+	trackedKey := strings.TrimSpace(string(authorizedKeyLine(tracked, "")))
+	otherLine := strings.TrimSpace(string(authorizedKeyLine(other, ""))) + " bob@desk\n"
+	data := []byte("# workstation\n" +
+		trackedKey + " alice@laptop\n" +
+		otherLine +
+		`  from="10.0.0.1,10.0.0.2",command="echo a b",expiry-time="20200101" ` + trackedKey + "  alice backup\r\n")
+
+	expiresAt := time.Date(2030, 5, 17, 13, 45, 10, 0, time.Local)
+	data, changed := SetExpiryTime(data, tracked, expiresAt)
+	if changed != 2 {
+		t.Errorf("Expected 2 lines changed, got %d", changed)
+	}
+
+	want := "# workstation\n" +
+		`expiry-time="203005171345" ` + trackedKey + " alice@laptop\n" +
+		otherLine +
+		`  from="10.0.0.1,10.0.0.2",command="echo a b",expiry-time="203005171345" ` + trackedKey + "  alice backup\r\n"
+	if string(data) != want {
+		t.Errorf("Unexpected authorized keys:\n%s\nwant:\n%s", data, want)
+	}
+
+	// The lines still parse with their options
+	for _, line := range strings.Split(string(data), "\n")[1:] {
+		if line == "" {
+			continue
+		}
+		if _, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line)); err != nil {
+			t.Errorf("Expected %q to parse: %v", line, err)
+		}
+	}
+
+	if _, changed := SetExpiryTime(data, tracked, expiresAt); changed != 0 {
+		t.Errorf("Expected up to date lines to be left alone, got %d changed", changed)
+	}
+}
+
+// TestUpdateAuthorizedKeysFile tests replacing a local authorized_keys file
+func TestUpdateAuthorizedKeysFile(t *testing.T) {
+	path := filepath.Join(testutil.CreateTestSSHDir(t), "authorized_keys")
+	if err := os.WriteFile(path, []byte("old\n"), 0640); err != nil {
+		t.Fatalf("Failed to write authorized keys: %v", err)
+	}
+
+	err := UpdateAuthorizedKeysFile(path, func(data []byte) ([]byte, bool) {
+		return append(data, "new\n"...), true
+	})
+	if err != nil {
+		t.Fatalf("Failed to update authorized keys: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "old\nnew\n" {
+		t.Errorf("Unexpected authorized keys %q, %v", data, err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0640 {
+		t.Errorf("Expected the permissions to be kept, got %v, %v", info.Mode().Perm(), err)
+	}
+
+	if err := UpdateAuthorizedKeysFile(filepath.Join(filepath.Dir(path), "missing"), nil); err == nil {
+		t.Error("Expected error for a missing file")
+	}
+}
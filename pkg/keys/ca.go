@@ -0,0 +1,193 @@
+package keys
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// DefaultCADirName is the directory holding the local user CA, inside the SSH directory.
+// It is hidden so key discovery never mistakes the CA key for a user key.
+const DefaultCADirName = ".portunus-ca"
+
+// caKeyName is the file name of the CA private key
+const caKeyName = "ca"
+
+// ErrNoCA is returned when no CA has been created in the CA directory
+var ErrNoCA = errors.New("no certificate authority found (run portunus ca init)")
+
+// CA is a local user certificate authority signing key certificates
+type CA struct {
+	dir    string
+	signer ssh.Signer
+}
+
+// CertificateSpec describes the certificate to issue for a key
+type CertificateSpec struct {
+	// KeyID identifies the certificate in server logs
+	KeyID string
+	// Principals are the user names the certificate is valid for
+	Principals []string
+	// ValidAfter and ValidBefore bound the validity window
+	ValidAfter  time.Time
+	ValidBefore time.Time
+}
+
+// defaultCertPermissions are the extensions ssh-keygen grants user certificates by default
+var defaultCertPermissions = map[string]string{
+	"permit-X11-forwarding":   "",
+	"permit-agent-forwarding": "",
+	"permit-port-forwarding":  "",
+	"permit-pty":              "",
+	"permit-user-rc":          "",
+}
+
+// InitCA creates a new ed25519 CA key in dir, encrypted with passphrase if it is not empty
+func InitCA(dir, passphrase string) (*CA, error) {
+	keyPath := filepath.Join(dir, caKeyName)
+	if _, err := os.Stat(keyPath); err == nil {
+		return nil, fmt.Errorf("certificate authority already exists in %s", dir)
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create CA directory: %w", err)
+	}
+
+	g := &nativeGenerator{}
+	spec := KeySpec{Cipher: "ed25519", Passphrase: passphrase, Comment: "portunus user CA"}
+	if err := g.Generate(context.Background(), keyPath, spec); err != nil {
+		return nil, fmt.Errorf("failed to generate CA key: %w", err)
+	}
+
+	return LoadCA(dir, passphrase)
+}
+
+// LoadCA opens the CA in dir, decrypting its key with passphrase
+func LoadCA(dir, passphrase string) (*CA, error) {
+	keyPath := filepath.Join(dir, caKeyName)
+	if _, err := os.Stat(keyPath); os.IsNotExist(err) {
+		return nil, ErrNoCA
+	}
+
+	privateKey, err := decryptPrivateKey(keyPath, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open CA key: %w", err)
+	}
+
+	signer, err := ssh.NewSignerFromKey(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to use CA key: %w", err)
+	}
+
+	return &CA{dir: dir, signer: signer}, nil
+}
+
+// ReadCAPublicKey returns the public key of the CA in dir without decrypting the CA key
+func ReadCAPublicKey(dir string) (ssh.PublicKey, error) {
+	keyPath := filepath.Join(dir, caKeyName)
+	if _, err := os.Stat(keyPath); os.IsNotExist(err) {
+		return nil, ErrNoCA
+	}
+	return LoadPublicKey(keyPath)
+}
+
+// Dir returns the directory holding the CA
+func (ca *CA) Dir() string {
+	return ca.dir
+}
+
+// PublicKey returns the CA public key servers should trust
+func (ca *CA) PublicKey() ssh.PublicKey {
+	return ca.signer.PublicKey()
+}
+
+// CertificatePath returns where OpenSSH looks for the certificate of the private key at keyPath
+func CertificatePath(keyPath string) string {
+	return keyPath + "-cert.pub"
+}
+
+// Sign issues a user certificate for the public key of the private key at keyPath
+// and writes it next to the key, replacing any previous certificate
+func (ca *CA) Sign(keyPath string, spec CertificateSpec) (*ssh.Certificate, error) {
+	if !spec.ValidBefore.After(spec.ValidAfter) {
+		return nil, fmt.Errorf("invalid validity window for %s: %s to %s", keyPath,
+			spec.ValidAfter.Format(time.RFC3339), spec.ValidBefore.Format(time.RFC3339))
+	}
+
+	pubKey, comment, err := ReadPublicKey(keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+
+	cert := &ssh.Certificate{
+		Key:             pubKey,
+		Serial:          serial,
+		CertType:        ssh.UserCert,
+		KeyId:           spec.KeyID,
+		ValidPrincipals: spec.Principals,
+		ValidAfter:      uint64(spec.ValidAfter.Unix()),
+		ValidBefore:     uint64(spec.ValidBefore.Unix()),
+		Permissions: ssh.Permissions{
+			Extensions: maps.Clone(defaultCertPermissions),
+		},
+	}
+	if err := cert.SignCert(rand.Reader, ca.signer); err != nil {
+		return nil, fmt.Errorf("failed to sign certificate for %s: %w", keyPath, err)
+	}
+
+	certPath := CertificatePath(keyPath)
+	if err := os.WriteFile(certPath, authorizedKeyLine(cert, comment), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write certificate %s: %w", certPath, err)
+	}
+
+	return cert, nil
+}
+
+// ReadCertificate parses the certificate stored next to the private key at keyPath
+func ReadCertificate(keyPath string) (*ssh.Certificate, error) {
+	certPath := CertificatePath(keyPath)
+
+	data, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate %s: %w", certPath, err)
+	}
+
+	pubKey, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate %s: %w", certPath, err)
+	}
+
+	cert, ok := pubKey.(*ssh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a certificate", certPath)
+	}
+	return cert, nil
+}
+
+// IsSignedBy reports whether cert was signed by the CA
+func (ca *CA) IsSignedBy(cert *ssh.Certificate) bool {
+	return bytes.Equal(cert.SignatureKey.Marshal(), ca.PublicKey().Marshal())
+}
+
+// randomSerial returns a random certificate serial number
+func randomSerial() (uint64, error) {
+	var buf [8]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return 0, fmt.Errorf("failed to generate certificate serial: %w", err)
+	}
+	return binary.BigEndian.Uint64(buf[:]), nil
+}
@@ -0,0 +1,156 @@
+package keys
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/de-lachende-cavalier/portunus/pkg/testutil"
+)
+
+// TestCA_InitAndLoad tests creating and reopening an encrypted CA
+func TestCA_InitAndLoad(t *testing.T) {
+	sshDir := testutil.CreateTestSSHDir(t)
+	dir := filepath.Join(sshDir, DefaultCADirName)
+
+	if _, err := LoadCA(dir, ""); !errors.Is(err, ErrNoCA) {
+		t.Errorf("Expected ErrNoCA, got %v", err)
+	}
+	if _, err := ReadCAPublicKey(dir); !errors.Is(err, ErrNoCA) {
+		t.Errorf("Expected ErrNoCA, got %v", err)
+	}
+
+	ca, err := InitCA(dir, "secret")
+	if err != nil {
+		t.Fatalf("Failed to create CA: %v", err)
+	}
+	if _, err := InitCA(dir, "secret"); err == nil {
+		t.Error("Expected error creating a CA twice, got nil")
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		t.Fatalf("Failed to stat CA directory: %v", err)
+	}
+	if info.Mode().Perm() != 0700 {
+		t.Errorf("Expected CA directory mode 0700, got %o", info.Mode().Perm())
+	}
+
+	if _, err := LoadCA(dir, "wrong"); !errors.Is(err, ErrIncorrectPassphrase) {
+		t.Errorf("Expected ErrIncorrectPassphrase, got %v", err)
+	}
+	loaded, err := LoadCA(dir, "secret")
+	if err != nil {
+		t.Fatalf("Failed to load CA: %v", err)
+	}
+
+	pubKey, err := ReadCAPublicKey(dir)
+	if err != nil {
+		t.Fatalf("Failed to read CA public key: %v", err)
+	}
+	for _, key := range []ssh.PublicKey{loaded.PublicKey(), pubKey} {
+		if ssh.FingerprintSHA256(key) != ssh.FingerprintSHA256(ca.PublicKey()) {
+			t.Errorf("Expected CA public key %s, got %s", ssh.FingerprintSHA256(ca.PublicKey()), ssh.FingerprintSHA256(key))
+		}
+	}
+}
+
+// TestCA_Sign tests that certificates are only accepted within the key's validity window
+func TestCA_Sign(t *testing.T) {
+	sshDir := testutil.CreateTestSSHDir(t)
+	ca, err := InitCA(filepath.Join(sshDir, DefaultCADirName), "")
+	if err != nil {
+		t.Fatalf("Failed to create CA: %v", err)
+	}
+
+	keyPath := filepath.Join(sshDir, "id_ed25519")
+	fingerprint := generateTestKey(t, keyPath, "")
+
+	now := time.Now().Truncate(time.Second)
+	spec := CertificateSpec{
+		KeyID:       "portunus:" + keyPath,
+		Principals:  []string{"alice"},
+		ValidAfter:  now.Add(-time.Hour),
+		ValidBefore: now.Add(time.Hour),
+	}
+	if _, err := ca.Sign(keyPath, CertificateSpec{ValidAfter: now, ValidBefore: now}); err == nil {
+		t.Error("Expected error signing with an empty validity window, got nil")
+	}
+	if _, err := ca.Sign(keyPath, spec); err != nil {
+		t.Fatalf("Failed to sign key: %v", err)
+	}
+
+	cert, err := ReadCertificate(keyPath)
+	if err != nil {
+		t.Fatalf("Failed to read certificate: %v", err)
+	}
+	if ssh.FingerprintSHA256(cert.Key) != fingerprint {
+		t.Errorf("Expected certificate for %s, got %s", fingerprint, ssh.FingerprintSHA256(cert.Key))
+	}
+	if cert.KeyId != spec.KeyID {
+		t.Errorf("Expected key ID %s, got %s", spec.KeyID, cert.KeyId)
+	}
+	if !ca.IsSignedBy(cert) {
+		t.Error("Expected certificate to be signed by the CA")
+	}
+
+	other, err := InitCA(filepath.Join(sshDir, "other-ca"), "")
+	if err != nil {
+		t.Fatalf("Failed to create CA: %v", err)
+	}
+	if other.IsSignedBy(cert) {
+		t.Error("Expected certificate not to be signed by another CA")
+	}
+
+	// A server trusting the CA accepts the certificate only within its validity window
+	checker := &ssh.CertChecker{
+		IsUserAuthority: func(auth ssh.PublicKey) bool {
+			return ssh.FingerprintSHA256(auth) == ssh.FingerprintSHA256(ca.PublicKey())
+		},
+	}
+	for _, tc := range []struct {
+		name    string
+		at      time.Time
+		wantErr bool
+	}{
+		{"valid", now, false},
+		{"not yet valid", now.Add(-2 * time.Hour), true},
+		{"expired", now.Add(2 * time.Hour), true},
+	} {
+		checker.Clock = func() time.Time { return tc.at }
+		err := checker.CheckCert("alice", cert)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%s: expected error %v, got %v", tc.name, tc.wantErr, err)
+		}
+	}
+	checker.Clock = func() time.Time { return now }
+	if err := checker.CheckCert("bob", cert); err == nil {
+		t.Error("Expected certificate to be rejected for another principal")
+	}
+}
+
+// TestReadCertificate_Errors tests reading missing and invalid certificates
+func TestReadCertificate_Errors(t *testing.T) {
+	sshDir := testutil.CreateTestSSHDir(t)
+	keyPath, pubPath := testutil.CreateTestKeyPair(t, sshDir, "id_ed25519")
+
+	if _, err := ReadCertificate(keyPath); err == nil {
+		t.Error("Expected error reading a missing certificate, got nil")
+	}
+
+	// A plain public key is not a certificate
+	data, err := os.ReadFile(pubPath)
+	if err != nil {
+		t.Fatalf("Failed to read public key: %v", err)
+	}
+	if err := os.WriteFile(CertificatePath(keyPath), data, 0644); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+	if _, err := ReadCertificate(keyPath); err == nil {
+		t.Error("Expected error reading a plain public key as certificate, got nil")
+	}
+}
@@ -0,0 +1,55 @@
+package keys
+
+import (
+	"bytes"
+	"errors"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// ErrCertificateMismatch is returned when a certificate does not certify the key it is stored next to
+var ErrCertificateMismatch = errors.New("certificate does not match the key")
+
+// CertificateInfo describes the certificate stored next to a private key
+type CertificateInfo struct {
+	KeyID      string
+	Principals []string
+	Serial     uint64
+	// Authority is the SHA256 fingerprint of the CA that signed the certificate
+	Authority string
+	// ValidAfter and ValidBefore bound the validity window; zero times leave it unbounded
+	ValidAfter  time.Time
+	ValidBefore time.Time
+}
+
+// ReadCertificateInfo reads the certificate stored next to the private key at keyPath,
+// checking that it certifies the key's public key
+func ReadCertificateInfo(keyPath string) (*CertificateInfo, error) {
+	cert, err := ReadCertificate(keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	pubKey, err := LoadPublicKey(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(cert.Key.Marshal(), pubKey.Marshal()) {
+		return nil, ErrCertificateMismatch
+	}
+
+	info := &CertificateInfo{
+		KeyID:      cert.KeyId,
+		Principals: cert.ValidPrincipals,
+		Serial:     cert.Serial,
+		Authority:  ssh.FingerprintSHA256(cert.SignatureKey),
+	}
+	if cert.ValidAfter != 0 {
+		info.ValidAfter = time.Unix(int64(cert.ValidAfter), 0)
+	}
+	if cert.ValidBefore != ssh.CertTimeInfinity {
+		info.ValidBefore = time.Unix(int64(cert.ValidBefore), 0)
+	}
+	return info, nil
+}
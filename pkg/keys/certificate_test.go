@@ -0,0 +1,98 @@
+package keys
+
+import (
+	"crypto/rand"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/de-lachende-cavalier/portunus/pkg/testutil"
+)
+
+// TestReadCertificateInfo tests reading the validity window and identity of a certificate
+func TestReadCertificateInfo(t *testing.T) {
+	sshDir := testutil.CreateTestSSHDir(t)
+	ca, err := InitCA(filepath.Join(sshDir, "company-ca"), "")
+	if err != nil {
+		t.Fatalf("Failed to create CA: %v", err)
+	}
+
+	keyPath := filepath.Join(sshDir, "id_ed25519")
+	generateTestKey(t, keyPath, "")
+
+	now := time.Now().Truncate(time.Second)
+	spec := CertificateSpec{
+		KeyID:       "alice@corp",
+		Principals:  []string{"alice", "deploy"},
+		ValidAfter:  now.Add(-time.Hour),
+		ValidBefore: now.Add(8 * time.Hour),
+	}
+	cert, err := ca.Sign(keyPath, spec)
+	if err != nil {
+		t.Fatalf("Failed to sign key: %v", err)
+	}
+
+	info, err := ReadCertificateInfo(keyPath)
+	if err != nil {
+		t.Fatalf("Failed to read certificate: %v", err)
+	}
+	if info.KeyID != spec.KeyID || len(info.Principals) != 2 || info.Serial != cert.Serial {
+		t.Errorf("Expected certificate identity %+v, got %+v", spec, info)
+	}
+	if !info.ValidAfter.Equal(spec.ValidAfter) || !info.ValidBefore.Equal(spec.ValidBefore) {
+		t.Errorf("Expected validity %v to %v, got %v to %v", spec.ValidAfter, spec.ValidBefore, info.ValidAfter, info.ValidBefore)
+	}
+	if info.Authority != ssh.FingerprintSHA256(ca.PublicKey()) {
+		t.Errorf("Expected authority %s, got %s", ssh.FingerprintSHA256(ca.PublicKey()), info.Authority)
+	}
+
+	// A certificate for another key is rejected
+	otherPath := filepath.Join(sshDir, "id_other")
+	generateTestKey(t, otherPath, "")
+	data, err := os.ReadFile(CertificatePath(keyPath))
+	if err != nil {
+		t.Fatalf("Failed to read certificate: %v", err)
+	}
+	if err := os.WriteFile(CertificatePath(otherPath), data, 0644); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+	if _, err := ReadCertificateInfo(otherPath); !errors.Is(err, ErrCertificateMismatch) {
+		t.Errorf("Expected ErrCertificateMismatch, got %v", err)
+	}
+}
+
+// TestReadCertificateInfo_Unbounded tests certificates valid forever
+func TestReadCertificateInfo_Unbounded(t *testing.T) {
+	sshDir := testutil.CreateTestSSHDir(t)
+	ca, err := InitCA(filepath.Join(sshDir, "company-ca"), "")
+	if err != nil {
+		t.Fatalf("Failed to create CA: %v", err)
+	}
+
+	keyPath := filepath.Join(sshDir, "id_ed25519")
+	generateTestKey(t, keyPath, "")
+	pubKey, err := LoadPublicKey(keyPath)
+	if err != nil {
+		t.Fatalf("Failed to load public key: %v", err)
+	}
+
+	cert := &ssh.Certificate{Key: pubKey, CertType: ssh.UserCert, ValidBefore: ssh.CertTimeInfinity}
+	if err := cert.SignCert(rand.Reader, ca.signer); err != nil {
+		t.Fatalf("Failed to sign certificate: %v", err)
+	}
+	if err := os.WriteFile(CertificatePath(keyPath), ssh.MarshalAuthorizedKey(cert), 0644); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+
+	info, err := ReadCertificateInfo(keyPath)
+	if err != nil {
+		t.Fatalf("Failed to read certificate: %v", err)
+	}
+	if !info.ValidAfter.IsZero() || !info.ValidBefore.IsZero() {
+		t.Errorf("Expected an unbounded validity window, got %v to %v", info.ValidAfter, info.ValidBefore)
+	}
+}
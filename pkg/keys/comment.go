@@ -0,0 +1,76 @@
+package keys
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// placeholderPattern matches the {name} placeholders of a comment template
+var placeholderPattern = regexp.MustCompile(`\{[^{}]*\}`)
+
+// CommentData holds the values available to a comment template
+type CommentData struct {
+	// Hostname is the name of the local machine
+	Hostname string
+	// User is the name of the current user
+	User string
+	// Date is when the key is rotated
+	Date time.Time
+	// Comment is the comment of the key being replaced
+	Comment string
+	// Name is the file name of the key
+	Name string
+}
+
+// NewCommentData collects the template values for the key at path
+func NewCommentData(path, oldComment string, now time.Time) CommentData {
+	data := CommentData{
+		Date:    now,
+		Comment: oldComment,
+		Name:    filepath.Base(path),
+	}
+
+	if u, err := user.Current(); err == nil {
+		data.User = u.Username
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		data.Hostname = hostname
+	}
+
+	return data
+}
+
+// ExpandCommentTemplate replaces the placeholders of a comment template.
+// Supported placeholders are {hostname}, {user}, {date} (YYYY-MM-DD), {comment} and {name}.
+func ExpandCommentTemplate(tmpl string, data CommentData) (string, error) {
+	var unknown string
+
+	expanded := placeholderPattern.ReplaceAllStringFunc(tmpl, func(placeholder string) string {
+		switch placeholder {
+		case "{hostname}":
+			return data.Hostname
+		case "{user}":
+			return data.User
+		case "{date}":
+			return data.Date.Format(time.DateOnly)
+		case "{comment}":
+			return data.Comment
+		case "{name}":
+			return data.Name
+		default:
+			if unknown == "" {
+				unknown = placeholder
+			}
+			return placeholder
+		}
+	})
+
+	if unknown != "" {
+		return "", fmt.Errorf("unknown placeholder %s in comment template %q", unknown, tmpl)
+	}
+	return expanded, nil
+}
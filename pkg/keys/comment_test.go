@@ -0,0 +1,91 @@
+package keys
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/de-lachende-cavalier/portunus/pkg/testutil"
+)
+
+// TestExpandCommentTemplate tests placeholder expansion in comment templates
+func TestExpandCommentTemplate(t *testing.T) {
+	data := CommentData{
+		Hostname: "laptop-work",
+		User:     "alice",
+		Date:     time.Date(2024, 3, 9, 12, 0, 0, 0, time.UTC),
+		Comment:  "alice@old-laptop",
+		Name:     "id_work",
+	}
+
+	tests := []struct {
+		name    string
+		tmpl    string
+		want    string
+		wantErr bool
+	}{
+		{"UserHost", "{user}@{hostname}", "alice@laptop-work", false},
+		{"Date", "{name} rotated {date}", "id_work rotated 2024-03-09", false},
+		{"OldComment", "{comment} (rotated)", "alice@old-laptop (rotated)", false},
+		{"NoPlaceholders", "deploy key", "deploy key", false},
+		{"UnknownPlaceholder", "{user}@{host}", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExpandCommentTemplate(tt.tmpl, data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ExpandCommentTemplate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ExpandCommentTemplate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestManager_RotateKeys_Comments tests that comments are carried over or set from templates
+func TestManager_RotateKeys_Comments(t *testing.T) {
+	sshDir := testutil.CreateTestSSHDir(t)
+
+	kept, _ := testutil.CreateTestKeyPair(t, sshDir, "id_kept")
+	templated, _ := testutil.CreateTestKeyPair(t, sshDir, "id_templated")
+
+	manager := &Manager{
+		sshDir:    sshDir,
+		generator: &nativeGenerator{},
+	}
+
+	requests := []RotationRequest{
+		{Path: kept, Spec: KeySpec{Cipher: "ed25519"}},
+		{Path: templated, Spec: KeySpec{Cipher: "ed25519"}, CommentTemplate: "{name} ({comment}) {date}"},
+	}
+	if _, err := manager.RotateKeys(context.Background(), requests); err != nil {
+		t.Fatalf("Failed to rotate keys: %v", err)
+	}
+
+	_, comment, err := ReadPublicKey(kept)
+	if err != nil {
+		t.Fatalf("Failed to read public key: %v", err)
+	}
+	if comment != "test@example.com" {
+		t.Errorf("Expected comment to be carried over, got %q", comment)
+	}
+
+	_, comment, err = ReadPublicKey(templated)
+	if err != nil {
+		t.Fatalf("Failed to read public key: %v", err)
+	}
+	expected := "id_templated (test@example.com) " + time.Now().Format(time.DateOnly)
+	if comment != expected {
+		t.Errorf("Expected comment %q, got %q", expected, comment)
+	}
+
+	// An invalid template fails the rotation before anything is replaced
+	requests = []RotationRequest{
+		{Path: kept, Spec: KeySpec{Cipher: "ed25519"}, CommentTemplate: "{unknown}"},
+	}
+	if _, err := manager.RotateKeys(context.Background(), requests); err == nil {
+		t.Error("Expected error for invalid comment template, got nil")
+	}
+}
@@ -0,0 +1,166 @@
+package keys
+
+import (
+	"context"
+	"fmt"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/de-lachende-cavalier/portunus/pkg/logger"
+)
+
+// Distributor authorizes keys on the remote hosts they give access to
+type Distributor interface {
+	// Hosts returns the hosts the key at path gives access to
+	Hosts(path string) []string
+	// Authorize logs in to host with signer and authorizes pubKey there
+	Authorize(ctx context.Context, host string, signer ssh.Signer, pubKey ssh.PublicKey, comment string) error
+	// Verify checks that signer can log in to host
+	Verify(ctx context.Context, host string, signer ssh.Signer) error
+	// Unauthorize logs in to host with signer and removes every entry of pubKey there
+	Unauthorize(ctx context.Context, host string, signer ssh.Signer, pubKey ssh.PublicKey) error
+}
+
+// HostResult describes the outcome of distributing a rotated key to one host
+type HostResult struct {
+	Host string
+	// Authorized is set while the new key is authorized on the host
+	Authorized bool
+	// Retired is set once the old key was removed from the host
+	Retired bool
+	Err     error
+}
+
+// WithDistributor makes the manager install rotated keys on their remote hosts
+func WithDistributor(d Distributor) Option {
+	return func(m *Manager) {
+		m.distributor = d
+	}
+}
+
+// distribution holds what is needed to log in to the hosts of a key while it is rotated
+type distribution struct {
+	oldSigner ssh.Signer
+	newSigner ssh.Signer
+	oldKey    ssh.PublicKey
+	newKey    ssh.PublicKey
+}
+
+// distributeKeys authorizes every staged key on the hosts of the key it replaces,
+// logging in with the old key, and verifies that the new key can log in.
+// It runs before the swap; on failure the new keys are withdrawn from the hosts.
+func (m *Manager) distributeKeys(ctx context.Context, requests []RotationRequest, results []RotationResult,
+	r *rotation, retired []ssh.PublicKey, passphrases []string) ([]*distribution, error) {
+	dists := make([]*distribution, len(requests))
+
+	for i, req := range requests {
+		hosts := m.distributor.Hosts(req.Path)
+		if len(hosts) == 0 {
+			continue
+		}
+
+		d, err := m.prepareDistribution(req, r.staged[i], retired[i], passphrases[i])
+		if err != nil {
+			results[i].Err = err
+			m.withdrawKeys(ctx, dists, results)
+			return nil, err
+		}
+		dists[i] = d
+
+		_, comment, _ := ReadPublicKey(r.staged[i].newPath())
+		for _, host := range hosts {
+			err := m.distributor.Authorize(ctx, host, d.oldSigner, d.newKey, comment)
+			authorized := err == nil
+			if authorized {
+				err = m.distributor.Verify(ctx, host, d.newSigner)
+			}
+			results[i].Hosts = append(results[i].Hosts, HostResult{Host: host, Authorized: authorized, Err: err})
+
+			if err != nil {
+				err = fmt.Errorf("failed to distribute new key of %s to %s: %w", req.Path, host, err)
+				results[i].Err = err
+				m.withdrawKeys(ctx, dists, results)
+				return nil, err
+			}
+			logger.Infof("Authorized new key of %s on %s", req.Path, host)
+		}
+	}
+
+	return dists, nil
+}
+
+// prepareDistribution loads the signers of the old and new keys of a rotated key
+func (m *Manager) prepareDistribution(req RotationRequest, sk *stagedKey, oldKey ssh.PublicKey, passphrase string) (*distribution, error) {
+	if oldKey == nil {
+		return nil, fmt.Errorf("cannot log in to the hosts of %s: its public key could not be read", req.Path)
+	}
+
+	oldSigner, err := m.loginSigner(req.Path, oldKey, req.OldPassphrase)
+	if err != nil {
+		return nil, fmt.Errorf("cannot log in to the hosts of %s: %w", req.Path, err)
+	}
+
+	newSigner, err := LoadSigner(sk.newPath(), passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	return &distribution{oldSigner: oldSigner, newSigner: newSigner, oldKey: oldKey, newKey: newSigner.PublicKey()}, nil
+}
+
+// loginSigner returns a signer for the key at path, taken from the agent when it holds the key,
+// or decrypted with passphrase otherwise
+func (m *Manager) loginSigner(path string, pubKey ssh.PublicKey, passphrase string) (ssh.Signer, error) {
+	if m.agent != nil {
+		if signer, err := m.agent.Signer(pubKey); err == nil && signer != nil {
+			return signer, nil
+		}
+	}
+
+	return LoadSigner(path, passphrase)
+}
+
+// withdrawKeys removes the new keys from the hosts they were authorized on,
+// after the rotation was aborted. Failures are only logged.
+func (m *Manager) withdrawKeys(ctx context.Context, dists []*distribution, results []RotationResult) {
+	// Withdrawing must happen even if the rotation was interrupted
+	ctx = context.WithoutCancel(ctx)
+
+	for i, d := range dists {
+		if d == nil {
+			continue
+		}
+		for j, host := range results[i].Hosts {
+			if !host.Authorized {
+				continue
+			}
+			if err := m.distributor.Unauthorize(ctx, host.Host, d.oldSigner, d.newKey); err != nil {
+				logger.Errorf(err, "Failed to withdraw new key of %s from %s", results[i].Path, host.Host)
+				continue
+			}
+			results[i].Hosts[j].Authorized = false
+		}
+	}
+}
+
+// retireRemoteKeys removes the old keys from the hosts, logging in with the new keys.
+// It runs after the swap, so failures are recorded per host but do not undo the rotation.
+func (m *Manager) retireRemoteKeys(ctx context.Context, dists []*distribution, results []RotationResult) {
+	for i, d := range dists {
+		if d == nil {
+			continue
+		}
+		for j, host := range results[i].Hosts {
+			if !host.Authorized {
+				continue
+			}
+			if err := m.distributor.Unauthorize(ctx, host.Host, d.newSigner, d.oldKey); err != nil {
+				logger.Errorf(err, "Failed to remove old key of %s from %s", results[i].Path, host.Host)
+				results[i].Hosts[j].Err = err
+				continue
+			}
+			results[i].Hosts[j].Retired = true
+			logger.Infof("Removed old key of %s from %s", results[i].Path, host.Host)
+		}
+	}
+}
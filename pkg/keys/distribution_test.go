@@ -0,0 +1,183 @@
+package keys
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/de-lachende-cavalier/portunus/pkg/testutil"
+)
+
+// fakeDistributor keeps the authorized_keys files of its hosts in memory,
+// only letting authorized keys log in to them
+type fakeDistributor struct {
+	hosts map[string][]byte
+	// unreachable hosts reject every login after the first one
+	unreachable map[string]bool
+	logins      map[string]int
+}
+
+func (d *fakeDistributor) Hosts(path string) []string {
+	var hosts []string
+	for host := range d.hosts {
+		hosts = append(hosts, host)
+	}
+	return hosts
+}
+
+func (d *fakeDistributor) login(host string, signer ssh.Signer) error {
+	d.logins[host]++
+	if d.unreachable[host] && d.logins[host] > 1 {
+		return errors.New("connection refused")
+	}
+	if !IsAuthorized(d.hosts[host], signer.PublicKey()) {
+		return fmt.Errorf("%s: permission denied", host)
+	}
+	return nil
+}
+
+func (d *fakeDistributor) Authorize(ctx context.Context, host string, signer ssh.Signer, pubKey ssh.PublicKey, comment string) error {
+	if err := d.login(host, signer); err != nil {
+		return err
+	}
+	d.hosts[host], _ = AuthorizeKey(d.hosts[host], pubKey, comment)
+	return nil
+}
+
+func (d *fakeDistributor) Verify(ctx context.Context, host string, signer ssh.Signer) error {
+	return d.login(host, signer)
+}
+
+func (d *fakeDistributor) Unauthorize(ctx context.Context, host string, signer ssh.Signer, pubKey ssh.PublicKey) error {
+	if err := d.login(host, signer); err != nil {
+		return err
+	}
+	d.hosts[host], _ = UnauthorizeKey(d.hosts[host], pubKey)
+	return nil
+}
+
+// newFakeDistributor returns a distributor whose hosts authorize the key at path
+func newFakeDistributor(t *testing.T, path string, hosts ...string) *fakeDistributor {
+	t.Helper()
+	pubKey, err := LoadPublicKey(path)
+	if err != nil {
+		t.Fatalf("Failed to load public key: %v", err)
+	}
+	d := &fakeDistributor{hosts: make(map[string][]byte), unreachable: make(map[string]bool), logins: make(map[string]int)}
+	for _, host := range hosts {
+		d.hosts[host] = authorizedKeyLine(pubKey, "")
+	}
+	return d
+}
+
+// TestManager_RotateKeys_Distribute tests replacing a rotated key on its remote hosts
+func TestManager_RotateKeys_Distribute(t *testing.T) {
+	sshDir := testutil.CreateTestSSHDir(t)
+	keyPath := filepath.Join(sshDir, "id_ed25519")
+	generateTestKey(t, keyPath, "secret")
+	oldKey, _ := LoadPublicKey(keyPath)
+
+	d := newFakeDistributor(t, keyPath, "alice@web", "alice@db")
+	manager := &Manager{sshDir: sshDir, generator: &nativeGenerator{}, distributor: d}
+
+	requests := NewRotationRequests([]string{keyPath}, KeySpec{Cipher: "ed25519", Passphrase: "secret"})
+	requests[0].OldPassphrase = "secret"
+	results, err := manager.RotateKeys(context.Background(), requests)
+	if err != nil {
+		t.Fatalf("Failed to rotate keys: %v", err)
+	}
+
+	newKey, _ := LoadPublicKey(keyPath)
+	if len(results[0].Hosts) != 2 {
+		t.Fatalf("Expected 2 host results, got %v", results[0].Hosts)
+	}
+	for _, host := range results[0].Hosts {
+		if !host.Authorized || !host.Retired || host.Err != nil {
+			t.Errorf("Expected the key to be replaced on %s, got %+v", host.Host, host)
+		}
+		data := d.hosts[host.Host]
+		if !IsAuthorized(data, newKey) || IsAuthorized(data, oldKey) {
+			t.Errorf("Expected only the new key to be authorized on %s, got:\n%s", host.Host, data)
+		}
+	}
+}
+
+// TestManager_RotateKeys_DistributeFailure tests that a host that cannot be updated aborts the rotation
+func TestManager_RotateKeys_DistributeFailure(t *testing.T) {
+	sshDir := testutil.CreateTestSSHDir(t)
+	keyPath := filepath.Join(sshDir, "id_ed25519")
+	fingerprint := generateTestKey(t, keyPath, "secret")
+	oldKey, _ := LoadPublicKey(keyPath)
+
+	t.Run("unreachable host", func(t *testing.T) {
+		d := newFakeDistributor(t, keyPath, "alice@web", "alice@db")
+		for host := range d.hosts {
+			d.unreachable[host] = true
+		}
+		manager := &Manager{sshDir: sshDir, generator: &nativeGenerator{}, distributor: d}
+
+		requests := NewRotationRequests([]string{keyPath}, KeySpec{Cipher: "ed25519", Passphrase: "secret"})
+		requests[0].OldPassphrase = "secret"
+		results, err := manager.RotateKeys(context.Background(), requests)
+		if err == nil || results[0].Success {
+			t.Fatal("Expected the rotation to fail")
+		}
+
+		if got, _ := PublicKeyFingerprint(keyPath); got != fingerprint {
+			t.Error("Expected the original key to be kept")
+		}
+		// The new key was added to the first host before verifying it failed, and stays there:
+		// withdrawing it needs another login, which the host refuses
+		for host, data := range d.hosts {
+			if !IsAuthorized(data, oldKey) {
+				t.Errorf("Expected the old key to stay authorized on %s", host)
+			}
+		}
+	})
+
+	t.Run("withdrawn from updated hosts", func(t *testing.T) {
+		d := newFakeDistributor(t, keyPath, "alice@web", "alice@db")
+		// One host does not authorize the old key, so the new one cannot be installed there
+		hosts := d.Hosts(keyPath)
+		d.hosts[hosts[1]] = nil
+		manager := &Manager{sshDir: sshDir, generator: &nativeGenerator{}, distributor: d}
+
+		requests := NewRotationRequests([]string{keyPath}, KeySpec{Cipher: "ed25519", Passphrase: "secret"})
+		requests[0].OldPassphrase = "secret"
+		results, err := manager.RotateKeys(context.Background(), requests)
+		if err == nil || results[0].Success {
+			t.Fatal("Expected the rotation to fail")
+		}
+
+		if got, _ := PublicKeyFingerprint(keyPath); got != fingerprint {
+			t.Error("Expected the original key to be kept")
+		}
+		want := string(authorizedKeyLine(oldKey, ""))
+		if data := string(d.hosts[hosts[0]]); data != want {
+			t.Errorf("Expected the new key to be withdrawn from %s, got:\n%s", hosts[0], data)
+		}
+		for _, host := range results[0].Hosts {
+			if host.Authorized {
+				t.Errorf("Expected the new key not to be authorized on %s anymore", host.Host)
+			}
+		}
+	})
+
+	t.Run("old key cannot log in", func(t *testing.T) {
+		d := newFakeDistributor(t, keyPath, "alice@web")
+		manager := &Manager{sshDir: sshDir, generator: &nativeGenerator{}, distributor: d}
+
+		requests := NewRotationRequests([]string{keyPath}, KeySpec{Cipher: "ed25519", Passphrase: "secret"})
+		requests[0].OldPassphrase = "wrong"
+		if _, err := manager.RotateKeys(context.Background(), requests); !errors.Is(err, ErrIncorrectPassphrase) {
+			t.Errorf("Expected ErrIncorrectPassphrase, got %v", err)
+		}
+		if d.logins["alice@web"] != 0 {
+			t.Error("Expected no login attempt")
+		}
+	})
+}
@@ -0,0 +1,65 @@
+package keys
+
+import (
+	"context"
+	"fmt"
+)
+
+// Backend names accepted by NewGenerator
+const (
+	BackendNative    = "native"
+	BackendSSHKeygen = "ssh-keygen"
+)
+
+// DefaultBackend is the backend used when none is specified
+const DefaultBackend = BackendNative
+
+// SupportedBackends is a list of supported key generation backends
+var SupportedBackends = map[string]bool{
+	BackendNative:    true,
+	BackendSSHKeygen: true,
+}
+
+// CipherKeep regenerates each key with the algorithm and size it already has
+const CipherKeep = "keep"
+
+// KeySpec describes the key pair a Generator should produce
+type KeySpec struct {
+	Cipher     string
+	Bits       int
+	Passphrase string
+	// Comment is stored in the key pair; backends use user@host when empty
+	Comment string
+}
+
+// Generator creates SSH key pairs on disk
+type Generator interface {
+	// Name returns the backend name of the generator
+	Name() string
+	// Generate writes a new private key to path and its public key to path.pub
+	Generate(ctx context.Context, path string, spec KeySpec) error
+}
+
+// NewGenerator returns the generator for the named backend
+func NewGenerator(backend string) (Generator, error) {
+	switch backend {
+	case BackendNative:
+		return &nativeGenerator{}, nil
+	case BackendSSHKeygen:
+		return &sshKeygenGenerator{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported backend: %s", backend)
+	}
+}
+
+// defaultBits returns the key size used for a cipher when none is specified
+func defaultBits(cipher string) int {
+	switch cipher {
+	case "rsa":
+		return 4096
+	case "ecdsa":
+		return 521
+	default:
+		return 0
+	}
+}
@@ -5,11 +5,11 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"strings"
 	"time"
 
+	"golang.org/x/crypto/ssh"
+
 	"github.com/de-lachende-cavalier/portunus/pkg/logger"
 )
 
@@ -22,11 +22,56 @@ var SupportedCiphers = map[string]bool{
 
 // Manager handles SSH key operations
 type Manager struct {
-	sshDir string
+	sshDir      string
+	generator   Generator
+	archive     *Archive
+	roots       []Root
+	sink        PassphraseSink
+	agent       *Agent
+	krl         *RevocationList
+	distributor Distributor
+}
+
+// Option configures a Manager
+type Option func(*Manager)
+
+// WithGenerator sets the backend used to generate key pairs
+func WithGenerator(g Generator) Option {
+	return func(m *Manager) {
+		m.generator = g
+	}
+}
+
+// WithArchive makes the manager archive retired key pairs instead of deleting them
+func WithArchive(a *Archive) Option {
+	return func(m *Manager) {
+		m.archive = a
+	}
+}
+
+// WithRoots sets the directories searched for private keys (default ~/.ssh)
+func WithRoots(roots ...Root) Option {
+	return func(m *Manager) {
+		m.roots = roots
+	}
+}
+
+// WithAgent makes the manager swap rotated keys in the given ssh-agent
+func WithAgent(a *Agent) Option {
+	return func(m *Manager) {
+		m.agent = a
+	}
+}
+
+// WithRevocationList makes the manager revoke retired public keys in the given KRL
+func WithRevocationList(l *RevocationList) Option {
+	return func(m *Manager) {
+		m.krl = l
+	}
 }
 
 // NewManager creates a new key manager
-func NewManager() (*Manager, error) {
+func NewManager(opts ...Option) (*Manager, error) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get home directory: %w", err)
@@ -37,9 +82,15 @@ func NewManager() (*Manager, error) {
 		return nil, fmt.Errorf("failed to ensure SSH directory exists: %w", err)
 	}
 
-	return &Manager{
-		sshDir: sshDir,
-	}, nil
+	m := &Manager{
+		sshDir:    sshDir,
+		generator: &nativeGenerator{},
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m, nil
 }
 
 // ensureDir ensures that the directory exists
@@ -50,42 +101,26 @@ func ensureDir(dir string) error {
 	return nil
 }
 
-// GetAllKeys returns all private keys in the SSH directory
+// GetAllKeys returns all private keys in the key roots.
+// Files that cannot be positively identified as private keys are skipped.
 func (m *Manager) GetAllKeys(ctx context.Context) ([]string, error) {
-	var keys []string
-
-	entries, err := os.ReadDir(m.sshDir)
+	discovery, err := m.DiscoverKeys(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read SSH directory: %w", err)
+		return nil, err
 	}
 
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
-		}
+	for _, skipped := range discovery.Skipped {
+		logger.Debugf("Skipping %s: %s", skipped.Path, skipped.Reason)
+	}
 
-		name := entry.Name()
-		if isPrivateKey(name) {
-			keys = append(keys, filepath.Join(m.sshDir, name))
-		}
+	var keys []string
+	for _, key := range discovery.Keys {
+		keys = append(keys, key.Path)
 	}
 
 	return keys, nil
 }
 
-// isPrivateKey checks if a file is likely a private key
-func isPrivateKey(name string) bool {
-	// Skip common non-key files
-	if strings.Contains(name, "authorized_keys") ||
-		strings.Contains(name, "known_hosts") ||
-		strings.Contains(name, "config") ||
-		strings.HasSuffix(name, ".pub") ||
-		strings.HasPrefix(name, ".") {
-		return false
-	}
-	return true
-}
-
 // DeleteKeyPair deletes both the private and public key files
 func (m *Manager) DeleteKeyPair(ctx context.Context, path string) error {
 	// Delete private key
@@ -103,29 +138,17 @@ func (m *Manager) DeleteKeyPair(ctx context.Context, path string) error {
 }
 
 // GenerateKeyPair generates a new SSH key pair
-func (m *Manager) GenerateKeyPair(ctx context.Context, path, cipher, password string) error {
-	if !SupportedCiphers[cipher] {
-		return fmt.Errorf("unsupported cipher: %s", cipher)
+func (m *Manager) GenerateKeyPair(ctx context.Context, path string, spec KeySpec) error {
+	if !SupportedCiphers[spec.Cipher] {
+		return fmt.Errorf("unsupported cipher: %s", spec.Cipher)
 	}
 
-	// Remove existing keys to avoid ssh-keygen prompts
+	// Remove existing keys so backends never have to overwrite them
 	_ = os.Remove(path)
 	_ = os.Remove(path + ".pub")
 
-	args := []string{"-q", "-t", cipher, "-N", password, "-f", path, "-a", "100"}
-
-	// Add specific options based on cipher type
-	switch cipher {
-	case "rsa":
-		args = append(args, "-b", "4096")
-	case "ecdsa":
-		args = append(args, "-b", "521")
-	}
-
-	cmd := exec.CommandContext(ctx, "ssh-keygen", args...)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("ssh-keygen failed: %w, output: %s", err, string(output))
+	if err := m.generator.Generate(ctx, path, spec); err != nil {
+		return err
 	}
 
 	// Verify the keys were created
@@ -136,25 +159,216 @@ func (m *Manager) GenerateKeyPair(ctx context.Context, path, cipher, password st
 		return fmt.Errorf("public key was not created at %s.pub", path)
 	}
 
-	logger.Infof("Generated new key pair: %s", path)
+	logger.Infof("Generated new key pair: %s (backend: %s)", path, m.generator.Name())
 	return nil
 }
 
-// RotateKeys rotates the specified keys
-func (m *Manager) RotateKeys(ctx context.Context, paths []string, cipher, password string) (map[string]time.Time, error) {
-	creationTimes := make(map[string]time.Time)
+// RotateKeys rotates the specified keys and reports the outcome for every path.
+// New key pairs are staged first and only swapped in once every key in the batch
+// was generated; on any failure or cancellation the original key pairs are restored.
+// With a distributor, new keys are authorized and verified on the remote hosts of the keys
+// they replace before the swap, and the old keys are removed from the hosts after it.
+// Retired key pairs are moved to the archive if one is configured, deleted otherwise,
+// and their public keys are added to the revocation list if one is configured.
+func (m *Manager) RotateKeys(ctx context.Context, requests []RotationRequest) ([]RotationResult, error) {
+	results := make([]RotationResult, len(requests))
+	retired := make([]ssh.PublicKey, len(requests))
+	for i, req := range requests {
+		results[i].Path = req.Path
+		// A key without a readable public key simply has no old fingerprint
+		results[i].OldFingerprint, _ = PublicKeyFingerprint(req.Path)
+		retired[i], _ = LoadPublicKey(req.Path)
+		results[i].OldPublicKey = retired[i]
+	}
+
+	r := &rotation{}
+	passphrases := make([]string, len(requests))
+	generated := make(map[int]string)
+
+	var err error
+	for i, req := range requests {
+		if err = ctx.Err(); err != nil {
+			err = fmt.Errorf("rotation interrupted: %w", err)
+			break
+		}
+
+		if req.GeneratePassphrase && m.sink == nil {
+			err = fmt.Errorf("no passphrase sink configured to store the generated passphrase of %s", req.Path)
+			results[i].Err = err
+			break
+		}
+
+		var spec KeySpec
+		if spec, err = r.stage(ctx, m, req); err != nil {
+			results[i].Err = err
+			break
+		}
+		passphrases[i] = spec.Passphrase
+		if req.GeneratePassphrase {
+			generated[i] = spec.Passphrase
+		}
+
+		results[i].Cipher = spec.Cipher
+		results[i].Bits = spec.Bits
+		if results[i].Bits == 0 {
+			results[i].Bits = defaultBits(spec.Cipher)
+		}
+		results[i].CreatedAt = time.Now()
+		results[i].NewFingerprint, _ = PublicKeyFingerprint(r.staged[i].newPath())
+	}
+
+	if err == nil {
+		err = m.storePassphrases(ctx, requests, results, generated)
+	}
+
+	var dists []*distribution
+	if err == nil && m.distributor != nil {
+		dists, err = m.distributeKeys(ctx, requests, results, r, retired, passphrases)
+	}
+
+	if err == nil {
+		var failed int
+		if failed, err = r.swap(ctx); err != nil {
+			results[failed].Err = err
+
+			if rollbackErr := r.rollback(); rollbackErr != nil {
+				// Keep the staging directories, they may hold the only copy of the original keys.
+				// Remote hosts keep authorizing both the old and the new keys.
+				err = fmt.Errorf("%w (rollback failed, original keys left in staging directories: %v)", err, rollbackErr)
+				markLiveKeys(results)
+				abortRemaining(results, err)
+				return results, err
+			}
+			if dists != nil {
+				m.withdrawKeys(ctx, dists, results)
+			}
+		}
+	}
+
+	if err != nil {
+		r.cleanup()
+		abortRemaining(results, err)
+		return results, err
+	}
+
+	now := time.Now()
+	for i := range results {
+		results[i].Success = true
+		results[i].RotatedAt = now
+	}
+
+	if dists != nil {
+		m.retireRemoteKeys(ctx, dists, results)
+	}
+
+	if m.agent != nil {
+		m.updateAgent(requests, results, passphrases)
+	}
+
+	if m.krl != nil {
+		m.revokeRetired(retired, results)
+	}
+
+	if m.archive != nil {
+		entry, err := r.retire(m.archive)
+		if err != nil {
+			// The rotation itself succeeded, so keep the retired keys rather than deleting them
+			logger.Errorf(err, "Failed to archive retired keys, they were left in the staging directories")
+			return results, nil
+		}
+
+		for i := range results {
+			results[i].ArchiveID = entry.ID
+		}
+		logger.Infof("Archived retired keys in %s", filepath.Join(m.archive.Dir(), entry.ID))
+	}
+
+	r.cleanup()
+	return results, nil
+}
+
+// updateAgent replaces the retired keys loaded in the agent with the new ones.
+// Agent failures do not undo the rotation, they are only logged.
+func (m *Manager) updateAgent(requests []RotationRequest, results []RotationResult, passphrases []string) {
+	for i, req := range requests {
+		var expiresAt time.Time
+		if req.Lifetime > 0 {
+			expiresAt = results[i].CreatedAt.Add(req.Lifetime)
+		}
 
-	for _, path := range paths {
-		if err := m.DeleteKeyPair(ctx, path); err != nil {
-			return nil, err
+		if err := m.agent.Replace(results[i].OldFingerprint, req.Path, passphrases[i], expiresAt); err != nil {
+			logger.Errorf(err, "Failed to update ssh-agent for %s", req.Path)
+			continue
+		}
+		results[i].AgentLoaded = true
+	}
+}
+
+// revokeRetired adds the retired public keys to the revocation list.
+// Failures do not undo the rotation, they are only logged.
+func (m *Manager) revokeRetired(retired []ssh.PublicKey, results []RotationResult) {
+	var pubKeys []ssh.PublicKey
+	for i, pubKey := range retired {
+		if pubKey == nil {
+			logger.Infof("Not revoking the retired key of %s: its public key could not be read", results[i].Path)
+			continue
+		}
+		pubKeys = append(pubKeys, pubKey)
+	}
+	if len(pubKeys) == 0 {
+		return
+	}
+
+	if _, err := m.krl.Revoke(pubKeys...); err != nil {
+		logger.Errorf(err, "Failed to revoke retired keys in %s", m.krl.Path())
+		return
+	}
+	for i := range results {
+		results[i].Revoked = retired[i] != nil
+	}
+}
+
+// storePassphrases hands the generated passphrases of the staged keys to the sink.
+// It runs before the swap so no key goes live with a passphrase nobody knows.
+func (m *Manager) storePassphrases(ctx context.Context, requests []RotationRequest, results []RotationResult, generated map[int]string) error {
+	for i, req := range requests {
+		passphrase, ok := generated[i]
+		if !ok {
+			continue
 		}
 
-		if err := m.GenerateKeyPair(ctx, path, cipher, password); err != nil {
-			return nil, err
+		ref, err := m.sink.Store(ctx, m.SecretName(req.Path), passphrase)
+		if err != nil {
+			err = fmt.Errorf("failed to store passphrase for %s: %w", req.Path, err)
+			results[i].Err = err
+			return err
 		}
+		results[i].PassphraseRef = ref
+	}
+	return nil
+}
 
-		creationTimes[path] = time.Now()
+// markLiveKeys marks as successful the keys whose new public key is in place
+// after a rollback could not restore them
+func markLiveKeys(results []RotationResult) {
+	now := time.Now()
+	for i := range results {
+		if results[i].NewFingerprint == "" {
+			continue
+		}
+		if fp, err := PublicKeyFingerprint(results[i].Path); err == nil && fp == results[i].NewFingerprint {
+			results[i].Success = true
+			results[i].Err = nil
+			results[i].RotatedAt = now
+		}
 	}
+}
 
-	return creationTimes, nil
+// abortRemaining records the batch failure on every key that has no outcome yet
+func abortRemaining(results []RotationResult, cause error) {
+	for i := range results {
+		if !results[i].Success && results[i].Err == nil {
+			results[i].Err = fmt.Errorf("%w: %v", ErrRotationAborted, cause)
+		}
+	}
 }
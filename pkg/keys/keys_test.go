@@ -119,12 +119,13 @@ func TestManager_GenerateKeyPair(t *testing.T) {
 
 	// Create a manager with the test SSH directory
 	manager := &Manager{
-		sshDir: sshDir,
+		sshDir:    sshDir,
+		generator: &sshKeygenGenerator{},
 	}
 
 	// Generate a key pair
 	keyPath := filepath.Join(sshDir, "test_key")
-	err := manager.GenerateKeyPair(context.Background(), keyPath, "ed25519", "")
+	err := manager.GenerateKeyPair(context.Background(), keyPath, KeySpec{Cipher: "ed25519"})
 	if err != nil {
 		t.Fatalf("Failed to generate key pair: %v", err)
 	}
@@ -150,18 +151,30 @@ func TestManager_RotateKeys(t *testing.T) {
 
 	// Create a manager with the test SSH directory
 	manager := &Manager{
-		sshDir: sshDir,
+		sshDir:    sshDir,
+		generator: &sshKeygenGenerator{},
 	}
 
 	// Rotate the keys
-	creationTimes, err := manager.RotateKeys(context.Background(), []string{key1, key2}, "ed25519", "")
+	results, err := manager.RotateKeys(context.Background(), NewRotationRequests([]string{key1, key2}, KeySpec{Cipher: "ed25519"}))
 	if err != nil {
 		t.Fatalf("Failed to rotate keys: %v", err)
 	}
 
-	// Check if the creation times are returned
-	if len(creationTimes) != 2 {
-		t.Errorf("Expected 2 creation times, got %d", len(creationTimes))
+	// Check if a successful result is returned for every key
+	if len(results) != 2 {
+		t.Errorf("Expected 2 results, got %d", len(results))
+	}
+	for _, result := range results {
+		if !result.Success || result.Err != nil {
+			t.Errorf("Expected key %s to be rotated, got error: %v", result.Path, result.Err)
+		}
+		if result.CreatedAt.IsZero() || result.RotatedAt.IsZero() {
+			t.Errorf("Expected timestamps for key %s", result.Path)
+		}
+		if result.NewFingerprint == "" || result.NewFingerprint == result.OldFingerprint {
+			t.Errorf("Expected a new fingerprint for key %s, got %q (old %q)", result.Path, result.NewFingerprint, result.OldFingerprint)
+		}
 	}
 
 	// Check if the key files still exist (they should be recreated)
@@ -170,28 +183,3 @@ func TestManager_RotateKeys(t *testing.T) {
 	testutil.AssertFileExists(t, key2)
 	testutil.AssertFileExists(t, key2+".pub")
 }
-
-// TestIsPrivateKey tests the isPrivateKey function
-func TestIsPrivateKey(t *testing.T) {
-	tests := []struct {
-		name     string
-		filename string
-		want     bool
-	}{
-		{"ValidKey", "id_ed25519", true},
-		{"ValidKey2", "id_rsa", true},
-		{"PublicKey", "id_ed25519.pub", false},
-		{"AuthorizedKeys", "authorized_keys", false},
-		{"KnownHosts", "known_hosts", false},
-		{"Config", "config", false},
-		{"HiddenFile", ".hidden", false},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if got := isPrivateKey(tt.filename); got != tt.want {
-				t.Errorf("isPrivateKey() = %v, want %v", got, tt.want)
-			}
-		})
-	}
-}
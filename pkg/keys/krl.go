@@ -0,0 +1,348 @@
+package keys
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// DefaultKRLName is the name of the key revocation list inside ~/.ssh
+const DefaultKRLName = "portunus.krl"
+
+// Binary KRL format constants, see PROTOCOL.krl in the OpenSSH sources
+const (
+	krlMagic              = 0x5353484b524c0a00
+	krlFormatVersion      = 1
+	krlSectionExplicitKey = 2
+	krlSectionSHA1        = 3
+	krlSectionSignature   = 4
+	krlSectionSHA256      = 5
+)
+
+// krlComment is recorded in the KRLs written by portunus
+const krlComment = "portunus: retired keys"
+
+// ErrInvalidKRL is returned when a file is not a binary OpenSSH KRL
+var ErrInvalidKRL = errors.New("not an OpenSSH key revocation list")
+
+// ErrSignedKRL is returned when changing a signed KRL, whose signatures would no longer match
+var ErrSignedKRL = errors.New("key revocation list is signed")
+
+// RevocationList is an OpenSSH key revocation list (KRL) of retired public keys,
+// which servers enforce through the RevokedKeys option of sshd_config
+type RevocationList struct {
+	path string
+}
+
+// KRL is the content of a key revocation list
+type KRL struct {
+	// Version is incremented every time the list changes
+	Version     uint64
+	GeneratedAt time.Time
+	Comment     string
+	// Keys are the explicitly revoked public keys
+	Keys []ssh.PublicKey
+
+	flags uint64
+	// sections are the other sections of the list, such as revoked certificates
+	// or fingerprints, kept as read so they are written back unchanged
+	sections []krlSection
+}
+
+// krlSection is a KRL section portunus does not edit
+type krlSection struct {
+	typ  byte
+	data []byte
+}
+
+// NewRevocationList creates a revocation list stored at path
+func NewRevocationList(path string) *RevocationList {
+	return &RevocationList{path: path}
+}
+
+// Path returns where the revocation list is stored
+func (l *RevocationList) Path() string {
+	return l.path
+}
+
+// Load reads the revocation list, which is empty if it was never written
+func (l *RevocationList) Load() (*KRL, error) {
+	data, err := os.ReadFile(l.path)
+	if os.IsNotExist(err) {
+		return &KRL{Comment: krlComment}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read revocation list: %w", err)
+	}
+
+	krl, err := ParseKRL(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse revocation list %s: %w", l.path, err)
+	}
+	return krl, nil
+}
+
+// Revoke adds public keys to the revocation list and returns those that were not revoked yet
+func (l *RevocationList) Revoke(pubKeys ...ssh.PublicKey) ([]ssh.PublicKey, error) {
+	krl, err := l.Load()
+	if err != nil {
+		return nil, err
+	}
+	if krl.Signed() {
+		return nil, fmt.Errorf("%w: %s can only be changed with ssh-keygen", ErrSignedKRL, l.path)
+	}
+
+	var added []ssh.PublicKey
+	for _, pubKey := range pubKeys {
+		if !krl.IsRevoked(pubKey) {
+			krl.Keys = append(krl.Keys, pubKey)
+			added = append(added, pubKey)
+		}
+	}
+	if len(added) == 0 {
+		return nil, nil
+	}
+
+	krl.Version++
+	krl.GeneratedAt = time.Now()
+	if err := l.save(krl); err != nil {
+		return nil, err
+	}
+	return added, nil
+}
+
+// save atomically replaces the revocation list file
+func (l *RevocationList) save(krl *KRL) error {
+	if err := os.MkdirAll(filepath.Dir(l.path), 0700); err != nil {
+		return fmt.Errorf("failed to create revocation list directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(l.path), ".portunus-krl-*")
+	if err != nil {
+		return fmt.Errorf("failed to write revocation list: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(krl.Marshal())
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write revocation list: %w", err)
+	}
+
+	// The list only holds public keys and is meant to be copied to servers
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("failed to write revocation list: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), l.path); err != nil {
+		return fmt.Errorf("failed to write revocation list: %w", err)
+	}
+	return nil
+}
+
+// IsRevoked reports whether pubKey is in the list, explicitly or by fingerprint
+func (k *KRL) IsRevoked(pubKey ssh.PublicKey) bool {
+	blob := pubKey.Marshal()
+	for _, key := range k.Keys {
+		if bytes.Equal(key.Marshal(), blob) {
+			return true
+		}
+	}
+
+	sha1Sum := sha1.Sum(blob)
+	sha256Sum := sha256.Sum256(blob)
+	for _, section := range k.sections {
+		var fingerprint []byte
+		switch section.typ {
+		case krlSectionSHA1:
+			fingerprint = sha1Sum[:]
+		case krlSectionSHA256:
+			fingerprint = sha256Sum[:]
+		default:
+			continue
+		}
+
+		r := krlReader{data: section.data}
+		for r.err == nil && len(r.data) > 0 {
+			if bytes.Equal(r.string(), fingerprint) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Signed reports whether the list carries signatures
+func (k *KRL) Signed() bool {
+	for _, section := range k.sections {
+		if section.typ == krlSectionSignature {
+			return true
+		}
+	}
+	return false
+}
+
+// Marshal encodes the list in the binary KRL format understood by sshd and ssh-keygen -Q
+func (k *KRL) Marshal() []byte {
+	// OpenSSH writes explicit keys ordered by their blobs
+	blobs := make([][]byte, len(k.Keys))
+	for i, key := range k.Keys {
+		blobs[i] = key.Marshal()
+	}
+	slices.SortFunc(blobs, bytes.Compare)
+
+	var section []byte
+	for _, blob := range blobs {
+		section = appendString(section, blob)
+	}
+
+	var generatedAt uint64
+	if !k.GeneratedAt.IsZero() {
+		generatedAt = uint64(k.GeneratedAt.Unix())
+	}
+
+	var out []byte
+	out = binary.BigEndian.AppendUint64(out, krlMagic)
+	out = binary.BigEndian.AppendUint32(out, krlFormatVersion)
+	out = binary.BigEndian.AppendUint64(out, k.Version)
+	out = binary.BigEndian.AppendUint64(out, generatedAt)
+	out = binary.BigEndian.AppendUint64(out, k.flags)
+	out = appendString(out, nil) // reserved
+	out = appendString(out, []byte(k.Comment))
+	if len(section) > 0 {
+		out = append(out, krlSectionExplicitKey)
+		out = appendString(out, section)
+	}
+	// Signatures cover everything before them, so they stay last
+	for _, other := range k.sections {
+		out = append(out, other.typ)
+		out = appendString(out, other.data)
+	}
+	return out
+}
+
+// ParseKRL decodes a binary KRL. Explicitly revoked keys are decoded into Keys;
+// other sections, such as revoked certificates, are kept as they are.
+func ParseKRL(data []byte) (*KRL, error) {
+	r := krlReader{data: data}
+
+	magic := r.uint64()
+	format := r.uint32()
+	if r.err != nil || magic != krlMagic {
+		return nil, ErrInvalidKRL
+	}
+	if format != krlFormatVersion {
+		return nil, fmt.Errorf("unsupported KRL format version %d", format)
+	}
+
+	krl := &KRL{Version: r.uint64()}
+	if generatedAt := r.uint64(); generatedAt != 0 {
+		krl.GeneratedAt = time.Unix(int64(generatedAt), 0)
+	}
+	krl.flags = r.uint64()
+	r.string() // reserved
+	krl.Comment = string(r.string())
+
+	for r.err == nil && len(r.data) > 0 {
+		sectionType := r.byte()
+		data := r.string()
+		if r.err != nil {
+			break
+		}
+		if sectionType != krlSectionExplicitKey {
+			krl.sections = append(krl.sections, krlSection{typ: sectionType, data: data})
+			continue
+		}
+
+		section := krlReader{data: data}
+		for section.err == nil && len(section.data) > 0 {
+			blob := section.string()
+			if section.err != nil {
+				break
+			}
+			pubKey, err := ssh.ParsePublicKey(blob)
+			if err != nil {
+				return nil, fmt.Errorf("invalid revoked key: %w", err)
+			}
+			krl.Keys = append(krl.Keys, pubKey)
+		}
+		if section.err != nil {
+			return nil, section.err
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return krl, nil
+}
+
+// appendString appends an SSH wire format string
+func appendString(out, s []byte) []byte {
+	out = binary.BigEndian.AppendUint32(out, uint32(len(s)))
+	return append(out, s...)
+}
+
+// krlReader decodes SSH wire format values, remembering the first error
+type krlReader struct {
+	data []byte
+	err  error
+}
+
+// errTruncatedKRL is returned when a KRL ends in the middle of a value
+var errTruncatedKRL = errors.New("truncated key revocation list")
+
+func (r *krlReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.data) < n {
+		r.err = errTruncatedKRL
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *krlReader) byte() byte {
+	if b := r.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *krlReader) uint32() uint32 {
+	if b := r.next(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *krlReader) uint64() uint64 {
+	if b := r.next(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (r *krlReader) string() []byte {
+	n := r.uint32()
+	if r.err != nil {
+		return nil
+	}
+	if uint64(n) > uint64(len(r.data)) {
+		r.err = errTruncatedKRL
+		return nil
+	}
+	return r.next(int(n))
+}
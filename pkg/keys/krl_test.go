@@ -0,0 +1,267 @@
+package keys
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/de-lachende-cavalier/portunus/pkg/testutil"
+)
+
+// TestRevocationList_Revoke tests adding keys to a revocation list and reading it back
+func TestRevocationList_Revoke(t *testing.T) {
+	sshDir := testutil.CreateTestSSHDir(t)
+	krl := NewRevocationList(filepath.Join(sshDir, DefaultKRLName))
+
+	list, err := krl.Load()
+	if err != nil {
+		t.Fatalf("Failed to load empty revocation list: %v", err)
+	}
+	if len(list.Keys) != 0 {
+		t.Errorf("Expected an empty revocation list, got %d keys", len(list.Keys))
+	}
+
+	var pubKeys []ssh.PublicKey
+	for _, name := range []string{"id_a", "id_b"} {
+		keyPath := filepath.Join(sshDir, name)
+		generateTestKey(t, keyPath, "")
+		pubKey, err := LoadPublicKey(keyPath)
+		if err != nil {
+			t.Fatalf("Failed to load public key: %v", err)
+		}
+		pubKeys = append(pubKeys, pubKey)
+	}
+
+	added, err := krl.Revoke(pubKeys[0])
+	if err != nil || len(added) != 1 {
+		t.Fatalf("Failed to revoke key: %v, %v", added, err)
+	}
+	added, err = krl.Revoke(pubKeys...)
+	if err != nil || len(added) != 1 || ssh.FingerprintSHA256(added[0]) != ssh.FingerprintSHA256(pubKeys[1]) {
+		t.Fatalf("Expected only the second key to be added, got %v, %v", added, err)
+	}
+
+	info, err := os.Stat(krl.Path())
+	if err != nil {
+		t.Fatalf("Failed to stat revocation list: %v", err)
+	}
+	if info.Mode().Perm() != 0644 {
+		t.Errorf("Expected revocation list mode 0644, got %o", info.Mode().Perm())
+	}
+
+	list, err = krl.Load()
+	if err != nil {
+		t.Fatalf("Failed to load revocation list: %v", err)
+	}
+	if list.Version != 2 || list.Comment != krlComment || list.GeneratedAt.IsZero() {
+		t.Errorf("Unexpected revocation list header: %+v", list)
+	}
+	for _, pubKey := range pubKeys {
+		if !list.IsRevoked(pubKey) {
+			t.Errorf("Expected %s to be revoked", ssh.FingerprintSHA256(pubKey))
+		}
+	}
+}
+
+// TestParseKRL_Invalid tests rejecting files that are not KRLs
+func TestParseKRL_Invalid(t *testing.T) {
+	if _, err := ParseKRL([]byte("ssh-ed25519 AAAA")); !errors.Is(err, ErrInvalidKRL) {
+		t.Errorf("Expected ErrInvalidKRL, got %v", err)
+	}
+
+	keyPath := filepath.Join(testutil.CreateTestSSHDir(t), "id_ed25519")
+	generateTestKey(t, keyPath, "")
+	pubKey, err := LoadPublicKey(keyPath)
+	if err != nil {
+		t.Fatalf("Failed to load public key: %v", err)
+	}
+
+	data := (&KRL{Keys: []ssh.PublicKey{pubKey}}).Marshal()
+	if _, err := ParseKRL(data[:len(data)-3]); err == nil {
+		t.Error("Expected error parsing a truncated KRL, got nil")
+	}
+}
+
+// TestKRL_OpenSSH tests that KRLs are interoperable with ssh-keygen
+func TestKRL_OpenSSH(t *testing.T) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen not available")
+	}
+
+	sshDir := testutil.CreateTestSSHDir(t)
+	revoked := filepath.Join(sshDir, "id_revoked")
+	valid := filepath.Join(sshDir, "id_valid")
+	generateTestKey(t, revoked, "")
+	generateTestKey(t, valid, "")
+
+	pubKey, err := LoadPublicKey(revoked)
+	if err != nil {
+		t.Fatalf("Failed to load public key: %v", err)
+	}
+	krl := NewRevocationList(filepath.Join(sshDir, DefaultKRLName))
+	if _, err := krl.Revoke(pubKey); err != nil {
+		t.Fatalf("Failed to revoke key: %v", err)
+	}
+
+	// ssh-keygen -Q exits with an error for revoked keys
+	if out, err := exec.Command("ssh-keygen", "-Q", "-f", krl.Path(), revoked+".pub").CombinedOutput(); err == nil || !strings.Contains(string(out), "REVOKED") {
+		t.Errorf("Expected ssh-keygen to report the key as revoked, got %v: %s", err, out)
+	}
+	if out, err := exec.Command("ssh-keygen", "-Q", "-f", krl.Path(), valid+".pub").CombinedOutput(); err != nil {
+		t.Errorf("Expected ssh-keygen to accept the valid key, got %v: %s", err, out)
+	}
+
+	// A KRL written by ssh-keygen is read back
+	generated := filepath.Join(sshDir, "generated.krl")
+	if out, err := exec.Command("ssh-keygen", "-k", "-f", generated, valid+".pub").CombinedOutput(); err != nil {
+		t.Fatalf("Failed to generate KRL: %v: %s", err, out)
+	}
+	data, err := os.ReadFile(generated)
+	if err != nil {
+		t.Fatalf("Failed to read KRL: %v", err)
+	}
+	list, err := ParseKRL(data)
+	if err != nil {
+		t.Fatalf("Failed to parse KRL: %v", err)
+	}
+	validKey, err := LoadPublicKey(valid)
+	if err != nil {
+		t.Fatalf("Failed to load public key: %v", err)
+	}
+	if len(list.Keys) != 1 || !list.IsRevoked(validKey) {
+		t.Errorf("Expected the KRL to revoke %s, got %d keys", ssh.FingerprintSHA256(validKey), len(list.Keys))
+	}
+}
+
+// TestKRL_OpenSSHSections tests that revoking keys keeps the sections portunus does not edit
+func TestKRL_OpenSSHSections(t *testing.T) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen not available")
+	}
+
+	sshDir := testutil.CreateTestSSHDir(t)
+	byHash := filepath.Join(sshDir, "id_hash")
+	bySHA1 := filepath.Join(sshDir, "id_sha1")
+	rotated := filepath.Join(sshDir, "id_rotated")
+	ca := filepath.Join(sshDir, "ca")
+	for _, path := range []string{byHash, bySHA1, rotated, ca} {
+		generateTestKey(t, path, "")
+	}
+
+	// ssh-keygen revokes keys by fingerprint and certificates by serial
+	hashKey, err := LoadPublicKey(byHash)
+	if err != nil {
+		t.Fatalf("Failed to load public key: %v", err)
+	}
+	sha1Line, err := os.ReadFile(bySHA1 + ".pub")
+	if err != nil {
+		t.Fatalf("Failed to read public key: %v", err)
+	}
+	spec := "hash: " + ssh.FingerprintSHA256(hashKey) + "\n" +
+		"sha1: " + string(sha1Line) +
+		"serial: 42\n"
+	specPath := testutil.CreateTestFile(t, sshDir, "spec", spec)
+	krl := NewRevocationList(filepath.Join(sshDir, DefaultKRLName))
+	if out, err := exec.Command("ssh-keygen", "-k", "-f", krl.Path(), "-s", ca+".pub", specPath).CombinedOutput(); err != nil {
+		t.Fatalf("Failed to generate KRL: %v: %s", err, out)
+	}
+
+	list, err := krl.Load()
+	if err != nil {
+		t.Fatalf("Failed to load revocation list: %v", err)
+	}
+	for _, path := range []string{byHash, bySHA1} {
+		pubKey, err := LoadPublicKey(path)
+		if err != nil {
+			t.Fatalf("Failed to load public key: %v", err)
+		}
+		if !list.IsRevoked(pubKey) {
+			t.Errorf("Expected %s to be revoked by fingerprint", path)
+		}
+	}
+
+	rotatedKey, err := LoadPublicKey(rotated)
+	if err != nil {
+		t.Fatalf("Failed to load public key: %v", err)
+	}
+	if _, err := krl.Revoke(rotatedKey); err != nil {
+		t.Fatalf("Failed to revoke key: %v", err)
+	}
+
+	// The revocations made by ssh-keygen are still enforced
+	for _, path := range []string{byHash, bySHA1, rotated} {
+		if out, err := exec.Command("ssh-keygen", "-Q", "-f", krl.Path(), path+".pub").CombinedOutput(); err == nil || !strings.Contains(string(out), "REVOKED") {
+			t.Errorf("Expected ssh-keygen to report %s as revoked, got %v: %s", path, err, out)
+		}
+	}
+	out, err := exec.Command("ssh-keygen", "-Q", "-l", "-f", krl.Path()).CombinedOutput()
+	if err != nil || !strings.Contains(string(out), "serial: 42") {
+		t.Errorf("Expected the revoked certificate serial to be kept, got %v: %s", err, out)
+	}
+}
+
+// TestRevocationList_Signed tests that signed lists are not rewritten
+func TestRevocationList_Signed(t *testing.T) {
+	sshDir := testutil.CreateTestSSHDir(t)
+	keyPath := filepath.Join(sshDir, "id_ed25519")
+	generateTestKey(t, keyPath, "")
+	pubKey, err := LoadPublicKey(keyPath)
+	if err != nil {
+		t.Fatalf("Failed to load public key: %v", err)
+	}
+
+	signed := (&KRL{Comment: "signed"}).Marshal()
+	signed = append(signed, krlSectionSignature)
+	signed = appendString(signed, []byte("signature"))
+	krl := NewRevocationList(filepath.Join(sshDir, DefaultKRLName))
+	testutil.CreateTestFile(t, sshDir, DefaultKRLName, string(signed))
+
+	if _, err := krl.Revoke(pubKey); !errors.Is(err, ErrSignedKRL) {
+		t.Errorf("Expected ErrSignedKRL, got %v", err)
+	}
+	assertUnchanged(t, krl.Path(), string(signed))
+}
+
+// TestManager_RotateKeys_Revoke tests that rotation revokes the retired public keys
+func TestManager_RotateKeys_Revoke(t *testing.T) {
+	sshDir := testutil.CreateTestSSHDir(t)
+	keyPath := filepath.Join(sshDir, "id_ed25519")
+	generateTestKey(t, keyPath, "")
+	oldKey, err := LoadPublicKey(keyPath)
+	if err != nil {
+		t.Fatalf("Failed to load public key: %v", err)
+	}
+
+	krl := NewRevocationList(filepath.Join(sshDir, DefaultKRLName))
+	manager := &Manager{
+		sshDir:    sshDir,
+		generator: &nativeGenerator{},
+		krl:       krl,
+	}
+
+	results, err := manager.RotateKeys(context.Background(), NewRotationRequests([]string{keyPath}, KeySpec{Cipher: "ed25519"}))
+	if err != nil {
+		t.Fatalf("Failed to rotate keys: %v", err)
+	}
+	if !results[0].Revoked {
+		t.Error("Expected the retired key to be reported as revoked")
+	}
+
+	list, err := krl.Load()
+	if err != nil {
+		t.Fatalf("Failed to load revocation list: %v", err)
+	}
+	newKey, err := LoadPublicKey(keyPath)
+	if err != nil {
+		t.Fatalf("Failed to load public key: %v", err)
+	}
+	if !list.IsRevoked(oldKey) || list.IsRevoked(newKey) {
+		t.Errorf("Expected only the retired key to be revoked, got %d keys", len(list.Keys))
+	}
+}
@@ -0,0 +1,140 @@
+package keys
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// minRSABits is the smallest RSA key size the native generator accepts
+const minRSABits = 2048
+
+// nativeGenerator generates key pairs in pure Go, without external binaries
+type nativeGenerator struct{}
+
+// Name returns the backend name of the generator
+func (g *nativeGenerator) Name() string {
+	return BackendNative
+}
+
+// Generate creates the key pair described by spec and writes it in OpenSSH format
+func (g *nativeGenerator) Generate(ctx context.Context, path string, spec KeySpec) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	privateKey, publicKey, err := newRawKey(spec.Cipher, spec.Bits)
+	if err != nil {
+		return err
+	}
+
+	comment := spec.Comment
+	if comment == "" {
+		comment = defaultComment()
+	}
+
+	block, err := marshalPrivateKey(privateKey, comment, spec.Passphrase)
+	if err != nil {
+		return fmt.Errorf("failed to marshal private key: %w", err)
+	}
+
+	sshPublicKey, err := ssh.NewPublicKey(publicKey)
+	if err != nil {
+		return fmt.Errorf("failed to marshal public key: %w", err)
+	}
+
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+		return fmt.Errorf("failed to write private key %s: %w", path, err)
+	}
+
+	pubPath := path + ".pub"
+	if err := os.WriteFile(pubPath, authorizedKeyLine(sshPublicKey, comment), 0644); err != nil {
+		return fmt.Errorf("failed to write public key %s: %w", pubPath, err)
+	}
+
+	return nil
+}
+
+// newRawKey generates a private key for the given cipher and size
+func newRawKey(cipher string, bits int) (crypto.PrivateKey, crypto.PublicKey, error) {
+	if bits == 0 {
+		bits = defaultBits(cipher)
+	}
+
+	switch cipher {
+	case "ed25519":
+		publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to generate ed25519 key: %w", err)
+		}
+		return privateKey, publicKey, nil
+	case "rsa":
+		if bits < minRSABits {
+			return nil, nil, fmt.Errorf("RSA key size must be at least %d bits, got %d", minRSABits, bits)
+		}
+		privateKey, err := rsa.GenerateKey(rand.Reader, bits)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to generate RSA key: %w", err)
+		}
+		return privateKey, &privateKey.PublicKey, nil
+	case "ecdsa":
+		curve, err := ecdsaCurve(bits)
+		if err != nil {
+			return nil, nil, err
+		}
+		privateKey, err := ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to generate ECDSA key: %w", err)
+		}
+		return privateKey, &privateKey.PublicKey, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported cipher: %s", cipher)
+	}
+}
+
+// ecdsaCurve returns the elliptic curve matching an ECDSA key size
+func ecdsaCurve(bits int) (elliptic.Curve, error) {
+	switch bits {
+	case 256:
+		return elliptic.P256(), nil
+	case 384:
+		return elliptic.P384(), nil
+	case 521:
+		return elliptic.P521(), nil
+	default:
+		return nil, fmt.Errorf("invalid ECDSA key size: %d (must be 256, 384 or 521)", bits)
+	}
+}
+
+// authorizedKeyLine formats a public key as a single authorized_keys line
+func authorizedKeyLine(key ssh.PublicKey, comment string) []byte {
+	line := ssh.MarshalAuthorizedKey(key)
+	if comment == "" {
+		return line
+	}
+	// MarshalAuthorizedKey terminates the line with a newline
+	line = line[:len(line)-1]
+	return append(append(line, ' '), comment+"\n"...)
+}
+
+// defaultComment returns the user@host comment ssh-keygen would use
+func defaultComment() string {
+	data := NewCommentData("", "", time.Time{})
+	if data.User == "" {
+		data.User = "portunus"
+	}
+	if data.Hostname == "" {
+		return data.User
+	}
+	return data.User + "@" + data.Hostname
+}
@@ -0,0 +1,179 @@
+package keys
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/blowfish"
+	"golang.org/x/crypto/ssh"
+)
+
+// keygenRounds is the number of bcrypt KDF rounds private keys are encrypted with,
+// by ssh-keygen (-a) and by the native backend alike
+const keygenRounds = 100
+
+// opensshMagic starts the openssh-key-v1 private key format
+const opensshMagic = "openssh-key-v1\x00"
+
+// opensshEnvelope is the openssh-key-v1 structure around the private key section
+type opensshEnvelope struct {
+	CipherName   string
+	KdfName      string
+	KdfOpts      string
+	NumKeys      uint32
+	PubKey       []byte
+	PrivKeyBlock []byte
+}
+
+// bcryptKDFOptions are the options of the bcrypt KDF
+type bcryptKDFOptions struct {
+	Salt   []byte
+	Rounds uint32
+}
+
+// marshalPrivateKey encodes a private key in OpenSSH format, encrypted with passphrase
+// and keygenRounds KDF rounds unless the passphrase is empty
+func marshalPrivateKey(key crypto.PrivateKey, comment, passphrase string) (*pem.Block, error) {
+	if passphrase == "" {
+		return ssh.MarshalPrivateKey(key, comment)
+	}
+	return marshalEncryptedPrivateKey(key, comment, passphrase, keygenRounds)
+}
+
+// marshalEncryptedPrivateKey encodes a private key in OpenSSH format, encrypted with
+// aes256-ctr under a key derived from passphrase with the given number of bcrypt rounds.
+// x/crypto always uses 16 rounds, so its output is decrypted and encrypted again.
+func marshalEncryptedPrivateKey(key crypto.PrivateKey, comment, passphrase string, rounds int) (*pem.Block, error) {
+	block, err := ssh.MarshalPrivateKeyWithPassphrase(key, comment, []byte(passphrase))
+	if err != nil {
+		return nil, err
+	}
+
+	envelope, opts, err := parseOpenSSHEnvelope(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	if envelope.CipherName != "aes256-ctr" || envelope.KdfName != "bcrypt" {
+		return nil, fmt.Errorf("unexpected private key encryption %s/%s", envelope.CipherName, envelope.KdfName)
+	}
+
+	// The private key section is padded to the AES block size already
+	privKeyBlock := make([]byte, len(envelope.PrivKeyBlock))
+	stream, err := opensshStream(passphrase, opts)
+	if err != nil {
+		return nil, err
+	}
+	stream.XORKeyStream(privKeyBlock, envelope.PrivKeyBlock)
+
+	opts = bcryptKDFOptions{Salt: make([]byte, 16), Rounds: uint32(rounds)}
+	if _, err := rand.Read(opts.Salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	if stream, err = opensshStream(passphrase, opts); err != nil {
+		return nil, err
+	}
+	stream.XORKeyStream(privKeyBlock, privKeyBlock)
+
+	envelope.KdfOpts = string(ssh.Marshal(opts))
+	envelope.PrivKeyBlock = privKeyBlock
+	block.Bytes = append([]byte(opensshMagic), ssh.Marshal(envelope)...)
+	return block, nil
+}
+
+// parseOpenSSHEnvelope reads the envelope of an openssh-key-v1 private key
+// and the options of its KDF, if it is encrypted
+func parseOpenSSHEnvelope(data []byte) (opensshEnvelope, bcryptKDFOptions, error) {
+	var envelope opensshEnvelope
+	var opts bcryptKDFOptions
+	if !bytes.HasPrefix(data, []byte(opensshMagic)) {
+		return envelope, opts, errors.New("not an OpenSSH private key")
+	}
+	if err := ssh.Unmarshal(data[len(opensshMagic):], &envelope); err != nil {
+		return envelope, opts, fmt.Errorf("invalid OpenSSH private key: %w", err)
+	}
+	if envelope.KdfName == "bcrypt" {
+		if err := ssh.Unmarshal([]byte(envelope.KdfOpts), &opts); err != nil {
+			return envelope, opts, fmt.Errorf("invalid KDF options: %w", err)
+		}
+	}
+	return envelope, opts, nil
+}
+
+// opensshStream returns the aes256-ctr stream of a private key section
+func opensshStream(passphrase string, opts bcryptKDFOptions) (cipher.Stream, error) {
+	k := bcryptPBKDF([]byte(passphrase), opts.Salt, int(opts.Rounds), 32+aes.BlockSize)
+	c, err := aes.NewCipher(k[:32])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewCTR(c, k[32:]), nil
+}
+
+// bcryptPBKDF derives a key of keyLen bytes from password and salt as OpenBSD's
+// bcrypt_pbkdf does, which OpenSSH encrypts private keys with
+func bcryptPBKDF(password, salt []byte, rounds, keyLen int) []byte {
+	const blockSize = 32
+	numBlocks := (keyLen + blockSize - 1) / blockSize
+	key := make([]byte, numBlocks*blockSize)
+
+	h := sha512.New()
+	h.Write(password)
+	shapass := h.Sum(nil)
+
+	shasalt := make([]byte, 0, sha512.Size)
+	cnt, tmp := make([]byte, 4), make([]byte, blockSize)
+	for block := 1; block <= numBlocks; block++ {
+		h.Reset()
+		h.Write(salt)
+		cnt[0], cnt[1], cnt[2], cnt[3] = byte(block>>24), byte(block>>16), byte(block>>8), byte(block)
+		h.Write(cnt)
+		bcryptHash(tmp, shapass, h.Sum(shasalt))
+
+		out := make([]byte, blockSize)
+		copy(out, tmp)
+		for i := 2; i <= rounds; i++ {
+			h.Reset()
+			h.Write(tmp)
+			bcryptHash(tmp, shapass, h.Sum(shasalt))
+			for j := range out {
+				out[j] ^= tmp[j]
+			}
+		}
+
+		// The output blocks are interleaved
+		for i, v := range out {
+			key[i*numBlocks+(block-1)] = v
+		}
+	}
+	return key[:keyLen]
+}
+
+// bcryptMagic is the plaintext bcrypt_pbkdf encrypts
+var bcryptMagic = []byte("OxychromaticBlowfishSwatDynamite")
+
+// bcryptHash is one round of bcrypt_pbkdf
+func bcryptHash(out, shapass, shasalt []byte) {
+	// A SHA-512 sum is always a valid Blowfish key
+	c, _ := blowfish.NewSaltedCipher(shapass, shasalt)
+	for i := 0; i < 64; i++ {
+		blowfish.ExpandKey(shasalt, c)
+		blowfish.ExpandKey(shapass, c)
+	}
+	copy(out, bcryptMagic)
+	for i := 0; i < 32; i += 8 {
+		for j := 0; j < 64; j++ {
+			c.Encrypt(out[i:i+8], out[i:i+8])
+		}
+	}
+	// The words are little-endian in OpenBSD's implementation
+	for i := 0; i < 32; i += 4 {
+		out[i+3], out[i+2], out[i+1], out[i] = out[i], out[i+1], out[i+2], out[i+3]
+	}
+}
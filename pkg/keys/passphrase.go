@@ -0,0 +1,195 @@
+package keys
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/de-lachende-cavalier/portunus/pkg/logger"
+)
+
+// generatedPassphraseBytes is the amount of randomness in a generated passphrase
+const generatedPassphraseBytes = 32
+
+// PassphraseSink stores generated passphrases in a secret manager
+type PassphraseSink interface {
+	// Store saves the passphrase of the named key and returns a reference to the stored secret.
+	// Names come from SecretName, so each key has its own secret.
+	Store(ctx context.Context, name, passphrase string) (string, error)
+}
+
+// SecretName returns the name the passphrase of the key at path is stored under.
+// Keys in the SSH directory are named by their path relative to it (e.g. "id_ed25519" or
+// "work/id_ed25519"), other keys by their path relative to its parent, usually the home
+// directory, behind "~/", or by their absolute path behind "@". Every segment is escaped,
+// including leading dots, so names are unique and safe as secret manager paths.
+func (m *Manager) SecretName(path string) string {
+	path = filepath.Clean(path)
+	if rel, ok := relativeTo(m.sshDir, path); ok {
+		return escapeSecretPath(rel)
+	}
+	if rel, ok := relativeTo(filepath.Dir(m.sshDir), path); ok {
+		return "~/" + escapeSecretPath(rel)
+	}
+	return "@/" + escapeSecretPath(strings.TrimPrefix(filepath.ToSlash(path), "/"))
+}
+
+// relativeTo returns the path of target relative to dir when target is inside dir
+func relativeTo(dir, target string) (string, bool) {
+	rel, err := filepath.Rel(filepath.Clean(dir), target)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// escapeSecretPath escapes every segment of a slash-separated path. Leading dots, tildes and
+// at signs are escaped too: they hide secrets in some stores and mark the kind of a name.
+func escapeSecretPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segment = url.PathEscape(segment)
+		if segment != "" && strings.ContainsRune(".~@", rune(segment[0])) {
+			segment = fmt.Sprintf("%%%02X", segment[0]) + segment[1:]
+		}
+		segments[i] = segment
+	}
+	return strings.Join(segments, "/")
+}
+
+// WithPassphraseSink sets where passphrases generated during rotation are stored
+func WithPassphraseSink(sink PassphraseSink) Option {
+	return func(m *Manager) {
+		m.sink = sink
+	}
+}
+
+// GeneratePassphrase returns a random passphrase with 256 bits of entropy
+func GeneratePassphrase() (string, error) {
+	buf := make([]byte, generatedPassphraseBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate passphrase: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// ErrIncorrectPassphrase is returned when a key cannot be decrypted with the given passphrase
+var ErrIncorrectPassphrase = errors.New("incorrect passphrase")
+
+// ChangePassphrase re-encrypts the private key at path with a new passphrase,
+// keeping the key material. An empty passphrase stands for an unencrypted key.
+// The key is rewritten in OpenSSH format.
+func (m *Manager) ChangePassphrase(ctx context.Context, path, oldPassphrase, newPassphrase string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read private key %s: %w", path, err)
+	}
+
+	privateKey, err := parsePrivateKey(data, oldPassphrase)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt %s: %w", path, err)
+	}
+
+	// The public key holds the comment; an unreadable one leaves the key without
+	_, comment, _ := ReadPublicKey(path)
+
+	block, err := marshalPrivateKey(privateKey, comment, newPassphrase)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt private key: %w", err)
+	}
+
+	// Write next to the key and rename so the key is never left half-written
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".portunus-passwd-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(pem.EncodeToMemory(block)); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write private key: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write private key: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0600); err != nil {
+		return fmt.Errorf("failed to set private key permissions: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace private key %s: %w", path, err)
+	}
+
+	logger.Infof("Changed passphrase of %s", path)
+	return nil
+}
+
+// parsePrivateKey decrypts a private key, accepting an empty passphrase for unencrypted keys.
+// A passphrase that does not fit the key, including one given for an unencrypted key,
+// is reported as ErrIncorrectPassphrase.
+func parsePrivateKey(data []byte, passphrase string) (any, error) {
+	key, err := ssh.ParseRawPrivateKey(data)
+	var missing *ssh.PassphraseMissingError
+	if !errors.As(err, &missing) {
+		if err == nil && passphrase != "" {
+			return nil, ErrIncorrectPassphrase
+		}
+		return key, err
+	}
+
+	// The key is encrypted
+	if passphrase == "" {
+		return nil, ErrIncorrectPassphrase
+	}
+	key, err = ssh.ParseRawPrivateKeyWithPassphrase(data, []byte(passphrase))
+	if errors.Is(err, x509.IncorrectPasswordError) {
+		return nil, ErrIncorrectPassphrase
+	}
+	return key, err
+}
+
+// LoadSigner returns a signer for the private key at path, decrypted with passphrase
+// unless the key is not encrypted
+func LoadSigner(path, passphrase string) (ssh.Signer, error) {
+	privateKey, err := decryptPrivateKey(path, passphrase)
+	if errors.Is(err, ErrIncorrectPassphrase) && passphrase != "" {
+		if plain, plainErr := decryptPrivateKey(path, ""); plainErr == nil {
+			privateKey, err = plain, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.NewSignerFromKey(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to use key %s: %w", path, err)
+	}
+	return signer, nil
+}
+
+// decryptPrivateKey reads the private key at path, decrypted with passphrase
+func decryptPrivateKey(path, passphrase string) (any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key %s: %w", path, err)
+	}
+
+	privateKey, err := parsePrivateKey(data, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt %s: %w", path, err)
+	}
+	return privateKey, nil
+}
@@ -0,0 +1,367 @@
+package keys
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/de-lachende-cavalier/portunus/pkg/testutil"
+)
+
+// memorySink is a passphrase sink keeping secrets in memory
+type memorySink struct {
+	secrets map[string]string
+	err     error
+}
+
+// Store records the passphrase under name
+func (s *memorySink) Store(ctx context.Context, name, passphrase string) (string, error) {
+	if s.err != nil {
+		return "", s.err
+	}
+	s.secrets[name] = passphrase
+	return "memory:" + name, nil
+}
+
+// TestGeneratePassphrase tests that generated passphrases are long and distinct
+func TestGeneratePassphrase(t *testing.T) {
+	first, err := GeneratePassphrase()
+	if err != nil {
+		t.Fatalf("Failed to generate passphrase: %v", err)
+	}
+	second, err := GeneratePassphrase()
+	if err != nil {
+		t.Fatalf("Failed to generate passphrase: %v", err)
+	}
+
+	if len(first) < 40 {
+		t.Errorf("Expected a passphrase of at least 40 characters, got %d", len(first))
+	}
+	if first == second {
+		t.Error("Expected generated passphrases to differ")
+	}
+}
+
+// TestManager_RotateKeys_GeneratePassphrase tests that generated passphrases are stored in the sink
+func TestManager_RotateKeys_GeneratePassphrase(t *testing.T) {
+	sshDir := testutil.CreateTestSSHDir(t)
+	key, _ := testutil.CreateTestKeyPair(t, sshDir, "id_ed25519")
+
+	sink := &memorySink{secrets: make(map[string]string)}
+	manager := &Manager{
+		sshDir:    sshDir,
+		generator: &nativeGenerator{},
+		sink:      sink,
+	}
+
+	requests := []RotationRequest{{Path: key, Spec: KeySpec{Cipher: "ed25519"}, GeneratePassphrase: true}}
+	results, err := manager.RotateKeys(context.Background(), requests)
+	if err != nil {
+		t.Fatalf("Failed to rotate keys: %v", err)
+	}
+	if results[0].PassphraseRef != "memory:id_ed25519" {
+		t.Errorf("Expected passphrase reference memory:id_ed25519, got %q", results[0].PassphraseRef)
+	}
+
+	privData, err := os.ReadFile(key)
+	if err != nil {
+		t.Fatalf("Failed to read private key: %v", err)
+	}
+	if _, err := ssh.ParsePrivateKeyWithPassphrase(privData, []byte(sink.secrets["id_ed25519"])); err != nil {
+		t.Errorf("Expected new key to be encrypted with the stored passphrase: %v", err)
+	}
+}
+
+// TestManager_RotateKeys_GeneratePassphrase_SameName tests that keys sharing a file name get their own secrets
+func TestManager_RotateKeys_GeneratePassphrase_SameName(t *testing.T) {
+	sshDir := testutil.CreateTestSSHDir(t)
+	workDir := filepath.Join(filepath.Dir(sshDir), "work")
+	if err := os.MkdirAll(workDir, 0700); err != nil {
+		t.Fatalf("Failed to create key directory: %v", err)
+	}
+	personal, _ := testutil.CreateTestKeyPair(t, sshDir, "id_ed25519")
+	work, _ := testutil.CreateTestKeyPair(t, workDir, "id_ed25519")
+
+	sink := &memorySink{secrets: make(map[string]string)}
+	manager := &Manager{
+		sshDir:    sshDir,
+		generator: &nativeGenerator{},
+		sink:      sink,
+	}
+
+	requests := []RotationRequest{
+		{Path: personal, Spec: KeySpec{Cipher: "ed25519"}, GeneratePassphrase: true},
+		{Path: work, Spec: KeySpec{Cipher: "ed25519"}, GeneratePassphrase: true},
+	}
+	results, err := manager.RotateKeys(context.Background(), requests)
+	if err != nil {
+		t.Fatalf("Failed to rotate keys: %v", err)
+	}
+	if results[0].PassphraseRef != "memory:id_ed25519" || results[1].PassphraseRef != "memory:~/work/id_ed25519" {
+		t.Errorf("Expected distinct passphrase references, got %q and %q", results[0].PassphraseRef, results[1].PassphraseRef)
+	}
+	if len(sink.secrets) != 2 {
+		t.Fatalf("Expected 2 stored secrets, got %d", len(sink.secrets))
+	}
+
+	// Each key is encrypted with the secret stored under its own name
+	for _, key := range []string{personal, work} {
+		privData, err := os.ReadFile(key)
+		if err != nil {
+			t.Fatalf("Failed to read private key: %v", err)
+		}
+		if _, err := ssh.ParsePrivateKeyWithPassphrase(privData, []byte(sink.secrets[manager.SecretName(key)])); err != nil {
+			t.Errorf("Expected %s to be encrypted with its stored passphrase: %v", key, err)
+		}
+	}
+}
+
+// TestManager_SecretName tests that secret names are unique and escaped
+func TestManager_SecretName(t *testing.T) {
+	manager := &Manager{sshDir: "/home/alice/.ssh"}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/home/alice/.ssh/id_ed25519", "id_ed25519"},
+		{"/home/alice/.ssh/work/id_ed25519", "work/id_ed25519"},
+		{"/home/alice/work/id_ed25519", "~/work/id_ed25519"},
+		{"/home/alice/.keys/id_ed25519", "~/%2Ekeys/id_ed25519"},
+		{"/home/alice/.ssh/~/id_ed25519", "%7E/id_ed25519"},
+		{"/home/alice/.ssh/100% key", "100%25%20key"},
+		{"/etc/ssh/id_ed25519", "@/etc/ssh/id_ed25519"},
+	}
+	for _, tt := range tests {
+		if got := manager.SecretName(tt.path); got != tt.want {
+			t.Errorf("SecretName(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+// TestManager_RotateKeys_SinkFailure tests that keys stay in place when the passphrase cannot be stored
+func TestManager_RotateKeys_SinkFailure(t *testing.T) {
+	sshDir := testutil.CreateTestSSHDir(t)
+	key, _ := testutil.CreateTestKeyPair(t, sshDir, "id_ed25519")
+	original, err := os.ReadFile(key)
+	if err != nil {
+		t.Fatalf("Failed to read private key: %v", err)
+	}
+
+	requests := []RotationRequest{{Path: key, Spec: KeySpec{Cipher: "ed25519"}, GeneratePassphrase: true}}
+
+	// Without a sink the generated passphrase would be lost
+	manager := &Manager{sshDir: sshDir, generator: &nativeGenerator{}}
+	if _, err := manager.RotateKeys(context.Background(), requests); err == nil {
+		t.Error("Expected error without a passphrase sink, got nil")
+	}
+
+	manager.sink = &memorySink{err: errors.New("vault sealed")}
+	results, err := manager.RotateKeys(context.Background(), requests)
+	if err == nil {
+		t.Fatal("Expected error when the sink fails, got nil")
+	}
+	if results[0].Success {
+		t.Error("Expected key not to be rotated")
+	}
+
+	assertUnchanged(t, key, string(original))
+	assertNoStagingDirs(t, sshDir)
+}
+
+// TestManager_ChangePassphrase tests re-encrypting a key without replacing it
+func TestManager_ChangePassphrase(t *testing.T) {
+	sshDir := testutil.CreateTestSSHDir(t)
+	keyPath := filepath.Join(sshDir, "id_ed25519")
+
+	g := &nativeGenerator{}
+	if err := g.Generate(context.Background(), keyPath, KeySpec{Cipher: "ed25519", Comment: "alice@laptop"}); err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	fingerprint, err := PublicKeyFingerprint(keyPath)
+	if err != nil {
+		t.Fatalf("Failed to fingerprint key: %v", err)
+	}
+
+	manager := &Manager{sshDir: sshDir, generator: g}
+
+	// Encrypt the unencrypted key, then change the passphrase again
+	if err := manager.ChangePassphrase(context.Background(), keyPath, "", "first"); err != nil {
+		t.Fatalf("Failed to set passphrase: %v", err)
+	}
+	if err := manager.ChangePassphrase(context.Background(), keyPath, "wrong", "second"); !errors.Is(err, ErrIncorrectPassphrase) {
+		t.Errorf("Expected ErrIncorrectPassphrase for a wrong passphrase, got %v", err)
+	}
+	if err := manager.ChangePassphrase(context.Background(), keyPath, "", "second"); !errors.Is(err, ErrIncorrectPassphrase) {
+		t.Errorf("Expected ErrIncorrectPassphrase for a missing passphrase, got %v", err)
+	}
+	if err := manager.ChangePassphrase(context.Background(), keyPath, "first", "second"); err != nil {
+		t.Fatalf("Failed to change passphrase: %v", err)
+	}
+
+	privData, err := os.ReadFile(keyPath)
+	if err != nil {
+		t.Fatalf("Failed to read private key: %v", err)
+	}
+	signer, err := ssh.ParsePrivateKeyWithPassphrase(privData, []byte("second"))
+	if err != nil {
+		t.Fatalf("Expected key to be encrypted with the new passphrase: %v", err)
+	}
+	if got := ssh.FingerprintSHA256(signer.PublicKey()); got != fingerprint {
+		t.Errorf("Expected key material to be kept (%s), got %s", fingerprint, got)
+	}
+	if rounds := kdfRounds(t, privData); rounds != keygenRounds {
+		t.Errorf("Expected %d bcrypt KDF rounds, got %d", keygenRounds, rounds)
+	}
+
+	info, err := os.Stat(keyPath)
+	if err != nil {
+		t.Fatalf("Failed to stat private key: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected private key mode 0600, got %o", info.Mode().Perm())
+	}
+
+	// Only the key pair is left behind
+	entries, err := os.ReadDir(sshDir)
+	if err != nil {
+		t.Fatalf("Failed to read directory: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("Expected only the key pair in %s, got %d entries", sshDir, len(entries))
+	}
+}
+
+// TestLoadSigner tests loading encrypted and unencrypted keys to log in with
+func TestLoadSigner(t *testing.T) {
+	sshDir := testutil.CreateTestSSHDir(t)
+	encrypted := filepath.Join(sshDir, "encrypted")
+	plain := filepath.Join(sshDir, "plain")
+	generateTestKey(t, encrypted, "secret")
+	fingerprint := generateTestKey(t, plain, "")
+
+	if _, err := LoadSigner(encrypted, "wrong"); !errors.Is(err, ErrIncorrectPassphrase) {
+		t.Errorf("Expected ErrIncorrectPassphrase, got %v", err)
+	}
+	if _, err := LoadSigner(encrypted, "secret"); err != nil {
+		t.Errorf("Failed to load encrypted key: %v", err)
+	}
+
+	// The passphrase is ignored for unencrypted keys
+	signer, err := LoadSigner(plain, "secret")
+	if err != nil {
+		t.Fatalf("Failed to load unencrypted key: %v", err)
+	}
+	if got := ssh.FingerprintSHA256(signer.PublicKey()); got != fingerprint {
+		t.Errorf("Expected fingerprint %s, got %s", fingerprint, got)
+	}
+}
+
+// writePEMTestKey writes a legacy PEM key pair of the given format, encrypted with passphrase
+// if it is not empty, and returns its fingerprint
+func writePEMTestKey(t *testing.T, path string, format KeyFormat, passphrase string) string {
+	t.Helper()
+
+	var privateKey any
+	var block *pem.Block
+	switch format {
+	case FormatPEMRSA:
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatalf("Failed to generate RSA key: %v", err)
+		}
+		privateKey = key
+		block = &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+	case FormatPEMEC:
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatalf("Failed to generate EC key: %v", err)
+		}
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			t.Fatalf("Failed to marshal EC key: %v", err)
+		}
+		privateKey = key
+		block = &pem.Block{Type: "EC PRIVATE KEY", Bytes: der}
+	default:
+		t.Fatalf("Unsupported test key format %s", format)
+	}
+
+	if passphrase != "" {
+		var err error
+		// EncryptPEMBlock is deprecated, but it is how legacy encrypted keys were written
+		block, err = x509.EncryptPEMBlock(rand.Reader, block.Type, block.Bytes, []byte(passphrase), x509.PEMCipherAES128)
+		if err != nil {
+			t.Fatalf("Failed to encrypt key: %v", err)
+		}
+	}
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatalf("Failed to write private key: %v", err)
+	}
+
+	signer, err := ssh.NewSignerFromKey(privateKey)
+	if err != nil {
+		t.Fatalf("Failed to create signer: %v", err)
+	}
+	if err := os.WriteFile(path+".pub", ssh.MarshalAuthorizedKey(signer.PublicKey()), 0644); err != nil {
+		t.Fatalf("Failed to write public key: %v", err)
+	}
+	return ssh.FingerprintSHA256(signer.PublicKey())
+}
+
+// TestLoadSigner_PEM tests loading and re-encrypting legacy PEM keys, which discovery marks as rotatable
+func TestLoadSigner_PEM(t *testing.T) {
+	for _, format := range []KeyFormat{FormatPEMRSA, FormatPEMEC} {
+		t.Run(string(format), func(t *testing.T) {
+			sshDir := testutil.CreateTestSSHDir(t)
+			plain := filepath.Join(sshDir, "plain")
+			encrypted := filepath.Join(sshDir, "encrypted")
+			fingerprint := writePEMTestKey(t, plain, format, "")
+			writePEMTestKey(t, encrypted, format, "secret")
+
+			// The passphrase is ignored for unencrypted keys
+			signer, err := LoadSigner(plain, "secret")
+			if err != nil {
+				t.Fatalf("Failed to load unencrypted key: %v", err)
+			}
+			if got := ssh.FingerprintSHA256(signer.PublicKey()); got != fingerprint {
+				t.Errorf("Expected fingerprint %s, got %s", fingerprint, got)
+			}
+
+			if _, err := LoadSigner(encrypted, "wrong"); !errors.Is(err, ErrIncorrectPassphrase) {
+				t.Errorf("Expected ErrIncorrectPassphrase, got %v", err)
+			}
+			if _, err := LoadSigner(encrypted, ""); !errors.Is(err, ErrIncorrectPassphrase) {
+				t.Errorf("Expected ErrIncorrectPassphrase without a passphrase, got %v", err)
+			}
+			if _, err := LoadSigner(encrypted, "secret"); err != nil {
+				t.Errorf("Failed to load encrypted key: %v", err)
+			}
+
+			// A passphrase that does not fit is refused, the right one re-encrypts the key
+			manager := &Manager{sshDir: sshDir}
+			if err := manager.ChangePassphrase(context.Background(), plain, "secret", "new"); !errors.Is(err, ErrIncorrectPassphrase) {
+				t.Errorf("Expected ErrIncorrectPassphrase for an unencrypted key, got %v", err)
+			}
+			if err := manager.ChangePassphrase(context.Background(), plain, "", "new"); err != nil {
+				t.Fatalf("Failed to set passphrase: %v", err)
+			}
+			if err := manager.ChangePassphrase(context.Background(), encrypted, "secret", ""); err != nil {
+				t.Fatalf("Failed to remove passphrase: %v", err)
+			}
+			if signer, err := LoadSigner(plain, "new"); err != nil || ssh.FingerprintSHA256(signer.PublicKey()) != fingerprint {
+				t.Errorf("Expected the key to be encrypted with the new passphrase, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package keys
+
+import (
+	"crypto/dsa"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// ReadPublicKey parses the public key stored next to a private key
+func ReadPublicKey(keyPath string) (ssh.PublicKey, string, error) {
+	pubPath := keyPath + ".pub"
+
+	data, err := os.ReadFile(pubPath)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read public key %s: %w", pubPath, err)
+	}
+
+	pubKey, comment, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to parse public key %s: %w", pubPath, err)
+	}
+
+	return pubKey, comment, nil
+}
+
+// PublicKeyFingerprint returns the SHA256 fingerprint of the public key stored next to a private key
+func PublicKeyFingerprint(keyPath string) (string, error) {
+	pubKey, _, err := ReadPublicKey(keyPath)
+	if err != nil {
+		return "", err
+	}
+	return ssh.FingerprintSHA256(pubKey), nil
+}
+
+// KeyInfo describes the public half of a key pair
+type KeyInfo struct {
+	// Type is the key algorithm, using the cipher names accepted by rotate
+	Type        string
+	Bits        int
+	Fingerprint string
+	Comment     string
+}
+
+// ReadKeyInfo parses the public key stored next to a private key and describes it
+func ReadKeyInfo(keyPath string) (*KeyInfo, error) {
+	pubKey, comment, err := ReadPublicKey(keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	keyType, bits := describePublicKey(pubKey)
+	return &KeyInfo{
+		Type:        keyType,
+		Bits:        bits,
+		Fingerprint: ssh.FingerprintSHA256(pubKey),
+		Comment:     comment,
+	}, nil
+}
+
+// describePublicKey returns the algorithm name and size of a public key
+func describePublicKey(pubKey ssh.PublicKey) (string, int) {
+	switch pubKey.Type() {
+	case ssh.KeyAlgoED25519:
+		return "ed25519", 256
+	case ssh.KeyAlgoSKED25519:
+		return "ed25519-sk", 256
+	case ssh.KeyAlgoSKECDSA256:
+		return "ecdsa-sk", 256
+	}
+
+	cryptoPubKey, ok := pubKey.(ssh.CryptoPublicKey)
+	if !ok {
+		return pubKey.Type(), 0
+	}
+
+	switch key := cryptoPubKey.CryptoPublicKey().(type) {
+	case *rsa.PublicKey:
+		return "rsa", key.N.BitLen()
+	case *ecdsa.PublicKey:
+		return "ecdsa", key.Curve.Params().BitSize
+	case *dsa.PublicKey:
+		return "dsa", key.P.BitLen()
+	default:
+		return pubKey.Type(), 0
+	}
+}
+
+// LoadPublicKey returns the public key of the private key at keyPath,
+// read from keyPath.pub or, when that is missing, from the private key itself
+func LoadPublicKey(keyPath string) (ssh.PublicKey, error) {
+	pubKey, _, err := ReadPublicKey(keyPath)
+	if err == nil {
+		return pubKey, nil
+	}
+
+	pubKey, fallbackErr := publicKeyFromPrivate(keyPath)
+	if fallbackErr != nil {
+		return nil, err
+	}
+	return pubKey, nil
+}
+
+// DetectAlgorithm returns the cipher and key size of an existing key pair.
+// The public key is read first; for OpenSSH keys the private key header is used as a fallback,
+// which works even when the private key is encrypted.
+func DetectAlgorithm(keyPath string) (string, int, error) {
+	pubKey, err := LoadPublicKey(keyPath)
+	if err != nil {
+		return "", 0, fmt.Errorf("cannot detect algorithm of %s: %w", keyPath, err)
+	}
+
+	cipher, bits := describePublicKey(pubKey)
+	if !SupportedCiphers[cipher] {
+		return "", 0, fmt.Errorf("cannot regenerate %s key %s: unsupported cipher", cipher, keyPath)
+	}
+	if cipher == "ed25519" {
+		// ed25519 keys have a fixed size
+		bits = 0
+	}
+
+	return cipher, bits, nil
+}
+
+// publicKeyFromPrivate extracts the public key from a private key file
+func publicKeyFromPrivate(keyPath string) (ssh.PublicKey, error) {
+	data, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := ssh.ParsePrivateKey(data)
+	if err == nil {
+		return signer.PublicKey(), nil
+	}
+
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) && missing.PublicKey != nil {
+		return missing.PublicKey, nil
+	}
+	return nil, err
+}
@@ -0,0 +1,165 @@
+package keys
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/de-lachende-cavalier/portunus/pkg/testutil"
+)
+
+// TestPublicKeyFingerprint tests fingerprinting the public key next to a private key
+func TestPublicKeyFingerprint(t *testing.T) {
+	sshDir := testutil.CreateTestSSHDir(t)
+	keyPath, _ := testutil.CreateTestKeyPair(t, sshDir, "id_ed25519")
+
+	fingerprint, err := PublicKeyFingerprint(keyPath)
+	if err != nil {
+		t.Fatalf("Failed to fingerprint public key: %v", err)
+	}
+
+	expected := "SHA256:7U5WPhVG7bqifPMzZQRwRhy8scnVoQjOMPJ6Wd5r7ng"
+	if fingerprint != expected {
+		t.Errorf("Expected fingerprint %s, got %s", expected, fingerprint)
+	}
+
+	_, comment, err := ReadPublicKey(keyPath)
+	if err != nil {
+		t.Fatalf("Failed to read public key: %v", err)
+	}
+	if comment != "test@example.com" {
+		t.Errorf("Expected comment test@example.com, got %s", comment)
+	}
+
+	// A key without a public key cannot be fingerprinted
+	if _, err := PublicKeyFingerprint(filepath.Join(sshDir, "missing")); err == nil {
+		t.Error("Expected error for missing public key, got nil")
+	}
+}
+
+// TestReadKeyInfo tests describing the public half of generated key pairs
+func TestReadKeyInfo(t *testing.T) {
+	tests := []struct {
+		spec     KeySpec
+		wantType string
+		wantBits int
+	}{
+		{KeySpec{Cipher: "ed25519"}, "ed25519", 256},
+		{KeySpec{Cipher: "rsa", Bits: 2048}, "rsa", 2048},
+		{KeySpec{Cipher: "ecdsa", Bits: 384}, "ecdsa", 384},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.wantType, func(t *testing.T) {
+			sshDir := testutil.CreateTestSSHDir(t)
+			keyPath := filepath.Join(sshDir, "test_key")
+
+			if err := (&nativeGenerator{}).Generate(context.Background(), keyPath, tt.spec); err != nil {
+				t.Fatalf("Failed to generate key pair: %v", err)
+			}
+
+			info, err := ReadKeyInfo(keyPath)
+			if err != nil {
+				t.Fatalf("Failed to read key info: %v", err)
+			}
+
+			if info.Type != tt.wantType || info.Bits != tt.wantBits {
+				t.Errorf("Expected %s/%d, got %s/%d", tt.wantType, tt.wantBits, info.Type, info.Bits)
+			}
+			if !strings.HasPrefix(info.Fingerprint, "SHA256:") {
+				t.Errorf("Expected SHA256 fingerprint, got %s", info.Fingerprint)
+			}
+		})
+	}
+}
+
+// TestDetectAlgorithm tests detecting the algorithm of an existing key pair
+func TestDetectAlgorithm(t *testing.T) {
+	sshDir := testutil.CreateTestSSHDir(t)
+	g := &nativeGenerator{}
+
+	rsaKey := filepath.Join(sshDir, "id_rsa")
+	if err := g.Generate(context.Background(), rsaKey, KeySpec{Cipher: "rsa", Bits: 3072}); err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+
+	cipher, bits, err := DetectAlgorithm(rsaKey)
+	if err != nil {
+		t.Fatalf("Failed to detect algorithm: %v", err)
+	}
+	if cipher != "rsa" || bits != 3072 {
+		t.Errorf("Expected rsa/3072, got %s/%d", cipher, bits)
+	}
+
+	// Without a public key the header of an encrypted private key is used
+	ecdsaKey := filepath.Join(sshDir, "id_ecdsa")
+	if err := g.Generate(context.Background(), ecdsaKey, KeySpec{Cipher: "ecdsa", Bits: 384, Passphrase: "secret"}); err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	if err := os.Remove(ecdsaKey + ".pub"); err != nil {
+		t.Fatalf("Failed to remove public key: %v", err)
+	}
+
+	cipher, bits, err = DetectAlgorithm(ecdsaKey)
+	if err != nil {
+		t.Fatalf("Failed to detect algorithm: %v", err)
+	}
+	if cipher != "ecdsa" || bits != 384 {
+		t.Errorf("Expected ecdsa/384, got %s/%d", cipher, bits)
+	}
+
+	// Nothing to detect from
+	if _, _, err := DetectAlgorithm(filepath.Join(sshDir, "missing")); err == nil {
+		t.Error("Expected error for missing key, got nil")
+	}
+}
+
+// TestManager_RotateKeys_KeepAlgorithm tests that keep mode regenerates keys with their own algorithm
+func TestManager_RotateKeys_KeepAlgorithm(t *testing.T) {
+	sshDir := testutil.CreateTestSSHDir(t)
+	g := &nativeGenerator{}
+
+	rsaKey := filepath.Join(sshDir, "id_rsa")
+	if err := g.Generate(context.Background(), rsaKey, KeySpec{Cipher: "rsa", Bits: 2048}); err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	ecdsaKey := filepath.Join(sshDir, "id_ecdsa")
+	if err := g.Generate(context.Background(), ecdsaKey, KeySpec{Cipher: "ecdsa", Bits: 256}); err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	edKey, _ := testutil.CreateTestKeyPair(t, sshDir, "id_ed25519")
+
+	manager := &Manager{
+		sshDir:    sshDir,
+		generator: g,
+	}
+
+	paths := []string{rsaKey, ecdsaKey, edKey}
+	results, err := manager.RotateKeys(context.Background(), NewRotationRequests(paths, KeySpec{Cipher: CipherKeep}))
+	if err != nil {
+		t.Fatalf("Failed to rotate keys: %v", err)
+	}
+
+	expected := []struct {
+		cipher string
+		bits   int
+	}{
+		{"rsa", 2048},
+		{"ecdsa", 256},
+		{"ed25519", 256},
+	}
+	for i, path := range paths {
+		info, err := ReadKeyInfo(path)
+		if err != nil {
+			t.Fatalf("Failed to read key info: %v", err)
+		}
+		if info.Type != expected[i].cipher || info.Bits != expected[i].bits {
+			t.Errorf("Expected %s to stay %s/%d, got %s/%d", path, expected[i].cipher, expected[i].bits, info.Type, info.Bits)
+		}
+		if results[i].Cipher != expected[i].cipher {
+			t.Errorf("Expected result cipher %s, got %s", expected[i].cipher, results[i].Cipher)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package keys
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/de-lachende-cavalier/portunus/pkg/logger"
+)
+
+// ErrRotationAborted is reported for keys that were not rotated because another key in the batch failed
+var ErrRotationAborted = errors.New("rotation aborted")
+
+// RotationResult describes the outcome of rotating a single key
+type RotationResult struct {
+	Path           string
+	Success        bool
+	Err            error
+	OldFingerprint string
+	NewFingerprint string
+	// OldPublicKey is the public key of the retired key pair, nil if it could not be read
+	OldPublicKey ssh.PublicKey
+	// CreatedAt is when the new key pair was generated
+	CreatedAt time.Time
+	// RotatedAt is when the new key pair replaced the old one
+	RotatedAt time.Time
+	// Cipher and Bits describe the new key pair
+	Cipher string
+	Bits   int
+	// ArchiveID identifies the archive entry holding the retired key pair, if any
+	ArchiveID string
+	// PassphraseRef references the generated passphrase in the passphrase sink, if any
+	PassphraseRef string
+	// AgentLoaded is set when the new key was loaded in the manager's ssh-agent
+	AgentLoaded bool
+	// Revoked is set when the retired public key was added to the manager's revocation list
+	Revoked bool
+	// Hosts reports the distribution of the new key to the remote hosts of the key
+	Hosts []HostResult
+}
+
+// RotationRequest describes how a single key should be rotated
+type RotationRequest struct {
+	Path string
+	// Spec describes the new key pair; a Cipher of CipherKeep keeps the old key's algorithm and size
+	Spec KeySpec
+	// CommentTemplate sets the new key's comment (see ExpandCommentTemplate).
+	// When empty and Spec.Comment is empty, the comment of the old key is carried over.
+	CommentTemplate string
+	// GeneratePassphrase replaces Spec.Passphrase with a random passphrase that is
+	// stored in the manager's passphrase sink before the new key goes live
+	GeneratePassphrase bool
+	// OldPassphrase decrypts the old key to log in to the key's remote hosts
+	// when the old key is not loaded in the manager's ssh-agent
+	OldPassphrase string
+	// Lifetime is how long the new key stays loaded in the manager's ssh-agent,
+	// counted from its creation; zero keeps it loaded indefinitely
+	Lifetime time.Duration
+}
+
+// NewRotationRequests builds requests rotating every path with the same key spec
+func NewRotationRequests(paths []string, spec KeySpec) []RotationRequest {
+	requests := make([]RotationRequest, len(paths))
+	for i, path := range paths {
+		requests[i] = RotationRequest{Path: path, Spec: spec}
+	}
+	return requests
+}
+
+// resolveSpec returns the key spec to generate, with the comment and algorithm resolved
+func (req RotationRequest) resolveSpec(now time.Time) (KeySpec, error) {
+	spec := req.Spec
+
+	comment, err := req.resolveComment(now)
+	if err != nil {
+		return spec, fmt.Errorf("failed to set comment for %s: %w", req.Path, err)
+	}
+	spec.Comment = comment
+
+	if req.GeneratePassphrase {
+		if spec.Passphrase, err = GeneratePassphrase(); err != nil {
+			return spec, err
+		}
+	}
+
+	if spec.Cipher == CipherKeep {
+		spec.Cipher, spec.Bits, err = DetectAlgorithm(req.Path)
+		if err != nil {
+			return spec, err
+		}
+	}
+
+	return spec, nil
+}
+
+// resolveComment returns the comment the new key pair should carry
+func (req RotationRequest) resolveComment(now time.Time) (string, error) {
+	if req.Spec.Comment != "" {
+		return req.Spec.Comment, nil
+	}
+
+	// A missing or unreadable public key leaves the comment to the backend
+	_, oldComment, _ := ReadPublicKey(req.Path)
+
+	if req.CommentTemplate == "" {
+		return oldComment, nil
+	}
+	return ExpandCommentTemplate(req.CommentTemplate, NewCommentData(req.Path, oldComment, now))
+}
+
+// stagingPattern is the name pattern of the directories new key pairs are staged in
+const stagingPattern = ".portunus-staging-*"
+
+// stagedKey is a key pair generated next to the key it will replace
+type stagedKey struct {
+	path       string
+	stagingDir string
+}
+
+// newPath returns the location of the staged private key
+func (s *stagedKey) newPath() string {
+	return filepath.Join(s.stagingDir, filepath.Base(s.path))
+}
+
+// backupPath returns the location the original private key is moved to during the swap
+func (s *stagedKey) backupPath() string {
+	return filepath.Join(s.stagingDir, filepath.Base(s.path)+".old")
+}
+
+// renameOp records a completed rename so it can be undone
+type renameOp struct {
+	from string
+	to   string
+}
+
+// rotation stages new key pairs and swaps them in as a single transaction
+type rotation struct {
+	staged  []*stagedKey
+	journal []renameOp
+}
+
+// stage generates a new key pair for the requested key in a private staging directory
+func (r *rotation) stage(ctx context.Context, m *Manager, req RotationRequest) (KeySpec, error) {
+	path := req.Path
+
+	spec, err := req.resolveSpec(time.Now())
+	if err != nil {
+		return spec, err
+	}
+
+	// The staging directory lives next to the key so the swap is a same-filesystem rename
+	stagingDir, err := os.MkdirTemp(filepath.Dir(path), stagingPattern)
+	if err != nil {
+		return spec, fmt.Errorf("failed to create staging directory for %s: %w", path, err)
+	}
+
+	sk := &stagedKey{path: path, stagingDir: stagingDir}
+	r.staged = append(r.staged, sk)
+
+	if err := m.GenerateKeyPair(ctx, sk.newPath(), spec); err != nil {
+		return spec, fmt.Errorf("failed to generate key pair for %s: %w", path, err)
+	}
+
+	return spec, nil
+}
+
+// swap moves every staged key pair into place, keeping the originals aside.
+// On failure it returns the index of the key that could not be swapped.
+func (r *rotation) swap(ctx context.Context) (int, error) {
+	for i, sk := range r.staged {
+		if err := ctx.Err(); err != nil {
+			return i, fmt.Errorf("rotation interrupted: %w", err)
+		}
+
+		for _, suffix := range []string{"", ".pub"} {
+			if err := r.rename(sk.path+suffix, sk.backupPath()+suffix, true); err != nil {
+				return i, err
+			}
+		}
+
+		for _, suffix := range []string{"", ".pub"} {
+			if err := r.rename(sk.newPath()+suffix, sk.path+suffix, false); err != nil {
+				return i, err
+			}
+		}
+	}
+
+	return -1, nil
+}
+
+// rename moves a file and records the move in the journal
+func (r *rotation) rename(from, to string, allowMissing bool) error {
+	if err := os.Rename(from, to); err != nil {
+		if allowMissing && errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("failed to move %s to %s: %w", from, to, err)
+	}
+
+	r.journal = append(r.journal, renameOp{from: from, to: to})
+	return nil
+}
+
+// rollback undoes every recorded rename, restoring the original key pairs
+func (r *rotation) rollback() error {
+	var errs []error
+
+	for i := len(r.journal) - 1; i >= 0; i-- {
+		op := r.journal[i]
+		if err := os.Rename(op.to, op.from); err != nil {
+			errs = append(errs, fmt.Errorf("failed to restore %s: %w", op.from, err))
+		}
+	}
+	r.journal = nil
+
+	return errors.Join(errs...)
+}
+
+// retire moves the original key pairs set aside by swap into the archive
+func (r *rotation) retire(archive *Archive) (*ArchiveEntry, error) {
+	items := make([]archiveItem, len(r.staged))
+	for i, sk := range r.staged {
+		items[i] = archiveItem{originalPath: sk.path, source: sk.backupPath()}
+	}
+	return archive.store(items)
+}
+
+// cleanup removes the staging directories, including the retired key pairs
+func (r *rotation) cleanup() {
+	for _, sk := range r.staged {
+		if err := os.RemoveAll(sk.stagingDir); err != nil {
+			logger.Errorf(err, "Failed to remove staging directory %s", sk.stagingDir)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package keys
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/de-lachende-cavalier/portunus/pkg/testutil"
+)
+
+// failingGenerator wraps the native generator and fails after a number of successful calls
+type failingGenerator struct {
+	nativeGenerator
+	succeed int
+	cancel  context.CancelFunc
+}
+
+// Generate fails once the allowed number of successful generations is used up
+func (g *failingGenerator) Generate(ctx context.Context, path string, spec KeySpec) error {
+	if g.succeed == 0 {
+		if g.cancel != nil {
+			g.cancel()
+			return ctx.Err()
+		}
+		return errors.New("generation failed")
+	}
+	g.succeed--
+	return g.nativeGenerator.Generate(ctx, path, spec)
+}
+
+// assertUnchanged checks that a file still holds the given content
+func assertUnchanged(t *testing.T, path, want string) {
+	t.Helper()
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", path, err)
+	}
+	if string(got) != want {
+		t.Errorf("Expected %s to be restored, got different content", path)
+	}
+}
+
+// assertNoStagingDirs checks that no staging directories were left behind
+func assertNoStagingDirs(t *testing.T, dir string) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", dir, err)
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".portunus-staging-") {
+			t.Errorf("Expected staging directory %s to be removed", entry.Name())
+		}
+	}
+}
+
+// TestManager_RotateKeys_GenerationFailure tests that a failed generation leaves all keys untouched
+func TestManager_RotateKeys_GenerationFailure(t *testing.T) {
+	sshDir := testutil.CreateTestSSHDir(t)
+
+	key1, pub1 := testutil.CreateTestKeyPair(t, sshDir, "id_ed25519")
+	key2, pub2 := testutil.CreateTestKeyPair(t, sshDir, "id_rsa")
+	keyContent, _ := os.ReadFile(key1)
+	pubContent, _ := os.ReadFile(pub1)
+
+	manager := &Manager{
+		sshDir:    sshDir,
+		generator: &failingGenerator{succeed: 1},
+	}
+
+	results, err := manager.RotateKeys(context.Background(), NewRotationRequests([]string{key1, key2}, KeySpec{Cipher: "ed25519"}))
+	if err == nil {
+		t.Fatal("Expected rotation to fail, got nil")
+	}
+
+	// Every key must be reported, the staged one as aborted and the other as failed
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results, got %d", len(results))
+	}
+	if results[0].Success || !errors.Is(results[0].Err, ErrRotationAborted) {
+		t.Errorf("Expected key %s to be aborted, got success=%v err=%v", key1, results[0].Success, results[0].Err)
+	}
+	if results[1].Success || results[1].Err == nil || errors.Is(results[1].Err, ErrRotationAborted) {
+		t.Errorf("Expected key %s to report its own failure, got success=%v err=%v", key2, results[1].Success, results[1].Err)
+	}
+
+	// The first key was generated successfully but must not have been swapped in
+	assertUnchanged(t, key1, string(keyContent))
+	assertUnchanged(t, pub1, string(pubContent))
+	assertUnchanged(t, key2, string(keyContent))
+	assertUnchanged(t, pub2, string(pubContent))
+	assertNoStagingDirs(t, sshDir)
+}
+
+// TestManager_RotateKeys_Cancelled tests that cancelling the context restores the original keys
+func TestManager_RotateKeys_Cancelled(t *testing.T) {
+	sshDir := testutil.CreateTestSSHDir(t)
+
+	key1, pub1 := testutil.CreateTestKeyPair(t, sshDir, "id_ed25519")
+	key2, _ := testutil.CreateTestKeyPair(t, sshDir, "id_rsa")
+	keyContent, _ := os.ReadFile(key1)
+	pubContent, _ := os.ReadFile(pub1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	manager := &Manager{
+		sshDir:    sshDir,
+		generator: &failingGenerator{succeed: 1, cancel: cancel},
+	}
+
+	_, err := manager.RotateKeys(ctx, NewRotationRequests([]string{key1, key2}, KeySpec{Cipher: "ed25519"}))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+
+	assertUnchanged(t, key1, string(keyContent))
+	assertUnchanged(t, pub1, string(pubContent))
+	assertNoStagingDirs(t, sshDir)
+}
+
+// swapWatchContext is cancelled as soon as the key at path no longer holds its original content,
+// i.e. in the middle of a swap once that key was replaced
+type swapWatchContext struct {
+	context.Context
+	path     string
+	original string
+}
+
+// Err reports cancellation once the watched key was swapped
+func (c *swapWatchContext) Err() error {
+	if data, err := os.ReadFile(c.path); err != nil || string(data) != c.original {
+		return context.Canceled
+	}
+	return nil
+}
+
+// TestManager_RotateKeys_CancelledDuringSwap tests that cancelling between two swaps restores every key
+func TestManager_RotateKeys_CancelledDuringSwap(t *testing.T) {
+	sshDir := testutil.CreateTestSSHDir(t)
+
+	key1, pub1 := testutil.CreateTestKeyPair(t, sshDir, "id_ed25519")
+	key2, pub2 := testutil.CreateTestKeyPair(t, sshDir, "id_rsa")
+	keyContent, _ := os.ReadFile(key1)
+	pubContent, _ := os.ReadFile(pub1)
+
+	manager := &Manager{
+		sshDir:    sshDir,
+		generator: &nativeGenerator{},
+	}
+
+	ctx := &swapWatchContext{Context: context.Background(), path: key1, original: string(keyContent)}
+	results, err := manager.RotateKeys(ctx, NewRotationRequests([]string{key1, key2}, KeySpec{Cipher: "ed25519"}))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+	if results[1].Err == nil || results[0].Success {
+		t.Errorf("Expected the swap to stop at the second key, got %+v", results)
+	}
+
+	// The first key was swapped in before the cancellation and must be put back
+	assertUnchanged(t, key1, string(keyContent))
+	assertUnchanged(t, pub1, string(pubContent))
+	assertUnchanged(t, key2, string(keyContent))
+	assertUnchanged(t, pub2, string(pubContent))
+	assertNoStagingDirs(t, sshDir)
+}
+
+// TestRotation_Rollback tests that a partially applied swap is fully undone
+func TestRotation_Rollback(t *testing.T) {
+	sshDir := testutil.CreateTestSSHDir(t)
+
+	key1, pub1 := testutil.CreateTestKeyPair(t, sshDir, "id_ed25519")
+	key2, _ := testutil.CreateTestKeyPair(t, sshDir, "id_rsa")
+	keyContent, _ := os.ReadFile(key1)
+	pubContent, _ := os.ReadFile(pub1)
+
+	manager := &Manager{
+		sshDir:    sshDir,
+		generator: &nativeGenerator{},
+	}
+
+	r := &rotation{}
+	for _, path := range []string{key1, key2} {
+		if _, err := r.stage(context.Background(), manager, RotationRequest{Path: path, Spec: KeySpec{Cipher: "ed25519"}}); err != nil {
+			t.Fatalf("Failed to stage key pair: %v", err)
+		}
+	}
+
+	// Break the second swap by removing its staged public key
+	if err := os.Remove(r.staged[1].newPath() + ".pub"); err != nil {
+		t.Fatalf("Failed to remove staged public key: %v", err)
+	}
+
+	failed, err := r.swap(context.Background())
+	if err == nil {
+		t.Fatal("Expected swap to fail, got nil")
+	}
+	if failed != 1 {
+		t.Errorf("Expected second key to fail, got index %d", failed)
+	}
+	if err := r.rollback(); err != nil {
+		t.Fatalf("Failed to roll back: %v", err)
+	}
+	r.cleanup()
+
+	assertUnchanged(t, key1, string(keyContent))
+	assertUnchanged(t, pub1, string(pubContent))
+	assertUnchanged(t, key2, string(keyContent))
+	testutil.AssertFileExists(t, filepath.Join(sshDir, "id_rsa.pub"))
+	assertNoStagingDirs(t, sshDir)
+}
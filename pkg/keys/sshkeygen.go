@@ -0,0 +1,80 @@
+package keys
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+)
+
+// sshKeygenGenerator generates key pairs by running ssh-keygen
+type sshKeygenGenerator struct{}
+
+// Name returns the backend name of the generator
+func (g *sshKeygenGenerator) Name() string {
+	return BackendSSHKeygen
+}
+
+// passphraseEnv holds the passphrase for the askpass helper in ssh-keygen's environment
+const passphraseEnv = "PORTUNUS_KEYGEN_PASSPHRASE"
+
+// askpassScript answers ssh-keygen's passphrase prompts from its environment
+const askpassScript = "#!/bin/sh\nprintf '%s\\n' \"$" + passphraseEnv + "\"\n"
+
+// Generate runs ssh-keygen to create the key pair described by spec.
+// The passphrase never appears in ssh-keygen's arguments: ssh-keygen asks for it through
+// an SSH_ASKPASS helper that reads it from the environment, which only the user can see,
+// so the private key is encrypted by ssh-keygen before it is written.
+func (g *sshKeygenGenerator) Generate(ctx context.Context, path string, spec KeySpec) error {
+	tmpDir, err := os.MkdirTemp(filepath.Dir(path), ".portunus-keygen-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	tmpPath := filepath.Join(tmpDir, filepath.Base(path))
+	args := []string{"-q", "-t", spec.Cipher, "-f", tmpPath, "-a", strconv.Itoa(keygenRounds)}
+
+	bits := spec.Bits
+	if bits == 0 {
+		bits = defaultBits(spec.Cipher)
+	}
+	if bits != 0 {
+		args = append(args, "-b", strconv.Itoa(bits))
+	}
+	if spec.Comment != "" {
+		args = append(args, "-C", spec.Comment)
+	}
+
+	cmd := exec.CommandContext(ctx, "ssh-keygen")
+	if spec.Passphrase == "" {
+		args = append(args, "-N", "")
+	} else {
+		askpass := filepath.Join(tmpDir, "askpass")
+		if err := os.WriteFile(askpass, []byte(askpassScript), 0700); err != nil {
+			return fmt.Errorf("failed to write askpass helper: %w", err)
+		}
+		cmd.Env = append(os.Environ(),
+			"SSH_ASKPASS="+askpass,
+			"SSH_ASKPASS_REQUIRE=force",
+			passphraseEnv+"="+spec.Passphrase,
+		)
+	}
+	cmd.Args = append(cmd.Args, args...)
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("ssh-keygen failed: %w, output: %s", err, string(output))
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to move private key to %s: %w", path, err)
+	}
+	if err := os.Rename(tmpPath+".pub", path+".pub"); err != nil {
+		return fmt.Errorf("failed to move public key to %s.pub: %w", path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,106 @@
+package keys
+
+import (
+	"context"
+	"encoding/pem"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/de-lachende-cavalier/portunus/pkg/testutil"
+)
+
+// kdfRounds returns the bcrypt KDF rounds of an encrypted OpenSSH private key
+func kdfRounds(t *testing.T, data []byte) int {
+	t.Helper()
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "OPENSSH PRIVATE KEY" {
+		t.Fatal("Expected an OpenSSH private key")
+	}
+	const magic = "openssh-key-v1\x00"
+	if !strings.HasPrefix(string(block.Bytes), magic) {
+		t.Fatal("Expected the openssh-key-v1 format")
+	}
+
+	var header struct {
+		CipherName   string
+		KdfName      string
+		KdfOpts      string
+		NumKeys      uint32
+		PubKey       []byte
+		PrivKeyBlock []byte
+	}
+	if err := ssh.Unmarshal(block.Bytes[len(magic):], &header); err != nil {
+		t.Fatalf("Failed to parse private key: %v", err)
+	}
+	if header.KdfName != "bcrypt" {
+		t.Fatalf("Expected the bcrypt KDF, got %q", header.KdfName)
+	}
+
+	var opts struct {
+		Salt   string
+		Rounds uint32
+	}
+	if err := ssh.Unmarshal([]byte(header.KdfOpts), &opts); err != nil {
+		t.Fatalf("Failed to parse KDF options: %v", err)
+	}
+	return int(opts.Rounds)
+}
+
+// TestSSHKeygenGenerator_Generate tests that ssh-keygen keys are encrypted without exposing the passphrase
+func TestSSHKeygenGenerator_Generate(t *testing.T) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen not available")
+	}
+
+	sshDir := testutil.CreateTestSSHDir(t)
+	keyPath := filepath.Join(sshDir, "test_key")
+
+	g := &sshKeygenGenerator{}
+	spec := KeySpec{Cipher: "ed25519", Passphrase: "secret", Comment: "test@example.com"}
+	if err := g.Generate(context.Background(), keyPath, spec); err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+
+	privData, err := os.ReadFile(keyPath)
+	if err != nil {
+		t.Fatalf("Failed to read private key: %v", err)
+	}
+	if _, err := ssh.ParsePrivateKey(privData); err == nil {
+		t.Error("Expected encrypted key to require a passphrase")
+	}
+	signer, err := ssh.ParsePrivateKeyWithPassphrase(privData, []byte(spec.Passphrase))
+	if err != nil {
+		t.Fatalf("Failed to parse private key with passphrase: %v", err)
+	}
+
+	// ssh-keygen encrypted the key itself, with its stronger KDF settings
+	if rounds := kdfRounds(t, privData); rounds != keygenRounds {
+		t.Errorf("Expected %d bcrypt KDF rounds, got %d", keygenRounds, rounds)
+	}
+
+	pubKey, comment, err := ReadPublicKey(keyPath)
+	if err != nil {
+		t.Fatalf("Failed to read public key: %v", err)
+	}
+	if string(pubKey.Marshal()) != string(signer.PublicKey().Marshal()) {
+		t.Error("Expected public key to match private key")
+	}
+	if comment != spec.Comment {
+		t.Errorf("Expected comment %q, got %q", spec.Comment, comment)
+	}
+
+	// Only the key pair is left behind
+	entries, err := os.ReadDir(sshDir)
+	if err != nil {
+		t.Fatalf("Failed to read directory: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("Expected only the key pair in %s, got %d entries", sshDir, len(entries))
+	}
+}
@@ -56,6 +56,11 @@ func Fatal(err error, msg string) {
 	log.Fatal().Err(err).Msg(msg)
 }
 
+// Debugf logs a formatted debug message
+func Debugf(format string, v ...any) {
+	log.Debug().Msg(fmt.Sprintf(format, v...))
+}
+
 // Infof logs a formatted info message
 func Infof(format string, v ...any) {
 	log.Info().Msg(fmt.Sprintf(format, v...))
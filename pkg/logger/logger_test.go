@@ -117,6 +117,20 @@ func TestError(t *testing.T) {
 	}
 }
 
+func TestDebugf(t *testing.T) {
+	output := captureOutput(func() {
+		Debugf("test %s message", "formatted")
+	})
+
+	if !strings.Contains(output, "test formatted message") {
+		t.Errorf("Expected output to contain 'test formatted message', got %s", output)
+	}
+
+	if !strings.Contains(output, "debug") {
+		t.Errorf("Expected output to contain 'debug', got %s", output)
+	}
+}
+
 func TestInfof(t *testing.T) {
 	output := captureOutput(func() {
 		Infof("test %s message", "formatted")
@@ -0,0 +1,53 @@
+package publish
+
+import (
+	"net/http"
+)
+
+// provider describes the user SSH key API of a Git hosting service
+type provider struct {
+	// defaultAddress is the API URL of the public instance, empty for self-hosted only services
+	defaultAddress string
+	// path locates the keys of the authenticated user under the address
+	path []string
+	// pageParam is the query parameter setting the page size, up to pageSize
+	pageParam string
+	pageSize  int
+	// authorize sets the credentials of a request
+	authorize func(req *http.Request, token string)
+}
+
+// providers maps the supported providers to their APIs
+var providers = map[string]provider{
+	// GitHub tokens need the admin:public_key scope; GitHub Enterprise Server is at https://<host>/api/v3
+	ProviderGitHub: {
+		defaultAddress: DefaultGitHubAddress,
+		path:           []string{"user", "keys"},
+		pageParam:      "per_page",
+		pageSize:       100,
+		authorize: func(req *http.Request, token string) {
+			req.Header.Set("Authorization", "Bearer "+token)
+			req.Header.Set("Accept", "application/vnd.github+json")
+			req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+		},
+	},
+	// GitLab tokens need the api scope
+	ProviderGitLab: {
+		defaultAddress: DefaultGitLabAddress,
+		path:           []string{"api", "v4", "user", "keys"},
+		pageParam:      "per_page",
+		pageSize:       100,
+		authorize: func(req *http.Request, token string) {
+			req.Header.Set("PRIVATE-TOKEN", token)
+		},
+	},
+	// Gitea (and Forgejo) tokens need the write:user scope
+	ProviderGitea: {
+		path:      []string{"api", "v1", "user", "keys"},
+		pageParam: "limit",
+		pageSize:  50,
+		authorize: func(req *http.Request, token string) {
+			req.Header.Set("Authorization", "token "+token)
+		},
+	},
+}
@@ -0,0 +1,200 @@
+// Package publish uploads public keys to the SSH key settings of Git hosting services
+package publish
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Supported providers
+const (
+	ProviderGitHub = "github"
+	ProviderGitLab = "gitlab"
+	ProviderGitea  = "gitea"
+)
+
+// Default API addresses of the providers hosted publicly
+const (
+	DefaultGitHubAddress = "https://api.github.com"
+	DefaultGitLabAddress = "https://gitlab.com"
+)
+
+// Publisher manages the public keys of a user account on a Git hosting service
+type Publisher interface {
+	// Publish uploads the public key under title, unless the account already has it
+	Publish(ctx context.Context, pubKey ssh.PublicKey, title string) error
+	// Unpublish deletes the public key from the account and returns how many entries were deleted
+	Unpublish(ctx context.Context, pubKey ssh.PublicKey) (int, error)
+}
+
+// New returns the publisher of an account on a provider. An empty address selects the
+// provider's public instance; Gitea has none.
+func New(name, address, token string) (Publisher, error) {
+	p, ok := providers[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported provider %q (supported: github, gitlab, gitea)", name)
+	}
+	if address == "" {
+		address = p.defaultAddress
+	}
+	if address == "" {
+		return nil, fmt.Errorf("%s address is not set", name)
+	}
+	if token == "" {
+		return nil, fmt.Errorf("%s token is not set", name)
+	}
+
+	endpoint, err := url.JoinPath(address, p.path...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s address %q: %w", name, address, err)
+	}
+	return &keyAPI{
+		name:      name,
+		endpoint:  endpoint,
+		pageParam: p.pageParam,
+		pageSize:  p.pageSize,
+		authorize: func(req *http.Request) { p.authorize(req, token) },
+		client:    &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// uploadedKey is a public key of a user account, as listed by the providers
+type uploadedKey struct {
+	ID    int64  `json:"id"`
+	Key   string `json:"key"`
+	Title string `json:"title"`
+}
+
+// keyAPI is the user SSH key REST API the providers have in common:
+// keys are listed with GET, added with POST and deleted with DELETE on <endpoint>/<id>
+type keyAPI struct {
+	// name describes the provider in errors
+	name     string
+	endpoint string
+	// pageParam is the query parameter setting the page size
+	pageParam string
+	pageSize  int
+	// authorize sets the credentials of a request
+	authorize func(*http.Request)
+	client    *http.Client
+}
+
+// Publish uploads the public key under title, unless the account already has it
+func (a *keyAPI) Publish(ctx context.Context, pubKey ssh.PublicKey, title string) error {
+	uploaded, err := a.list(ctx)
+	if err != nil {
+		return err
+	}
+	for _, k := range uploaded {
+		if sameKey(k, pubKey) {
+			return nil
+		}
+	}
+
+	body, err := json.Marshal(map[string]string{
+		"title": title,
+		"key":   strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pubKey))),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode key: %w", err)
+	}
+	if _, err := a.do(ctx, http.MethodPost, a.endpoint, body); err != nil {
+		return fmt.Errorf("failed to upload key to %s: %w", a.name, err)
+	}
+	return nil
+}
+
+// Unpublish deletes every entry of the account holding the public key and returns how many were deleted
+func (a *keyAPI) Unpublish(ctx context.Context, pubKey ssh.PublicKey) (int, error) {
+	uploaded, err := a.list(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, k := range uploaded {
+		if !sameKey(k, pubKey) {
+			continue
+		}
+		endpoint, err := url.JoinPath(a.endpoint, strconv.FormatInt(k.ID, 10))
+		if err != nil {
+			return deleted, fmt.Errorf("invalid %s address: %w", a.name, err)
+		}
+		if _, err := a.do(ctx, http.MethodDelete, endpoint, nil); err != nil {
+			return deleted, fmt.Errorf("failed to delete key %d from %s: %w", k.ID, a.name, err)
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// list returns every public key of the account, page by page
+func (a *keyAPI) list(ctx context.Context) ([]uploadedKey, error) {
+	var keys []uploadedKey
+	for page := 1; ; page++ {
+		query := url.Values{}
+		query.Set(a.pageParam, strconv.Itoa(a.pageSize))
+		query.Set("page", strconv.Itoa(page))
+
+		data, err := a.do(ctx, http.MethodGet, a.endpoint+"?"+query.Encode(), nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list keys on %s: %w", a.name, err)
+		}
+
+		var batch []uploadedKey
+		if err := json.Unmarshal(data, &batch); err != nil {
+			return nil, fmt.Errorf("failed to decode %s response: %w", a.name, err)
+		}
+		keys = append(keys, batch...)
+		if len(batch) < a.pageSize {
+			return keys, nil
+		}
+	}
+}
+
+// do sends an authorized request and returns the body of a successful response
+func (a *keyAPI) do(ctx context.Context, method, endpoint string, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	a.authorize(req)
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	return data, nil
+}
+
+// sameKey reports whether an uploaded key is the public key, whatever its comment
+func sameKey(k uploadedKey, pubKey ssh.PublicKey) bool {
+	uploaded, _, _, _, err := ssh.ParseAuthorizedKey([]byte(k.Key))
+	if err != nil {
+		return false
+	}
+	return ssh.FingerprintSHA256(uploaded) == ssh.FingerprintSHA256(pubKey)
+}
@@ -0,0 +1,198 @@
+package publish
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"net/http"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/de-lachende-cavalier/portunus/pkg/testutil"
+)
+
+// newTestPublicKey returns a random ed25519 public key
+func newTestPublicKey(t *testing.T) ssh.PublicKey {
+	t.Helper()
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	pubKey, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatalf("Failed to create public key: %v", err)
+	}
+	return pubKey
+}
+
+// authorizedKey returns the public key in authorized_keys format, without comment
+func authorizedKey(pubKey ssh.PublicKey) string {
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pubKey)))
+}
+
+// providerTest describes how a provider talks to its API
+type providerTest struct {
+	provider   string
+	path       string
+	pageParam  string
+	pageSize   int
+	authorized func(*http.Request) bool
+}
+
+var providerTests = []providerTest{
+	{
+		provider:  ProviderGitHub,
+		path:      "/user/keys",
+		pageParam: "per_page",
+		pageSize:  100,
+		authorized: func(r *http.Request) bool {
+			return r.Header.Get("Authorization") == "Bearer t0ken" &&
+				r.Header.Get("Accept") == "application/vnd.github+json"
+		},
+	},
+	{
+		provider:  ProviderGitLab,
+		path:      "/api/v4/user/keys",
+		pageParam: "per_page",
+		pageSize:  100,
+		authorized: func(r *http.Request) bool {
+			return r.Header.Get("PRIVATE-TOKEN") == "t0ken"
+		},
+	},
+	{
+		provider:  ProviderGitea,
+		path:      "/api/v1/user/keys",
+		pageParam: "limit",
+		pageSize:  50,
+		authorized: func(r *http.Request) bool {
+			return r.Header.Get("Authorization") == "token t0ken"
+		},
+	},
+}
+
+// TestPublisher_Publish tests uploading keys to every provider
+func TestPublisher_Publish(t *testing.T) {
+	for _, tt := range providerTests {
+		t.Run(tt.provider, func(t *testing.T) {
+			server := testutil.StartKeyServer(t, tt.path, tt.pageParam, tt.authorized)
+			publisher, err := New(tt.provider, server.URL, "t0ken")
+			if err != nil {
+				t.Fatalf("Failed to create publisher: %v", err)
+			}
+
+			pubKey := newTestPublicKey(t)
+			if err := publisher.Publish(context.Background(), pubKey, "laptop 2026-10-17"); err != nil {
+				t.Fatalf("Failed to publish key: %v", err)
+			}
+
+			keys := server.Keys()
+			if len(keys) != 1 {
+				t.Fatalf("Expected 1 uploaded key, got %d", len(keys))
+			}
+			if keys[0].Key != authorizedKey(pubKey) {
+				t.Errorf("Expected key %q, got %q", authorizedKey(pubKey), keys[0].Key)
+			}
+			if keys[0].Title != "laptop 2026-10-17" {
+				t.Errorf("Expected title %q, got %q", "laptop 2026-10-17", keys[0].Title)
+			}
+
+			// Publishing again leaves the account untouched
+			if err := publisher.Publish(context.Background(), pubKey, "again"); err != nil {
+				t.Fatalf("Failed to publish key again: %v", err)
+			}
+			if n := len(server.Keys()); n != 1 {
+				t.Errorf("Expected the key to be uploaded once, got %d keys", n)
+			}
+		})
+	}
+}
+
+// TestPublisher_Unpublish tests deleting keys by fingerprint, across pages
+func TestPublisher_Unpublish(t *testing.T) {
+	for _, tt := range providerTests {
+		t.Run(tt.provider, func(t *testing.T) {
+			server := testutil.StartKeyServer(t, tt.path, tt.pageParam, tt.authorized)
+			publisher, err := New(tt.provider, server.URL, "t0ken")
+			if err != nil {
+				t.Fatalf("Failed to create publisher: %v", err)
+			}
+
+			// Fill the first page so the old key is only found on the second one
+			for i := 0; i < tt.pageSize; i++ {
+				server.Add(authorizedKey(newTestPublicKey(t)), "other")
+			}
+			oldKey := newTestPublicKey(t)
+			server.Add(authorizedKey(oldKey)+" user@old-laptop", "old")
+
+			deleted, err := publisher.Unpublish(context.Background(), oldKey)
+			if err != nil {
+				t.Fatalf("Failed to unpublish key: %v", err)
+			}
+			if deleted != 1 {
+				t.Errorf("Expected 1 deleted key, got %d", deleted)
+			}
+			for _, k := range server.Keys() {
+				if k.Title == "old" {
+					t.Errorf("Expected the old key to be deleted, still have %d", k.ID)
+				}
+			}
+			if n := len(server.Keys()); n != tt.pageSize {
+				t.Errorf("Expected the other %d keys to be kept, got %d", tt.pageSize, n)
+			}
+
+			// A key the account does not have is not an error
+			deleted, err = publisher.Unpublish(context.Background(), oldKey)
+			if err != nil || deleted != 0 {
+				t.Errorf("Expected nothing to delete, got %d, %v", deleted, err)
+			}
+		})
+	}
+}
+
+// TestPublisher_Errors tests the errors of misconfigured publishers
+func TestPublisher_Errors(t *testing.T) {
+	for _, tt := range providerTests {
+		t.Run(tt.provider, func(t *testing.T) {
+			server := testutil.StartKeyServer(t, tt.path, tt.pageParam, tt.authorized)
+			pubKey := newTestPublicKey(t)
+
+			publisher, err := New(tt.provider, server.URL, "wrong")
+			if err != nil {
+				t.Fatalf("Failed to create publisher: %v", err)
+			}
+			err = publisher.Publish(context.Background(), pubKey, "title")
+			if err == nil || !strings.Contains(err.Error(), "401") {
+				t.Errorf("Expected unauthorized error, got %v", err)
+			}
+
+			if _, err := New(tt.provider, server.URL, ""); err == nil {
+				t.Error("Expected error without a token, got nil")
+			}
+		})
+	}
+
+	if _, err := New("bitbucket", "", "t0ken"); err == nil {
+		t.Error("Expected error for an unsupported provider, got nil")
+	}
+	if _, err := New(ProviderGitea, "", "t0ken"); err == nil {
+		t.Error("Expected error for Gitea without an address, got nil")
+	}
+}
+
+// TestNew_DefaultAddress tests that the public instances are used without an address
+func TestNew_DefaultAddress(t *testing.T) {
+	for provider, want := range map[string]string{
+		ProviderGitHub: DefaultGitHubAddress + "/user/keys",
+		ProviderGitLab: DefaultGitLabAddress + "/api/v4/user/keys",
+	} {
+		publisher, err := New(provider, "", "t0ken")
+		if err != nil {
+			t.Fatalf("Failed to create %s publisher: %v", provider, err)
+		}
+		if endpoint := publisher.(*keyAPI).endpoint; endpoint != want {
+			t.Errorf("Expected %s endpoint %s, got %s", provider, want, endpoint)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+// Package remote manages authorized keys on remote hosts over SSH
+package remote
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"path"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// DefaultAuthorizedKeys is the authorized_keys file of a host, relative to the user's home
+const DefaultAuthorizedKeys = ".ssh/authorized_keys"
+
+// DefaultTimeout bounds connecting and logging in to a host
+const DefaultTimeout = 30 * time.Second
+
+// Host is a remote host a key gives access to
+type Host struct {
+	// Address is the host name, optionally followed by :port (default 22)
+	Address string
+	// User is the remote user name (default: the current user)
+	User string
+	// AuthorizedKeys is the path of the authorized_keys file, relative to the remote home
+	// unless absolute (default .ssh/authorized_keys)
+	AuthorizedKeys string
+}
+
+// String returns the host as user@address
+func (h Host) String() string {
+	if h.User == "" {
+		return h.Address
+	}
+	return h.User + "@" + h.Address
+}
+
+// dialAddress returns the address to connect to, with the default port if none is given
+func (h Host) dialAddress() string {
+	if _, _, err := net.SplitHostPort(h.Address); err == nil {
+		return h.Address
+	}
+	return net.JoinHostPort(h.Address, "22")
+}
+
+// authorizedKeysPath returns the path of the authorized_keys file on the host
+func (h Host) authorizedKeysPath() string {
+	p := h.AuthorizedKeys
+	if p == "" {
+		return DefaultAuthorizedKeys
+	}
+	// Commands run in the remote home directory
+	return strings.TrimPrefix(p, "~/")
+}
+
+// KnownHosts returns a host key callback checking hosts against the known_hosts files
+func KnownHosts(files ...string) (ssh.HostKeyCallback, error) {
+	for _, file := range files {
+		if _, err := os.Stat(file); err != nil {
+			return nil, fmt.Errorf("cannot verify host keys: %w", err)
+		}
+	}
+
+	callback, err := knownhosts.New(files...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read known hosts: %w", err)
+	}
+	return callback, nil
+}
+
+// Client is a connection to a host, logged in with a single key
+type Client struct {
+	host   Host
+	client *ssh.Client
+	stop   func() bool
+}
+
+// Dial logs in to host with signer, checking the host key with hostKeyCallback
+func Dial(ctx context.Context, host Host, signer ssh.Signer, hostKeyCallback ssh.HostKeyCallback, timeout time.Duration) (*Client, error) {
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+
+	userName := host.User
+	if userName == "" {
+		current, err := user.Current()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get current user: %w", err)
+		}
+		userName = current.Username
+	}
+
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", host.dialAddress())
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", host, err)
+	}
+
+	// Bound the handshake and login, which may otherwise hang on an unresponsive host
+	conn.SetDeadline(time.Now().Add(timeout))
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, host.dialAddress(), &ssh.ClientConfig{
+		User:            userName,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         timeout,
+	})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to log in to %s with %s: %w", host, ssh.FingerprintSHA256(signer.PublicKey()), err)
+	}
+	conn.SetDeadline(time.Time{})
+
+	client := ssh.NewClient(sshConn, chans, reqs)
+	stop := context.AfterFunc(ctx, func() { client.Close() })
+	return &Client{host: host, client: client, stop: stop}, nil
+}
+
+// Close closes the connection
+func (c *Client) Close() error {
+	c.stop()
+	return c.client.Close()
+}
+
+// ReadAuthorizedKeys returns the content of the authorized_keys file, empty if it does not exist
+func (c *Client) ReadAuthorizedKeys() ([]byte, error) {
+	p := shellQuote(c.host.authorizedKeysPath())
+	out, err := c.run("if [ -f "+p+" ]; then cat "+p+"; fi", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read authorized keys on %s: %w", c.host, err)
+	}
+	return out, nil
+}
+
+// WriteAuthorizedKeys atomically replaces the content of the authorized_keys file
+func (c *Client) WriteAuthorizedKeys(data []byte) error {
+	p := c.host.authorizedKeysPath()
+	tmp := shellQuote(p + ".portunus-tmp")
+	cmd := fmt.Sprintf("umask 077 && mkdir -p %s && cat > %s && mv -f %s %s",
+		shellQuote(path.Dir(p)), tmp, tmp, shellQuote(p))
+
+	if _, err := c.run(cmd, data); err != nil {
+		return fmt.Errorf("failed to write authorized keys on %s: %w", c.host, err)
+	}
+	return nil
+}
+
+// run runs a shell command on the host, feeding it stdin, and returns its output
+func (c *Client) run(cmd string, stdin []byte) ([]byte, error) {
+	session, err := c.client.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	var stdout, stderr bytes.Buffer
+	session.Stdin = bytes.NewReader(stdin)
+	session.Stdout = &stdout
+	session.Stderr = &stderr
+
+	if err := session.Run(cmd); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
+
+// shellQuote quotes s for a POSIX shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
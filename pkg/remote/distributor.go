@@ -0,0 +1,144 @@
+package remote
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/de-lachende-cavalier/portunus/pkg/keys"
+)
+
+// Distributor authorizes keys on the hosts of an inventory over SSH
+type Distributor struct {
+	// Inventory maps private key paths to the hosts they give access to
+	Inventory map[string][]Host
+	// HostKeyCallback verifies the identity of the hosts
+	HostKeyCallback ssh.HostKeyCallback
+	// Timeout bounds connecting and logging in to a host (default DefaultTimeout)
+	Timeout time.Duration
+}
+
+var _ keys.Distributor = (*Distributor)(nil)
+
+// NewDistributor returns a distributor for the hosts of inventory. Hosts are named
+// user@address, so entries sharing a name must describe the same host; a name whose
+// entries disagree, e.g. on the authorized_keys file, is rejected.
+func NewDistributor(inventory map[string][]Host, hostKeyCallback ssh.HostKeyCallback) (*Distributor, error) {
+	d := &Distributor{Inventory: inventory, HostKeyCallback: hostKeyCallback}
+	for _, hosts := range inventory {
+		for _, host := range hosts {
+			if _, err := d.lookup(host.String()); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return d, nil
+}
+
+// Hosts returns the hosts the key at path gives access to
+func (d *Distributor) Hosts(path string) []string {
+	var hosts []string
+	for _, host := range d.Inventory[path] {
+		hosts = append(hosts, host.String())
+	}
+	return hosts
+}
+
+// Authorize logs in to host with signer and appends pubKey to its authorized_keys
+func (d *Distributor) Authorize(ctx context.Context, host string, signer ssh.Signer, pubKey ssh.PublicKey, comment string) error {
+	return d.edit(ctx, host, signer, func(data []byte) ([]byte, bool) {
+		return keys.AuthorizeKey(data, pubKey, comment)
+	})
+}
+
+// Verify checks that signer can log in to host
+func (d *Distributor) Verify(ctx context.Context, host string, signer ssh.Signer) error {
+	h, err := d.lookup(host)
+	if err != nil {
+		return err
+	}
+
+	client, err := Dial(ctx, h, signer, d.HostKeyCallback, d.Timeout)
+	if err != nil {
+		return err
+	}
+	return client.Close()
+}
+
+// Unauthorize logs in to host with signer and removes every entry of pubKey from its authorized_keys
+func (d *Distributor) Unauthorize(ctx context.Context, host string, signer ssh.Signer, pubKey ssh.PublicKey) error {
+	return d.edit(ctx, host, signer, func(data []byte) ([]byte, bool) {
+		out, removed := keys.UnauthorizeKey(data, pubKey)
+		return out, removed > 0
+	})
+}
+
+// RemoveKeys logs in to host with signer and removes every entry of pubKeys from its authorized_keys.
+// It returns how many lines were removed for each key.
+func (d *Distributor) RemoveKeys(ctx context.Context, host string, signer ssh.Signer, pubKeys []ssh.PublicKey) ([]int, error) {
+	removed := make([]int, len(pubKeys))
+	err := d.edit(ctx, host, signer, func(data []byte) ([]byte, bool) {
+		changed := false
+		for i, pubKey := range pubKeys {
+			data, removed[i] = keys.UnauthorizeKey(data, pubKey)
+			changed = changed || removed[i] > 0
+		}
+		return data, changed
+	})
+	if err != nil {
+		return nil, err
+	}
+	return removed, nil
+}
+
+// edit rewrites the authorized_keys file of host, if change reports a modification
+func (d *Distributor) edit(ctx context.Context, host string, signer ssh.Signer, change func([]byte) ([]byte, bool)) error {
+	h, err := d.lookup(host)
+	if err != nil {
+		return err
+	}
+
+	client, err := Dial(ctx, h, signer, d.HostKeyCallback, d.Timeout)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	data, err := client.ReadAuthorizedKeys()
+	if err != nil {
+		return err
+	}
+
+	data, changed := change(data)
+	if !changed {
+		return nil
+	}
+	return client.WriteAuthorizedKeys(data)
+}
+
+// lookup finds a host of the inventory by its name. Every entry of that name must agree,
+// so the host edited does not depend on which key lists it first.
+func (d *Distributor) lookup(name string) (Host, error) {
+	var found *Host
+	for _, hosts := range d.Inventory {
+		for i, host := range hosts {
+			if host.String() != name {
+				continue
+			}
+			if found == nil {
+				found = &hosts[i]
+				continue
+			}
+			if host.authorizedKeysPath() != found.authorizedKeysPath() {
+				return Host{}, fmt.Errorf("host %s is listed with different authorized_keys files (%s and %s)",
+					name, found.authorizedKeysPath(), host.authorizedKeysPath())
+			}
+		}
+	}
+	if found == nil {
+		return Host{}, fmt.Errorf("unknown host %s", name)
+	}
+	return *found, nil
+}
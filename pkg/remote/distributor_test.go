@@ -0,0 +1,205 @@
+package remote
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/de-lachende-cavalier/portunus/pkg/keys"
+	"github.com/de-lachende-cavalier/portunus/pkg/testutil"
+)
+
+// newTestSigner generates an in-memory ed25519 signer
+func newTestSigner(t *testing.T) ssh.Signer {
+	t.Helper()
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(privateKey)
+	if err != nil {
+		t.Fatalf("Failed to create signer: %v", err)
+	}
+	return signer
+}
+
+// TestDistributor tests replacing a key in the authorized_keys file of a host
+func TestDistributor(t *testing.T) {
+	server := testutil.StartSSHServer(t)
+	oldSigner, newSigner, otherSigner := newTestSigner(t), newTestSigner(t), newTestSigner(t)
+
+	// The host authorizes the old key, next to other entries that must be kept
+	otherLine := `from="10.0.0.0/8" ` + strings.TrimSpace(string(ssh.MarshalAuthorizedKey(otherSigner.PublicKey()))) + " backup\n"
+	initial := "# managed by hand\n" + otherLine + string(ssh.MarshalAuthorizedKey(oldSigner.PublicKey()))
+	if err := os.WriteFile(server.AuthorizedKeysPath(), []byte(initial), 0600); err != nil {
+		t.Fatalf("Failed to write authorized keys: %v", err)
+	}
+
+	host := Host{Address: server.Addr, User: "alice"}
+	d := &Distributor{
+		Inventory:       map[string][]Host{"/home/alice/.ssh/id_ed25519": {host}},
+		HostKeyCallback: ssh.FixedHostKey(server.HostKey),
+	}
+	ctx := context.Background()
+
+	hosts := d.Hosts("/home/alice/.ssh/id_ed25519")
+	if len(hosts) != 1 || hosts[0] != "alice@"+server.Addr {
+		t.Fatalf("Expected the inventory host, got %v", hosts)
+	}
+
+	if err := d.Verify(ctx, hosts[0], newSigner); err == nil {
+		t.Error("Expected the new key not to log in before it is authorized")
+	}
+	if err := d.Authorize(ctx, hosts[0], oldSigner, newSigner.PublicKey(), "alice@laptop"); err != nil {
+		t.Fatalf("Failed to authorize new key: %v", err)
+	}
+	// Authorizing twice does not duplicate the entry
+	if err := d.Authorize(ctx, hosts[0], oldSigner, newSigner.PublicKey(), "alice@laptop"); err != nil {
+		t.Fatalf("Failed to authorize new key: %v", err)
+	}
+	if err := d.Verify(ctx, hosts[0], newSigner); err != nil {
+		t.Fatalf("Expected the new key to log in: %v", err)
+	}
+	if err := d.Unauthorize(ctx, hosts[0], newSigner, oldSigner.PublicKey()); err != nil {
+		t.Fatalf("Failed to remove old key: %v", err)
+	}
+
+	data, err := os.ReadFile(server.AuthorizedKeysPath())
+	if err != nil {
+		t.Fatalf("Failed to read authorized keys: %v", err)
+	}
+	want := "# managed by hand\n" + otherLine + strings.TrimSpace(string(ssh.MarshalAuthorizedKey(newSigner.PublicKey()))) + " alice@laptop\n"
+	if string(data) != want {
+		t.Errorf("Unexpected authorized keys:\n%s\nwant:\n%s", data, want)
+	}
+
+	if err := d.Verify(ctx, hosts[0], oldSigner); err == nil {
+		t.Error("Expected the old key not to log in anymore")
+	}
+
+	// Removing keys reports how many entries of each key were found
+	if err := d.Authorize(ctx, hosts[0], newSigner, oldSigner.PublicKey(), ""); err != nil {
+		t.Fatalf("Failed to authorize old key: %v", err)
+	}
+	removed, err := d.RemoveKeys(ctx, hosts[0], newSigner, []ssh.PublicKey{oldSigner.PublicKey(), otherSigner.PublicKey()})
+	if err != nil {
+		t.Fatalf("Failed to remove keys: %v", err)
+	}
+	if len(removed) != 2 || removed[0] != 1 || removed[1] != 1 {
+		t.Errorf("Expected one entry of each key removed, got %v", removed)
+	}
+	if err := d.Verify(ctx, "bob@elsewhere", newSigner); err == nil {
+		t.Error("Expected error for a host outside the inventory")
+	}
+}
+
+// TestDistributor_HostKey tests that hosts are only trusted when their host key is known
+func TestDistributor_HostKey(t *testing.T) {
+	server := testutil.StartSSHServer(t)
+	signer := newTestSigner(t)
+	if err := os.WriteFile(server.AuthorizedKeysPath(), ssh.MarshalAuthorizedKey(signer.PublicKey()), 0600); err != nil {
+		t.Fatalf("Failed to write authorized keys: %v", err)
+	}
+
+	knownHosts := filepath.Join(testutil.TempDir(t), "known_hosts")
+	if _, err := KnownHosts(knownHosts); err == nil {
+		t.Error("Expected error for a missing known_hosts file")
+	}
+
+	// An unknown host is rejected
+	if err := os.WriteFile(knownHosts, []byte(""), 0600); err != nil {
+		t.Fatalf("Failed to write known hosts: %v", err)
+	}
+	callback, err := KnownHosts(knownHosts)
+	if err != nil {
+		t.Fatalf("Failed to read known hosts: %v", err)
+	}
+	host := Host{Address: server.Addr, User: "alice"}
+	d := &Distributor{Inventory: map[string][]Host{"key": {host}}, HostKeyCallback: callback}
+	if err := d.Verify(context.Background(), host.String(), signer); err == nil {
+		t.Error("Expected an unknown host to be rejected")
+	}
+
+	// A known host is accepted
+	if err := os.WriteFile(knownHosts, []byte(server.KnownHostsLine()), 0600); err != nil {
+		t.Fatalf("Failed to write known hosts: %v", err)
+	}
+	if d.HostKeyCallback, err = KnownHosts(knownHosts); err != nil {
+		t.Fatalf("Failed to read known hosts: %v", err)
+	}
+	if err := d.Verify(context.Background(), host.String(), signer); err != nil {
+		t.Errorf("Expected a known host to be accepted: %v", err)
+	}
+}
+
+// TestNewDistributor tests that hosts listed by several keys must agree on where they are
+func TestNewDistributor(t *testing.T) {
+	callback := ssh.InsecureIgnoreHostKey()
+
+	// The same host shared by two keys, and another port of it, are fine
+	inventory := map[string][]Host{
+		"/home/alice/.ssh/id_work": {{Address: "example.com", User: "deploy"}},
+		"/home/alice/.ssh/id_ci": {
+			{Address: "example.com", User: "deploy", AuthorizedKeys: "~/.ssh/authorized_keys"},
+			{Address: "example.com:2222", User: "deploy", AuthorizedKeys: "/etc/ssh/keys/deploy"},
+		},
+	}
+	d, err := NewDistributor(inventory, callback)
+	if err != nil {
+		t.Fatalf("Failed to create distributor: %v", err)
+	}
+	host, err := d.lookup("deploy@example.com:2222")
+	if err != nil || host.AuthorizedKeys != "/etc/ssh/keys/deploy" {
+		t.Errorf("Expected the host on port 2222, got %+v, %v", host, err)
+	}
+
+	// The same host with another authorized_keys file is ambiguous
+	inventory["/home/alice/.ssh/id_backup"] = []Host{{Address: "example.com", User: "deploy", AuthorizedKeys: ".ssh/authorized_keys2"}}
+	if _, err := NewDistributor(inventory, callback); err == nil || !strings.Contains(err.Error(), "deploy@example.com") {
+		t.Errorf("Expected the conflicting entries to be rejected, got %v", err)
+	}
+	if _, err := d.lookup("deploy@example.com"); err == nil {
+		t.Error("Expected the lookup of the ambiguous host to fail")
+	}
+}
+
+// TestClient_AuthorizedKeysPath tests writing a missing authorized_keys file at a custom path
+func TestClient_AuthorizedKeysPath(t *testing.T) {
+	server := testutil.StartSSHServer(t)
+	signer := newTestSigner(t)
+	if err := os.WriteFile(server.AuthorizedKeysPath(), ssh.MarshalAuthorizedKey(signer.PublicKey()), 0600); err != nil {
+		t.Fatalf("Failed to write authorized keys: %v", err)
+	}
+
+	host := Host{Address: server.Addr, AuthorizedKeys: "~/.config/ssh/keys"}
+	client, err := Dial(context.Background(), host, signer, ssh.FixedHostKey(server.HostKey), 0)
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+	defer client.Close()
+
+	data, err := client.ReadAuthorizedKeys()
+	if err != nil || len(data) != 0 {
+		t.Fatalf("Expected a missing file to read as empty, got %q, %v", data, err)
+	}
+
+	data, _ = keys.AuthorizeKey(nil, signer.PublicKey(), "test")
+	if err := client.WriteAuthorizedKeys(data); err != nil {
+		t.Fatalf("Failed to write authorized keys: %v", err)
+	}
+
+	path := filepath.Join(server.Home, ".config", "ssh", "keys")
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Expected the authorized keys to be written: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected mode 0600, got %o", info.Mode().Perm())
+	}
+}
@@ -0,0 +1,167 @@
+package secrets
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Names of the policy rules reported in a PolicyError
+const (
+	RuleForbidEmpty = "forbid_empty"
+	RuleMinLength   = "min_length"
+	RuleMinEntropy  = "min_entropy"
+	RuleForbidReuse = "forbid_reuse"
+)
+
+// Policy describes the passphrases that are acceptable for a key
+type Policy struct {
+	// MinLength is the minimum number of characters
+	MinLength int
+	// MinEntropy is the minimum estimated entropy in bits
+	MinEntropy float64
+	// ForbidEmpty rejects empty passphrases, which leave keys unencrypted
+	ForbidEmpty bool
+	// ForbidReuse rejects the passphrase the key had before
+	ForbidReuse bool
+}
+
+// PolicyError reports the policy rule a passphrase breaks
+type PolicyError struct {
+	Rule   string
+	Reason string
+}
+
+// Error returns the broken rule and why the passphrase breaks it
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("passphrase violates %s: %s", e.Rule, e.Reason)
+}
+
+// Check returns a *PolicyError if passphrase breaks the policy.
+// previousHash is the hash of the key's previous passphrase (see HashPassphrase), if known.
+func (p Policy) Check(passphrase, previousHash string) error {
+	if p.ForbidEmpty && passphrase == "" {
+		return &PolicyError{Rule: RuleForbidEmpty, Reason: "keys must be encrypted"}
+	}
+
+	if length := len([]rune(passphrase)); length < p.MinLength {
+		return &PolicyError{
+			Rule:   RuleMinLength,
+			Reason: fmt.Sprintf("%d characters, at least %d required", length, p.MinLength),
+		}
+	}
+
+	if entropy := EstimateEntropy(passphrase); entropy < p.MinEntropy {
+		return &PolicyError{
+			Rule:   RuleMinEntropy,
+			Reason: fmt.Sprintf("estimated %.0f bits of entropy, at least %.0f required", entropy, p.MinEntropy),
+		}
+	}
+
+	if p.ForbidReuse && previousHash != "" {
+		matches, err := MatchesHash(passphrase, previousHash)
+		if err != nil {
+			return err
+		}
+		if matches {
+			return &PolicyError{Rule: RuleForbidReuse, Reason: "same as the previous passphrase"}
+		}
+	}
+
+	return nil
+}
+
+// EstimateEntropy estimates the entropy of a passphrase in bits from its length
+// and the character classes it uses
+func EstimateEntropy(passphrase string) float64 {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range passphrase {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < unicode.MaxASCII && unicode.IsPrint(r):
+			symbol = true
+		default:
+			other = true
+		}
+	}
+
+	pool := 0
+	for _, class := range []struct {
+		used bool
+		size int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if class.used {
+			pool += class.size
+		}
+	}
+	if pool == 0 {
+		return 0
+	}
+
+	return float64(len([]rune(passphrase))) * math.Log2(float64(pool))
+}
+
+// Parameters of the argon2id hashes of previous passphrases
+const (
+	hashTime    = 1
+	hashMemory  = 64 * 1024
+	hashThreads = 4
+	hashKeyLen  = 32
+	hashSaltLen = 16
+)
+
+// HashPassphrase returns a salted argon2id hash of passphrase in the
+// $argon2id$v=19$m=<memory>,t=<time>,p=<threads>$<salt>$<hash> format
+func HashPassphrase(passphrase string) (string, error) {
+	salt := make([]byte, hashSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	hash := argon2.IDKey([]byte(passphrase), salt, hashTime, hashMemory, hashThreads, hashKeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, hashMemory, hashTime, hashThreads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(hash)), nil
+}
+
+// MatchesHash reports whether passphrase matches a hash produced by HashPassphrase
+func MatchesHash(passphrase, encoded string) (bool, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return false, errors.New("invalid passphrase hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, fmt.Errorf("unsupported passphrase hash version %q", parts[2])
+	}
+
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false, fmt.Errorf("invalid passphrase hash parameters: %w", err)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, fmt.Errorf("invalid passphrase hash salt: %w", err)
+	}
+	want, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, fmt.Errorf("invalid passphrase hash: %w", err)
+	}
+
+	got := argon2.IDKey([]byte(passphrase), salt, time, memory, threads, uint32(len(want)))
+	return subtle.ConstantTimeCompare(got, want) == 1, nil
+}
@@ -0,0 +1,99 @@
+package secrets
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// TestPolicy_Check tests that every rule reports the passphrases breaking it
+func TestPolicy_Check(t *testing.T) {
+	previous, err := HashPassphrase("correct horse battery staple")
+	if err != nil {
+		t.Fatalf("Failed to hash passphrase: %v", err)
+	}
+
+	policy := Policy{MinLength: 12, MinEntropy: 60, ForbidEmpty: true, ForbidReuse: true}
+
+	tests := []struct {
+		name       string
+		passphrase string
+		wantRule   string
+	}{
+		{"Empty", "", RuleForbidEmpty},
+		{"TooShort", "Sh0rt!", RuleMinLength},
+		{"LowEntropy", "aaaaaaaaaaaa", RuleMinEntropy},
+		{"Reused", "correct horse battery staple", RuleForbidReuse},
+		{"Valid", "new horse battery staple", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Check(tt.passphrase, previous)
+			if tt.wantRule == "" {
+				if err != nil {
+					t.Errorf("Expected passphrase to be accepted, got %v", err)
+				}
+				return
+			}
+
+			var policyErr *PolicyError
+			if !errors.As(err, &policyErr) {
+				t.Fatalf("Expected a policy error, got %v", err)
+			}
+			if policyErr.Rule != tt.wantRule {
+				t.Errorf("Expected rule %s to fail, got %s", tt.wantRule, policyErr.Rule)
+			}
+			if !strings.Contains(err.Error(), tt.wantRule) {
+				t.Errorf("Expected error to name the rule, got %q", err.Error())
+			}
+		})
+	}
+
+	// An empty policy accepts anything
+	if err := (Policy{}).Check("", previous); err != nil {
+		t.Errorf("Expected empty policy to accept an empty passphrase, got %v", err)
+	}
+}
+
+// TestHashPassphrase tests that hashes are salted and verifiable
+func TestHashPassphrase(t *testing.T) {
+	first, err := HashPassphrase("secret")
+	if err != nil {
+		t.Fatalf("Failed to hash passphrase: %v", err)
+	}
+	second, err := HashPassphrase("secret")
+	if err != nil {
+		t.Fatalf("Failed to hash passphrase: %v", err)
+	}
+
+	if first == second {
+		t.Error("Expected hashes of the same passphrase to use different salts")
+	}
+	if strings.Contains(first, "secret") {
+		t.Error("Expected hash not to contain the passphrase")
+	}
+
+	if ok, err := MatchesHash("secret", first); err != nil || !ok {
+		t.Errorf("Expected passphrase to match its hash, got %v, %v", ok, err)
+	}
+	if ok, err := MatchesHash("other", first); err != nil || ok {
+		t.Errorf("Expected different passphrase not to match, got %v, %v", ok, err)
+	}
+	if _, err := MatchesHash("secret", "not-a-hash"); err == nil {
+		t.Error("Expected error for an invalid hash, got nil")
+	}
+}
+
+// TestEstimateEntropy tests that larger character sets and longer passphrases score higher
+func TestEstimateEntropy(t *testing.T) {
+	if got := EstimateEntropy(""); got != 0 {
+		t.Errorf("Expected no entropy for an empty passphrase, got %f", got)
+	}
+	if EstimateEntropy("abcdefgh") >= EstimateEntropy("abcDEF12") {
+		t.Error("Expected mixed character classes to increase the estimate")
+	}
+	if EstimateEntropy("abcdefgh") >= EstimateEntropy("abcdefghijkl") {
+		t.Error("Expected longer passphrases to increase the estimate")
+	}
+}
@@ -0,0 +1,57 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// CommandSink stores secrets by piping them to a shell command, e.g. "pass insert -m -f {name}".
+// The secret is written to the command's stdin; {name} is replaced by the shell-quoted
+// secret name, which is also available as $PORTUNUS_SECRET_NAME.
+type CommandSink struct {
+	Command string
+	// LookupCommand prints a stored secret, e.g. "pass show {name}", so it can be read back
+	LookupCommand string
+	// Prefix is prepended to every secret name, e.g. "ssh/"
+	Prefix string
+}
+
+// Store runs the command with the secret on stdin and returns "command:<name>"
+func (s *CommandSink) Store(ctx context.Context, name, secret string) (string, error) {
+	name = s.Prefix + name
+	command := strings.ReplaceAll(s.Command, "{name}", shellQuote(name))
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Env = append(os.Environ(), "PORTUNUS_SECRET_NAME="+name)
+	cmd.Stdin = strings.NewReader(secret + "\n")
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("secret command %q failed: %w, output: %s", command, err, strings.TrimSpace(stderr.String()))
+	}
+
+	return "command:" + name, nil
+}
+
+// Lookup reads back the secret referenced by ref, as returned by Store, from the first
+// line of the output of LookupCommand
+func (s *CommandSink) Lookup(ctx context.Context, ref string) (string, error) {
+	name, ok := strings.CutPrefix(ref, "command:")
+	if !ok {
+		return "", fmt.Errorf("%q is not a command secret reference", ref)
+	}
+	if s.LookupCommand == "" {
+		return "", errors.New("no lookup command configured")
+	}
+	return runCommand(ctx, strings.ReplaceAll(s.LookupCommand, "{name}", shellQuote(name)))
+}
+
+// shellQuote quotes s for use as a single POSIX shell word
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
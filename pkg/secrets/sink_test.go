@@ -0,0 +1,69 @@
+package secrets
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/de-lachende-cavalier/portunus/pkg/testutil"
+)
+
+// TestCommandSink_Store tests piping secrets to an external command
+func TestCommandSink_Store(t *testing.T) {
+	dir := testutil.TempDir(t)
+
+	sink := &CommandSink{
+		Command: "mkdir -p " + dir + "/ssh && cat > " + dir + "/{name}",
+		Prefix:  "ssh/",
+	}
+
+	ref, err := sink.Store(context.Background(), "id_work", "secret")
+	if err != nil {
+		t.Fatalf("Failed to store secret: %v", err)
+	}
+	if ref != "command:ssh/id_work" {
+		t.Errorf("Expected reference command:ssh/id_work, got %q", ref)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "ssh", "id_work"))
+	if err != nil {
+		t.Fatalf("Failed to read stored secret: %v", err)
+	}
+	if string(data) != "secret\n" {
+		t.Errorf("Expected stored secret %q, got %q", "secret\n", data)
+	}
+
+	// Names are quoted so they cannot inject shell commands
+	if _, err := sink.Store(context.Background(), "x'; touch "+dir+"/pwned; '", "secret"); err == nil {
+		t.Error("Expected error storing under a missing directory, got nil")
+	}
+	testutil.AssertFileNotExists(t, filepath.Join(dir, "pwned"))
+
+	failing := &CommandSink{Command: "exit 1"}
+	if _, err := failing.Store(context.Background(), "id_work", "secret"); err == nil {
+		t.Error("Expected error from failing command, got nil")
+	}
+}
+
+// TestCommandSink_Lookup tests reading secrets back through the lookup command
+func TestCommandSink_Lookup(t *testing.T) {
+	dir := testutil.TempDir(t)
+	testutil.CreateTestFile(t, dir, "id_work", "secret\n")
+
+	sink := &CommandSink{LookupCommand: "cat " + dir + "/{name}"}
+	secret, err := sink.Lookup(context.Background(), "command:id_work")
+	if err != nil {
+		t.Fatalf("Failed to look up secret: %v", err)
+	}
+	if secret != "secret" {
+		t.Errorf("Expected secret %q, got %q", "secret", secret)
+	}
+
+	if _, err := sink.Lookup(context.Background(), "vault:secret/id_work"); err == nil {
+		t.Error("Expected error for a reference of another sink, got nil")
+	}
+	if _, err := (&CommandSink{}).Lookup(context.Background(), "command:id_work"); err == nil {
+		t.Error("Expected error without a lookup command, got nil")
+	}
+}
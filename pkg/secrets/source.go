@@ -0,0 +1,114 @@
+// Package secrets reads and stores key passphrases in external secret managers
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Source describes where a passphrase is read from.
+// Exactly one of its fields must be set.
+type Source struct {
+	// Env is the name of an environment variable holding the passphrase
+	Env string
+	// File is the path of a file holding the passphrase
+	File string
+	// Command is a shell command printing the passphrase, e.g. "pass show ssh/work"
+	Command string
+}
+
+// Validate checks that exactly one location is set
+func (s Source) Validate() error {
+	set := 0
+	for _, field := range []string{s.Env, s.File, s.Command} {
+		if field != "" {
+			set++
+		}
+	}
+
+	switch set {
+	case 0:
+		return errors.New("passphrase source is empty")
+	case 1:
+		return nil
+	default:
+		return errors.New("passphrase source must set only one of env, file or command")
+	}
+}
+
+// String describes the source without revealing the passphrase
+func (s Source) String() string {
+	switch {
+	case s.Env != "":
+		return "env:" + s.Env
+	case s.File != "":
+		return "file:" + s.File
+	case s.Command != "":
+		return "command:" + s.Command
+	default:
+		return "none"
+	}
+}
+
+// Resolve reads the passphrase from the source.
+// Only the first line of a file or of the command's output is used.
+func (s Source) Resolve(ctx context.Context) (string, error) {
+	if err := s.Validate(); err != nil {
+		return "", err
+	}
+
+	switch {
+	case s.Env != "":
+		value, ok := os.LookupEnv(s.Env)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", s.Env)
+		}
+		return value, nil
+	case s.File != "":
+		return readFile(s.File)
+	default:
+		return runCommand(ctx, s.Command)
+	}
+}
+
+// readFile reads a passphrase from a file only its owner can access
+func readFile(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to stat passphrase file: %w", err)
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		return "", fmt.Errorf("passphrase file %s is accessible by others (mode %o)", path, info.Mode().Perm())
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase file: %w", err)
+	}
+	return firstLine(data), nil
+}
+
+// runCommand runs a shell command and returns the first line of its output
+func runCommand(ctx context.Context, command string) (string, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("passphrase command %q failed: %w, output: %s", command, err, strings.TrimSpace(stderr.String()))
+	}
+
+	return firstLine(stdout.Bytes()), nil
+}
+
+// firstLine returns the first line of data without its line ending
+func firstLine(data []byte) string {
+	line, _, _ := strings.Cut(string(data), "\n")
+	return strings.TrimSuffix(line, "\r")
+}
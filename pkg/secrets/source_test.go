@@ -0,0 +1,61 @@
+package secrets
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/de-lachende-cavalier/portunus/pkg/testutil"
+)
+
+// TestSource_Resolve tests reading passphrases from every kind of source
+func TestSource_Resolve(t *testing.T) {
+	dir := testutil.TempDir(t)
+
+	secretFile := filepath.Join(dir, "secret")
+	if err := os.WriteFile(secretFile, []byte("from-file\nsecond line\n"), 0600); err != nil {
+		t.Fatalf("Failed to write secret file: %v", err)
+	}
+	openFile := filepath.Join(dir, "open")
+	if err := os.WriteFile(openFile, []byte("from-file\n"), 0644); err != nil {
+		t.Fatalf("Failed to write secret file: %v", err)
+	}
+
+	t.Setenv("PORTUNUS_TEST_PASSPHRASE", "from-env")
+
+	tests := []struct {
+		name    string
+		source  Source
+		want    string
+		wantErr bool
+	}{
+		{name: "Env", source: Source{Env: "PORTUNUS_TEST_PASSPHRASE"}, want: "from-env"},
+		{name: "EnvUnset", source: Source{Env: "PORTUNUS_TEST_UNSET"}, wantErr: true},
+		{name: "File", source: Source{File: secretFile}, want: "from-file"},
+		{name: "FileReadableByOthers", source: Source{File: openFile}, wantErr: true},
+		{name: "FileMissing", source: Source{File: filepath.Join(dir, "missing")}, wantErr: true},
+		{name: "Command", source: Source{Command: "printf 'from-command\\r\\nignored\\n'"}, want: "from-command"},
+		{name: "CommandFails", source: Source{Command: "exit 1"}, wantErr: true},
+		{name: "Empty", source: Source{}, wantErr: true},
+		{name: "Ambiguous", source: Source{Env: "PORTUNUS_TEST_PASSPHRASE", File: secretFile}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.source.Resolve(context.Background())
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected error, got passphrase %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to resolve passphrase: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected passphrase %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
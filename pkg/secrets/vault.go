@@ -0,0 +1,191 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Defaults of a VaultSink
+const (
+	DefaultVaultMount = "secret"
+	DefaultVaultField = "passphrase"
+)
+
+// VaultSink stores secrets in a key/value secrets engine compatible with Vault's KV v2 API
+type VaultSink struct {
+	// Address is the base URL of the server, e.g. https://vault.example.com:8200
+	Address string
+	// Token authenticates the requests
+	Token string
+	// Mount is the path the KV v2 engine is mounted at (default "secret")
+	Mount string
+	// Prefix is prepended to every secret name, e.g. "ssh/"
+	Prefix string
+	// Field is the key the secret is stored under (default "passphrase")
+	Field string
+	// Client sends the requests (default a client with a 30 second timeout)
+	Client *http.Client
+}
+
+// vaultWriteResponse is the part of a KV v2 write response we use
+type vaultWriteResponse struct {
+	Data struct {
+		Version int `json:"version"`
+	} `json:"data"`
+}
+
+// vaultReadResponse is the part of a KV v2 read response we use
+type vaultReadResponse struct {
+	Data struct {
+		Data map[string]string `json:"data"`
+	} `json:"data"`
+}
+
+// Store writes the secret as a new version and returns "vault:<mount>/<name>?version=<n>"
+func (s *VaultSink) Store(ctx context.Context, name, secret string) (string, error) {
+	if s.Address == "" {
+		return "", errors.New("vault address is not set")
+	}
+	if s.Token == "" {
+		return "", errors.New("vault token is not set")
+	}
+
+	mount := strings.Trim(s.Mount, "/")
+	if mount == "" {
+		mount = DefaultVaultMount
+	}
+	field := s.Field
+	if field == "" {
+		field = DefaultVaultField
+	}
+	name = strings.Trim(s.Prefix+name, "/")
+
+	body, err := json.Marshal(map[string]any{"data": map[string]string{field: secret}})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode secret: %w", err)
+	}
+
+	endpoint, err := url.JoinPath(s.Address, "v1", mount, "data", name)
+	if err != nil {
+		return "", fmt.Errorf("invalid vault address %q: %w", s.Address, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to create vault request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", s.Token)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := s.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to write secret %s to vault: %w", name, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", fmt.Errorf("failed to read vault response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return "", fmt.Errorf("failed to write secret %s to vault: %s: %s", name, resp.Status, strings.TrimSpace(string(data)))
+	}
+
+	var written vaultWriteResponse
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &written); err != nil {
+			return "", fmt.Errorf("failed to decode vault response: %w", err)
+		}
+	}
+
+	ref := fmt.Sprintf("vault:%s/%s", mount, name)
+	if written.Data.Version > 0 {
+		ref += fmt.Sprintf("?version=%d", written.Data.Version)
+	}
+	return ref, nil
+}
+
+// Lookup reads the version of the secret referenced by ref, as returned by Store
+func (s *VaultSink) Lookup(ctx context.Context, ref string) (string, error) {
+	if s.Address == "" {
+		return "", errors.New("vault address is not set")
+	}
+	if s.Token == "" {
+		return "", errors.New("vault token is not set")
+	}
+
+	path, ok := strings.CutPrefix(ref, "vault:")
+	if !ok {
+		return "", fmt.Errorf("%q is not a vault secret reference", ref)
+	}
+	path, version, _ := strings.Cut(path, "?version=")
+
+	mount := strings.Trim(s.Mount, "/")
+	if mount == "" {
+		mount = DefaultVaultMount
+	}
+	field := s.Field
+	if field == "" {
+		field = DefaultVaultField
+	}
+	name, ok := strings.CutPrefix(path, mount+"/")
+	if !ok {
+		return "", fmt.Errorf("secret %s is not in the %s mount", path, mount)
+	}
+
+	endpoint, err := url.JoinPath(s.Address, "v1", mount, "data", name)
+	if err != nil {
+		return "", fmt.Errorf("invalid vault address %q: %w", s.Address, err)
+	}
+	if version != "" {
+		endpoint += "?version=" + url.QueryEscape(version)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create vault request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", s.Token)
+
+	client := s.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret %s from vault: %w", name, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", fmt.Errorf("failed to read vault response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to read secret %s from vault: %s: %s", name, resp.Status, strings.TrimSpace(string(data)))
+	}
+
+	var read vaultReadResponse
+	if err := json.Unmarshal(data, &read); err != nil {
+		return "", fmt.Errorf("failed to decode vault response: %w", err)
+	}
+	secret, ok := read.Data.Data[field]
+	if !ok {
+		return "", fmt.Errorf("secret %s has no %s field", name, field)
+	}
+	return secret, nil
+}
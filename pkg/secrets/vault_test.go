@@ -0,0 +1,110 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestVaultSink_Store tests writing secrets through the KV v2 API
+func TestVaultSink_Store(t *testing.T) {
+	stored := make(map[string]map[string]string)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "s.token" {
+			http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, `{"errors":["unsupported method"]}`, http.StatusMethodNotAllowed)
+			return
+		}
+
+		var body struct {
+			Data map[string]string `json:"data"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, `{"errors":["invalid body"]}`, http.StatusBadRequest)
+			return
+		}
+		stored[r.URL.Path] = body.Data
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data":{"created_time":"2024-01-01T00:00:00Z","version":3}}`))
+	}))
+	defer server.Close()
+
+	sink := &VaultSink{
+		Address: server.URL,
+		Token:   "s.token",
+		Mount:   "kv",
+		Prefix:  "ssh/",
+	}
+
+	ref, err := sink.Store(context.Background(), "id_work", "secret")
+	if err != nil {
+		t.Fatalf("Failed to store secret: %v", err)
+	}
+	if ref != "vault:kv/ssh/id_work?version=3" {
+		t.Errorf("Expected reference vault:kv/ssh/id_work?version=3, got %q", ref)
+	}
+
+	data, ok := stored["/v1/kv/data/ssh/id_work"]
+	if !ok {
+		t.Fatalf("Expected secret to be written to /v1/kv/data/ssh/id_work, got %v", stored)
+	}
+	if data[DefaultVaultField] != "secret" {
+		t.Errorf("Expected field %s to hold the secret, got %v", DefaultVaultField, data)
+	}
+
+	sink.Token = "wrong"
+	if _, err := sink.Store(context.Background(), "id_work", "secret"); err == nil {
+		t.Error("Expected error with an invalid token, got nil")
+	}
+
+	sink.Token = ""
+	if _, err := sink.Store(context.Background(), "id_work", "secret"); err == nil {
+		t.Error("Expected error without a token, got nil")
+	}
+}
+
+// TestVaultSink_Lookup tests reading back the version of a secret a reference points to
+func TestVaultSink_Lookup(t *testing.T) {
+	versions := map[string]string{"2": "old", "3": "current"}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "s.token" {
+			http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+			return
+		}
+		secret, ok := versions[r.URL.Query().Get("version")]
+		if r.Method != http.MethodGet || r.URL.Path != "/v1/kv/data/ssh/id_work" || !ok {
+			http.Error(w, `{"errors":[]}`, http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"data": map[string]any{"data": map[string]string{DefaultVaultField: secret}},
+		})
+	}))
+	defer server.Close()
+
+	sink := &VaultSink{Address: server.URL, Token: "s.token", Mount: "kv"}
+
+	secret, err := sink.Lookup(context.Background(), "vault:kv/ssh/id_work?version=2")
+	if err != nil {
+		t.Fatalf("Failed to look up secret: %v", err)
+	}
+	if secret != "old" {
+		t.Errorf("Expected version 2 of the secret, got %q", secret)
+	}
+
+	for _, ref := range []string{"vault:kv/ssh/id_work?version=9", "vault:other/ssh/id_work", "command:ssh/id_work"} {
+		if _, err := sink.Lookup(context.Background(), ref); err == nil {
+			t.Errorf("Expected error looking up %s, got nil", ref)
+		}
+	}
+}
@@ -0,0 +1,474 @@
+// Package sshconfig reads and edits the key references of OpenSSH client configuration files
+package sshconfig
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// maxIncludeDepth bounds nested Include directives, like ssh does
+const maxIncludeDepth = 16
+
+// DefaultPath returns the path of the user's SSH client configuration
+func DefaultPath() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(".ssh", "config")
+	}
+	return filepath.Join(homeDir, ".ssh", "config")
+}
+
+// File is a configuration file, kept line by line so it can be rewritten as it was
+type File struct {
+	Path    string
+	lines   []string
+	mode    os.FileMode
+	changed bool
+}
+
+// Directive is an IdentityFile or CertificateFile line of a configuration file
+type Directive struct {
+	File *File
+	// Line is the 1-based line number in the file
+	Line    int
+	Keyword string
+	// Value is the path as written in the file, unquoted
+	Value string
+	// Path is Value with its tokens expanded, empty when it cannot be resolved
+	Path string
+	// Err tells why Value cannot be resolved, e.g. it depends on the host being connected to
+	Err error
+	// Block is the Host or Match line the directive applies to, empty outside any block
+	Block string
+
+	scope *scope
+	// argStart and argEnd locate the argument, quotes included, in the line
+	argStart, argEnd int
+}
+
+// scope is a Host or Match block, or the lines outside any block
+type scope struct {
+	line      string
+	patterns  []string
+	hostNames []string
+}
+
+// Usage describes a Host or Match block using a key
+type Usage struct {
+	// Block is the Host or Match line, empty outside any block
+	Block string
+	// Patterns are the host patterns of a Host block, nil for Match blocks and outside any block
+	Patterns []string
+	// HostNames are the real host names the block sets with HostName
+	HostNames []string
+}
+
+// String describes the hosts of the block, e.g. "bastion (bastion.corp.example)"
+func (u Usage) String() string {
+	var hosts string
+	switch {
+	case u.Block == "":
+		hosts = "all hosts"
+	case u.Patterns == nil:
+		hosts = u.Block
+	default:
+		hosts = strings.Join(u.Patterns, " ")
+	}
+	if len(u.HostNames) > 0 {
+		hosts += " (" + strings.Join(u.HostNames, ", ") + ")"
+	}
+	return hosts
+}
+
+// Config is an SSH client configuration with the files it includes
+type Config struct {
+	Files      []*File
+	Directives []*Directive
+	// Unresolved are the IdentityFile, CertificateFile and Include lines whose paths
+	// ssh only resolves when connecting; they may refer to any key
+	Unresolved []*Directive
+	home       string
+	user       string
+}
+
+// Load reads the configuration at path and the files it includes.
+// A missing configuration is empty.
+func Load(path string) (*Config, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get home directory: %w", err)
+	}
+
+	c := &Config{home: home}
+	if current, err := user.Current(); err == nil {
+		c.user = current.Username
+	}
+	if err := c.load(path, &scope{}, 0); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// load reads a configuration file whose lines apply to block until a Host or Match line
+func (c *Config) load(path string, block *scope, depth int) error {
+	if depth > maxIncludeDepth {
+		return fmt.Errorf("too many nested includes in %s", path)
+	}
+
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read SSH config: %w", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read SSH config: %w", err)
+	}
+
+	f := &File{Path: path, lines: strings.SplitAfter(string(data), "\n"), mode: info.Mode().Perm()}
+	c.Files = append(c.Files, f)
+
+	for i, line := range f.lines {
+		keyword, args, argStart := splitLine(line)
+		switch strings.ToLower(keyword) {
+		case "host":
+			block = &scope{line: strings.TrimSpace(keyword + " " + strings.Join(args, " ")), patterns: args}
+		case "match":
+			block = &scope{line: strings.TrimSpace(keyword + " " + strings.Join(args, " "))}
+		case "hostname":
+			if len(args) > 0 && !slices.Contains(block.hostNames, args[0]) {
+				block.hostNames = append(block.hostNames, args[0])
+			}
+		case "include":
+			for _, pattern := range args {
+				if err := c.include(pattern, block, depth); err != nil {
+					var unresolved *unresolvedError
+					if !errors.As(err, &unresolved) {
+						return err
+					}
+					c.Unresolved = append(c.Unresolved, &Directive{
+						File: f, Line: i + 1, Keyword: keyword, Value: pattern, Err: unresolved.err, Block: block.line, scope: block,
+					})
+				}
+			}
+		case "identityfile", "certificatefile":
+			if len(args) == 0 {
+				continue
+			}
+			d := &Directive{
+				File:     f,
+				Line:     i + 1,
+				Keyword:  keyword,
+				Value:    args[0],
+				Block:    block.line,
+				scope:    block,
+				argStart: argStart,
+				argEnd:   argEnd(line, argStart),
+			}
+			d.Path, d.Err = c.expand(d.Value)
+			c.Directives = append(c.Directives, d)
+			if d.Err != nil {
+				c.Unresolved = append(c.Unresolved, d)
+			}
+		}
+	}
+	return nil
+}
+
+// include reads the files matching an Include pattern, relative to ~/.ssh unless absolute
+func (c *Config) include(pattern string, block *scope, depth int) error {
+	pattern, err := c.expandTokens(pattern)
+	if err != nil {
+		return &unresolvedError{err}
+	}
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(c.home, ".ssh", pattern)
+	}
+
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid Include pattern %q: %w", pattern, err)
+	}
+	for _, match := range matches {
+		if err := c.load(match, block, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// References returns the directives referring to the key at keyPath, its public key or its certificate
+func (c *Config) References(keyPath string) []*Directive {
+	var refs []*Directive
+	for _, d := range c.Directives {
+		if _, ok := keySuffix(d.Path, keyPath); ok {
+			refs = append(refs, d)
+		}
+	}
+	return refs
+}
+
+// Usage returns the blocks whose directives refer to the key at keyPath, in the order of the configuration
+func (c *Config) Usage(keyPath string) []Usage {
+	var usage []Usage
+	seen := make(map[*scope]bool)
+	for _, d := range c.References(keyPath) {
+		if seen[d.scope] {
+			continue
+		}
+		seen[d.scope] = true
+		usage = append(usage, Usage{Block: d.scope.line, Patterns: d.scope.patterns, HostNames: d.scope.hostNames})
+	}
+	return usage
+}
+
+// Rewrite points the directives referring to the key at oldPath to newPath, keeping the
+// formatting of their lines, and returns them. Changes are written by Save.
+func (c *Config) Rewrite(oldPath, newPath string) []*Directive {
+	var rewritten []*Directive
+	for _, d := range c.Directives {
+		suffix, ok := keySuffix(d.Path, oldPath)
+		if !ok {
+			continue
+		}
+
+		value := c.contract(newPath+suffix, d.Value)
+		arg := value
+		if strings.ContainsAny(value, " \t") || strings.HasPrefix(d.File.lines[d.Line-1][d.argStart:], `"`) {
+			arg = `"` + value + `"`
+		}
+
+		line := d.File.lines[d.Line-1]
+		d.File.lines[d.Line-1] = line[:d.argStart] + arg + line[d.argEnd:]
+		d.File.changed = true
+		d.argEnd = d.argStart + len(arg)
+		d.Value = value
+		d.Path = filepath.Clean(newPath + suffix)
+		rewritten = append(rewritten, d)
+	}
+	return rewritten
+}
+
+// Save writes the files changed by Rewrite, keeping their permissions
+func (c *Config) Save() error {
+	for _, f := range c.Files {
+		if !f.changed {
+			continue
+		}
+		if err := f.save(); err != nil {
+			return err
+		}
+		f.changed = false
+	}
+	return nil
+}
+
+// save atomically replaces the file. A symlinked file, as dotfile managers set up,
+// stays a symlink: the file it points to is replaced instead.
+func (f *File) save() error {
+	target, err := filepath.EvalSymlinks(f.Path)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", f.Path, err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".portunus-ssh-config-*")
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", f.Path, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.WriteString(strings.Join(f.lines, ""))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", f.Path, err)
+	}
+	if err := os.Chmod(tmp.Name(), f.mode); err != nil {
+		return fmt.Errorf("failed to write %s: %w", f.Path, err)
+	}
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return fmt.Errorf("failed to write %s: %w", f.Path, err)
+	}
+	return nil
+}
+
+// String returns where the directive is, as file:line
+func (d *Directive) String() string {
+	return fmt.Sprintf("%s:%d", d.File.Path, d.Line)
+}
+
+// unresolvedError marks paths that cannot be resolved without connecting
+type unresolvedError struct {
+	err error
+}
+
+func (e *unresolvedError) Error() string {
+	return e.err.Error()
+}
+
+// expand resolves the path of an IdentityFile or CertificateFile line like ssh does.
+// ssh reads relative paths from the directory it runs in, so they cannot be resolved.
+func (c *Config) expand(value string) (string, error) {
+	path, err := c.expandTokens(value)
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(path) {
+		return "", errors.New("relative paths depend on the directory ssh runs in")
+	}
+	return filepath.Clean(path), nil
+}
+
+// expandTokens resolves a leading ~ or ~user, ${VAR} environment variables and the %d (home
+// directory), %u (user name), %i (user id) and %% tokens. The other tokens depend on the
+// host being connected to.
+func (c *Config) expandTokens(value string) (string, error) {
+	if rest, ok := strings.CutPrefix(value, "~"); ok {
+		name, rest, _ := strings.Cut(rest, "/")
+		home := c.home
+		if name != "" {
+			u, err := user.Lookup(name)
+			if err != nil {
+				return "", fmt.Errorf("unknown user %s", name)
+			}
+			home = u.HomeDir
+		}
+		value = filepath.Join(home, rest)
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		switch {
+		case value[i] == '%':
+			if i+1 == len(value) {
+				return "", errors.New("incomplete % token")
+			}
+			i++
+			switch value[i] {
+			case '%':
+				b.WriteByte('%')
+			case 'd':
+				b.WriteString(c.home)
+			case 'u':
+				if c.user == "" {
+					return "", errors.New("unknown user name for %u")
+				}
+				b.WriteString(c.user)
+			case 'i':
+				b.WriteString(strconv.Itoa(os.Getuid()))
+			default:
+				return "", fmt.Errorf("%%%c depends on the connection", value[i])
+			}
+		case strings.HasPrefix(value[i:], "${"):
+			end := strings.IndexByte(value[i:], '}')
+			if end < 0 {
+				return "", errors.New("unterminated ${ environment variable")
+			}
+			name := value[i+2 : i+end]
+			env, ok := os.LookupEnv(name)
+			if !ok {
+				return "", fmt.Errorf("environment variable %s is not set", name)
+			}
+			b.WriteString(env)
+			i += end
+		default:
+			b.WriteByte(value[i])
+		}
+	}
+	return b.String(), nil
+}
+
+// contract writes path relative to the directory the previous value starts with, such as
+// ~, ~user, %d or ${HOME}, so that rewritten lines keep their form
+func (c *Config) contract(path, previous string) string {
+	head, _, found := strings.Cut(previous, "/")
+	if !found || head == "" {
+		return path
+	}
+	dir, err := c.expandTokens(head)
+	if err != nil || !filepath.IsAbs(dir) {
+		return path
+	}
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+		return path
+	}
+	return head + "/" + filepath.ToSlash(rel)
+}
+
+// keySuffix reports whether path is the key at keyPath or one of its companion files,
+// and returns the suffix of that file
+func keySuffix(path, keyPath string) (string, bool) {
+	if path == "" {
+		return "", false
+	}
+	for _, suffix := range []string{"", ".pub", "-cert.pub"} {
+		if path == filepath.Clean(keyPath)+suffix {
+			return suffix, true
+		}
+	}
+	return "", false
+}
+
+// splitLine returns the keyword and arguments of a configuration line, and where its arguments start.
+// Keywords are separated from their arguments by blanks and an optional "=".
+func splitLine(line string) (string, []string, int) {
+	body := strings.TrimRight(line, "\r\n")
+	i := skipBlanks(body, 0)
+	if i == len(body) || body[i] == '#' {
+		return "", nil, 0
+	}
+
+	start := i
+	for i < len(body) && body[i] != ' ' && body[i] != '\t' && body[i] != '=' {
+		i++
+	}
+	keyword := body[start:i]
+
+	i = skipBlanks(body, i)
+	if i < len(body) && body[i] == '=' {
+		i = skipBlanks(body, i+1)
+	}
+	argStart := i
+
+	var args []string
+	for i < len(body) {
+		end := argEnd(body, i)
+		args = append(args, strings.Trim(body[i:end], `"`))
+		i = skipBlanks(body, end)
+	}
+	return keyword, args, argStart
+}
+
+// argEnd returns the end of the argument starting at start, which may be double quoted
+func argEnd(line string, start int) int {
+	line = strings.TrimRight(line, "\r\n")
+	if start < len(line) && line[start] == '"' {
+		if end := strings.IndexByte(line[start+1:], '"'); end >= 0 {
+			return start + end + 2
+		}
+		return len(line)
+	}
+	end := start
+	for end < len(line) && line[end] != ' ' && line[end] != '\t' {
+		end++
+	}
+	return end
+}
+
+// skipBlanks returns the index of the first non-blank character of s from i
+func skipBlanks(s string, i int) int {
+	for i < len(s) && (s[i] == ' ' || s[i] == '\t') {
+		i++
+	}
+	return i
+}
@@ -0,0 +1,319 @@
+package sshconfig
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/de-lachende-cavalier/portunus/pkg/testutil"
+)
+
+// setupTestHome creates a home directory with an SSH client configuration and an included file
+func setupTestHome(t *testing.T) string {
+	t.Helper()
+	home := testutil.TempDir(t)
+	t.Setenv("HOME", home)
+
+	if err := os.MkdirAll(filepath.Join(home, ".ssh", "config.d"), 0700); err != nil {
+		t.Fatalf("Failed to create SSH dir: %v", err)
+	}
+
+	config := `# Personal hosts
+Host github.com
+    IdentityFile ~/.ssh/id_work
+	CertificateFile  "~/.ssh/id_work-cert.pub"
+
+Host *.corp  bastion
+  Include config.d/*.conf
+  User alice
+
+Host *
+    IdentityFile=%d/.ssh/id_default
+    IdentityFile ` + filepath.Join(home, ".ssh", "id_work") + `
+`
+	included := "# Work\r\nIdentityFile ~/.ssh/id_work.pub\r\nMatch host db\r\n  identityfile \"~/.ssh/id_work\" # trailing\r\n"
+
+	if err := os.WriteFile(filepath.Join(home, ".ssh", "config"), []byte(config), 0600); err != nil {
+		t.Fatalf("Failed to write SSH config: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(home, ".ssh", "config.d", "work.conf"), []byte(included), 0644); err != nil {
+		t.Fatalf("Failed to write SSH config: %v", err)
+	}
+	return home
+}
+
+// TestConfig_References tests finding the Host blocks using a key, through includes
+func TestConfig_References(t *testing.T) {
+	home := setupTestHome(t)
+
+	c, err := Load(DefaultPath())
+	if err != nil {
+		t.Fatalf("Failed to load SSH config: %v", err)
+	}
+	if len(c.Files) != 2 {
+		t.Fatalf("Expected the config and its include, got %d files", len(c.Files))
+	}
+
+	refs := c.References(filepath.Join(home, ".ssh", "id_work"))
+	want := []struct {
+		file    string
+		line    int
+		keyword string
+		block   string
+	}{
+		{"config", 3, "IdentityFile", "Host github.com"},
+		{"config", 4, "CertificateFile", "Host github.com"},
+		{"work.conf", 2, "IdentityFile", "Host *.corp bastion"},
+		{"work.conf", 4, "identityfile", "Match host db"},
+		{"config", 12, "IdentityFile", "Host *"},
+	}
+	if len(refs) != len(want) {
+		t.Fatalf("Expected %d references, got %d", len(want), len(refs))
+	}
+	for i, w := range want {
+		r := refs[i]
+		if filepath.Base(r.File.Path) != w.file || r.Line != w.line || r.Keyword != w.keyword || r.Block != w.block {
+			t.Errorf("Reference %d: expected %+v, got %s %s in %q", i, w, r, r.Keyword, r.Block)
+		}
+	}
+
+	if refs := c.References(filepath.Join(home, ".ssh", "id_default")); len(refs) != 1 || refs[0].Value != "%d/.ssh/id_default" {
+		t.Errorf("Expected the %%d reference, got %v", refs)
+	}
+	if refs := c.References(filepath.Join(home, ".ssh", "id_other")); len(refs) != 0 {
+		t.Errorf("Expected no reference, got %v", refs)
+	}
+}
+
+// TestConfig_Rewrite tests pointing references to a moved key, keeping the formatting of the files
+func TestConfig_Rewrite(t *testing.T) {
+	home := setupTestHome(t)
+
+	c, err := Load(DefaultPath())
+	if err != nil {
+		t.Fatalf("Failed to load SSH config: %v", err)
+	}
+	oldPath := filepath.Join(home, ".ssh", "id_work")
+	newPath := filepath.Join(home, ".ssh", "keys", "id_work 2025")
+	if rewritten := c.Rewrite(oldPath, newPath); len(rewritten) != 5 {
+		t.Fatalf("Expected 5 references rewritten, got %d", len(rewritten))
+	}
+	if err := c.Save(); err != nil {
+		t.Fatalf("Failed to save SSH config: %v", err)
+	}
+
+	config := `# Personal hosts
+Host github.com
+    IdentityFile "~/.ssh/keys/id_work 2025"
+	CertificateFile  "~/.ssh/keys/id_work 2025-cert.pub"
+
+Host *.corp  bastion
+  Include config.d/*.conf
+  User alice
+
+Host *
+    IdentityFile=%d/.ssh/id_default
+    IdentityFile "` + newPath + `"
+`
+	included := "# Work\r\nIdentityFile \"~/.ssh/keys/id_work 2025.pub\"\r\nMatch host db\r\n  identityfile \"~/.ssh/keys/id_work 2025\" # trailing\r\n"
+
+	if data, _ := os.ReadFile(filepath.Join(home, ".ssh", "config")); string(data) != config {
+		t.Errorf("Unexpected config:\n%s\nwant:\n%s", data, config)
+	}
+	path := filepath.Join(home, ".ssh", "config.d", "work.conf")
+	if data, _ := os.ReadFile(path); string(data) != included {
+		t.Errorf("Unexpected included config:\n%q\nwant:\n%q", data, included)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0644 {
+		t.Errorf("Expected the permissions to be kept, got %v", err)
+	}
+
+	// The rewritten config refers to the moved key
+	c, err = Load(DefaultPath())
+	if err != nil {
+		t.Fatalf("Failed to load SSH config: %v", err)
+	}
+	if refs := c.References(newPath); len(refs) != 5 {
+		t.Errorf("Expected 5 references to the moved key, got %d", len(refs))
+	}
+}
+
+// TestConfig_Save_Symlink tests that a symlinked configuration stays a symlink
+func TestConfig_Save_Symlink(t *testing.T) {
+	home := setupTestHome(t)
+
+	// The config lives in a dotfiles repository, linked from ~/.ssh
+	dotfiles := filepath.Join(home, "dotfiles")
+	if err := os.MkdirAll(dotfiles, 0700); err != nil {
+		t.Fatalf("Failed to create dotfiles dir: %v", err)
+	}
+	link := filepath.Join(home, ".ssh", "config")
+	target := filepath.Join(dotfiles, "ssh_config")
+	if err := os.Rename(link, target); err != nil {
+		t.Fatalf("Failed to move SSH config: %v", err)
+	}
+	if err := os.Symlink(filepath.Join("..", "dotfiles", "ssh_config"), link); err != nil {
+		t.Fatalf("Failed to link SSH config: %v", err)
+	}
+
+	c, err := Load(DefaultPath())
+	if err != nil {
+		t.Fatalf("Failed to load SSH config: %v", err)
+	}
+	newPath := filepath.Join(home, ".ssh", "id_moved")
+	if rewritten := c.Rewrite(filepath.Join(home, ".ssh", "id_work"), newPath); len(rewritten) == 0 {
+		t.Fatal("Expected references to be rewritten")
+	}
+	if err := c.Save(); err != nil {
+		t.Fatalf("Failed to save SSH config: %v", err)
+	}
+
+	if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Fatalf("Expected %s to stay a symlink, got %v", link, err)
+	}
+	data, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatalf("Failed to read SSH config: %v", err)
+	}
+	if !strings.Contains(string(data), "IdentityFile ~/.ssh/id_moved") {
+		t.Errorf("Expected the linked file to be rewritten, got:\n%s", data)
+	}
+	if entries, _ := os.ReadDir(dotfiles); len(entries) != 1 {
+		t.Errorf("Expected only the config in %s, got %d entries", dotfiles, len(entries))
+	}
+}
+
+// TestLoad_Missing tests that a missing configuration is empty
+func TestLoad_Missing(t *testing.T) {
+	t.Setenv("HOME", testutil.TempDir(t))
+
+	c, err := Load(DefaultPath())
+	if err != nil {
+		t.Fatalf("Failed to load SSH config: %v", err)
+	}
+	if len(c.Files) != 0 || len(c.Directives) != 0 {
+		t.Errorf("Expected an empty config, got %d files", len(c.Files))
+	}
+}
+
+// TestConfig_Usage tests mapping a key to the hosts it is used for
+func TestConfig_Usage(t *testing.T) {
+	home := testutil.TempDir(t)
+	t.Setenv("HOME", home)
+	if err := os.MkdirAll(filepath.Join(home, ".ssh"), 0700); err != nil {
+		t.Fatalf("Failed to create SSH dir: %v", err)
+	}
+
+	config := `IdentityFile ~/.ssh/id_work
+
+Host bastion jump
+    HostName bastion.corp.example
+    IdentityFile ~/.ssh/id_work
+    CertificateFile ~/.ssh/id_work-cert.pub
+
+Host github.com
+    IdentityFile ~/.ssh/id_personal
+
+Match host *.internal
+    IdentityFile ~/.ssh/id_work
+`
+	if err := os.WriteFile(filepath.Join(home, ".ssh", "config"), []byte(config), 0600); err != nil {
+		t.Fatalf("Failed to write SSH config: %v", err)
+	}
+
+	c, err := Load(DefaultPath())
+	if err != nil {
+		t.Fatalf("Failed to load SSH config: %v", err)
+	}
+
+	usage := c.Usage(filepath.Join(home, ".ssh", "id_work"))
+	var got []string
+	for _, u := range usage {
+		got = append(got, u.String())
+	}
+	want := []string{"all hosts", "bastion jump (bastion.corp.example)", "Match host *.internal"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("Expected usage %q, got %q", want, got)
+	}
+	if len(usage) == 3 && (len(usage[1].Patterns) != 2 || usage[1].Patterns[0] != "bastion") {
+		t.Errorf("Expected the Host patterns, got %v", usage[1].Patterns)
+	}
+}
+
+// TestConfig_Expand tests resolving the tokens ssh expands in key paths, and reporting
+// the paths that depend on the connection
+func TestConfig_Expand(t *testing.T) {
+	home := testutil.TempDir(t)
+	t.Setenv("HOME", home)
+	sshDir := filepath.Join(home, ".ssh")
+	t.Setenv("PORTUNUS_TEST_KEYS", sshDir)
+	if err := os.MkdirAll(sshDir, 0700); err != nil {
+		t.Fatalf("Failed to create SSH dir: %v", err)
+	}
+	current, err := user.Current()
+	if err != nil {
+		t.Fatalf("Failed to get current user: %v", err)
+	}
+
+	config := `Host resolved
+    IdentityFile ${PORTUNUS_TEST_KEYS}/id_env
+    IdentityFile %d/.ssh/%u_key
+    IdentityFile ~` + current.Username + `/.ssh/id_tilde
+    IdentityFile ~/.ssh/id_100%%
+
+Host unresolved
+    IdentityFile ~/.ssh/id_%h
+    IdentityFile id_relative
+    IdentityFile ${PORTUNUS_TEST_UNSET}/id_unset
+    Include %h.conf
+`
+	if err := os.WriteFile(filepath.Join(sshDir, "config"), []byte(config), 0600); err != nil {
+		t.Fatalf("Failed to write SSH config: %v", err)
+	}
+
+	c, err := Load(DefaultPath())
+	if err != nil {
+		t.Fatalf("Failed to load SSH config: %v", err)
+	}
+
+	for _, keyPath := range []string{
+		filepath.Join(sshDir, "id_env"),
+		filepath.Join(sshDir, current.Username+"_key"),
+		filepath.Join(current.HomeDir, ".ssh", "id_tilde"),
+		filepath.Join(sshDir, "id_100%"),
+	} {
+		if refs := c.References(keyPath); len(refs) != 1 {
+			t.Errorf("Expected 1 reference to %s, got %d", keyPath, len(refs))
+		}
+	}
+
+	var unresolved []string
+	for _, d := range c.Unresolved {
+		if d.Err == nil || d.Block != "Host unresolved" {
+			t.Errorf("Expected %s to be reported with its reason, got %v", d, d.Err)
+		}
+		unresolved = append(unresolved, d.Value)
+	}
+	want := []string{"~/.ssh/id_%h", "id_relative", "${PORTUNUS_TEST_UNSET}/id_unset", "%h.conf"}
+	if strings.Join(unresolved, "|") != strings.Join(want, "|") {
+		t.Errorf("Expected unresolved references %q, got %q", want, unresolved)
+	}
+
+	// Rewritten lines keep the variable or home directory they start with
+	c.Rewrite(filepath.Join(sshDir, "id_env"), filepath.Join(sshDir, "keys", "id_env"))
+	c.Rewrite(filepath.Join(current.HomeDir, ".ssh", "id_tilde"), filepath.Join(current.HomeDir, ".ssh", "id_moved"))
+	if err := c.Save(); err != nil {
+		t.Fatalf("Failed to save SSH config: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(sshDir, "config"))
+	if err != nil {
+		t.Fatalf("Failed to read SSH config: %v", err)
+	}
+	for _, line := range []string{"IdentityFile ${PORTUNUS_TEST_KEYS}/keys/id_env\n", "IdentityFile ~" + current.Username + "/.ssh/id_moved\n"} {
+		if !strings.Contains(string(data), line) {
+			t.Errorf("Expected %q in the rewritten config:\n%s", line, data)
+		}
+	}
+}
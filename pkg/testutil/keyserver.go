@@ -0,0 +1,149 @@
+package testutil
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// UploadedKey is a public key held by a KeyServer
+type UploadedKey struct {
+	ID    int64  `json:"id"`
+	Key   string `json:"key"`
+	Title string `json:"title"`
+}
+
+// KeyServer is a stand-in for the user SSH key REST APIs of Git hosting services.
+// It lists keys with GET on Path, paginated by PageParam and "page", adds them with
+// POST on Path and deletes them with DELETE on Path/<id>.
+type KeyServer struct {
+	URL string
+	// Path is where the keys of the user are, e.g. /user/keys
+	Path string
+	// PageParam is the query parameter setting the page size, e.g. per_page
+	PageParam string
+	// Authorized checks the credentials of a request
+	Authorized func(*http.Request) bool
+
+	mu     sync.Mutex
+	keys   []UploadedKey
+	nextID int64
+}
+
+// StartKeyServer starts a key server for the duration of a test
+func StartKeyServer(t *testing.T, path, pageParam string, authorized func(*http.Request) bool) *KeyServer {
+	t.Helper()
+
+	s := &KeyServer{Path: path, PageParam: pageParam, Authorized: authorized, nextID: 1}
+	server := httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(server.Close)
+	s.URL = server.URL
+	return s
+}
+
+// Add stores a key as if it was uploaded by the user, and returns its id
+func (s *KeyServer) Add(key, title string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := s.nextID
+	s.nextID++
+	s.keys = append(s.keys, UploadedKey{ID: id, Key: key, Title: title})
+	return id
+}
+
+// Keys returns the keys the server holds
+func (s *KeyServer) Keys() []UploadedKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]UploadedKey(nil), s.keys...)
+}
+
+// serve handles the requests of the key API
+func (s *KeyServer) serve(w http.ResponseWriter, r *http.Request) {
+	if !s.Authorized(r) {
+		http.Error(w, `{"message":"Bad credentials"}`, http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case r.URL.Path == s.Path && r.Method == http.MethodGet:
+		s.list(w, r)
+	case r.URL.Path == s.Path && r.Method == http.MethodPost:
+		s.create(w, r)
+	case strings.HasPrefix(r.URL.Path, s.Path+"/") && r.Method == http.MethodDelete:
+		s.delete(w, r)
+	default:
+		http.Error(w, `{"message":"Not Found"}`, http.StatusNotFound)
+	}
+}
+
+// list writes a page of keys
+func (s *KeyServer) list(w http.ResponseWriter, r *http.Request) {
+	size, err := strconv.Atoi(r.URL.Query().Get(s.PageParam))
+	if err != nil || size <= 0 {
+		size = 30
+	}
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page <= 0 {
+		page = 1
+	}
+
+	s.mu.Lock()
+	keys := []UploadedKey{}
+	for i := (page - 1) * size; i < len(s.keys) && i < page*size; i++ {
+		keys = append(keys, s.keys[i])
+	}
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(keys)
+}
+
+// create adds a key, rejecting keys the user already has like the real services do
+func (s *KeyServer) create(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Title string `json:"title"`
+		Key   string `json:"key"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Key == "" {
+		http.Error(w, `{"message":"Validation Failed"}`, http.StatusUnprocessableEntity)
+		return
+	}
+
+	for _, k := range s.Keys() {
+		if k.Key == body.Key {
+			http.Error(w, `{"message":"key is already in use"}`, http.StatusUnprocessableEntity)
+			return
+		}
+	}
+	id := s.Add(body.Key, body.Title)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(UploadedKey{ID: id, Key: body.Key, Title: body.Title})
+}
+
+// delete removes a key by id
+func (s *KeyServer) delete(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, s.Path+"/"), 10, 64)
+	if err != nil {
+		http.Error(w, `{"message":"Not Found"}`, http.StatusNotFound)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, k := range s.keys {
+		if k.ID == id {
+			s.keys = append(s.keys[:i], s.keys[i+1:]...)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+	http.Error(w, `{"message":"Not Found"}`, http.StatusNotFound)
+}
@@ -0,0 +1,166 @@
+package testutil
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SSHServer is an in-process SSH server for testing. Like sshd, it authorizes the
+// public keys listed in the .ssh/authorized_keys file of its home directory, and
+// runs exec requests with sh in that directory.
+type SSHServer struct {
+	Addr    string
+	Home    string
+	HostKey ssh.PublicKey
+
+	mu     sync.Mutex
+	logins []string
+}
+
+// StartSSHServer starts an SSH server on localhost for the duration of a test
+func StartSSHServer(t *testing.T) *SSHServer {
+	t.Helper()
+
+	_, hostPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate host key: %v", err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostPrivateKey)
+	if err != nil {
+		t.Fatalf("Failed to create host key signer: %v", err)
+	}
+
+	home := TempDir(t)
+	if err := os.MkdirAll(filepath.Join(home, ".ssh"), 0700); err != nil {
+		t.Fatalf("Failed to create server SSH dir: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	s := &SSHServer{Addr: listener.Addr().String(), Home: home, HostKey: hostSigner.PublicKey()}
+
+	config := &ssh.ServerConfig{PublicKeyCallback: s.authorize}
+	config.AddHostKey(hostSigner)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn, config)
+		}
+	}()
+
+	return s
+}
+
+// KnownHostsLine returns the known_hosts line of the server
+func (s *SSHServer) KnownHostsLine() string {
+	return knownhosts.Line([]string{s.Addr}, s.HostKey) + "\n"
+}
+
+// AuthorizedKeysPath returns the path of the authorized_keys file of the server
+func (s *SSHServer) AuthorizedKeysPath() string {
+	return filepath.Join(s.Home, ".ssh", "authorized_keys")
+}
+
+// Logins returns the SHA256 fingerprints of the keys that logged in, in order
+func (s *SSHServer) Logins() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.logins...)
+}
+
+// authorize accepts the keys listed in the authorized_keys file
+func (s *SSHServer) authorize(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+	data, _ := os.ReadFile(s.AuthorizedKeysPath())
+	for len(data) > 0 {
+		authorized, _, _, rest, err := ssh.ParseAuthorizedKey(data)
+		if err != nil {
+			break
+		}
+		if bytes.Equal(authorized.Marshal(), key.Marshal()) {
+			s.mu.Lock()
+			s.logins = append(s.logins, ssh.FingerprintSHA256(key))
+			s.mu.Unlock()
+			return &ssh.Permissions{}, nil
+		}
+		data = rest
+	}
+	return nil, errors.New("public key not authorized")
+}
+
+// serve handles the sessions of a connection
+func (s *SSHServer) serve(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "only sessions are supported")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go s.session(channel, requests)
+	}
+}
+
+// session runs the command of an exec request with sh
+func (s *SSHServer) session(channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer channel.Close()
+
+	for req := range requests {
+		if req.Type != "exec" {
+			req.Reply(false, nil)
+			continue
+		}
+
+		var payload struct{ Command string }
+		if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+			req.Reply(false, nil)
+			continue
+		}
+		req.Reply(true, nil)
+
+		cmd := exec.Command("sh", "-c", payload.Command)
+		cmd.Dir = s.Home
+		cmd.Env = append(os.Environ(), "HOME="+s.Home)
+		cmd.Stdin = channel
+		cmd.Stdout = channel
+		cmd.Stderr = channel.Stderr()
+
+		var status struct{ Status uint32 }
+		if err := cmd.Run(); err != nil {
+			status.Status = 1
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				status.Status = uint32(exitErr.ExitCode())
+			}
+		}
+		channel.SendRequest("exit-status", false, ssh.Marshal(&status))
+		return
+	}
+}